@@ -7,7 +7,7 @@
 
   Vue.component('message', {
     // 1-1. ユーザー名を表示しよう
-    props: ['id', 'body', 'username', 'removeMessage', 'updateMessage'],
+    props: ['id', 'body', 'username', 'version', 'removeMessage', 'updateMessage'],
     data() {
       return {
         editing: false,
@@ -25,7 +25,7 @@
         </div>
       </div>
       <div class="message-body" v-else>
-        <span>{{ body }} - {{ username }}</span>
+        <span class="message-text">{{ body }}</span> - <span>{{ username }}</span>
         <span class="action-button u-pull-right" v-on:click="edit">&#9998;</span>
         <span class="action-button u-pull-right" v-on:click="remove">&#10007;</span>
       </div>
@@ -33,7 +33,7 @@
   `,
     methods: {
       remove() {
-        this.removeMessage(this.id)
+        this.removeMessage(this.id, this.version)
       },
       edit() {
         this.editing = true
@@ -44,7 +44,7 @@
         this.editedBody = null
       },
       doneEdit() {
-        this.updateMessage({id: this.id, body: this.editedBody})
+        this.updateMessage({id: this.id, body: this.editedBody, version: this.version})
           .then(response => {
             this.cancelEdit()
           })
@@ -86,11 +86,12 @@
             console.log(error);
           });
       },
-      removeMessage(id) {
+      removeMessage(id, version) {
         return fetch(`/api/messages/${id}`, {
-          method: 'DELETE'
+          method: 'DELETE',
+          headers: {'If-Match': `"${version}"`}
         })
-        .then(response => response.json())
+        .then(response => this.checkConflict(response))
         .then(response => {
           if (response.error) {
             alert(response.error.message);
@@ -104,9 +105,10 @@
       updateMessage(updatedMessage) {
         return fetch(`/api/messages/${updatedMessage.id}`, {
           method: 'PUT',
-          body: JSON.stringify(updatedMessage),
+          headers: {'If-Match': `"${updatedMessage.version}"`},
+          body: JSON.stringify({body: updatedMessage.body}),
         })
-        .then(response => response.json())
+        .then(response => this.checkConflict(response))
         .then(response => {
             if (response.error) {
               alert(response.error.message);
@@ -118,6 +120,13 @@
             Vue.set(this.messages, index, response.result)
         })
       },
+      // 他の人が先に編集、削除していた場合は412が返るので、最新のメッセージを読み込み直します
+      checkConflict(response) {
+        if (response.status === 412) {
+          this.getMessages();
+        }
+        return response.json();
+      },
       clearMessage() {
         this.newMessage = new Message();
       }
@@ -2,7 +2,10 @@ package bot
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
 )
@@ -11,20 +14,35 @@ type (
 	// Bot はinで受け取ったmessageがcheckerの条件を満たした場合、processorが投稿用messageを作り、outに渡します
 	//
 	//   fields
-	//     name      string
-	//     in        chan *model.Message
-	//     out       chan *model.Message
-	//     checker   Checker
-	//     processor Processor
+	//     name          string
+	//     in            chan *model.Message
+	//     out           chan *model.Message
+	//     checker       Checker
+	//     processor     Processor
+	//     conversations *ConversationStore
 	Bot struct {
-		name      string
-		in        chan *model.Message
-		out       chan *model.Message
-		checker   Checker
-		processor Processor
+		name          string
+		in            chan *model.Message
+		out           chan *model.Message
+		checker       Checker
+		processor     Processor
+		conversations *ConversationStore
+	}
+
+	// ReplyError はユーザーに伝えるべきエラーのインターフェースです
+	//
+	// processorがこのエラーを返した場合、Bot.Runは"気が乗らないパカ"の代わりにReplyMessageを返信します
+	ReplyError interface {
+		error
+		ReplyMessage() string
 	}
 )
 
+// Name はbotの名前を返します
+func (b *Bot) Name() string {
+	return b.name
+}
+
 // Run はBotを起動します
 func (b *Bot) Run(ctx context.Context) {
 	// メッセージ監視
@@ -34,22 +52,63 @@ func (b *Bot) Run(ctx context.Context) {
 			close(b.in)
 			return
 		case m := <-b.in:
-			if b.checker.Check(m) {
-				nm, err := b.processor.Process(m)
+			conv, err := b.conversation(m)
+			if err != nil {
+				log.Printf("%s: %#v\n", b.name, err)
+				break
+			}
+			// 返事を待っている会話があればcheckerを満たさなくてもprocessorに渡します
+			if groups, ok := match(b.checker, m); ok || conv.Awaiting() {
+				nm, err := b.process(m, groups, conv)
 				if err != nil {
 					log.Printf("%s: %#v\n", b.name, err)
+					body := "気が乗らないパカ"
+					if re, ok := err.(ReplyError); ok {
+						body = re.ReplyMessage()
+					}
 					b.out <- &model.Message{
-						Body: "気が乗らないパカ",
+						Body:     body,
+						UserName: "bot",
 					}
 					// selectから抜ける
 					break
 				}
-				b.out <- nm
+				// processorがnilを返した場合は何も投稿しません
+				if nm != nil {
+					b.out <- nm
+				}
 			}
 		}
 	}
 }
 
+// conversation はprocessorがConversationProcessorの場合、messageを送ったユーザーとの会話を返します
+//
+// そうでない場合はnilを返します
+func (b *Bot) conversation(m *model.Message) (*Conversation, error) {
+	if _, ok := b.processor.(ConversationProcessor); !ok || b.conversations == nil {
+		return nil, nil
+	}
+	return b.conversations.Load(b.name, m.UserName)
+}
+
+// process はmessageを処理します
+//
+// 会話があればConversationProcessorに渡して会話を保存し、processorがMatchProcessorならcheckerのキャプチャも渡します
+func (b *Bot) process(m *model.Message, groups []string, conv *Conversation) (*model.Message, error) {
+	if conv != nil {
+		nm, err := b.processor.(ConversationProcessor).Converse(m, conv)
+		if err != nil {
+			return nil, err
+		}
+		return nm, b.conversations.Save(b.name, m.UserName, conv)
+	}
+	if mp, ok := b.processor.(MatchProcessor); ok && groups != nil {
+		return mp.ProcessMatch(m, groups)
+	}
+	return b.processor.Process(m)
+}
+
 // NewHelloWorldBot は"hello"を受け取ると"hello, world!"を返す新しいBotの構造体のポインタを返します
 func NewHelloWorldBot(out chan *model.Message) *Bot {
 	in := make(chan *model.Message)
@@ -67,13 +126,19 @@ func NewHelloWorldBot(out chan *model.Message) *Bot {
 	}
 }
 
-// NewOmikujiBot は"大吉", "吉", "中吉", "小吉", "末吉", "凶"のいずれかをランダムで返す新しいBotの構造体のポインタを返します
-func NewOmikujiBot(out chan *model.Message) *Bot {
+// NewOmikujiBot はtableからユーザーと日付で決まるおみくじの結果を返す新しいBotの構造体のポインタを返します
+//
+// "omikuji history"でこれまでの記録を返します
+func NewOmikujiBot(out chan *model.Message, db *sql.DB, table *OmikujiTable) *Bot {
 	in := make(chan *model.Message)
 
-	checker := NewRegexpChecker("\\Aomikuji\\z")
+	checker := NewRegexpChecker("\\Aomikuji( history)?\\z")
 
-	processor := &OmikujiProcessor{}
+	processor := &OmikujiProcessor{
+		db:    db,
+		table: table,
+		now:   time.Now,
+	}
 
 	return &Bot{
 		name:      "omikujibot",
@@ -85,12 +150,14 @@ func NewOmikujiBot(out chan *model.Message) *Bot {
 }
 
 // NewKeywordBot はメッセージ本文からキーワードを抽出して返す新しいBotの構造体のポインタを返します
-func NewKeywordBot(out chan *model.Message) *Bot {
+//
+// appIDはYahoo!デベロッパーネットワーク（https://developer.yahoo.co.jp/）のアプリケーションIDです
+func NewKeywordBot(out chan *model.Message, appID string) *Bot {
 	in := make(chan *model.Message)
 
-	checker := NewRegexpChecker("\\Akeyword .*")
+	checker := &RegexpChecker{regexp: keywordPattern}
 
-	processor := &KeywordProcessor{}
+	processor := &KeywordProcessor{appID: appID}
 
 	return &Bot{
 		name:      "keywordbot",
@@ -117,10 +184,12 @@ func NewGachaBot(out chan *model.Message) *Bot {
 }
 
 // NewTalkBot m2-2でつくるやつです
-func NewTalkBot(out chan *model.Message) *Bot {
+//
+// apiKeyはA3RTのTalk API（https://a3rt.recruit-tech.co.jp/product/talkAPI/）のAPIキーです
+func NewTalkBot(out chan *model.Message, apiKey string) *Bot {
 	in := make(chan *model.Message)
-	checker := NewRegexpChecker("\\Atalk .*")
-	processor := &TalkProcessor{}
+	checker := &RegexpChecker{regexp: talkPattern}
+	processor := &TalkProcessor{apiKey: apiKey}
 
 	return &Bot{
 		name:      "talkbot",
@@ -130,3 +199,245 @@ func NewTalkBot(out chan *model.Message) *Bot {
 		processor: processor,
 	}
 }
+
+// NewCommandBot は"/"で始まるメッセージをrouterに登録されたコマンドとして実行する新しいBotの構造体のポインタを返します
+func NewCommandBot(out chan *model.Message, router *CommandRouter) *Bot {
+	in := make(chan *model.Message)
+
+	return &Bot{
+		name:      "commandbot",
+		in:        in,
+		out:       out,
+		checker:   router,
+		processor: router,
+	}
+}
+
+// NewReminderBot は"remind me in 30m to deploy"のようなメッセージからリマインダーを作る新しいBotの構造体のポインタを返します
+//
+// 時刻はlocで解釈します。リマインダーを知らせるのはNewReminderDispatchBotです
+func NewReminderBot(out chan *model.Message, db *sql.DB, loc *time.Location) *Bot {
+	in := make(chan *model.Message)
+
+	checker := &RegexpChecker{regexp: remindPattern}
+
+	processor := &ReminderProcessor{
+		db:  db,
+		loc: loc,
+		now: time.Now,
+	}
+
+	return &Bot{
+		name:      "reminderbot",
+		in:        in,
+		out:       out,
+		checker:   checker,
+		processor: processor,
+	}
+}
+
+// NewPollBot は"poll "Lunch?" ramen sushi curry"で投票を作り、"vote <id> <option>"で投票を受け付ける新しいBotの構造体のポインタを返します
+//
+// 投票のメッセージはmessagesに保存してstreamに流し、投票のたびに集計結果に書き換えられます。締め切るのはNewPollCloseBotです
+func NewPollBot(out chan *model.Message, db *sql.DB, loc *time.Location, messages model.MessageStore, stream chan *model.Message) *Bot {
+	in := make(chan *model.Message)
+
+	router := NewBareCommandRouter(
+		newPollCommand(db, loc, time.Now, publisher(messages, stream)),
+		newVoteCommand(db, loc, time.Now),
+	)
+
+	checker := And(&RegexpChecker{regexp: pollCommandPattern}, router)
+
+	return &Bot{
+		name:      "pollbot",
+		in:        in,
+		out:       out,
+		checker:   checker,
+		processor: router,
+	}
+}
+
+// NewQuizBot は"quiz"でクイズを出し、同じユーザーの次のメッセージを答えとして受け取る新しいBotの構造体のポインタを返します
+//
+// 答えを待っている間の会話はdbに保存されます
+func NewQuizBot(out chan *model.Message, db *sql.DB) *Bot {
+	in := make(chan *model.Message)
+
+	checker := NewRegexpChecker("\\Aquiz\\z")
+
+	processor := NewQuizProcessor(DefaultQuizQuestions)
+
+	return &Bot{
+		name:          "quizbot",
+		in:            in,
+		out:           out,
+		checker:       checker,
+		processor:     processor,
+		conversations: NewConversationStore(db),
+	}
+}
+
+// NewKarmaBot は"alice++ for fixing CI"や"bob--"でkarmaを記録し、"karma top", "karma alice"でスコアを返す新しいBotの構造体のポインタを返します
+//
+// 同じユーザーが同じ相手に投票できるのは1時間に1回です。"@"のない名前への投票はメッセージを投稿したことのあるユーザーだけが対象です
+func NewKarmaBot(out chan *model.Message, db *sql.DB) *Bot {
+	in := make(chan *model.Message)
+
+	checker := &RegexpChecker{regexp: karmaPattern}
+
+	processor := &KarmaProcessor{
+		db:  db,
+		now: time.Now,
+	}
+
+	return &Bot{
+		name:      "karmabot",
+		in:        in,
+		out:       out,
+		checker:   checker,
+		processor: processor,
+	}
+}
+
+// NewDiceBot は"roll 3d6+2", "roll 4d6kh3"でダイスを振り、"calc (1+2)*3/4"で計算する新しいBotの構造体のポインタを返します
+func NewDiceBot(out chan *model.Message) *Bot {
+	in := make(chan *model.Message)
+
+	checker := &RegexpChecker{regexp: dicePattern}
+
+	processor := NewDiceProcessor()
+
+	return &Bot{
+		name:      "dicebot",
+		in:        in,
+		out:       out,
+		checker:   checker,
+		processor: processor,
+	}
+}
+
+// NewWebhookBot は人が投稿したメッセージをdispatcherに渡し、登録されたwebhookに送る新しいBotの構造体のポインタを返します
+//
+// webhookからの返信でwebhookが呼ばれ続けないように、botやwebhookが投稿したメッセージは送りません
+func NewWebhookBot(out chan *model.Message, dispatcher *WebhookDispatcher) *Bot {
+	in := make(chan *model.Message)
+
+	checker := NewHumanChecker()
+
+	return &Bot{
+		name:      "webhookbot",
+		in:        in,
+		out:       out,
+		checker:   checker,
+		processor: dispatcher,
+	}
+}
+
+// NewStandupBot は平日の10時に朝会の時間を知らせる新しいScheduledBotの構造体のポインタを返します
+func NewStandupBot(loc *time.Location) *ScheduledBot {
+	schedule := MustParseSchedule("0 10 * * mon-fri")
+	job := JobFunc(func(t time.Time) ([]*model.Message, error) {
+		return []*model.Message{{
+			Body:     "朝会の時間パカ",
+			UserName: "bot",
+		}}, nil
+	})
+
+	return NewScheduledBot("standupbot", schedule, loc, SkipMissed, job)
+}
+
+// NewDailyOmikujiBot は毎朝9時にみんなの今日の運勢を投稿する新しいScheduledBotの構造体のポインタを返します
+//
+// サーバーが止まっていた場合、起動時にその日の分を1回だけ投稿します
+func NewDailyOmikujiBot(table *OmikujiTable, loc *time.Location) *ScheduledBot {
+	schedule := MustParseSchedule("0 9 * * *")
+	job := JobFunc(func(t time.Time) ([]*model.Message, error) {
+		return []*model.Message{{
+			Body:     fmt.Sprintf("今日のみんなの運勢は%s", table.Draw("みんな", t)),
+			UserName: "bot",
+		}}, nil
+	})
+
+	return NewScheduledBot("dailyomikujibot", schedule, loc, RunOnceMissed, job)
+}
+
+// NewReminderDispatchBot は毎分、時刻になったリマインダーを知らせる新しいScheduledBotの構造体のポインタを返します
+//
+// サーバーが止まっていた間のリマインダーは起動後最初の回にまとめて知らせます
+func NewReminderDispatchBot(db *sql.DB) *ScheduledBot {
+	schedule := MustParseSchedule("* * * * *")
+	job := JobFunc(func(t time.Time) ([]*model.Message, error) {
+		rs, err := model.RemindersDue(db, t)
+		if err != nil {
+			return nil, err
+		}
+
+		var msgs []*model.Message
+		for _, r := range rs {
+			body := fmt.Sprintf("@%s リマインダー: %s", r.Target, r.Body)
+			if r.UserName != r.Target {
+				body += fmt.Sprintf(" (%sさんから)", r.UserName)
+			}
+			if err := r.MarkFired(db); err != nil {
+				return msgs, err
+			}
+			msgs = append(msgs, &model.Message{
+				Body:     body,
+				UserName: "bot",
+			})
+		}
+		return msgs, nil
+	})
+
+	return NewScheduledBot("reminderdispatchbot", schedule, nil, SkipMissed, job)
+}
+
+// NewKVExpireBot は毎時、期限が切れたキーバリューストアの値を削除する新しいScheduledBotの構造体のポインタを返します
+//
+// 期限が切れた値は削除されるまでも読めないので、これは容量を減らすためだけのものです
+func NewKVExpireBot(db *sql.DB) *ScheduledBot {
+	schedule := MustParseSchedule("0 * * * *")
+	job := JobFunc(func(t time.Time) ([]*model.Message, error) {
+		_, err := model.KVDeleteExpired(db, t)
+		return nil, err
+	})
+
+	return NewScheduledBot("kvexpirebot", schedule, nil, SkipMissed, job)
+}
+
+// NewConversationExpireBot は毎時、期限が切れた会話を削除する新しいScheduledBotの構造体のポインタを返します
+//
+// 期限が切れた会話は読み込まれないので、これは容量を減らすためだけのものです
+func NewConversationExpireBot(db *sql.DB) *ScheduledBot {
+	schedule := MustParseSchedule("30 * * * *")
+	job := JobFunc(func(t time.Time) ([]*model.Message, error) {
+		_, err := model.ConversationsDeleteExpired(db, t)
+		return nil, err
+	})
+
+	return NewScheduledBot("conversationexpirebot", schedule, nil, SkipMissed, job)
+}
+
+// NewPollCloseBot は毎分、締め切りを過ぎた投票を締め切って結果を知らせる新しいScheduledBotの構造体のポインタを返します
+func NewPollCloseBot(db *sql.DB, loc *time.Location) *ScheduledBot {
+	schedule := MustParseSchedule("* * * * *")
+	job := JobFunc(func(t time.Time) ([]*model.Message, error) {
+		ids, err := model.PollsExpired(db, t)
+		if err != nil {
+			return nil, err
+		}
+
+		var msgs []*model.Message
+		for _, id := range ids {
+			m, err := closePoll(db, id, loc)
+			if err != nil {
+				return msgs, err
+			}
+			msgs = append(msgs, m)
+		}
+		return msgs, nil
+	})
+
+	return NewScheduledBot("pollclosebot", schedule, loc, SkipMissed, job)
+}
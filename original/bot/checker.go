@@ -1,7 +1,11 @@
 package bot
 
 import (
+	"fmt"
+	"math/rand"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
 )
@@ -12,17 +16,96 @@ type (
 		Check(*model.Message) bool
 	}
 
+	// Matcher は条件を満たすかに加えて、正規表現のキャプチャなどの付随する文字列も返すCheckerです
+	//
+	// 返す文字列はregexp.FindStringSubmatchにならい、0番目がマッチした全体です
+	Matcher interface {
+		Checker
+		Match(*model.Message) ([]string, bool)
+	}
+
 	// RegexpChecker は 正規表現を満たす場合true、そうでない場合falseを返す構造体です
 	RegexpChecker struct {
 		regexp *regexp.Regexp
 	}
+
+	// PrefixChecker はbodyが接頭辞で始まる場合trueを返す構造体です
+	PrefixChecker struct {
+		prefix string
+	}
+
+	// MentionChecker はbodyに"@name"が含まれる場合trueを返す構造体です
+	MentionChecker struct {
+		mention *regexp.Regexp
+	}
+
+	// UserChecker はusernameが許可リストに含まれる、または拒否リストに含まれない場合trueを返す構造体です
+	UserChecker struct {
+		names map[string]bool
+		allow bool
+	}
+
+	// HumanChecker はbotやwebhookではなく、人が投稿したメッセージの場合trueを返す構造体です
+	//
+	// ユーザー名ではなくmodel.Message.Originで判定するので、名前を変えたwebhookも通しません
+	HumanChecker struct{}
+
+	// ChannelChecker はchannelがいずれかに一致する場合trueを返す構造体です
+	ChannelChecker struct {
+		channels map[string]bool
+	}
+
+	// TimeWindowChecker は現在時刻が1日のうちの指定された時間帯に入っている場合trueを返す構造体です
+	//
+	// startよりendが前の場合は日付をまたぐ時間帯として扱います
+	TimeWindowChecker struct {
+		start time.Duration
+		end   time.Duration
+		loc   *time.Location
+		now   func() time.Time
+	}
+
+	// ProbabilityChecker は確率pでtrueを返す構造体です
+	ProbabilityChecker struct {
+		p     float64
+		float func() float64
+	}
+
+	// AndChecker は全てのCheckerを満たす場合trueを返す構造体です
+	AndChecker struct {
+		checkers []Checker
+	}
+
+	// OrChecker はいずれかのCheckerを満たす場合trueを返す構造体です
+	OrChecker struct {
+		checkers []Checker
+	}
+
+	// NotChecker はCheckerを満たさない場合trueを返す構造体です
+	NotChecker struct {
+		checker Checker
+	}
 )
 
+// match はcがMatcherならキャプチャも含めて、そうでなければCheckだけで判定します
+func match(c Checker, m *model.Message) ([]string, bool) {
+	if mc, ok := c.(Matcher); ok {
+		return mc.Match(m)
+	}
+	return nil, c.Check(m)
+}
+
 // Check は正規表現を満たす場合true、そうでない場合falseを返します
 func (c *RegexpChecker) Check(m *model.Message) bool {
 	return c.regexp.MatchString(m.Body)
 }
 
+// Match は正規表現を満たす場合、キャプチャした文字列を返します
+func (c *RegexpChecker) Match(m *model.Message) ([]string, bool) {
+	groups := c.regexp.FindStringSubmatch(m.Body)
+	return groups, groups != nil
+}
+
 // NewRegexpChecker は新しいRegexpChecker構造体のポインタを返します
 func NewRegexpChecker(pattern string) *RegexpChecker {
 	r := regexp.MustCompile(pattern)
@@ -30,3 +113,215 @@ func NewRegexpChecker(pattern string) *RegexpChecker {
 		regexp: r,
 	}
 }
+
+// Check はbodyが接頭辞で始まる場合true、そうでない場合falseを返します
+func (c *PrefixChecker) Check(m *model.Message) bool {
+	return strings.HasPrefix(m.Body, c.prefix)
+}
+
+// Match はbodyが接頭辞で始まる場合、bodyと接頭辞を除いた残りを返します
+func (c *PrefixChecker) Match(m *model.Message) ([]string, bool) {
+	if !c.Check(m) {
+		return nil, false
+	}
+	return []string{m.Body, strings.TrimSpace(strings.TrimPrefix(m.Body, c.prefix))}, true
+}
+
+// NewPrefixChecker は新しいPrefixChecker構造体のポインタを返します
+func NewPrefixChecker(prefix string) *PrefixChecker {
+	return &PrefixChecker{
+		prefix: prefix,
+	}
+}
+
+// Check はbodyに"@name"が含まれる場合true、そうでない場合falseを返します
+func (c *MentionChecker) Check(m *model.Message) bool {
+	return c.mention.MatchString(m.Body)
+}
+
+// Match はbodyに"@name"が含まれる場合、bodyと"@name"を除いた残りを返します
+func (c *MentionChecker) Match(m *model.Message) ([]string, bool) {
+	if !c.Check(m) {
+		return nil, false
+	}
+	rest := strings.Join(strings.Fields(c.mention.ReplaceAllString(m.Body, " ")), " ")
+	return []string{m.Body, rest}, true
+}
+
+// NewMentionChecker は新しいMentionChecker構造体のポインタを返します
+func NewMentionChecker(name string) *MentionChecker {
+	return &MentionChecker{
+		mention: regexp.MustCompile(`(?:\A|\s)@` + regexp.QuoteMeta(name) + `(?:\z|[\s:,、])`),
+	}
+}
+
+// Check はusernameが許可リストに含まれる、または拒否リストに含まれない場合trueを返します
+func (c *UserChecker) Check(m *model.Message) bool {
+	return c.names[m.UserName] == c.allow
+}
+
+// NewUserAllowChecker はnamesのユーザーのメッセージだけ通す新しいUserChecker構造体のポインタを返します
+func NewUserAllowChecker(names ...string) *UserChecker {
+	return &UserChecker{
+		names: stringSet(names),
+		allow: true,
+	}
+}
+
+// NewUserDenyChecker はnamesのユーザーのメッセージを通さない新しいUserChecker構造体のポインタを返します
+func NewUserDenyChecker(names ...string) *UserChecker {
+	return &UserChecker{
+		names: stringSet(names),
+		allow: false,
+	}
+}
+
+// Check はOriginが空の場合true、そうでない場合falseを返します
+func (c *HumanChecker) Check(m *model.Message) bool {
+	return m.Origin == ""
+}
+
+// NewHumanChecker は人が投稿したメッセージだけ通す新しいHumanChecker構造体のポインタを返します
+func NewHumanChecker() *HumanChecker {
+	return &HumanChecker{}
+}
+
+// Check はchannelがいずれかに一致する場合true、そうでない場合falseを返します
+func (c *ChannelChecker) Check(m *model.Message) bool {
+	return c.channels[m.Channel]
+}
+
+// NewChannelChecker は新しいChannelChecker構造体のポインタを返します
+func NewChannelChecker(channels ...string) *ChannelChecker {
+	return &ChannelChecker{
+		channels: stringSet(channels),
+	}
+}
+
+// Check は現在時刻が時間帯に入っている場合true、そうでない場合falseを返します
+func (c *TimeWindowChecker) Check(m *model.Message) bool {
+	now := c.now().In(c.loc)
+	t := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+	if c.start <= c.end {
+		return c.start <= t && t < c.end
+	}
+	return c.start <= t || t < c.end
+}
+
+// NewTimeWindowChecker は"09:00"のような形式のstartからendまでの時間帯の新しいTimeWindowChecker構造体のポインタを返します
+//
+// locがnilの場合はtime.Localを使います
+func NewTimeWindowChecker(start, end string, loc *time.Location) (*TimeWindowChecker, error) {
+	s, err := parseClock(start)
+	if err != nil {
+		return nil, err
+	}
+	e, err := parseClock(end)
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	return &TimeWindowChecker{
+		start: s,
+		end:   e,
+		loc:   loc,
+		now:   time.Now,
+	}, nil
+}
+
+// parseClock は"15:04"形式の時刻を0時からの経過時間にします
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected like 09:00", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Check は確率pでtrueを返します
+func (c *ProbabilityChecker) Check(m *model.Message) bool {
+	return c.float() < c.p
+}
+
+// NewProbabilityChecker は0から1の確率pでtrueを返す新しいProbabilityChecker構造体のポインタを返します
+func NewProbabilityChecker(p float64) *ProbabilityChecker {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &ProbabilityChecker{
+		p:     p,
+		float: r.Float64,
+	}
+}
+
+// Check は全てのCheckerを満たす場合trueを返します
+func (c *AndChecker) Check(m *model.Message) bool {
+	_, ok := c.Match(m)
+	return ok
+}
+
+// Match は全てのCheckerを満たす場合、最初にキャプチャを返したCheckerのキャプチャを返します
+func (c *AndChecker) Match(m *model.Message) ([]string, bool) {
+	var groups []string
+	for _, checker := range c.checkers {
+		g, ok := match(checker, m)
+		if !ok {
+			return nil, false
+		}
+		if groups == nil {
+			groups = g
+		}
+	}
+	return groups, true
+}
+
+// And は全てのcheckersを満たす場合trueを返すCheckerを返します
+func And(checkers ...Checker) *AndChecker {
+	return &AndChecker{
+		checkers: checkers,
+	}
+}
+
+// Check はいずれかのCheckerを満たす場合trueを返します
+func (c *OrChecker) Check(m *model.Message) bool {
+	_, ok := c.Match(m)
+	return ok
+}
+
+// Match は最初に満たしたCheckerのキャプチャを返します
+func (c *OrChecker) Match(m *model.Message) ([]string, bool) {
+	for _, checker := range c.checkers {
+		if groups, ok := match(checker, m); ok {
+			return groups, true
+		}
+	}
+	return nil, false
+}
+
+// Or はいずれかのcheckersを満たす場合trueを返すCheckerを返します
+func Or(checkers ...Checker) *OrChecker {
+	return &OrChecker{
+		checkers: checkers,
+	}
+}
+
+// Check はCheckerを満たさない場合trueを返します
+func (c *NotChecker) Check(m *model.Message) bool {
+	return !c.checker.Check(m)
+}
+
+// Not はcheckerを満たさない場合trueを返すCheckerを返します
+func Not(checker Checker) *NotChecker {
+	return &NotChecker{
+		checker: checker,
+	}
+}
+
+// stringSet はssを要素にもつ集合を返します
+func stringSet(ss []string) map[string]bool {
+	set := map[string]bool{}
+	for _, s := range ss {
+		set[s] = true
+	}
+	return set
+}
@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+func TestCheckerを組み合わせられる(t *testing.T) {
+	c := And(
+		Or(NewPrefixChecker("deploy"), NewMentionChecker("deploybot")),
+		NewUserDenyChecker("mallory"),
+		NewHumanChecker(),
+		NewChannelChecker("ops"),
+		Not(NewRegexpChecker("dry-run")),
+	)
+
+	cases := []struct {
+		message  *model.Message
+		expected bool
+	}{
+		{&model.Message{Body: "deploy api", UserName: "alice", Channel: "ops"}, true},
+		{&model.Message{Body: "@deploybot: api please", UserName: "alice", Channel: "ops"}, true},
+		{&model.Message{Body: "deploy api", UserName: "mallory", Channel: "ops"}, false},
+		{&model.Message{Body: "deploy api", UserName: "alice", Channel: "random"}, false},
+		{&model.Message{Body: "hello @deploybotx", UserName: "alice", Channel: "ops"}, false},
+		{&model.Message{Body: "deploy api dry-run", UserName: "alice", Channel: "ops"}, false},
+		{&model.Message{Body: "deploy api", UserName: "ci", Channel: "ops", Origin: model.OriginWebhook}, false},
+		{&model.Message{Body: "deploy api", UserName: "alice", Channel: "ops", Origin: model.OriginBot}, false},
+	}
+	for _, tc := range cases {
+		if actual := c.Check(tc.message); actual != tc.expected {
+			t.Fatalf("%#v: check expected %v but not", tc.message, tc.expected)
+		}
+	}
+}
+
+func TestCheckerがキャプチャを返す(t *testing.T) {
+	cases := []struct {
+		checker  Checker
+		body     string
+		expected []string
+	}{
+		{NewRegexpChecker(`\Aremind (\S+) (.*)\z`), "remind me deploy", []string{"remind me deploy", "me", "deploy"}},
+		{NewPrefixChecker("karma"), "karma top", []string{"karma top", "top"}},
+		{NewMentionChecker("bot"), "@bot hello  there", []string{"@bot hello  there", "hello there"}},
+		{And(NewUserAllowChecker("alice"), NewPrefixChecker("karma")), "karma top", []string{"karma top", "top"}},
+		{Or(NewRegexpChecker(`\Ano\z`), NewPrefixChecker("karma")), "karma top", []string{"karma top", "top"}},
+	}
+	for _, tc := range cases {
+		groups, ok := match(tc.checker, &model.Message{Body: tc.body, UserName: "alice"})
+		if !ok {
+			t.Fatalf("%s: match expected true but false", tc.body)
+		}
+		if !reflect.DeepEqual(groups, tc.expected) {
+			t.Fatalf("%s: groups expected %q but not, actual %q", tc.body, tc.expected, groups)
+		}
+	}
+}
+
+func TestTimeWindowCheckerは日付をまたぐ時間帯を扱える(t *testing.T) {
+	c, err := NewTimeWindowChecker("22:00", "06:00", time.UTC)
+	if err != nil {
+		t.Fatalf("failed to create checker: %s", err)
+	}
+
+	cases := map[string]bool{
+		"21:59": false,
+		"22:00": true,
+		"03:00": true,
+		"05:59": true,
+		"06:00": false,
+		"12:00": false,
+	}
+	for clock, expected := range cases {
+		now, _ := time.Parse("15:04", clock)
+		c.now = func() time.Time { return now }
+		if actual := c.Check(&model.Message{}); actual != expected {
+			t.Fatalf("%s: check expected %v but not", clock, expected)
+		}
+	}
+
+	if _, err := NewTimeWindowChecker("25:00", "06:00", nil); err == nil {
+		t.Fatal("error expected but nil")
+	}
+}
+
+func TestProbabilityCheckerは確率でtrueを返す(t *testing.T) {
+	c := NewProbabilityChecker(0.3)
+	c.float = func() float64 { return 0.29 }
+	if !c.Check(&model.Message{}) {
+		t.Fatal("check expected true but false")
+	}
+	c.float = func() float64 { return 0.3 }
+	if c.Check(&model.Message{}) {
+		t.Fatal("check expected false but true")
+	}
+}
@@ -0,0 +1,624 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+// commandPrefix はメッセージをコマンドとして扱うための接頭辞です
+const commandPrefix = "/"
+
+// 引数とフラグの型です
+const (
+	ArgString ArgType = iota
+	ArgInt
+	ArgBool
+	ArgDuration
+)
+
+type (
+	// ArgType はコマンドの引数とフラグの型です
+	ArgType int
+
+	// Arg はコマンドの位置引数の定義です
+	//
+	// Variadicな引数は最後に1つだけ置けて、残りの引数を全て受け取ります
+	Arg struct {
+		Name        string
+		Type        ArgType
+		Optional    bool
+		Variadic    bool
+		Description string
+	}
+
+	// Flag はコマンドの"--name value"形式のフラグの定義です
+	//
+	// ArgBoolのフラグは値を取らず、"--name"だけでtrueになります
+	Flag struct {
+		Name        string
+		Type        ArgType
+		Default     string
+		Description string
+	}
+
+	// Command は"/name sub --flag value arg"の形で呼び出されるコマンドの定義です
+	//
+	// Subcommandsがある場合、最初の引数がサブコマンド名に一致すればそちらが実行されます
+	Command struct {
+		Name        string
+		Aliases     []string
+		Description string
+		Args        []Arg
+		Flags       []Flag
+		Subcommands []*Command
+		Run         func(ctx *CommandContext) (*model.Message, error)
+
+		prefix string
+		parent *Command
+	}
+
+	// CommandContext はコマンドの実行時に渡される、解析済みの引数とフラグです
+	CommandContext struct {
+		Message *model.Message
+		Command *Command
+		values  map[string]interface{}
+	}
+
+	// UsageError はコマンドの使い方が間違っていることを表すエラーです
+	//
+	// CommandRouterはこのエラーを、使い方を添えた返信にします
+	UsageError struct {
+		Command *Command
+		Message string
+	}
+
+	// CommandFallback は登録されていないコマンドを処理するインターフェースです
+	//
+	// 処理しなかった場合はokにfalseを返します
+	CommandFallback interface {
+		Dispatch(msgIn *model.Message, name, text string) (msg *model.Message, ok bool, err error)
+	}
+
+	// CommandRouter は登録されたコマンドにメッセージを振り分けるCheckerかつProcessorです
+	//
+	//   fields
+	//     prefix   string
+	//     commands []*Command
+	//     names    map[string]*Command
+	//     fallback CommandFallback
+	CommandRouter struct {
+		prefix   string
+		commands []*Command
+		names    map[string]*Command
+		fallback CommandFallback
+	}
+)
+
+// String はArgTypeの名前を返します
+func (t ArgType) String() string {
+	switch t {
+	case ArgInt:
+		return "int"
+	case ArgBool:
+		return "bool"
+	case ArgDuration:
+		return "duration"
+	default:
+		return "string"
+	}
+}
+
+// parse はsをArgTypeの値に変換します
+func (t ArgType) parse(s string) (interface{}, error) {
+	switch t {
+	case ArgInt:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q は整数ではありません", s)
+		}
+		return n, nil
+	case ArgBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q は真偽値ではありません", s)
+		}
+		return b, nil
+	case ArgDuration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q は時間ではありません (例: 30m, 1h)", s)
+		}
+		return d, nil
+	default:
+		return s, nil
+	}
+}
+
+// Error はエラーメッセージを返します
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+// Path は親コマンドを含めた"/name sub"形式の名前を返します
+func (c *Command) Path() string {
+	if c.parent == nil {
+		return c.prefix + c.Name
+	}
+	return c.parent.Path() + " " + c.Name
+}
+
+// Usage は"/name <arg> [--flag value]"形式の使い方を返します
+func (c *Command) Usage() string {
+	parts := []string{c.Path()}
+	if len(c.Subcommands) > 0 {
+		names := []string{}
+		for _, sub := range c.Subcommands {
+			names = append(names, sub.Name)
+		}
+		parts = append(parts, "{"+strings.Join(names, "|")+"}")
+	}
+	for _, a := range c.Args {
+		name := a.Name
+		if a.Variadic {
+			name += "..."
+		}
+		if a.Optional {
+			parts = append(parts, "["+name+"]")
+		} else {
+			parts = append(parts, "<"+name+">")
+		}
+	}
+	for _, f := range c.Flags {
+		if f.Type == ArgBool {
+			parts = append(parts, "[--"+f.Name+"]")
+		} else {
+			parts = append(parts, "[--"+f.Name+" "+f.Type.String()+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Help はコマンドの説明、使い方、引数とフラグの説明を返します
+func (c *Command) Help() string {
+	lines := []string{c.Path() + " - " + c.Description, "使い方: " + c.Usage()}
+	if len(c.Aliases) > 0 {
+		lines = append(lines, "別名: "+c.prefix+strings.Join(c.Aliases, ", "+c.prefix))
+	}
+	for _, sub := range c.Subcommands {
+		lines = append(lines, "  "+sub.Name+": "+sub.Description)
+	}
+	for _, a := range c.Args {
+		lines = append(lines, fmt.Sprintf("  %s (%s): %s", a.Name, a.Type, a.Description))
+	}
+	for _, f := range c.Flags {
+		line := fmt.Sprintf("  --%s (%s): %s", f.Name, f.Type, f.Description)
+		if f.Default != "" {
+			line += " (デフォルト: " + f.Default + ")"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// usageErrorf はcのUsageErrorを返します
+func (c *Command) usageErrorf(format string, a ...interface{}) *UsageError {
+	return &UsageError{
+		Command: c,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+// flag はnameのフラグの定義を返します
+func (c *Command) flag(name string) (Flag, bool) {
+	for _, f := range c.Flags {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Flag{}, false
+}
+
+// subcommand はnameのサブコマンドを返します
+func (c *Command) subcommand(name string) *Command {
+	for _, sub := range c.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+		for _, alias := range sub.Aliases {
+			if alias == name {
+				return sub
+			}
+		}
+	}
+	return nil
+}
+
+// parse はtokensを引数とフラグの定義に従って解析します
+func (c *Command) parse(tokens []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, f := range c.Flags {
+		switch {
+		case f.Default != "":
+			v, err := f.Type.parse(f.Default)
+			if err != nil {
+				return nil, fmt.Errorf("invalid default of --%s: %s", f.Name, err)
+			}
+			values[f.Name] = v
+		case f.Type == ArgBool:
+			values[f.Name] = false
+		}
+	}
+
+	var positional []string
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t == "--" {
+			positional = append(positional, tokens[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(t, "--") || len(t) == 2 {
+			positional = append(positional, t)
+			continue
+		}
+
+		name, value := t[2:], ""
+		hasValue := false
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, value, hasValue = name[:eq], name[eq+1:], true
+		}
+		f, ok := c.flag(name)
+		if !ok {
+			return nil, c.usageErrorf("--%s というフラグはありません", name)
+		}
+		if !hasValue {
+			if f.Type == ArgBool {
+				value = "true"
+			} else {
+				if i+1 >= len(tokens) {
+					return nil, c.usageErrorf("--%s には値が必要です", name)
+				}
+				i++
+				value = tokens[i]
+			}
+		}
+		v, err := f.Type.parse(value)
+		if err != nil {
+			return nil, c.usageErrorf("--%s: %s", name, err)
+		}
+		values[name] = v
+	}
+
+	for i, a := range c.Args {
+		if a.Variadic {
+			var rest []string
+			if i < len(positional) {
+				rest = positional[i:]
+			}
+			if len(rest) == 0 && !a.Optional {
+				return nil, c.usageErrorf("%s が指定されていません", a.Name)
+			}
+			vs := []interface{}{}
+			for _, s := range rest {
+				v, err := a.Type.parse(s)
+				if err != nil {
+					return nil, c.usageErrorf("%s: %s", a.Name, err)
+				}
+				vs = append(vs, v)
+			}
+			values[a.Name] = vs
+			return values, nil
+		}
+		if i >= len(positional) {
+			if !a.Optional {
+				return nil, c.usageErrorf("%s が指定されていません", a.Name)
+			}
+			continue
+		}
+		v, err := a.Type.parse(positional[i])
+		if err != nil {
+			return nil, c.usageErrorf("%s: %s", a.Name, err)
+		}
+		values[a.Name] = v
+	}
+	if len(positional) > len(c.Args) {
+		return nil, c.usageErrorf("引数が多すぎます: %s", strings.Join(positional[len(c.Args):], " "))
+	}
+
+	return values, nil
+}
+
+// Has は引数かフラグが指定されているか返します
+func (ctx *CommandContext) Has(name string) bool {
+	_, ok := ctx.values[name]
+	return ok
+}
+
+// String はstringの引数かフラグの値を返します。指定されていない場合は""を返します
+func (ctx *CommandContext) String(name string) string {
+	s, _ := ctx.values[name].(string)
+	return s
+}
+
+// Int はintの引数かフラグの値を返します。指定されていない場合は0を返します
+func (ctx *CommandContext) Int(name string) int {
+	n, _ := ctx.values[name].(int)
+	return n
+}
+
+// Bool はboolの引数かフラグの値を返します。指定されていない場合はfalseを返します
+func (ctx *CommandContext) Bool(name string) bool {
+	b, _ := ctx.values[name].(bool)
+	return b
+}
+
+// Duration はdurationの引数かフラグの値を返します。指定されていない場合は0を返します
+func (ctx *CommandContext) Duration(name string) time.Duration {
+	d, _ := ctx.values[name].(time.Duration)
+	return d
+}
+
+// Strings はVariadicなstringの引数の値を返します
+func (ctx *CommandContext) Strings(name string) []string {
+	vs, _ := ctx.values[name].([]interface{})
+	ss := []string{}
+	for _, v := range vs {
+		if s, ok := v.(string); ok {
+			ss = append(ss, s)
+		}
+	}
+	return ss
+}
+
+// UsageErrorf は実行中のコマンドのUsageErrorを返します
+func (ctx *CommandContext) UsageErrorf(format string, a ...interface{}) error {
+	return ctx.Command.usageErrorf(format, a...)
+}
+
+// Reply はbodyを本文にしたbotの投稿用メッセージを返します
+func (ctx *CommandContext) Reply(body string) (*model.Message, error) {
+	return &model.Message{
+		Body:     body,
+		UserName: "bot",
+	}, nil
+}
+
+// Register はコマンドを登録します。名前か別名が重複している場合はpanicします
+func (r *CommandRouter) Register(cmds ...*Command) {
+	for _, c := range cmds {
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			if _, ok := r.names[name]; ok {
+				panic(fmt.Sprintf("bot: command %s is already registered", name))
+			}
+			r.names[name] = c
+		}
+		c.prefix = r.prefix
+		setParent(c)
+		r.commands = append(r.commands, c)
+	}
+}
+
+// setParent はサブコマンドに親コマンドを設定します
+func setParent(c *Command) {
+	for _, sub := range c.Subcommands {
+		sub.parent = c
+		setParent(sub)
+	}
+}
+
+// SetFallback は登録されていないコマンドをfに渡すようにします
+func (r *CommandRouter) SetFallback(f CommandFallback) {
+	r.fallback = f
+}
+
+// Commands は登録されたコマンドを名前順に返します
+func (r *CommandRouter) Commands() []*Command {
+	cmds := make([]*Command, len(r.commands))
+	copy(cmds, r.commands)
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+	return cmds
+}
+
+// Lookup は名前か別名からコマンドを返します
+func (r *CommandRouter) Lookup(name string) (*Command, bool) {
+	c, ok := r.names[strings.TrimPrefix(name, r.prefix)]
+	return c, ok
+}
+
+// Check はメッセージが"/"で始まるコマンドの形をしている場合trueを返します
+//
+// 接頭辞のないCommandRouterでは、登録されたコマンド名で始まる場合だけtrueを返します
+// "/nothing というコマンドはありません"のような返信をコマンドとして実行し続けないように、botの投稿は扱いません
+func (r *CommandRouter) Check(m *model.Message) bool {
+	if m.Origin == model.OriginBot {
+		return false
+	}
+	if r.prefix == "" {
+		fields := strings.Fields(m.Body)
+		if len(fields) == 0 {
+			return false
+		}
+		_, ok := r.names[fields[0]]
+		return ok
+	}
+	return len(m.Body) > len(r.prefix) && strings.HasPrefix(m.Body, r.prefix) && m.Body[len(r.prefix)] != ' '
+}
+
+// Process はメッセージを解析してコマンドを実行します
+//
+// 使い方の誤りはエラーではなく、使い方を添えた返信になります
+func (r *CommandRouter) Process(msgIn *model.Message) (*model.Message, error) {
+	tokens, err := splitCommandLine(strings.TrimPrefix(msgIn.Body, r.prefix))
+	if err != nil {
+		return r.reply(err.Error())
+	}
+
+	c, ok := r.Lookup(tokens[0])
+	if !ok && r.fallback != nil {
+		text := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(msgIn.Body, r.prefix), tokens[0]))
+		msg, handled, err := r.fallback.Dispatch(msgIn, tokens[0], text)
+		if handled || err != nil {
+			return msg, err
+		}
+	}
+	if !ok {
+		return r.reply(fmt.Sprintf("%s%s というコマンドはありません。%shelp で一覧を表示します", r.prefix, tokens[0], r.prefix))
+	}
+	tokens = tokens[1:]
+	for len(tokens) > 0 {
+		sub := c.subcommand(tokens[0])
+		if sub == nil {
+			break
+		}
+		c, tokens = sub, tokens[1:]
+	}
+
+	msg, err := r.run(c, msgIn, tokens)
+	if ue, ok := err.(*UsageError); ok {
+		return r.reply(fmt.Sprintf("%s\n使い方: %s", ue.Message, ue.Command.Usage()))
+	}
+	return msg, err
+}
+
+// run はtokensを解析してcを実行します
+func (r *CommandRouter) run(c *Command, msgIn *model.Message, tokens []string) (*model.Message, error) {
+	if c.Run == nil {
+		if len(tokens) > 0 {
+			return nil, c.usageErrorf("%s というサブコマンドはありません", tokens[0])
+		}
+		return nil, c.usageErrorf("サブコマンドを指定してください")
+	}
+
+	values, err := c.parse(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return c.Run(&CommandContext{
+		Message: msgIn,
+		Command: c,
+		values:  values,
+	})
+}
+
+// reply はbodyを本文にしたbotの投稿用メッセージを返します
+func (r *CommandRouter) reply(body string) (*model.Message, error) {
+	return &model.Message{
+		Body:     body,
+		UserName: "bot",
+	}, nil
+}
+
+// helpCommand は登録されたコマンドの一覧か、指定されたコマンドの使い方を返す組み込みのコマンドです
+func (r *CommandRouter) helpCommand() *Command {
+	return &Command{
+		Name:        "help",
+		Description: "コマンドの一覧か、指定したコマンドの使い方を表示します",
+		Args: []Arg{
+			{Name: "command", Type: ArgString, Optional: true, Variadic: true, Description: "使い方を表示するコマンド"},
+		},
+		Run: func(ctx *CommandContext) (*model.Message, error) {
+			path := ctx.Strings("command")
+			if len(path) == 0 {
+				lines := []string{"コマンド一覧"}
+				for _, c := range r.Commands() {
+					lines = append(lines, c.Path()+" - "+c.Description)
+				}
+				return ctx.Reply(strings.Join(lines, "\n"))
+			}
+
+			c, ok := r.Lookup(path[0])
+			if !ok {
+				return nil, ctx.UsageErrorf("%s というコマンドはありません", path[0])
+			}
+			for _, name := range path[1:] {
+				sub := c.subcommand(name)
+				if sub == nil {
+					return nil, ctx.UsageErrorf("%s に %s というサブコマンドはありません", c.Path(), name)
+				}
+				c = sub
+			}
+			return ctx.Reply(c.Help())
+		},
+	}
+}
+
+// splitCommandLine はsを空白で区切ります。引用符で囲まれた部分は空白を含む1つの引数になります
+func splitCommandLine(s string) ([]string, error) {
+	var (
+		tokens  []string
+		current []rune
+		quote   rune
+		inToken bool
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			current = append(current, r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inToken = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current = append(current, r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inToken = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '　':
+			if inToken {
+				tokens = append(tokens, string(current))
+				current = current[:0]
+				inToken = false
+			}
+		default:
+			current = append(current, r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("引用符が閉じられていません")
+	}
+	if escaped {
+		return nil, errors.New("末尾の \\ の後に文字がありません")
+	}
+	if inToken {
+		tokens = append(tokens, string(current))
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("コマンドが空です")
+	}
+	return tokens, nil
+}
+
+// NewCommandRouter は組み込みのhelpコマンドとcmdsが登録された新しいCommandRouter構造体のポインタを返します
+func NewCommandRouter(cmds ...*Command) *CommandRouter {
+	r := &CommandRouter{
+		prefix: commandPrefix,
+		names:  map[string]*Command{},
+	}
+	r.Register(r.helpCommand())
+	r.Register(cmds...)
+	return r
+}
+
+// NewBareCommandRouter は"/"なしで、コマンド名で始まるメッセージを振り分ける新しいCommandRouter構造体のポインタを返します
+//
+// "poll ..."のように決まった単語で始まるbotで、引数の解析と使い方の返信を使うためのものです。helpコマンドは登録されません
+func NewBareCommandRouter(cmds ...*Command) *CommandRouter {
+	r := &CommandRouter{
+		names: map[string]*Command{},
+	}
+	r.Register(cmds...)
+	return r
+}
@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+func newEchoCommand() *Command {
+	return &Command{
+		Name:        "echo",
+		Aliases:     []string{"say"},
+		Description: "そのまま返します",
+		Args: []Arg{
+			{Name: "words", Type: ArgString, Variadic: true, Description: "返す文字列"},
+		},
+		Flags: []Flag{
+			{Name: "times", Type: ArgInt, Default: "1", Description: "繰り返す回数"},
+			{Name: "upper", Type: ArgBool, Description: "大文字にする"},
+		},
+		Run: func(ctx *CommandContext) (*model.Message, error) {
+			s := strings.Join(ctx.Strings("words"), " ")
+			if ctx.Bool("upper") {
+				s = strings.ToUpper(s)
+			}
+			return ctx.Reply(strings.Repeat(s, ctx.Int("times")))
+		},
+	}
+}
+
+func TestSplitCommandLineは引用符で囲まれた空白を区切らない(t *testing.T) {
+	actual, err := splitCommandLine(`poll "Lunch?" 'ramen  sushi' curry\ rice`)
+	if err != nil {
+		t.Fatalf("failed to split: %s", err)
+	}
+	if expected := []string{"poll", "Lunch?", "ramen  sushi", "curry rice"}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("tokens expected %q but not, actual %q", expected, actual)
+	}
+
+	if _, err := splitCommandLine(`poll "Lunch?`); err == nil {
+		t.Fatal("error expected but nil")
+	}
+}
+
+func TestCommandRouterがコマンドを実行する(t *testing.T) {
+	r := NewCommandRouter(newEchoCommand())
+
+	cases := map[string]string{
+		`/echo hello`:                "hello",
+		`/say --upper "hello world"`: "HELLO WORLD",
+		`/echo --times 2 ab`:         "abab",
+		`/echo --times=3 -- --upper`: "--upper--upper--upper",
+		`/echo --times x ab`:         "--times: \"x\" は整数ではありません\n使い方: /echo <words...> [--times int] [--upper]",
+		`/echo`:                      "words が指定されていません\n使い方: /echo <words...> [--times int] [--upper]",
+		`/nothing`:                   "/nothing というコマンドはありません。/help で一覧を表示します",
+		`/help`:                      "コマンド一覧\n/echo - そのまま返します\n/help - コマンドの一覧か、指定したコマンドの使い方を表示します",
+		`/echo --verbose hello`:      "--verbose というフラグはありません\n使い方: /echo <words...> [--times int] [--upper]",
+		`/echo "unterminated`:        "引用符が閉じられていません",
+		`/help say`:                  "/echo - そのまま返します\n使い方: /echo <words...> [--times int] [--upper]\n別名: /say\n  words (string): 返す文字列\n  --times (int): 繰り返す回数 (デフォルト: 1)\n  --upper (bool): 大文字にする",
+	}
+	for body, expected := range cases {
+		m := &model.Message{Body: body, UserName: "alice"}
+		if !r.Check(m) {
+			t.Fatalf("%s: check expected true but false", body)
+		}
+		actual, err := r.Process(m)
+		if err != nil {
+			t.Fatalf("%s: failed to process: %s", body, err)
+		}
+		if actual.Body != expected {
+			t.Fatalf("%s: body expected %q but not, actual %q", body, expected, actual.Body)
+		}
+	}
+}
+
+func TestCommandRouterがサブコマンドを実行する(t *testing.T) {
+	r := NewCommandRouter(&Command{
+		Name:        "todo",
+		Description: "TODOを管理します",
+		Subcommands: []*Command{
+			{
+				Name:        "add",
+				Description: "TODOを追加します",
+				Args:        []Arg{{Name: "title", Type: ArgString}},
+				Run: func(ctx *CommandContext) (*model.Message, error) {
+					return ctx.Reply("added " + ctx.String("title"))
+				},
+			},
+		},
+	})
+
+	m, err := r.Process(&model.Message{Body: `/todo add "buy milk"`})
+	if err != nil {
+		t.Fatalf("failed to process: %s", err)
+	}
+	if expected := "added buy milk"; m.Body != expected {
+		t.Fatalf("body expected %q but not, actual %q", expected, m.Body)
+	}
+
+	m, err = r.Process(&model.Message{Body: `/todo remove 1`})
+	if err != nil {
+		t.Fatalf("failed to process: %s", err)
+	}
+	if expected := "remove というサブコマンドはありません\n使い方: /todo {add}"; m.Body != expected {
+		t.Fatalf("body expected %q but not, actual %q", expected, m.Body)
+	}
+}
+
+func TestCommandRouterはコマンドでないメッセージを無視する(t *testing.T) {
+	r := NewCommandRouter()
+	for _, body := range []string{"hello", "/", "/ hello", "omikuji"} {
+		if r.Check(&model.Message{Body: body}) {
+			t.Fatalf("%s: check expected false but true", body)
+		}
+	}
+}
+
+func TestCommandRouterは自分の返信をコマンドとして扱わない(t *testing.T) {
+	r := NewCommandRouter(newEchoCommand())
+	for _, body := range []string{"/nothing", "/help echo", "/echo /echo"} {
+		m, err := r.Process(&model.Message{Body: body, UserName: "alice"})
+		if err != nil {
+			t.Fatalf("%s: failed to process: %s", body, err)
+		}
+		if !strings.HasPrefix(m.Body, "/") {
+			t.Fatalf("%s: reply starting with the prefix expected but not, actual %q", body, m.Body)
+		}
+		// Posterが投稿したメッセージとして戻ってきます
+		m.Origin = model.OriginBot
+		if r.Check(m) {
+			t.Fatalf("%s: reply %q expected not to be checked but it was", body, m.Body)
+		}
+	}
+}
+
+func TestBareCommandRouterは登録されたコマンド名で始まるメッセージだけ扱う(t *testing.T) {
+	r := NewBareCommandRouter(newEchoCommand())
+
+	for body, expected := range map[string]bool{"echo hi": true, "say hi": true, "/echo hi": false, "help": false, "echoes": false} {
+		if actual := r.Check(&model.Message{Body: body}); actual != expected {
+			t.Fatalf("%s: check expected %v but not", body, expected)
+		}
+	}
+
+	m, err := r.Process(&model.Message{Body: "echo"})
+	if err != nil {
+		t.Fatalf("failed to process: %s", err)
+	}
+	if expected := "words が指定されていません\n使い方: echo <words...> [--times int] [--upper]"; m.Body != expected {
+		t.Fatalf("body expected %q but not, actual %q", expected, m.Body)
+	}
+}
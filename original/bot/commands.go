@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+// gachaMaxCount は/gachaで一度に引ける回数の上限です
+const gachaMaxCount = 10
+
+// NewOmikujiCommand は今日のおみくじを引く/omikujiコマンドを返します
+//
+// "/omikuji history"でこれまでの記録を返します
+func NewOmikujiCommand(db *sql.DB, table *OmikujiTable) *Command {
+	p := &OmikujiProcessor{
+		db:    db,
+		table: table,
+		now:   time.Now,
+	}
+
+	return &Command{
+		Name:        "omikuji",
+		Aliases:     []string{"kuji"},
+		Description: "今日のおみくじを引きます",
+		Subcommands: []*Command{
+			{
+				Name:        "history",
+				Description: "これまでのおみくじの記録を表示します",
+				Run: func(ctx *CommandContext) (*model.Message, error) {
+					return p.history(ctx.Message.UserName)
+				},
+			},
+		},
+		Run: func(ctx *CommandContext) (*model.Message, error) {
+			return p.draw(ctx.Message.UserName)
+		},
+	}
+}
+
+// NewGachaCommand はガチャを引く/gachaコマンドを返します
+func NewGachaCommand() *Command {
+	p := &GachaProcessor{}
+
+	return &Command{
+		Name:        "gacha",
+		Description: "ガチャを引きます",
+		Flags: []Flag{
+			{Name: "count", Type: ArgInt, Default: "1", Description: "引く回数"},
+		},
+		Run: func(ctx *CommandContext) (*model.Message, error) {
+			n := ctx.Int("count")
+			if n < 1 || n > gachaMaxCount {
+				return nil, ctx.UsageErrorf("--count は1から%dまでです", gachaMaxCount)
+			}
+
+			results := []string{}
+			for i := 0; i < n; i++ {
+				results = append(results, p.draw())
+			}
+			return ctx.Reply(strings.Join(results, ", "))
+		},
+	}
+}
@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+type (
+	// ConversationProcessor は会話の状態を受け取り、投稿用messageを作るProcessorです
+	//
+	// Awaitを呼ぶと、そのユーザーの次のメッセージはcheckerを満たさなくてもこのprocessorに渡されます
+	// Awaitを呼ばなかった場合、会話はそのメッセージで終わります
+	ConversationProcessor interface {
+		Processor
+		Converse(message *model.Message, conv *Conversation) (*model.Message, error)
+	}
+
+	// Conversation はbotとユーザーの間で続いている会話の状態です
+	//
+	//   fields
+	//     State     map[string]string
+	//     awaiting  bool
+	//     await     bool
+	//     expiresAt time.Time
+	//     now       func() time.Time
+	Conversation struct {
+		State     map[string]string
+		awaiting  bool
+		await     bool
+		expiresAt time.Time
+		now       func() time.Time
+	}
+
+	// ConversationStore はbotごと、ユーザーごとの会話の状態をDBに保存します
+	//
+	//   fields
+	//     db  *sql.DB
+	//     now func() time.Time
+	ConversationStore struct {
+		db  *sql.DB
+		now func() time.Time
+	}
+)
+
+// Awaiting はこのメッセージを受け取った時点で返事を待っていたか返します
+func (c *Conversation) Awaiting() bool {
+	return c != nil && c.awaiting
+}
+
+// Await はttlの間、ユーザーの次のメッセージを待ちます
+//
+// 期限は会話を読み込んだConversationStoreの時計で決めます
+func (c *Conversation) Await(ttl time.Duration) {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	c.await = true
+	c.expiresAt = now().Add(ttl)
+}
+
+// End は会話を終わらせて状態を捨てます
+func (c *Conversation) End() {
+	c.await = false
+	c.State = map[string]string{}
+}
+
+// Load はbotとusernameの会話を返します。会話がない、または期限が切れている場合は空の会話を返します
+func (s *ConversationStore) Load(bot, username string) (*Conversation, error) {
+	mc, err := model.ConversationByBotAndUserName(s.db, bot, username, s.now())
+	switch {
+	case err == sql.ErrNoRows:
+		return &Conversation{State: map[string]string{}, now: s.now}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	c := &Conversation{
+		awaiting:  true,
+		expiresAt: mc.ExpiresAt,
+		now:       s.now,
+	}
+	if err := json.Unmarshal([]byte(mc.State), &c.State); err != nil {
+		return nil, err
+	}
+	if c.State == nil {
+		c.State = map[string]string{}
+	}
+	return c, nil
+}
+
+// Save はAwaitされている会話を保存し、そうでなければ削除します
+func (s *ConversationStore) Save(bot, username string, c *Conversation) error {
+	mc := &model.Conversation{
+		Bot:       bot,
+		UserName:  username,
+		ExpiresAt: c.expiresAt,
+	}
+	if !c.await {
+		return mc.Delete(s.db)
+	}
+
+	b, err := json.Marshal(c.State)
+	if err != nil {
+		return err
+	}
+	mc.State = string(b)
+	return mc.Save(s.db)
+}
+
+// NewConversationStore は新しいConversationStore構造体のポインタを返します
+func NewConversationStore(db *sql.DB) *ConversationStore {
+	return &ConversationStore{
+		db:  db,
+		now: time.Now,
+	}
+}
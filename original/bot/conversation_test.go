@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestQuizBotは返事を待っているユーザーの次のメッセージを答えとして受け取る(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE conversation (bot TEXT NOT NULL, username TEXT NOT NULL, state TEXT NOT NULL DEFAULT "{}", expires_at INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (bot, username))`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+
+	out := make(chan *model.Message, 10)
+	b := NewQuizBot(out, db)
+	b.processor.(*QuizProcessor).perm = func(n int) []int {
+		p := make([]int, n)
+		for i := range p {
+			p[i] = i
+		}
+		return p
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	cases := []struct {
+		username string
+		body     string
+		expected string
+	}{
+		{"alice", "富士山", ""},
+		{"alice", "quiz", "第1問: 日本で一番高い山は?"},
+		{"bob", "富士山", ""},
+		{"alice", "富士山", "正解パカ!\n第2問: 1バイトは何ビット?"},
+		{"alice", "9", "残念、正解は「8」パカ\n第3問: Goのマスコットの名前は?"},
+		{"alice", "Gopher", "正解パカ!\n3問中2問正解パカ"},
+		{"alice", "gopher", ""},
+		{"alice", "quiz", "第1問: 日本で一番高い山は?"},
+		{"alice", "やめる", "クイズをやめるパカ (0問中0問正解)"},
+		{"alice", "富士山", ""},
+	}
+	for _, c := range cases {
+		b.in <- &model.Message{Body: c.body, UserName: c.username}
+		// 次のメッセージを受け取れた時点で前のメッセージの処理は終わっています
+		b.in <- &model.Message{Body: "", UserName: "nobody"}
+
+		if c.expected == "" {
+			if len(out) != 0 {
+				t.Fatalf("%s %q: no reply expected but not, actual %q", c.username, c.body, (<-out).Body)
+			}
+			continue
+		}
+		if len(out) != 1 {
+			t.Fatalf("%s %q: a reply expected but not, actual %d", c.username, c.body, len(out))
+		}
+		if actual := (<-out).Body; actual != "@"+c.username+" "+c.expected {
+			t.Fatalf("%s %q: reply expected %q but not, actual %q", c.username, c.body, c.expected, actual)
+		}
+	}
+
+	var n int
+	if err := db.QueryRow(`select count(*) from conversation`).Scan(&n); err != nil {
+		t.Fatalf("failed to count: %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("finished conversations expected to be deleted but not, actual %d", n)
+	}
+}
+
+func TestConversationStoreは自分の時計で会話の期限を決める(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE conversation (bot TEXT NOT NULL, username TEXT NOT NULL, state TEXT NOT NULL DEFAULT "{}", expires_at INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (bot, username))`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+
+	now := time.Date(2018, 4, 22, 10, 0, 0, 0, time.UTC)
+	s := NewConversationStore(db)
+	s.now = func() time.Time { return now }
+
+	c, err := s.Load("quizbot", "alice")
+	if err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	c.Await(5 * time.Minute)
+	if err := s.Save("quizbot", "alice", c); err != nil {
+		t.Fatalf("failed to save: %s", err)
+	}
+
+	now = now.Add(5*time.Minute - time.Second)
+	if c, err := s.Load("quizbot", "alice"); err != nil || !c.Awaiting() {
+		t.Fatalf("awaiting conversation expected but not, actual %v, %v", c, err)
+	}
+	now = now.Add(time.Second)
+	if c, err := s.Load("quizbot", "alice"); err != nil || c.Awaiting() {
+		t.Fatalf("expired conversation expected but not, actual %v, %v", c, err)
+	}
+
+	// 期限が切れた会話は定期的に削除します
+	if _, err := NewConversationExpireBot(db).job.Run(now); err != nil {
+		t.Fatalf("failed to delete expired conversations: %s", err)
+	}
+	var n int
+	if err := db.QueryRow(`select count(*) from conversation`).Scan(&n); err != nil {
+		t.Fatalf("failed to count: %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("expired conversations expected to be deleted but not, actual %d", n)
+	}
+}
@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestScheduleが次の時刻を返す(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	// 2018-04-22は日曜日です
+	base := time.Date(2018, 4, 22, 9, 30, 15, 0, jst)
+
+	cases := map[string]time.Time{
+		"* * * * *":        time.Date(2018, 4, 22, 9, 31, 0, 0, jst),
+		"*/15 * * * *":     time.Date(2018, 4, 22, 9, 45, 0, 0, jst),
+		"0 10 * * mon-fri": time.Date(2018, 4, 23, 10, 0, 0, 0, jst),
+		"0 9 * * *":        time.Date(2018, 4, 23, 9, 0, 0, 0, jst),
+		"30 9 1 * *":       time.Date(2018, 5, 1, 9, 30, 0, 0, jst),
+		"0 0 29 2 *":       time.Date(2020, 2, 29, 0, 0, 0, 0, jst),
+		"0 12 * * 7":       time.Date(2018, 4, 22, 12, 0, 0, 0, jst),
+		"0 0 13 * fri":     time.Date(2018, 4, 27, 0, 0, 0, 0, jst),
+		"@monthly":         time.Date(2018, 5, 1, 0, 0, 0, 0, jst),
+		"0 9-17/4 * jun *": time.Date(2018, 6, 1, 9, 0, 0, 0, jst),
+		"5,10 22 * * sat":  time.Date(2018, 4, 28, 22, 5, 0, 0, jst),
+	}
+	for spec, expected := range cases {
+		s, err := ParseSchedule(spec)
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %s", spec, err)
+		}
+		if actual := s.Next(base); !actual.Equal(expected) {
+			t.Fatalf("%s: next expected %s but not, actual %s", spec, expected, actual)
+		}
+	}
+}
+
+func TestParseScheduleは不正な形式をエラーにする(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Fatalf("%q: error expected but nil", spec)
+		}
+	}
+}
+
+func TestSchedulerは止まっていた間の回をpolicyに従って実行する(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE scheduled_run (name TEXT NOT NULL PRIMARY KEY, last_run INTEGER NOT NULL DEFAULT 0)`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+
+	lastRun := time.Date(2018, 4, 22, 9, 0, 0, 0, time.UTC)
+	now := lastRun.Add(3*time.Hour + 30*time.Minute)
+
+	cases := map[MissedRunPolicy]int{
+		SkipMissed:    0,
+		RunOnceMissed: 1,
+		RunAllMissed:  3,
+	}
+	for policy, expected := range cases {
+		out := make(chan *model.Message, 10)
+		s := NewScheduler(db, out)
+		name := "hourly" + string(rune('0'+policy))
+		if err := (&model.ScheduledRun{Name: name, LastRun: lastRun}).Save(db); err != nil {
+			t.Fatalf("failed to save: %s", err)
+		}
+
+		job := JobFunc(func(t time.Time) ([]*model.Message, error) {
+			return []*model.Message{{Body: t.Format("15:04")}}, nil
+		})
+		s.catchUp(NewScheduledBot(name, MustParseSchedule("@hourly"), time.UTC, policy, job), now)
+
+		if actual := len(out); actual != expected {
+			t.Fatalf("policy %d: runs expected %d but not, actual %d", policy, expected, actual)
+		}
+		if policy == RunOnceMissed {
+			if m := <-out; m.Body != "12:00" {
+				t.Fatalf("policy %d: last missed run expected 12:00 but not, actual %s", policy, m.Body)
+			}
+		}
+
+		r, err := model.ScheduledRunByName(db, name)
+		if err != nil {
+			t.Fatalf("failed to get last run: %s", err)
+		}
+		if !r.LastRun.Equal(now) {
+			t.Fatalf("policy %d: last run expected %s but not, actual %s", policy, now, r.LastRun)
+		}
+	}
+
+	// 毎分のスケジュールで長く止まっていても、実行するのは最近の回だけです
+	out := make(chan *model.Message, missedRunsLimit+1)
+	s := NewScheduler(db, out)
+	if err := (&model.ScheduledRun{Name: "minutely", LastRun: lastRun.AddDate(0, -1, 0)}).Save(db); err != nil {
+		t.Fatalf("failed to save: %s", err)
+	}
+	job := JobFunc(func(t time.Time) ([]*model.Message, error) {
+		return []*model.Message{{Body: t.Format("15:04")}}, nil
+	})
+	s.catchUp(NewScheduledBot("minutely", MustParseSchedule("* * * * *"), time.UTC, RunAllMissed, job), now)
+	if actual := len(out); actual != missedRunsLimit {
+		t.Fatalf("runs expected %d but not, actual %d", missedRunsLimit, actual)
+	}
+	if m := <-out; m.Body != "12:21" {
+		t.Fatalf("first of the last %d runs expected 12:21 but not, actual %s", missedRunsLimit, m.Body)
+	}
+}
@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+// dicePattern は"roll 3d6+2", "calc (1+2)*3/4"にマッチします
+var dicePattern = regexp.MustCompile(`\A(roll|calc)\s+(.+)\z`)
+
+type (
+	// DiceProcessor は"roll"でダイスを含む式を、"calc"で四則演算の式を計算するprocessorの構造体です
+	//
+	// 式を解釈できない場合はExprErrorを返し、Bot.Runがその内容を返信します
+	//
+	//   fields
+	//     intn func(int) int
+	DiceProcessor struct {
+		intn func(int) int
+	}
+)
+
+// Process はmessageの式を計算した結果を返します
+func (p *DiceProcessor) Process(message *model.Message) (*model.Message, error) {
+	return p.ProcessMatch(message, dicePattern.FindStringSubmatch(message.Body))
+}
+
+// ProcessMatch は"(roll|calc) (.+)"でキャプチャした式を計算した結果を返します
+func (p *DiceProcessor) ProcessMatch(message *model.Message, groups []string) (*model.Message, error) {
+	if len(groups) < 3 {
+		return nil, &ExprError{Message: "式がありません"}
+	}
+	roll := groups[1] == "roll"
+
+	x, err := ParseExpr(groups[2], roll)
+	if err != nil {
+		return nil, err
+	}
+	v, rolls, err := x.Eval(p.intn)
+	if err != nil {
+		return nil, err
+	}
+
+	body := fmt.Sprintf("@%s %s = %s", message.UserName, x, formatNumber(v))
+	if len(rolls) > 0 {
+		rs := make([]string, len(rolls))
+		for i, r := range rolls {
+			rs[i] = r.String()
+		}
+		body += fmt.Sprintf(" (%s)", strings.Join(rs, " / "))
+	}
+	return &model.Message{
+		Body:     body,
+		UserName: "bot",
+	}, nil
+}
+
+// NewDiceProcessor は新しいDiceProcessor構造体のポインタを返します
+func NewDiceProcessor() *DiceProcessor {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &DiceProcessor{
+		intn: r.Intn,
+	}
+}
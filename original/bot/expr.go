@@ -0,0 +1,527 @@
+package bot
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// exprMaxLength は解析する式の最大の長さです
+	exprMaxLength = 200
+	// exprMaxDepth は括弧や単項演算子の入れ子の最大の深さです
+	exprMaxDepth = 32
+	// exprMaxDice は1つの式で振れるダイスの最大の個数です
+	exprMaxDice = 100
+	// exprMaxSides はダイスの最大の面数です
+	exprMaxSides = 1000
+)
+
+// diceTokenPattern は"3d6", "d20", "4d6kh3", "2d20kl1", "d%"にマッチします
+var diceTokenPattern = regexp.MustCompile(`\A(\d*)[dD](\d+|%)(?:(kh|kl|k)(\d+))?`)
+
+type (
+	// ExprError は式を解釈、または計算できなかったことを表すエラーです
+	//
+	// Posは問題のある位置で、式の先頭の文字を1文字目とします。0の場合は位置を持ちません
+	ExprError struct {
+		Expr    string
+		Pos     int
+		Message string
+	}
+
+	// Expr は解析済みの式です
+	//
+	//   fields
+	//     text string
+	//     root exprNode
+	Expr struct {
+		text string
+		root exprNode
+	}
+
+	// DiceRoll は式の中で振ったダイスの結果です
+	//
+	// Keptは合計に数えた出目、Droppedはkh, klで捨てた出目です
+	DiceRoll struct {
+		Spec    string
+		Kept    []int
+		Dropped []int
+	}
+
+	// exprNode は式の構文木の節です
+	exprNode interface {
+		eval(e *exprEval) (float64, error)
+	}
+
+	// exprNumber は数値の節です
+	exprNumber float64
+
+	// exprDice は"3d6"のようなダイスの節です
+	//
+	//   fields
+	//     spec  string
+	//     count int
+	//     sides int
+	//     keep  string
+	//     n     int
+	exprDice struct {
+		spec  string
+		count int
+		sides int
+		keep  string
+		n     int
+	}
+
+	// exprUnary は符号の節です
+	exprUnary struct {
+		op rune
+		x  exprNode
+	}
+
+	// exprBinary は二項演算の節です
+	exprBinary struct {
+		op   rune
+		x, y exprNode
+	}
+
+	// exprToken は字句の種類と位置です
+	//
+	// kindは'n'が数値、'd'がダイス、0が終端で、それ以外は演算子や括弧の文字そのものです
+	exprToken struct {
+		kind rune
+		text string
+		pos  int
+	}
+
+	// exprParser は字句の並びから構文木を作ります
+	//
+	//   fields
+	//     text   string
+	//     tokens []exprToken
+	//     i      int
+	//     depth  int
+	//     dice   int
+	exprParser struct {
+		text   string
+		tokens []exprToken
+		i      int
+		depth  int
+		dice   int
+	}
+
+	// exprEval は式を計算するときの乱数と振ったダイスの記録です
+	//
+	//   fields
+	//     intn  func(int) int
+	//     rolls []DiceRoll
+	exprEval struct {
+		intn  func(int) int
+		rolls []DiceRoll
+	}
+)
+
+// Error はエラーメッセージを返します
+func (e *ExprError) Error() string {
+	if e.Pos == 0 {
+		return fmt.Sprintf("expr %q: %s", e.Expr, e.Message)
+	}
+	return fmt.Sprintf("expr %q: %s at %d", e.Expr, e.Message, e.Pos)
+}
+
+// ReplyMessage はユーザーに返信するメッセージを返します
+//
+// 読めなかった場合はその位置を、制限を超えた場合や計算できなかった場合は理由だけを返します
+func (e *ExprError) ReplyMessage() string {
+	if e.Pos == 0 {
+		return fmt.Sprintf("計算できないパカ: %s", e.Message)
+	}
+	return fmt.Sprintf("式の%d文字目が読めないパカ: %s\n%s", e.Pos, e.Message, e.Expr)
+}
+
+// ParseExpr は四則演算、剰余、べき乗、括弧からなる式を解析します
+//
+// allowDiceがtrueの場合は"3d6", "4d6kh3"のようなダイスも使えます
+func ParseExpr(text string, allowDice bool) (*Expr, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, &ExprError{Expr: text, Message: "式が空です"}
+	}
+	if utf8.RuneCountInString(text) > exprMaxLength {
+		return nil, &ExprError{Expr: text, Message: fmt.Sprintf("式は%d文字までです", exprMaxLength)}
+	}
+
+	tokens, err := tokenizeExpr(text, allowDice)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{text: text, tokens: tokens}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != 0 {
+		return nil, p.errorf(t, "%qは余分です", t.text)
+	}
+
+	return &Expr{text: text, root: root}, nil
+}
+
+// String は解析前の式を返します
+func (x *Expr) String() string {
+	return x.text
+}
+
+// Eval は式を計算し、結果と振ったダイスを返します。ダイスはintn(n)で0からn-1の値を引いて振ります
+func (x *Expr) Eval(intn func(int) int) (float64, []DiceRoll, error) {
+	e := &exprEval{intn: intn}
+	v, err := x.root.eval(e)
+	if err != nil {
+		if ee, ok := err.(*ExprError); ok {
+			ee.Expr = x.text
+		}
+		return 0, e.rolls, err
+	}
+	return v, e.rolls, nil
+}
+
+// String は"4d6kh3: 6, 5, 4, (1)"のように、捨てた出目を括弧に入れて返します
+func (r DiceRoll) String() string {
+	faces := make([]string, 0, len(r.Kept)+len(r.Dropped))
+	for _, v := range r.Kept {
+		faces = append(faces, strconv.Itoa(v))
+	}
+	for _, v := range r.Dropped {
+		faces = append(faces, fmt.Sprintf("(%d)", v))
+	}
+	return fmt.Sprintf("%s: %s", r.Spec, strings.Join(faces, ", "))
+}
+
+// formatNumber は計算結果を表示用の文字列にします
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'g', 12, 64)
+}
+
+// tokenizeExpr はtextを字句に分けます。位置は1から数えた文字の位置です
+func tokenizeExpr(text string, allowDice bool) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case strings.ContainsRune("+-*/%^()", r):
+			tokens = append(tokens, exprToken{kind: r, text: string(r), pos: pos})
+			i++
+			continue
+		case r == '×':
+			tokens = append(tokens, exprToken{kind: '*', text: string(r), pos: pos})
+			i++
+			continue
+		case r == '÷':
+			tokens = append(tokens, exprToken{kind: '/', text: string(r), pos: pos})
+			i++
+			continue
+		}
+
+		rest := string(runes[i:])
+		if allowDice {
+			if m := diceTokenPattern.FindString(rest); m != "" && !startsWithLetter(rest[len(m):]) {
+				tokens = append(tokens, exprToken{kind: 'd', text: m, pos: pos})
+				i += utf8.RuneCountInString(m)
+				continue
+			}
+		}
+		if unicode.IsDigit(r) || r == '.' {
+			j := i
+			for j < len(runes) && (runes[j] >= '0' && runes[j] <= '9' || runes[j] == '.') {
+				j++
+			}
+			if j == i {
+				return nil, &ExprError{Expr: text, Pos: pos, Message: fmt.Sprintf("%qは数字として使えません", string(r))}
+			}
+			tokens = append(tokens, exprToken{kind: 'n', text: string(runes[i:j]), pos: pos})
+			i = j
+			continue
+		}
+		return nil, &ExprError{Expr: text, Pos: pos, Message: fmt.Sprintf("%qは使えない文字です", string(r))}
+	}
+	tokens = append(tokens, exprToken{pos: len(runes) + 1})
+	return tokens, nil
+}
+
+// peek は次の字句を返します
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.i]
+}
+
+// next は次の字句を返して進めます
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.i]
+	if t.kind != 0 {
+		p.i++
+	}
+	return t
+}
+
+// errorf はtの位置のExprErrorを返します
+func (p *exprParser) errorf(t exprToken, format string, a ...interface{}) *ExprError {
+	return &ExprError{Expr: p.text, Pos: t.pos, Message: fmt.Sprintf(format, a...)}
+}
+
+// limitf は式は読めたものの制限を超えたことを表す、位置を持たないExprErrorを返します
+func (p *exprParser) limitf(format string, a ...interface{}) *ExprError {
+	return &ExprError{Expr: p.text, Message: fmt.Sprintf(format, a...)}
+}
+
+// enter は入れ子を1段深くします。exprMaxDepthを超える場合はエラーを返します
+func (p *exprParser) enter() error {
+	p.depth++
+	if p.depth > exprMaxDepth {
+		return p.limitf("入れ子は%d段までです", exprMaxDepth)
+	}
+	return nil
+}
+
+// parseExpr は expr := term (('+' | '-') term)* を解析します
+func (p *exprParser) parseExpr() (exprNode, error) {
+	x, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != '+' && t.kind != '-' {
+			return x, nil
+		}
+		p.next()
+		y, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		x = &exprBinary{op: t.kind, x: x, y: y}
+	}
+}
+
+// parseTerm は term := unary (('*' | '/' | '%') unary)* を解析します
+func (p *exprParser) parseTerm() (exprNode, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != '*' && t.kind != '/' && t.kind != '%' {
+			return x, nil
+		}
+		p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &exprBinary{op: t.kind, x: x, y: y}
+	}
+}
+
+// parseUnary は unary := ('+' | '-') unary | power を解析します
+func (p *exprParser) parseUnary() (exprNode, error) {
+	t := p.peek()
+	if t.kind != '+' && t.kind != '-' {
+		return p.parsePower()
+	}
+	p.next()
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &exprUnary{op: t.kind, x: x}, nil
+}
+
+// parsePower は power := primary ('^' unary)? を解析します。べき乗は右結合です
+func (p *exprParser) parsePower() (exprNode, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != '^' {
+		return x, nil
+	}
+	p.next()
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	y, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &exprBinary{op: '^', x: x, y: y}, nil
+}
+
+// parsePrimary は primary := number | dice | '(' expr ')' を解析します
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case 'n':
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "%qは数字として読めません", t.text)
+		}
+		return exprNumber(v), nil
+	case 'd':
+		return p.parseDice(t)
+	case '(':
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != ')' {
+			return nil, p.errorf(c, "%d文字目の\"(\"に対応する\")\"がありません", t.pos)
+		}
+		return x, nil
+	case 0:
+		return nil, p.errorf(t, "式が途中で終わっています")
+	default:
+		return nil, p.errorf(t, "%qの前に数字が必要です", t.text)
+	}
+}
+
+// parseDice はダイスの字句を解析します
+func (p *exprParser) parseDice(t exprToken) (exprNode, error) {
+	m := diceTokenPattern.FindStringSubmatch(t.text)
+	d := &exprDice{spec: t.text, count: 1, sides: 100}
+
+	if m[1] != "" {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 {
+			return nil, p.limitf("ダイスの個数は1以上です")
+		}
+		d.count = n
+	}
+	if m[2] != "%" {
+		n, err := strconv.Atoi(m[2])
+		if err != nil || n < 1 || n > exprMaxSides {
+			return nil, p.limitf("ダイスの面は1から%dです", exprMaxSides)
+		}
+		d.sides = n
+	}
+
+	p.dice += d.count
+	if p.dice > exprMaxDice {
+		return nil, p.limitf("ダイスは合わせて%d個までです", exprMaxDice)
+	}
+
+	if m[3] != "" {
+		n, err := strconv.Atoi(m[4])
+		if err != nil || n < 1 || n > d.count {
+			return nil, p.limitf("残すダイスは1から%d個です", d.count)
+		}
+		d.keep = m[3]
+		if d.keep == "k" {
+			d.keep = "kh"
+		}
+		d.n = n
+	}
+	return d, nil
+}
+
+// eval は数値を返します
+func (x exprNumber) eval(e *exprEval) (float64, error) {
+	return float64(x), nil
+}
+
+// eval はダイスを振って残した出目の合計を返します
+func (x *exprDice) eval(e *exprEval) (float64, error) {
+	faces := make([]int, x.count)
+	for i := range faces {
+		faces[i] = e.intn(x.sides) + 1
+	}
+
+	roll := DiceRoll{Spec: x.spec, Kept: faces}
+	if x.keep != "" {
+		sorted := append([]int(nil), faces...)
+		if x.keep == "kh" {
+			sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+		} else {
+			sort.Ints(sorted)
+		}
+		roll.Kept, roll.Dropped = sorted[:x.n], sorted[x.n:]
+	}
+	e.rolls = append(e.rolls, roll)
+
+	sum := 0
+	for _, v := range roll.Kept {
+		sum += v
+	}
+	return float64(sum), nil
+}
+
+// eval は符号を適用した値を返します
+func (x *exprUnary) eval(e *exprEval) (float64, error) {
+	v, err := x.x.eval(e)
+	if err != nil {
+		return 0, err
+	}
+	if x.op == '-' {
+		return -v, nil
+	}
+	return v, nil
+}
+
+// eval は二項演算の結果を返します
+func (x *exprBinary) eval(e *exprEval) (float64, error) {
+	a, err := x.x.eval(e)
+	if err != nil {
+		return 0, err
+	}
+	b, err := x.y.eval(e)
+	if err != nil {
+		return 0, err
+	}
+
+	var v float64
+	switch x.op {
+	case '+':
+		v = a + b
+	case '-':
+		v = a - b
+	case '*':
+		v = a * b
+	case '/':
+		if b == 0 {
+			return 0, &ExprError{Message: "0で割ることはできません"}
+		}
+		v = a / b
+	case '%':
+		if b == 0 {
+			return 0, &ExprError{Message: "0で割ることはできません"}
+		}
+		v = math.Mod(a, b)
+	case '^':
+		v = math.Pow(a, b)
+	}
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, &ExprError{Message: "結果が大きすぎるか、数になりません"}
+	}
+	return v, nil
+}
@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExprは式を計算する(t *testing.T) {
+	cases := map[string]string{
+		"(1+2)*3/4":  "2.25",
+		"1 + 2 * 3":  "7",
+		"-2^2":       "-4",
+		"2^3^2":      "512",
+		"10 % 4":     "2",
+		"-(3 - 5)":   "2",
+		"6 ÷ 4 × 2":  "3",
+		"0.1 + 0.2":  "0.3",
+		"1/3":        "0.333333333333",
+		"((((1))))":  "1",
+		"1e3":        "",
+		"1 / 0":      "",
+		"3d6":        "",
+		"(1+2":       "",
+		"1 2":        "",
+		"2 * ":       "",
+		"*2":         "",
+		"1..2":       "",
+		"10^1000":    "",
+		"":           "",
+		"(-1)^0.5":   "",
+		"alert(1)":   "",
+		"1 + 2 + 3 ": "6",
+	}
+	for text, expected := range cases {
+		x, err := ParseExpr(text, false)
+		if err == nil {
+			var v float64
+			v, _, err = x.Eval(func(int) int { return 0 })
+			if err == nil {
+				if actual := formatNumber(v); actual != expected {
+					t.Fatalf("%q expected %s but not, actual %s", text, expected, actual)
+				}
+				continue
+			}
+		}
+		if expected != "" {
+			t.Fatalf("%q: unexpected error %s", text, err)
+		}
+		if _, ok := err.(ReplyError); !ok {
+			t.Fatalf("%q: error expected to be ReplyError but not, actual %#v", text, err)
+		}
+	}
+}
+
+func TestExprはダイスを振る(t *testing.T) {
+	// 出目は6, 1, 5, 2, 4, 3, ...の順に出ます
+	faces := []int{6, 1, 5, 2, 4, 3}
+	cases := []struct {
+		text     string
+		expected string
+		rolls    string
+	}{
+		{"3d6+2", "14", "3d6: 6, 1, 5"},
+		{"4d6kh3", "13", "4d6kh3: 6, 5, 2, (1)"},
+		{"2d20kl1 + d4", "2", "2d20kl1: 1, (6) / d4: 1"},
+		{"d%", "6", "d%: 6"},
+		{"(1d6 + 1d6) * 2", "14", "1d6: 6 / 1d6: 1"},
+	}
+	for _, c := range cases {
+		x, err := ParseExpr(c.text, true)
+		if err != nil {
+			t.Fatalf("%q: unexpected error %s", c.text, err)
+		}
+		i := 0
+		v, rolls, err := x.Eval(func(n int) int {
+			f := faces[i%len(faces)]
+			i++
+			return (f - 1) % n
+		})
+		if err != nil {
+			t.Fatalf("%q: unexpected error %s", c.text, err)
+		}
+		if actual := formatNumber(v); actual != c.expected {
+			t.Fatalf("%q expected %s but not, actual %s", c.text, c.expected, actual)
+		}
+		rs := make([]string, len(rolls))
+		for j, r := range rolls {
+			rs[j] = r.String()
+		}
+		if actual := strings.Join(rs, " / "); actual != c.rolls {
+			t.Fatalf("%q: rolls expected %q but not, actual %q", c.text, c.rolls, actual)
+		}
+	}
+}
+
+func TestParseExprは大きすぎる式をエラーにする(t *testing.T) {
+	cases := map[string]string{
+		"101d6":       "ダイスは合わせて100個までです",
+		"60d6 + 50d6": "ダイスは合わせて100個までです",
+		"d1001":       "ダイスの面は1から1000です",
+		"0d6":         "ダイスの個数は1以上です",
+		"4d6kh5":      "残すダイスは1から4個です",
+		strings.Repeat("(", 40) + "1" + strings.Repeat(")", 40): "入れ子は32段までです",
+		strings.Repeat("-", 40) + "1":                           "入れ子は32段までです",
+		strings.Repeat("1+", 100) + "1":                         "式は200文字までです",
+		"3d6 +":                                                 "式が途中で終わっています",
+		"3d6x":                                                  "\"d\"は使えない文字です",
+	}
+	for text, expected := range cases {
+		_, err := ParseExpr(text, true)
+		if err == nil {
+			t.Fatalf("%q: error expected but not", text)
+		}
+		if actual := err.(*ExprError).Message; actual != expected {
+			t.Fatalf("%q: error expected %q but not, actual %q", text, expected, actual)
+		}
+	}
+}
+
+func TestExprErrorは制限を超えた式に位置を付けずに返信する(t *testing.T) {
+	cases := map[string]string{
+		"1000d6":  "計算できないパカ: ダイスは合わせて100個までです",
+		"d1001":   "計算できないパカ: ダイスの面は1から1000です",
+		"4d6kh5":  "計算できないパカ: 残すダイスは1から4個です",
+		"1 + * 2": "式の5文字目が読めないパカ: \"*\"の前に数字が必要です\n1 + * 2",
+		strings.Repeat("(", 40) + "1" + strings.Repeat(")", 40): "計算できないパカ: 入れ子は32段までです",
+	}
+	for text, expected := range cases {
+		_, err := ParseExpr(text, true)
+		re, ok := err.(ReplyError)
+		if !ok {
+			t.Fatalf("%q: ReplyError expected but not, actual %v", text, err)
+		}
+		if actual := re.ReplyMessage(); actual != expected {
+			t.Fatalf("%q: reply expected %q but not, actual %q", text, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// externalHelloTimeout は接続してからhelloを受け取るまで待つ時間です
+	externalHelloTimeout = 10 * time.Second
+	// externalPingInterval はサーバーからpingを送る間隔です
+	externalPingInterval = 30 * time.Second
+	// externalReadTimeout はこの時間何も受け取らなかった場合に接続を切る時間です
+	externalReadTimeout = 2 * externalPingInterval
+	// externalWriteTimeout は1回の送信のタイムアウトです
+	externalWriteTimeout = 10 * time.Second
+	// externalSendBuffer は送信を待てるフレームの数です。超えた分は捨てます
+	externalSendBuffer = 100
+	// externalResumeLimit は再接続時に送り直すメッセージの最大の数です
+	externalResumeLimit = 100
+	// externalMaxTriggers は1つのbotが宣言できるトリガーの最大の数です
+	externalMaxTriggers = 20
+	// externalMaxBodyLength は返信の本文の最大の文字数です
+	externalMaxBodyLength = 4000
+	// externalQuotaWindow は返信の数を数える期間です
+	externalQuotaWindow = time.Minute
+)
+
+// ExternalFrame の種類です
+const (
+	// FrameHello は接続直後にbotが送る、トリガーと再開位置の宣言です
+	FrameHello = "hello"
+	// FrameWelcome はhelloを受け付けたことを表します
+	FrameWelcome = "welcome"
+	// FrameMessage はトリガーにマッチしたメッセージです。Cursorを次のhelloのResumeFromに使えます
+	FrameMessage = "message"
+	// FrameReply はbotからの返信です
+	FrameReply = "reply"
+	// FramePing はbotからの生存確認です。サーバーはFramePongを返します
+	FramePing = "ping"
+	// FramePong はFramePingへの応答です
+	FramePong = "pong"
+	// FrameError はエラーです
+	FrameError = "error"
+)
+
+type (
+	// ExternalBotHub はWebSocketで接続した外部のbotをMulticasterに登録し、返信をoutに渡します
+	//
+	// 同じbotが接続し直した場合は古い接続を切ります
+	// 返信の数はbotのIDごとに数えるので、接続し直しても制限は続きます
+	//
+	//   fields
+	//     messages    model.MessageStore
+	//     multicaster *Multicaster
+	//     out         chan *model.Message
+	//     now         func() time.Time
+	//     mu          sync.Mutex
+	//     sessions    map[string]*externalSession
+	//     replied     map[int64][]time.Time
+	ExternalBotHub struct {
+		messages    model.MessageStore
+		multicaster *Multicaster
+		out         chan *model.Message
+		now         func() time.Time
+		mu          sync.Mutex
+		sessions    map[string]*externalSession
+		replied     map[int64][]time.Time
+	}
+
+	// ExternalFrame は外部のbotとやりとりするJSONのフレームです
+	//
+	// Typeによって使うフィールドが決まります
+	//   hello:   Triggers, Channels, ResumeFrom (bot -> サーバー)
+	//   welcome: Bot, Quota, Cursor (サーバー -> bot)
+	//   message: Message, Matches, Cursor (サーバー -> bot)
+	//   reply:   Body, Channel (bot -> サーバー)
+	//   ping, pong
+	//   error:   Error
+	ExternalFrame struct {
+		Type       string         `json:"type"`
+		Triggers   []string       `json:"triggers,omitempty"`
+		Channels   []string       `json:"channels,omitempty"`
+		ResumeFrom int64          `json:"resume_from,omitempty"`
+		Bot        string         `json:"bot,omitempty"`
+		Quota      int            `json:"quota,omitempty"`
+		Message    *model.Message `json:"message,omitempty"`
+		Matches    []string       `json:"matches,omitempty"`
+		Cursor     int64          `json:"cursor,omitempty"`
+		Body       string         `json:"body,omitempty"`
+		Channel    string         `json:"channel,omitempty"`
+		Error      string         `json:"error,omitempty"`
+	}
+
+	// externalSession は1つの接続です。MatchProcessorとしてマッチしたメッセージを送信待ちに入れます
+	//
+	//   fields
+	//     hub     *ExternalBotHub
+	//     bot     *model.ExternalBot
+	//     conn    *websocket.Conn
+	//     checker Checker
+	//     send    chan *ExternalFrame
+	//     cancel  context.CancelFunc
+	externalSession struct {
+		hub     *ExternalBotHub
+		bot     *model.ExternalBot
+		conn    *websocket.Conn
+		checker Checker
+		send    chan *ExternalFrame
+		cancel  context.CancelFunc
+	}
+)
+
+// Serve はconnをebとして扱い、接続が切れるかctxが終了するまでメッセージを中継します
+//
+// 最初のフレームはhelloでなければなりません
+func (h *ExternalBotHub) Serve(ctx context.Context, conn *websocket.Conn, eb *model.ExternalBot) error {
+	defer conn.Close()
+
+	hello, checker, err := h.hello(conn, eb)
+	if err != nil {
+		conn.SetWriteDeadline(time.Now().Add(externalWriteTimeout))
+		conn.WriteJSON(&ExternalFrame{Type: FrameError, Error: err.Error()})
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s := &externalSession{
+		hub:     h,
+		bot:     eb,
+		conn:    conn,
+		checker: checker,
+		send:    make(chan *ExternalFrame, externalSendBuffer),
+		cancel:  cancel,
+	}
+	h.attach(s)
+	defer h.detach(s)
+
+	b := &Bot{
+		name:      "external:" + eb.Name,
+		in:        make(chan *model.Message),
+		out:       h.out,
+		checker:   checker,
+		processor: s,
+	}
+	botCtx, botCancel := context.WithCancel(context.Background())
+	go b.Run(botCtx)
+	select {
+	case h.multicaster.BotIn <- b:
+	case <-ctx.Done():
+		botCancel()
+		return ctx.Err()
+	}
+	defer func() {
+		// 登録を解除してからでないとMulticasterが閉じたinに送ってしまうので、解除できるまで待ってから止めます
+		// Multicasterが忙しくても接続の後片付けを待たせないように、別のgoroutineで待ちます
+		go func() {
+			h.multicaster.BotOut <- b
+			botCancel()
+		}()
+	}()
+
+	go s.writeLoop(ctx, hello.ResumeFrom)
+	return s.readLoop(ctx)
+}
+
+// Disconnect はnameのbotの接続を切ります
+func (h *ExternalBotHub) Disconnect(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, ok := h.sessions[name]; ok {
+		s.close()
+		delete(h.sessions, name)
+	}
+}
+
+// hello はhelloフレームを受け取り、トリガーからCheckerを作ります
+func (h *ExternalBotHub) hello(conn *websocket.Conn, eb *model.ExternalBot) (*ExternalFrame, Checker, error) {
+	conn.SetReadDeadline(time.Now().Add(externalHelloTimeout))
+	var f ExternalFrame
+	if err := conn.ReadJSON(&f); err != nil {
+		return nil, nil, err
+	}
+	if f.Type != FrameHello {
+		return nil, nil, errors.New("first frame must be hello")
+	}
+	if len(f.Triggers) == 0 || len(f.Triggers) > externalMaxTriggers {
+		return nil, nil, fmt.Errorf("triggers must have 1 to %d patterns", externalMaxTriggers)
+	}
+
+	triggers := make([]Checker, len(f.Triggers))
+	for i, t := range f.Triggers {
+		re, err := regexp.Compile(t)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid trigger %q: %s", t, err)
+		}
+		triggers[i] = &RegexpChecker{regexp: re}
+	}
+
+	// 自分の返信には反応しないようにします
+	checkers := []Checker{Or(triggers...), NewUserDenyChecker(eb.Name)}
+	if len(f.Channels) > 0 {
+		checkers = append(checkers, NewChannelChecker(f.Channels...))
+	}
+	return &f, And(checkers...), nil
+}
+
+// attach はsを登録し、同じbotの古い接続を切ります
+func (h *ExternalBotHub) attach(s *externalSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if old, ok := h.sessions[s.bot.Name]; ok {
+		old.close()
+	}
+	h.sessions[s.bot.Name] = s
+}
+
+// detach はsがまだ登録されていれば登録を解除します
+func (h *ExternalBotHub) detach(s *externalSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.sessions[s.bot.Name] == s {
+		delete(h.sessions, s.bot.Name)
+	}
+}
+
+// allowReply はebの直近externalQuotaWindowの返信の数がQuotaより少なければ、今の返信を数えてnilを返します
+func (h *ExternalBotHub) allowReply(eb *model.ExternalBot) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	var recent []time.Time
+	for _, t := range h.replied[eb.ID] {
+		if now.Sub(t) < externalQuotaWindow {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= eb.Quota {
+		h.replied[eb.ID] = recent
+		return fmt.Errorf("quota exceeded: %d replies per minute", eb.Quota)
+	}
+	h.replied[eb.ID] = append(recent, now)
+	return nil
+}
+
+// Process はmessageを送信待ちに入れます
+func (s *externalSession) Process(message *model.Message) (*model.Message, error) {
+	return s.ProcessMatch(message, nil)
+}
+
+// ProcessMatch はmessageとトリガーのキャプチャを送信待ちに入れます。返信は非同期に届くので、nilを返します
+func (s *externalSession) ProcessMatch(message *model.Message, groups []string) (*model.Message, error) {
+	s.push(&ExternalFrame{
+		Type:    FrameMessage,
+		Message: message,
+		Matches: groups,
+		Cursor:  message.ID,
+	})
+	return nil, nil
+}
+
+// push はfを送信待ちに入れます。いっぱいの場合は捨てます
+func (s *externalSession) push(f *ExternalFrame) {
+	select {
+	case s.send <- f:
+	default:
+	}
+}
+
+// close は接続を切ります
+func (s *externalSession) close() {
+	s.cancel()
+	s.conn.Close()
+}
+
+// readLoop はbotからのフレームを受け取ります
+func (s *externalSession) readLoop(ctx context.Context) error {
+	extend := func() {
+		s.conn.SetReadDeadline(time.Now().Add(externalReadTimeout))
+	}
+	extend()
+	s.conn.SetPongHandler(func(string) error {
+		extend()
+		return nil
+	})
+
+	for {
+		var f ExternalFrame
+		if err := s.conn.ReadJSON(&f); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		extend()
+
+		switch f.Type {
+		case FramePing:
+			s.push(&ExternalFrame{Type: FramePong})
+		case FrameReply:
+			if err := s.reply(&f); err != nil {
+				s.push(&ExternalFrame{Type: FrameError, Error: err.Error()})
+			}
+		default:
+			s.push(&ExternalFrame{Type: FrameError, Error: fmt.Sprintf("unknown frame type %q", f.Type)})
+		}
+	}
+}
+
+// reply は返信を投稿します。1分間の返信の数がQuotaを超える場合はエラーを返します
+func (s *externalSession) reply(f *ExternalFrame) error {
+	n := utf8.RuneCountInString(f.Body)
+	if n == 0 || n > externalMaxBodyLength {
+		return fmt.Errorf("body must have 1 to %d characters", externalMaxBodyLength)
+	}
+
+	if err := s.hub.allowReply(s.bot); err != nil {
+		return err
+	}
+
+	s.hub.out <- &model.Message{
+		Body:     f.Body,
+		UserName: s.bot.Name,
+		Channel:  f.Channel,
+	}
+	return nil
+}
+
+// writeLoop はwelcomeと、resumeFromより後のメッセージを送った後、送信待ちのフレームとpingを送ります
+func (s *externalSession) writeLoop(ctx context.Context, resumeFrom int64) {
+	defer s.close()
+
+	if err := s.write(&ExternalFrame{Type: FrameWelcome, Bot: s.bot.Name, Quota: s.bot.Quota, Cursor: resumeFrom}); err != nil {
+		return
+	}
+
+	cursor, err := s.resume(resumeFrom)
+	if err != nil {
+		s.write(&ExternalFrame{Type: FrameError, Error: err.Error()})
+		return
+	}
+
+	ticker := time.NewTicker(externalPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(externalWriteTimeout))
+			return
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(externalWriteTimeout)); err != nil {
+				return
+			}
+		case f := <-s.send:
+			// 送り直したメッセージは重ねて送りません
+			if f.Type == FrameMessage && f.Cursor <= cursor {
+				continue
+			}
+			if err := s.write(f); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// resume はresumeFromより後のメッセージのうちトリガーにマッチするものを送り、最後に確認したメッセージのIDを返します
+//
+// resumeFromが0の場合は何も送りません
+func (s *externalSession) resume(resumeFrom int64) (int64, error) {
+	if resumeFrom <= 0 {
+		return 0, nil
+	}
+
+	ms, err := s.hub.messages.AfterID(resumeFrom, externalResumeLimit)
+	if err != nil {
+		return 0, err
+	}
+	cursor := resumeFrom
+	for _, m := range ms {
+		cursor = m.ID
+		groups, ok := match(s.checker, m)
+		if !ok {
+			continue
+		}
+		if err := s.write(&ExternalFrame{Type: FrameMessage, Message: m, Matches: groups, Cursor: m.ID}); err != nil {
+			return 0, err
+		}
+	}
+	if len(ms) == externalResumeLimit {
+		s.write(&ExternalFrame{Type: FrameError, Error: fmt.Sprintf("resume is limited to %d messages", externalResumeLimit), Cursor: cursor})
+	}
+	return cursor, nil
+}
+
+// write はfを送信します
+func (s *externalSession) write(f *ExternalFrame) error {
+	s.conn.SetWriteDeadline(time.Now().Add(externalWriteTimeout))
+	return s.conn.WriteJSON(f)
+}
+
+// NewExternalBotHub は新しいExternalBotHub構造体のポインタを返します
+func NewExternalBotHub(messages model.MessageStore, multicaster *Multicaster, out chan *model.Message) *ExternalBotHub {
+	return &ExternalBotHub{
+		messages:    messages,
+		multicaster: multicaster,
+		out:         out,
+		now:         time.Now,
+		sessions:    map[string]*externalSession{},
+		replied:     map[int64][]time.Time{},
+	}
+}
@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gorilla/websocket"
+)
+
+func TestExternalBotHubは再開位置から送り直し返信の数を制限する(t *testing.T) {
+	messages := model.NewMemoryMessageStore(
+		&model.Message{Body: "deploy web", UserName: "alice"},
+		&model.Message{Body: "deploy api", UserName: "alice"},
+		&model.Message{Body: "hello", UserName: "bob"},
+		&model.Message{Body: "deploy done", UserName: "deployer"},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := make(chan *model.Message)
+	mc := NewMulticaster(stream)
+	go mc.Run(ctx)
+	out := make(chan *model.Message, 10)
+	hub := NewExternalBotHub(messages, mc, out)
+
+	eb := &model.ExternalBot{ID: 1, Name: "deployer", Quota: 1}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade: %s", err)
+			return
+		}
+		hub.Serve(ctx, conn, eb)
+	}))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	read := func() *ExternalFrame {
+		var f ExternalFrame
+		if err := conn.ReadJSON(&f); err != nil {
+			t.Fatalf("failed to read frame: %s", err)
+		}
+		return &f
+	}
+
+	if err := conn.WriteJSON(&ExternalFrame{Type: FrameHello, Triggers: []string{`\Adeploy (\w+)\z`}, ResumeFrom: 1}); err != nil {
+		t.Fatalf("failed to write hello: %s", err)
+	}
+	if f := read(); f.Type != FrameWelcome || f.Bot != "deployer" || f.Quota != 1 {
+		t.Fatalf("welcome expected but not, actual %+v", f)
+	}
+
+	// id 1は再開位置より前、id 3はトリガーにマッチせず、id 4は自分の投稿なので送りません
+	f := read()
+	if f.Type != FrameMessage || f.Cursor != 2 || f.Message.Body != "deploy api" || len(f.Matches) != 2 || f.Matches[1] != "api" {
+		t.Fatalf("replayed message 2 expected but not, actual %+v", f)
+	}
+
+	stream <- &model.Message{ID: 5, Body: "deploy db", UserName: "carol"}
+	if f := read(); f.Type != FrameMessage || f.Cursor != 5 || f.Matches[1] != "db" {
+		t.Fatalf("live message 5 expected but not, actual %+v", f)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := conn.WriteJSON(&ExternalFrame{Type: FrameReply, Body: "ok"}); err != nil {
+			t.Fatalf("failed to write reply: %s", err)
+		}
+	}
+	select {
+	case m := <-out:
+		if m.Body != "ok" || m.UserName != "deployer" {
+			t.Fatalf("reply from deployer expected but not, actual %+v", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reply expected but not")
+	}
+	if f := read(); f.Type != FrameError || !strings.Contains(f.Error, "quota") {
+		t.Fatalf("quota error expected but not, actual %+v", f)
+	}
+	select {
+	case m := <-out:
+		t.Fatalf("reply over quota expected to be dropped but not, actual %+v", m)
+	default:
+	}
+
+	// 接続し直しても返信の数はリセットされません
+	conn.Close()
+	conn, _, err = websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.WriteJSON(&ExternalFrame{Type: FrameHello, Triggers: []string{`\Adeploy`}}); err != nil {
+		t.Fatalf("failed to write hello: %s", err)
+	}
+	if f := read(); f.Type != FrameWelcome {
+		t.Fatalf("welcome expected but not, actual %+v", f)
+	}
+	if err := conn.WriteJSON(&ExternalFrame{Type: FrameReply, Body: "ok again"}); err != nil {
+		t.Fatalf("failed to write reply: %s", err)
+	}
+	if f := read(); f.Type != FrameError || !strings.Contains(f.Error, "quota") {
+		t.Fatalf("quota error after reconnect expected but not, actual %+v", f)
+	}
+	select {
+	case m := <-out:
+		t.Fatalf("reply over quota expected to be dropped but not, actual %+v", m)
+	default:
+	}
+}
@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+const (
+	// karmaVoteInterval は同じユーザーが同じ相手に続けて投票できるまでの間隔です
+	karmaVoteInterval = time.Hour
+	// karmaTopLimit は"karma top"で表示する人数です
+	karmaTopLimit = 10
+	// karmaReasonLimit は"karma alice"で表示する理由の件数です
+	karmaReasonLimit = 5
+)
+
+// karmaPattern は"alice++ for fixing CI", "@bob--", "karma top", "karma alice", "karma @top"にマッチします
+//
+// 名前には空白と"@", "+"を含められず、"-"で終わることもできません。"@"があったかどうかもキャプチャします
+var karmaPattern = regexp.MustCompile(`\A(?:(@?)([^\s@+\-](?:[^\s@+]*[^\s@+\-])?)(\+\+|--)(?:\s+(.*))?|karma(?:\s+(@?)(\S+))?)\z`)
+
+type (
+	// KarmaProcessor は"alice++"で投票を受け付け、"karma top", "karma alice"でスコアを返すprocessorの構造体です
+	//
+	//   fields
+	//     db  *sql.DB
+	//     now func() time.Time
+	KarmaProcessor struct {
+		db  *sql.DB
+		now func() time.Time
+	}
+)
+
+// Process はmessageに対して投票を受け付けるか、スコアを返します
+func (p *KarmaProcessor) Process(message *model.Message) (*model.Message, error) {
+	return p.ProcessMatch(message, karmaPattern.FindStringSubmatch(message.Body))
+}
+
+// ProcessMatch はkarmaPatternでキャプチャした文字列から投票を受け付けるか、スコアを返します
+func (p *KarmaProcessor) ProcessMatch(message *model.Message, groups []string) (*model.Message, error) {
+	if len(groups) < 7 {
+		return nil, nil
+	}
+	if groups[3] != "" {
+		return p.vote(message.UserName, groups[2], groups[3], groups[4], groups[1] != "")
+	}
+
+	// "karma @top"は"top"という名前のユーザーのスコアを返します
+	switch {
+	case groups[6] == "top" && groups[5] == "":
+		return p.top()
+	case groups[6] == "":
+		return p.show(message.UserName)
+	default:
+		return p.show(groups[6])
+	}
+}
+
+// vote はgiverからtargetへの投票を受け付けます
+//
+// "c++"のような言葉を投票にしないため、mentionedがfalseの場合はメッセージを投稿したことのあるユーザーへの投票だけを受け付けます
+func (p *KarmaProcessor) vote(giver, target, op, reason string, mentioned bool) (*model.Message, error) {
+	if !mentioned {
+		ok, err := model.MessageUserNameExists(p.db, target)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, nil
+		}
+	}
+	if giver == target {
+		return p.reply("自分のkarmaは変えられないパカ")
+	}
+
+	delta := 1
+	if op == "--" {
+		delta = -1
+	}
+	for _, prefix := range []string{"for ", "because "} {
+		if strings.HasPrefix(strings.ToLower(reason), prefix) {
+			reason = reason[len(prefix):]
+			break
+		}
+	}
+
+	v := &model.KarmaVote{
+		Giver:   giver,
+		Target:  target,
+		Delta:   delta,
+		Reason:  strings.TrimSpace(reason),
+		VotedAt: p.now(),
+	}
+	if _, err := v.Insert(p.db, karmaVoteInterval); err != nil {
+		if err == model.ErrKarmaVotedRecently {
+			return p.reply(fmt.Sprintf("%sさんへの投票は1時間に1回までパカ", target))
+		}
+		return nil, err
+	}
+
+	k, err := model.KarmaByUserName(p.db, target)
+	if err != nil {
+		return nil, err
+	}
+	verb := "上がった"
+	if delta < 0 {
+		verb = "下がった"
+	}
+	return p.reply(fmt.Sprintf("%sさんのkarmaが%sパカ (%d)", target, verb, k.Score))
+}
+
+// show はusernameのスコアと最近の理由を返します
+func (p *KarmaProcessor) show(username string) (*model.Message, error) {
+	k, err := model.KarmaByUserName(p.db, username)
+	if err != nil {
+		return nil, err
+	}
+	vs, err := model.KarmaVotesWithReasonByTarget(p.db, username, karmaReasonLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{fmt.Sprintf("%sさんのkarmaは%dパカ (++%d / --%d)", username, k.Score, k.Plus, k.Minus)}
+	for _, v := range vs {
+		op := "++"
+		if v.Delta < 0 {
+			op = "--"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s (%sさんから)", op, v.Reason, v.Giver))
+	}
+	return p.reply(strings.Join(lines, "\n"))
+}
+
+// top はスコアの高い順のランキングを返します
+func (p *KarmaProcessor) top() (*model.Message, error) {
+	ks, err := model.KarmaTop(p.db, karmaTopLimit)
+	if err != nil {
+		return nil, err
+	}
+	if len(ks) == 0 {
+		return p.reply("まだ誰もkarmaをもらっていないパカ")
+	}
+
+	lines := []string{"karmaランキング"}
+	for i, k := range ks {
+		lines = append(lines, fmt.Sprintf("%d. %s %d", i+1, k.UserName, k.Score))
+	}
+	return p.reply(strings.Join(lines, "\n"))
+}
+
+// reply はbodyを本文にしたbotの投稿用メッセージを返します
+func (p *KarmaProcessor) reply(body string) (*model.Message, error) {
+	return &model.Message{
+		Body:     body,
+		UserName: "bot",
+	}, nil
+}
@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestKarmaProcessorは1時間に1回だけ投票を受け付ける(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE karma (id INTEGER NOT NULL PRIMARY KEY, giver TEXT NOT NULL DEFAULT "", target TEXT NOT NULL DEFAULT "", delta INTEGER NOT NULL DEFAULT 0, reason TEXT NOT NULL DEFAULT "", voted_at INTEGER NOT NULL DEFAULT 0)`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	if _, err := db.Exec(`CREATE TABLE message (id INTEGER NOT NULL PRIMARY KEY, body TEXT NOT NULL DEFAULT "", username TEXT NOT NULL DEFAULT "", channel TEXT NOT NULL DEFAULT "", version INTEGER NOT NULL DEFAULT 1)`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	for _, username := range []string{"alice", "bob", "carol"} {
+		if _, err := (&model.Message{Body: "hello", UserName: username}).Insert(db); err != nil {
+			t.Fatalf("failed to insert message: %s", err)
+		}
+	}
+
+	now := time.Date(2018, 4, 22, 10, 0, 0, 0, time.UTC)
+	p := &KarmaProcessor{db: db, now: func() time.Time { return now }}
+
+	cases := []struct {
+		username string
+		body     string
+		after    time.Duration
+		expected string
+	}{
+		{"bob", "alice++ for fixing CI", 0, "aliceさんのkarmaが上がったパカ (1)"},
+		{"bob", "@alice++", 30 * time.Minute, "aliceさんへの投票は1時間に1回までパカ"},
+		{"carol", "alice--", 0, "aliceさんのkarmaが下がったパカ (0)"},
+		{"alice", "alice++", 0, "自分のkarmaは変えられないパカ"},
+		{"bob", "alice++ レビューありがとう", time.Hour, "aliceさんのkarmaが上がったパカ (1)"},
+		{"alice", "@the-bot++", 0, "the-botさんのkarmaが上がったパカ (1)"},
+		{"alice", "karma top", 0, "karmaランキング\n1. alice 1\n2. the-bot 1"},
+		{"bob", "karma alice", 0, "aliceさんのkarmaは1パカ (++2 / --1)\n++ レビューありがとう (bobさんから)\n++ fixing CI (bobさんから)"},
+		{"dave", "karma", 0, "daveさんのkarmaは0パカ (++0 / --0)"},
+		{"alice", "@top++", 0, "topさんのkarmaが上がったパカ (1)"},
+		{"bob", "karma @top", 0, "topさんのkarmaは1パカ (++1 / --0)"},
+	}
+	for _, c := range cases {
+		now = now.Add(c.after)
+		m := &model.Message{Body: c.body, UserName: c.username}
+		groups, ok := match(&RegexpChecker{regexp: karmaPattern}, m)
+		if !ok {
+			t.Fatalf("%q expected to match but not", c.body)
+		}
+		actual, err := p.ProcessMatch(m, groups)
+		if err != nil {
+			t.Fatalf("%q: unexpected error %s", c.body, err)
+		}
+		if actual.Body != c.expected {
+			t.Fatalf("%q: expected %q but not, actual %q", c.body, c.expected, actual.Body)
+		}
+	}
+
+	// メッセージを投稿したことのない名前は"@"がなければ投票になりません
+	for _, body := range []string{"c++", "c++ is fast", "go--"} {
+		m := &model.Message{Body: body, UserName: "bob"}
+		groups, ok := match(&RegexpChecker{regexp: karmaPattern}, m)
+		if !ok {
+			t.Fatalf("%q expected to match but not", body)
+		}
+		if actual, err := p.ProcessMatch(m, groups); err != nil || actual != nil {
+			t.Fatalf("%q: no reply expected but not, actual %v, %v", body, actual, err)
+		}
+	}
+	if k, err := model.KarmaByUserName(db, "c"); err != nil || k.Plus != 0 {
+		t.Fatalf("no vote for c expected but not, actual %+v, %v", k, err)
+	}
+
+	for _, body := range []string{"alice+++", "alice ++", "karma top 10", "++"} {
+		if karmaPattern.MatchString(body) {
+			t.Fatalf("%q expected not to match but matched", body)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+// kvListMaxLimit はKV.Listで返せる最大の件数です
+const kvListMaxLimit = 1000
+
+type (
+	// KV は1つのbotの名前空間に分けられたキーバリューストアです
+	//
+	// 状態を持つprocessorは、自分のテーブルを作る代わりにNewKVで作ったKVを受け取って使えます
+	//
+	//   fields
+	//     db        *sql.DB
+	//     namespace string
+	//     now       func() time.Time
+	KV struct {
+		db        *sql.DB
+		namespace string
+		now       func() time.Time
+	}
+)
+
+// Get はkeyの値を返します。ないか期限が切れている場合はfalseを返します
+func (kv *KV) Get(key string) (string, bool, error) {
+	v, err := model.KVGet(kv.db, kv.namespace, key, kv.now())
+	switch {
+	case err == sql.ErrNoRows:
+		return "", false, nil
+	case err != nil:
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+// Set はkeyに値を保存します。ttlが0の場合は期限がありません
+func (kv *KV) Set(key, value string, ttl time.Duration) error {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = kv.now().Add(ttl)
+	}
+	return model.KVSet(kv.db, kv.namespace, key, value, expiresAt)
+}
+
+// Delete はkeyを削除します
+func (kv *KV) Delete(key string) error {
+	return model.KVDelete(kv.db, kv.namespace, key)
+}
+
+// Incr はkeyの整数の値にdeltaを不可分に足し、足した後の値を返します。keyがない場合は0に足します
+//
+// 整数でない値の場合はmodel.ErrKVNotIntegerを返します
+func (kv *KV) Incr(key string, delta int64) (int64, error) {
+	return model.KVIncr(kv.db, kv.namespace, key, delta, kv.now())
+}
+
+// List はprefixで始まるkeyの値をkeyの順に最大limit件返します。limitはkvListMaxLimitまでです
+func (kv *KV) List(prefix string, limit int) ([]*model.KVEntry, error) {
+	if limit <= 0 || limit > kvListMaxLimit {
+		limit = kvListMaxLimit
+	}
+	return model.KVList(kv.db, kv.namespace, prefix, limit, kv.now())
+}
+
+// NewKV はdbに保存する、namespaceの新しいKV構造体のポインタを返します
+func NewKV(db *sql.DB, namespace string) *KV {
+	return &KV{
+		db:        db,
+		namespace: namespace,
+		now:       time.Now,
+	}
+}
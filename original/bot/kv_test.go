@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestKVは名前空間ごとに値を保存し期限が切れたら返さない(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file:kvtest?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE bot_kv (namespace TEXT NOT NULL, key TEXT NOT NULL, value TEXT NOT NULL DEFAULT "", expires_at INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (namespace, key))`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+
+	now := time.Date(2018, 4, 22, 10, 0, 0, 0, time.UTC)
+	gacha := NewKV(db, "gacha")
+	gacha.now = func() time.Time { return now }
+	quiz := NewKV(db, "quiz")
+	quiz.now = gacha.now
+
+	for k, v := range map[string]string{"alice:ssr": "1", "alice:sr": "3", "bob:sr": "2"} {
+		if err := gacha.Set(k, v, 0); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+	}
+	if err := gacha.Set("alice:temp", "x", time.Minute); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if _, ok, _ := quiz.Get("alice:ssr"); ok {
+		t.Fatal("value in another namespace expected to be hidden but not")
+	}
+
+	es, err := gacha.List("alice:", 10)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(es) != 3 || es[0].Key != "alice:sr" || es[1].Key != "alice:ssr" || es[2].Key != "alice:temp" {
+		t.Fatalf("3 entries of alice expected but not, actual %+v", es)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := gacha.Get("alice:temp"); ok {
+		t.Fatal("expired value expected to be hidden but not")
+	}
+	if es, _ := gacha.List("alice:", 10); len(es) != 2 {
+		t.Fatalf("2 entries expected after expiry but not, actual %+v", es)
+	}
+	if n, err := model.KVDeleteExpired(db, now); err != nil || n != 1 {
+		t.Fatalf("1 expired value expected to be deleted but not, actual %d, %v", n, err)
+	}
+
+	if err := gacha.Delete("bob:sr"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if _, ok, _ := gacha.Get("bob:sr"); ok {
+		t.Fatal("deleted value expected to be hidden but not")
+	}
+	if _, err := gacha.Incr("alice:temp", 1); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if err := gacha.Set("alice:name", "alice", 0); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if _, err := gacha.Incr("alice:name", 1); err != model.ErrKVNotInteger {
+		t.Fatalf("ErrKVNotInteger expected but not, actual %v", err)
+	}
+}
+
+func TestKVのIncrは同時に呼んでも数え漏らさない(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file:kvincrtest?mode=memory&cache=shared&_busy_timeout=5000")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE bot_kv (namespace TEXT NOT NULL, key TEXT NOT NULL, value TEXT NOT NULL DEFAULT "", expires_at INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (namespace, key))`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+
+	kv := NewKV(db, "karma")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := kv.Incr("alice", 1); err != nil {
+					t.Errorf("unexpected error %s", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _, _ := kv.Get("alice"); v != "100" {
+		t.Fatalf("100 expected but not, actual %q", v)
+	}
+}
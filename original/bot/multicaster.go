@@ -10,16 +10,18 @@ import (
 //
 // msgInで受け取ったmessageをbotsに登録された全botに渡します
 //
-// botsへの登録はBotInで行います
+// botsへの登録はBotInで、登録の解除はBotOutで行います
 //
 //   fields
-// 	   BotIn chan *Bot
-// 	   bots  map[*Bot]bool
-// 	   msgIn chan *model.Message
+// 	   BotIn  chan *Bot
+// 	   BotOut chan *Bot
+// 	   bots   []*Bot
+// 	   msgIn  chan *model.Message
 type Multicaster struct {
-	BotIn chan *Bot
-	bots  []*Bot
-	msgIn chan *model.Message
+	BotIn  chan *Bot
+	BotOut chan *Bot
+	bots   []*Bot
+	msgIn  chan *model.Message
 }
 
 // Run はMulticasterを起動します
@@ -31,6 +33,13 @@ func (mc *Multicaster) Run(ctx context.Context) {
 			return
 		case bot := <-mc.BotIn:
 			mc.bots = append(mc.bots, bot)
+		case bot := <-mc.BotOut:
+			for i, b := range mc.bots {
+				if b == bot {
+					mc.bots = append(mc.bots[:i], mc.bots[i+1:]...)
+					break
+				}
+			}
 		case msg := <-mc.msgIn:
 			for _, bot := range mc.bots {
 				bot.in <- msg
@@ -42,9 +51,11 @@ func (mc *Multicaster) Run(ctx context.Context) {
 // NewMulticaster は新しいMulticaster構造体のポインタを返します
 func NewMulticaster(msgIn chan *model.Message) *Multicaster {
 	memberIn := make(chan *Bot)
+	memberOut := make(chan *Bot)
 	return &Multicaster{
-		BotIn: memberIn,
-		bots:  []*Bot{},
-		msgIn: msgIn,
+		BotIn:  memberIn,
+		BotOut: memberOut,
+		bots:   []*Bot{},
+		msgIn:  msgIn,
 	}
 }
@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const omikujiDateLayout = "2006-01-02"
+
+type (
+	// OmikujiTable はおみくじの結果を組み立てるための表です
+	//
+	// yamlから読み込むことで内容を差し替えられます
+	OmikujiTable struct {
+		Fortunes   []string          `yaml:"fortunes"`
+		Items      []string          `yaml:"items"`
+		Colors     []string          `yaml:"colors"`
+		Categories []OmikujiCategory `yaml:"categories"`
+	}
+
+	// OmikujiCategory は"恋愛", "仕事"などの項目と、その項目に書かれる文言の候補です
+	OmikujiCategory struct {
+		Name    string   `yaml:"name"`
+		Sayings []string `yaml:"sayings"`
+	}
+
+	// Fortune は1回分のおみくじの結果です
+	Fortune struct {
+		Fortune    string
+		Item       string
+		Color      string
+		Categories []FortuneCategory
+	}
+
+	// FortuneCategory はおみくじの結果のうち1項目分です
+	FortuneCategory struct {
+		Name   string
+		Saying string
+	}
+)
+
+// DefaultOmikujiTable は設定ファイルを指定しない場合に使われるおみくじの表です
+var DefaultOmikujiTable = &OmikujiTable{
+	Fortunes: []string{"大吉", "吉", "中吉", "小吉", "末吉", "凶"},
+	Items:    []string{"傘", "ハンカチ", "腕時計", "手帳", "イヤホン", "マグカップ", "付箋"},
+	Colors:   []string{"赤", "青", "黄", "緑", "白", "黒", "紫"},
+	Categories: []OmikujiCategory{
+		{Name: "恋愛", Sayings: []string{"思いが通じる", "焦らず待て", "身近な人を大切に", "言葉にすれば叶う"}},
+		{Name: "仕事", Sayings: []string{"努力が実る", "慎重に進めよ", "周りを頼れ", "新しいことに挑め"}},
+		{Name: "健康", Sayings: []string{"心配なし", "睡眠をとれ", "食事に気をつけよ", "体を動かせ"}},
+	},
+}
+
+// Draw はusernameとdateの日付から決まるおみくじの結果を返します
+//
+// 同じユーザーが同じ日に何度引いても同じ結果になります
+func (t *OmikujiTable) Draw(username string, date time.Time) *Fortune {
+	h := fnv.New64a()
+	io.WriteString(h, username+"\x00"+date.Format(omikujiDateLayout))
+	r := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	f := &Fortune{
+		Fortune: t.Fortunes[r.Intn(len(t.Fortunes))],
+		Item:    t.Items[r.Intn(len(t.Items))],
+		Color:   t.Colors[r.Intn(len(t.Colors))],
+	}
+	for _, c := range t.Categories {
+		f.Categories = append(f.Categories, FortuneCategory{
+			Name:   c.Name,
+			Saying: c.Sayings[r.Intn(len(c.Sayings))],
+		})
+	}
+	return f
+}
+
+// Validate は表から結果を組み立てられるか検証します
+func (t *OmikujiTable) Validate() error {
+	switch {
+	case len(t.Fortunes) == 0:
+		return errors.New("omikuji: fortunes is empty")
+	case len(t.Items) == 0:
+		return errors.New("omikuji: items is empty")
+	case len(t.Colors) == 0:
+		return errors.New("omikuji: colors is empty")
+	}
+	for _, c := range t.Categories {
+		if len(c.Sayings) == 0 {
+			return fmt.Errorf("omikuji: sayings of %s is empty", c.Name)
+		}
+	}
+	return nil
+}
+
+// String はおみくじの結果を投稿用の文章にします
+func (f *Fortune) String() string {
+	lines := []string{
+		f.Fortune,
+		"ラッキーアイテム：" + f.Item,
+		"ラッキーカラー：" + f.Color,
+	}
+	for _, c := range f.Categories {
+		lines = append(lines, c.Name+"："+c.Saying)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NewOmikujiTableFromFile はファイルパスから新しいOmikujiTableを返します
+func NewOmikujiTableFromFile(path string) (*OmikujiTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewOmikujiTable(f)
+}
+
+// NewOmikujiTable はyamlを読み込んで新しいOmikujiTableを返します
+func NewOmikujiTable(r io.Reader) (*OmikujiTable, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var t OmikujiTable
+	if err = yaml.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+	if err = t.Validate(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
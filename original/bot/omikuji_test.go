@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOmikujiTableは同じユーザーと日付なら同じ結果を返す(t *testing.T) {
+	day := time.Date(2018, 4, 22, 9, 0, 0, 0, time.Local)
+
+	expected := DefaultOmikujiTable.Draw("alice", day).String()
+	for i := 0; i < 10; i++ {
+		later := day.Add(time.Duration(i) * time.Hour)
+		if actual := DefaultOmikujiTable.Draw("alice", later).String(); actual != expected {
+			t.Fatalf("fortune expected %s but not, actual %s", expected, actual)
+		}
+	}
+}
+
+func TestOmikujiTableは日付が変わると結果が変わる(t *testing.T) {
+	day := time.Date(2018, 4, 22, 9, 0, 0, 0, time.Local)
+
+	first := DefaultOmikujiTable.Draw("alice", day).String()
+	for i := 1; i <= 30; i++ {
+		if DefaultOmikujiTable.Draw("alice", day.AddDate(0, 0, i)).String() != first {
+			return
+		}
+	}
+	t.Fatalf("fortune never changed in 30 days: %s", first)
+}
+
+func TestNewOmikujiTableは項目が空の表をエラーにする(t *testing.T) {
+	y := `
+fortunes: [大吉]
+items: []
+colors: [赤]
+`
+	if _, err := NewOmikujiTable(strings.NewReader(y)); err == nil {
+		t.Fatal("error expected but nil")
+	}
+}
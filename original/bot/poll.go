@@ -0,0 +1,212 @@
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+const (
+	pollDefaultDuration = "1h"
+	pollMaxDuration     = 7 * 24 * time.Hour
+	pollMinOptions      = 2
+	pollMaxOptions      = 10
+	pollTimeLayout      = "01/02 15:04"
+)
+
+// pollCommandPattern は"poll "Lunch?" ..."や"vote 3 ramen"のように、投票のコマンドとして書かれたメッセージにマッチします
+//
+// "vote for pizza"のような普通の会話に使い方を返信しないように、質問が引用符で始まるか、IDが数字の場合だけ扱います
+var pollCommandPattern = regexp.MustCompile(`\A(?:poll\s+(?:--for[=\s]\S+\s+)?["']|vote\s+\d+(?:\s|\z))`)
+
+// newPollCommand は"poll "Lunch?" ramen sushi curry"で投票を作るコマンドを返します
+//
+// 投票のメッセージはpostで投稿してIDを受け取り、そのIDを投票に記録して後から集計結果に書き換えます
+func newPollCommand(db *sql.DB, loc *time.Location, now func() time.Time, post func(*model.Message) (*model.Message, error)) *Command {
+	return &Command{
+		Name:        "poll",
+		Description: "投票を作ります",
+		Args: []Arg{
+			{Name: "question", Type: ArgString, Description: "質問"},
+			{Name: "options", Type: ArgString, Variadic: true, Description: "選択肢"},
+		},
+		Flags: []Flag{
+			{Name: "for", Type: ArgDuration, Default: pollDefaultDuration, Description: "締め切りまでの時間"},
+		},
+		Run: func(ctx *CommandContext) (*model.Message, error) {
+			labels := ctx.Strings("options")
+			if len(labels) < pollMinOptions || len(labels) > pollMaxOptions {
+				return nil, ctx.UsageErrorf("選択肢は%dから%d個までです", pollMinOptions, pollMaxOptions)
+			}
+			d := ctx.Duration("for")
+			if d <= 0 || d > pollMaxDuration {
+				return nil, ctx.UsageErrorf("--for は%sまでです", pollMaxDuration)
+			}
+
+			p := &model.Poll{
+				Question: ctx.String("question"),
+				UserName: ctx.Message.UserName,
+				ClosesAt: now().Add(d),
+			}
+			for _, l := range labels {
+				p.Options = append(p.Options, &model.PollOption{Label: l})
+			}
+			inserted, err := p.Insert(db)
+			if err != nil {
+				return nil, err
+			}
+
+			m := &model.Message{
+				Body:     renderPoll(inserted, loc),
+				UserName: "bot",
+				Channel:  ctx.Message.Channel,
+			}
+			msg, err := post(m)
+			if err != nil {
+				return nil, err
+			}
+			if err := inserted.SetMessageID(db, msg.ID); err != nil {
+				return nil, err
+			}
+
+			// 投票のメッセージは投稿済みなので、返信はしません
+			return nil, nil
+		},
+	}
+}
+
+// newVoteCommand は"vote <id> <option>"で投票するコマンドを返します
+//
+// 投票が成功した場合は返信せずに、投票のメッセージの集計結果を書き換えます
+func newVoteCommand(db *sql.DB, loc *time.Location, now func() time.Time) *Command {
+	return &Command{
+		Name:        "vote",
+		Description: "投票します",
+		Args: []Arg{
+			{Name: "id", Type: ArgInt, Description: "投票のID"},
+			{Name: "option", Type: ArgString, Variadic: true, Description: "選択肢の番号か名前"},
+		},
+		Run: func(ctx *CommandContext) (*model.Message, error) {
+			p, err := model.PollByID(db, int64(ctx.Int("id")))
+			if err == sql.ErrNoRows {
+				return ctx.Reply(fmt.Sprintf("投票 #%d は見つからないパカ", ctx.Int("id")))
+			}
+			if err != nil {
+				return nil, err
+			}
+			if p.Closed {
+				return ctx.Reply(fmt.Sprintf("投票 #%d は締め切られているパカ", p.ID))
+			}
+
+			o := findPollOption(p, strings.Join(ctx.Strings("option"), " "))
+			if o == nil {
+				return nil, ctx.UsageErrorf("投票 #%d にその選択肢はありません", p.ID)
+			}
+
+			err = p.Vote(db, ctx.Message.UserName, o, now())
+			if err == model.ErrPollClosed {
+				return ctx.Reply(fmt.Sprintf("投票 #%d は締め切られているパカ", p.ID))
+			}
+			if err == model.ErrAlreadyVoted {
+				return ctx.Reply(fmt.Sprintf("%sさんは投票 #%d に投票済みパカ", ctx.Message.UserName, p.ID))
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, updatePollMessage(db, p.ID, loc)
+		},
+	}
+}
+
+// findPollOption は番号か名前で選択肢を探します
+func findPollOption(p *model.Poll, s string) *model.PollOption {
+	if n, err := strconv.Atoi(s); err == nil {
+		for _, o := range p.Options {
+			if o.Position == n {
+				return o
+			}
+		}
+	}
+	for _, o := range p.Options {
+		if strings.EqualFold(o.Label, s) {
+			return o
+		}
+	}
+	return nil
+}
+
+// updatePollMessage は投票のメッセージを最新の集計結果に書き換えます
+func updatePollMessage(db *sql.DB, id int64, loc *time.Location) error {
+	p, err := model.PollByID(db, id)
+	if err != nil {
+		return err
+	}
+	m := &model.Message{
+		ID:   p.MessageID,
+		Body: renderPoll(p, loc),
+	}
+	_, err = m.Update(db)
+	return err
+}
+
+// renderPoll は投票の質問、選択肢ごとの得票数、締め切りを表示用の文章にします
+func renderPoll(p *model.Poll, loc *time.Location) string {
+	lines := []string{fmt.Sprintf("[投票 #%d] %s", p.ID, p.Question)}
+	for _, o := range p.Options {
+		lines = append(lines, fmt.Sprintf("%d. %s %s %d票", o.Position, o.Label, strings.Repeat("■", o.Votes), o.Votes))
+	}
+	if p.Closed {
+		lines = append(lines, "締め切りました")
+	} else {
+		lines = append(lines, fmt.Sprintf("\"vote %d <番号>\"で投票 (%s まで)", p.ID, p.ClosesAt.In(loc).Format(pollTimeLayout)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pollWinners は最も得票数の多い選択肢を返します
+func pollWinners(p *model.Poll) []*model.PollOption {
+	var winners []*model.PollOption
+	for _, o := range p.Options {
+		switch {
+		case len(winners) == 0 || o.Votes > winners[0].Votes:
+			winners = []*model.PollOption{o}
+		case o.Votes == winners[0].Votes:
+			winners = append(winners, o)
+		}
+	}
+	return winners
+}
+
+// closePoll は投票を締め切ってメッセージを書き換え、結果を知らせるメッセージを返します
+func closePoll(db *sql.DB, id int64, loc *time.Location) (*model.Message, error) {
+	p, err := model.PollByID(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Close(db); err != nil {
+		return nil, err
+	}
+	if err := updatePollMessage(db, p.ID, loc); err != nil {
+		return nil, err
+	}
+
+	winners := pollWinners(p)
+	body := fmt.Sprintf("投票 #%d「%s」は投票がなかったパカ", p.ID, p.Question)
+	if len(winners) > 0 && winners[0].Votes > 0 {
+		labels := []string{}
+		for _, o := range winners {
+			labels = append(labels, o.Label)
+		}
+		body = fmt.Sprintf("投票 #%d「%s」の結果: %s (%d票)", p.ID, p.Question, strings.Join(labels, ", "), winners[0].Votes)
+	}
+	return &model.Message{
+		Body:     body,
+		UserName: "bot",
+	}, nil
+}
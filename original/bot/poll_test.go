@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestPollBotは投票のメッセージを投稿してstreamに流す(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, q := range []string{
+		`CREATE TABLE message (id INTEGER NOT NULL PRIMARY KEY, body TEXT NOT NULL DEFAULT "", username TEXT NOT NULL DEFAULT "", channel TEXT NOT NULL DEFAULT "", version INTEGER NOT NULL DEFAULT 1)`,
+		`CREATE TABLE poll (id INTEGER NOT NULL PRIMARY KEY, message_id INTEGER NOT NULL DEFAULT 0, question TEXT NOT NULL DEFAULT "", username TEXT NOT NULL DEFAULT "", closes_at INTEGER NOT NULL DEFAULT 0, closed INTEGER NOT NULL DEFAULT 0)`,
+		`CREATE TABLE poll_option (id INTEGER NOT NULL PRIMARY KEY, poll_id INTEGER NOT NULL, position INTEGER NOT NULL, label TEXT NOT NULL DEFAULT "")`,
+		`CREATE TABLE poll_vote (id INTEGER NOT NULL PRIMARY KEY, poll_id INTEGER NOT NULL, option_id INTEGER NOT NULL, username TEXT NOT NULL DEFAULT "")`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to create table: %s", err)
+		}
+	}
+
+	stream := make(chan *model.Message, 1)
+	b := NewPollBot(make(chan *model.Message), db, time.UTC, model.NewSQLMessageStore(db), stream)
+
+	m := &model.Message{Body: `poll "Lunch?" ramen sushi`, UserName: "alice", Channel: "random"}
+	if !b.checker.Check(m) {
+		t.Fatalf("%q expected to be checked but not", m.Body)
+	}
+	if reply, err := b.processor.Process(m); err != nil || reply != nil {
+		t.Fatalf("no reply expected but not, actual %v, %v", reply, err)
+	}
+
+	select {
+	case posted := <-stream:
+		if !strings.HasPrefix(posted.Body, "[投票 #1] Lunch?") || posted.Channel != "random" || posted.Origin != model.OriginBot {
+			t.Fatalf("poll message from the bot expected but not, actual %#v", posted)
+		}
+		p, err := model.PollByID(db, 1)
+		if err != nil {
+			t.Fatalf("failed to get poll: %s", err)
+		}
+		if p.MessageID != posted.ID {
+			t.Fatalf("message id %d expected but not, actual %d", posted.ID, p.MessageID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("poll message expected to be streamed but not")
+	}
+}
+
+func TestPollBotは投票のコマンドに見えるメッセージだけ扱う(t *testing.T) {
+	b := NewPollBot(make(chan *model.Message), nil, time.UTC, nil, nil)
+
+	for body, expected := range map[string]bool{
+		`poll "Lunch?" ramen sushi`:          true,
+		`poll --for 2h 'Lunch?' ramen sushi`: true,
+		`poll --for=2h "Lunch?" ramen sushi`: true,
+		"vote 3 ramen":                       true,
+		"vote 3":                             true,
+		"vote for pizza at lunch":            false,
+		"poll the team about lunch":          false,
+		"voters 3":                           false,
+	} {
+		if actual := b.checker.Check(&model.Message{Body: body, UserName: "alice"}); actual != expected {
+			t.Errorf("%q: check expected %v but not", body, expected)
+		}
+	}
+}
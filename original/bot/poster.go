@@ -2,14 +2,25 @@ package bot
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
 )
 
+// PosterTokenHeader はPosterが投稿したことを示すtokenを入れるヘッダーです
+//
+// APIはtokenが一致したメッセージをbotの投稿として扱い、webhookなどに送りません
+const PosterTokenHeader = "X-Poster-Token"
+
 type (
 	// Poster はInに渡されたmessageをPOSTするための構造体です
+	//
+	//   fields
+	//     In    chan *model.Message
+	//     token string
 	Poster struct {
-		In chan *model.Message
+		In    chan *model.Message
+		token string
 	}
 )
 
@@ -21,15 +32,34 @@ func (p *Poster) Run(ctx context.Context, url string) {
 			close(p.In)
 			return
 		case m := <-p.In:
-			postJSON(url+"/api/messages", m, nil)
+			postJSON(url+"/api/messages", http.Header{PosterTokenHeader: {p.token}}, m, nil)
 		}
 	}
 }
 
-// NewPoster は新しいPoster構造体のポインタを返します
-func NewPoster(bufferSize int) *Poster {
+// NewPoster はtokenを付けて投稿する新しいPoster構造体のポインタを返します
+func NewPoster(bufferSize int, token string) *Poster {
 	in := make(chan *model.Message, bufferSize)
 	return &Poster{
-		In: in,
+		In:    in,
+		token: token,
+	}
+}
+
+// publisher はメッセージをAPIから投稿されたものと同じようにmessagesに保存し、botの投稿としてstreamに流す関数を返します
+//
+// Posterと違い保存したメッセージをすぐに返すので、投稿したメッセージのIDを使うbotに使います
+func publisher(messages model.MessageStore, stream chan *model.Message) func(*model.Message) (*model.Message, error) {
+	return func(m *model.Message) (*model.Message, error) {
+		inserted, err := messages.Create(m)
+		if err != nil {
+			return nil, err
+		}
+		inserted.Origin = model.OriginBot
+		// Multicasterは呼び出したbotにメッセージを渡し終わるまで待っているので、別のgoroutineで流します
+		go func() {
+			stream <- inserted
+		}()
+		return inserted, nil
 	}
 }
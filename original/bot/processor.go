@@ -1,12 +1,14 @@
 package bot
 
 import (
+	"database/sql"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"fmt"
 
-	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/env"
 	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
 	"net/url"
 )
@@ -14,6 +16,18 @@ import (
 const (
 	keywordAPIURLFormat = "https://jlp.yahooapis.jp/KeyphraseService/V1/extract?appid=%s&sentence=%s&output=json"
 	talkAPIURL          = "https://api.a3rt.recruit-tech.co.jp/talk/v1/smalltalk"
+
+	// omikujiHistoryLimit は"omikuji history"で表示する記録の件数です
+	omikujiHistoryLimit = 7
+
+	reminderTimeLayout = "2006-01-02 15:04"
+	reminderUsage      = "使い方: remind me in 30m to deploy / remind @alice 明日10時 レビュー / remind list / remind cancel <id>"
+)
+
+var (
+	keywordPattern = regexp.MustCompile("\\Akeyword (.*)\\z")
+	talkPattern    = regexp.MustCompile("\\Atalk (.*)\\z")
+	remindPattern  = regexp.MustCompile("\\Aremind\\s+(.*)\\z")
 )
 
 type (
@@ -22,54 +36,136 @@ type (
 		Process(message *model.Message) (*model.Message, error)
 	}
 
+	// MatchProcessor はMatcherがキャプチャした文字列も受け取り、投稿用messageを作るProcessorです
+	//
+	// 同じ正規表現をProcessの中で再び評価しなくて済みます
+	MatchProcessor interface {
+		Processor
+		ProcessMatch(message *model.Message, groups []string) (*model.Message, error)
+	}
+
 	// HelloWorldProcessor は"hello, world!"メッセージを作るprocessorの構造体です
 	HelloWorldProcessor struct{}
 
-	// OmikujiProcessor は"大吉", "吉", "中吉", "小吉", "末吉", "凶"のいずれかをランダムで作るprocessorの構造体です
-	OmikujiProcessor struct{}
+	// OmikujiProcessor はユーザーと日付で決まるおみくじの結果を作るprocessorの構造体です
+	//
+	//   fields
+	//     db    *sql.DB
+	//     table *OmikujiTable
+	//     now   func() time.Time
+	OmikujiProcessor struct {
+		db    *sql.DB
+		table *OmikujiTable
+		now   func() time.Time
+	}
 
 	// KeywordProcessor はメッセージ本文からキーワードを抽出するprocessorの構造体です
-	KeywordProcessor struct{}
+	//
+	//   fields
+	//     appID string
+	KeywordProcessor struct {
+		appID string
+	}
+
+	// ReminderProcessor は"remind me in 30m to deploy"のようなメッセージからリマインダーを作るprocessorの構造体です
+	//
+	// "remind list"で一覧を、"remind cancel <id>"で取り消しを行います
+	//
+	//   fields
+	//     db  *sql.DB
+	//     loc *time.Location
+	//     now func() time.Time
+	ReminderProcessor struct {
+		db  *sql.DB
+		loc *time.Location
+		now func() time.Time
+	}
 
 	// GachaProcessor m2-1で追加するやつ
 	GachaProcessor struct{}
 
 	// TalkProcessor m2-2で追加するやつ
-	TalkProcessor struct{}
+	//
+	//   fields
+	//     apiKey string
+	TalkProcessor struct {
+		apiKey string
+	}
 )
 
 // Process は"hello, world!"というbodyがセットされたメッセージのポインタを返します
 func (p *HelloWorldProcessor) Process(msgIn *model.Message) (*model.Message, error) {
 	return &model.Message{
-		Body: msgIn.Body + ", world!",
+		Body:     msgIn.Body + ", world!",
 		UserName: "bot",
 	}, nil
 }
 
-// Process は"大吉", "吉", "中吉", "小吉", "末吉", "凶"のいずれかがbodyにセットされたメッセージへのポインタを返します
+// Process はその日のおみくじの結果、または"omikuji history"の場合はこれまでの記録がbodyにセットされたメッセージへのポインタを返します
 func (p *OmikujiProcessor) Process(msgIn *model.Message) (*model.Message, error) {
-	fortunes := []string{
-		"大吉",
-		"吉",
-		"中吉",
-		"小吉",
-		"末吉",
-		"凶",
-	}
-	result := fortunes[randIntn(len(fortunes))]
+	if strings.HasSuffix(msgIn.Body, " history") {
+		return p.history(msgIn.UserName)
+	}
+	return p.draw(msgIn.UserName)
+}
+
+// draw はusernameの今日のおみくじの結果を記録し、結果のメッセージを返します
+func (p *OmikujiProcessor) draw(username string) (*model.Message, error) {
+	today := p.now()
+	fortune := p.table.Draw(username, today)
+
+	o := &model.Omikuji{
+		UserName: username,
+		Date:     today.Format(omikujiDateLayout),
+		Fortune:  fortune.Fortune,
+	}
+	if err := o.Insert(p.db); err != nil {
+		return nil, err
+	}
+
+	return &model.Message{
+		Body:     fmt.Sprintf("%sさんの今日の運勢は%s", username, fortune),
+		UserName: "bot",
+	}, nil
+}
+
+// history はusernameのおみくじの記録を並べたメッセージを返します
+func (p *OmikujiProcessor) history(username string) (*model.Message, error) {
+	omikujis, err := model.OmikujisByUserName(p.db, username, omikujiHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(omikujis) == 0 {
+		return &model.Message{
+			Body:     username + "さんはまだおみくじを引いていないパカ",
+			UserName: "bot",
+		}, nil
+	}
+
+	lines := []string{username + "さんのおみくじの記録"}
+	for _, o := range omikujis {
+		lines = append(lines, o.Date+" "+o.Fortune)
+	}
 	return &model.Message{
-		Body: result,
+		Body:     strings.Join(lines, "\n"),
 		UserName: "bot",
 	}, nil
 }
 
 // Process はメッセージ本文からキーワードを抽出します
 func (p *KeywordProcessor) Process(msgIn *model.Message) (*model.Message, error) {
-	r := regexp.MustCompile("\\Akeyword (.*)\\z")
-	matchedStrings := r.FindStringSubmatch(msgIn.Body)
-	text := matchedStrings[1]
+	return p.ProcessMatch(msgIn, keywordPattern.FindStringSubmatch(msgIn.Body))
+}
 
-	url := fmt.Sprintf(keywordAPIURLFormat, env.KeywordAPIAppID, url.QueryEscape(text))
+// ProcessMatch は"keyword (.*)"でキャプチャした文字列からキーワードを抽出します
+func (p *KeywordProcessor) ProcessMatch(msgIn *model.Message, groups []string) (*model.Message, error) {
+	if len(groups) < 2 {
+		return nil, fmt.Errorf("keyword: no text in %q", msgIn.Body)
+	}
+	text := groups[1]
+
+	url := fmt.Sprintf(keywordAPIURLFormat, p.appID, url.QueryEscape(text))
 
 	type keywordAPIResponse map[string]interface{}
 	var json keywordAPIResponse
@@ -84,32 +180,41 @@ func (p *KeywordProcessor) Process(msgIn *model.Message) (*model.Message, error)
 	}
 
 	return &model.Message{
-		Body: "キーワード：" + strings.Join(keywords, ", "),
+		Body:     "キーワード：" + strings.Join(keywords, ", "),
 		UserName: "bot",
 	}, nil
 }
 
 // Process ...
 func (p *GachaProcessor) Process(msgIn *model.Message) (*model.Message, error) {
+	return &model.Message{
+		Body:     p.draw(),
+		UserName: "bot",
+	}, nil
+}
+
+// draw はガチャを1回引いた結果を返します
+func (p *GachaProcessor) draw() string {
 	fortunes := []string{
 		"SSレア",
 		"Sレア",
 		"レア",
 		"ノーマル",
 	}
-	result := fortunes[randIntn(len(fortunes))]
-
-	return &model.Message{
-		Body: result,
-		UserName: "bot",
-	}, nil
+	return fortunes[randIntn(len(fortunes))]
 }
 
 // Process ...
 func (p *TalkProcessor) Process(msgIn *model.Message) (*model.Message, error) {
-	r := regexp.MustCompile("\\Atalk (.*)\\z")
-	matchedStrings := r.FindStringSubmatch(msgIn.Body)
-	text := matchedStrings[1]
+	return p.ProcessMatch(msgIn, talkPattern.FindStringSubmatch(msgIn.Body))
+}
+
+// ProcessMatch は"talk (.*)"でキャプチャした文字列に対する返事を作ります
+func (p *TalkProcessor) ProcessMatch(msgIn *model.Message, groups []string) (*model.Message, error) {
+	if len(groups) < 2 {
+		return nil, fmt.Errorf("talk: no text in %q", msgIn.Body)
+	}
+	text := groups[1]
 
 	res := &struct {
 		Status  int64  `json:status`
@@ -121,7 +226,7 @@ func (p *TalkProcessor) Process(msgIn *model.Message) (*model.Message, error) {
 	}{}
 
 	params := url.Values{}
-	params.Set("apikey", env.TalkAPIKey)
+	params.Set("apikey", p.apiKey)
 	params.Add("query", text)
 
 	post(talkAPIURL, params, res)
@@ -132,7 +237,108 @@ func (p *TalkProcessor) Process(msgIn *model.Message) (*model.Message, error) {
 	}
 
 	return &model.Message{
-		Body: res.Results[0].Reply,
+		Body:     res.Results[0].Reply,
+		UserName: "bot",
+	}, nil
+}
+
+// Process は"remind ..."のメッセージからリマインダーを作る、一覧を返す、または取り消します
+func (p *ReminderProcessor) Process(msgIn *model.Message) (*model.Message, error) {
+	return p.ProcessMatch(msgIn, remindPattern.FindStringSubmatch(msgIn.Body))
+}
+
+// ProcessMatch は"remind (.*)"でキャプチャした文字列からリマインダーを作る、一覧を返す、または取り消します
+func (p *ReminderProcessor) ProcessMatch(msgIn *model.Message, groups []string) (*model.Message, error) {
+	if len(groups) < 2 {
+		return p.reply(reminderUsage)
+	}
+	args := strings.Fields(groups[1])
+	if len(args) == 0 {
+		return p.reply(reminderUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		return p.list(msgIn.UserName)
+	case "cancel":
+		if len(args) != 2 {
+			return p.reply(reminderUsage)
+		}
+		return p.cancel(msgIn.UserName, args[1])
+	}
+
+	target := args[0]
+	switch {
+	case target == "me":
+		target = msgIn.UserName
+	case strings.HasPrefix(target, "@") && len(target) > 1:
+		target = target[1:]
+	default:
+		return p.reply(reminderUsage)
+	}
+
+	text := strings.TrimSpace(strings.TrimPrefix(groups[1], args[0]))
+	dueAt, body, err := parseWhen(text, p.now().In(p.loc))
+	if err != nil {
+		return p.reply(err.Error())
+	}
+	if body == "" {
+		return p.reply("何を知らせるか書いてください\n" + reminderUsage)
+	}
+
+	r := &model.Reminder{
+		UserName: msgIn.UserName,
+		Target:   target,
+		Body:     body,
+		DueAt:    dueAt,
+	}
+	inserted, err := r.Insert(p.db)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.reply(fmt.Sprintf("%sに%sさんへ知らせるパカ (ID:%d)", dueAt.Format(reminderTimeLayout), target, inserted.ID))
+}
+
+// list はusernameが作った、またはusername宛てのリマインダーの一覧を返します
+func (p *ReminderProcessor) list(username string) (*model.Message, error) {
+	rs, err := model.RemindersPendingByUserName(p.db, username)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return p.reply(username + "さんのリマインダーはないパカ")
+	}
+
+	lines := []string{username + "さんのリマインダー"}
+	for _, r := range rs {
+		lines = append(lines, fmt.Sprintf("ID:%d %s @%s %s", r.ID, r.DueAt.In(p.loc).Format(reminderTimeLayout), r.Target, r.Body))
+	}
+	return p.reply(strings.Join(lines, "\n"))
+}
+
+// cancel はidのリマインダーを取り消します
+func (p *ReminderProcessor) cancel(username, id string) (*model.Message, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return p.reply(reminderUsage)
+	}
+
+	r := &model.Reminder{ID: n}
+	ok, err := r.Cancel(p.db, username)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return p.reply(fmt.Sprintf("ID:%d のリマインダーは見つからないパカ", n))
+	}
+	return p.reply(fmt.Sprintf("ID:%d のリマインダーを取り消したパカ", n))
+}
+
+// reply はbodyを本文にしたbotの投稿用メッセージを返します
+func (p *ReminderProcessor) reply(body string) (*model.Message, error) {
+	return &model.Message{
+		Body:     body,
 		UserName: "bot",
 	}, nil
 }
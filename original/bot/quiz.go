@@ -0,0 +1,163 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+const (
+	// quizRounds は1回のクイズで出す問題の数です
+	quizRounds = 3
+	// quizAnswerTimeout は答えを待つ時間です。過ぎるとクイズは終わります
+	quizAnswerTimeout = time.Minute
+)
+
+type (
+	// QuizProcessor はクイズを出して答え合わせをするprocessorの構造体です
+	//
+	// "quiz"で始まり、quizRounds問出したところで点数を返します。"quiz stop"か"やめる"で途中でやめられます
+	//
+	//   fields
+	//     questions []QuizQuestion
+	//     perm      func(int) []int
+	QuizProcessor struct {
+		questions []QuizQuestion
+		perm      func(int) []int
+	}
+
+	// QuizQuestion はクイズの問題と正解として認める答えの構造体です
+	QuizQuestion struct {
+		Question string
+		Answers  []string
+	}
+)
+
+// DefaultQuizQuestions は標準のクイズの問題です
+var DefaultQuizQuestions = []QuizQuestion{
+	{Question: "日本で一番高い山は?", Answers: []string{"富士山", "ふじさん", "fuji"}},
+	{Question: "1バイトは何ビット?", Answers: []string{"8", "8ビット", "8bit", "8 bits"}},
+	{Question: "Goのマスコットの名前は?", Answers: []string{"gopher", "ゴーファー"}},
+	{Question: "ページが見つからないときのHTTPステータスコードは?", Answers: []string{"404"}},
+	{Question: "円周率を小数第2位まで答えてください", Answers: []string{"3.14"}},
+	{Question: "1日は何時間?", Answers: []string{"24", "24時間"}},
+}
+
+// Process はクイズを始めます
+//
+// 会話の状態を保存できないため、答え合わせはできません
+func (p *QuizProcessor) Process(message *model.Message) (*model.Message, error) {
+	return p.Converse(message, &Conversation{State: map[string]string{}})
+}
+
+// Converse はクイズを始めるか、答え合わせをして次の問題を出します
+func (p *QuizProcessor) Converse(message *model.Message, conv *Conversation) (*model.Message, error) {
+	body := strings.TrimSpace(message.Body)
+
+	switch {
+	case body == "quiz":
+		return p.start(message, conv)
+	case !conv.Awaiting():
+		return nil, nil
+	case body == "quiz stop" || body == "やめる":
+		turn, _ := strconv.Atoi(conv.State["turn"])
+		score, _ := strconv.Atoi(conv.State["score"])
+		conv.End()
+		return p.reply(message, fmt.Sprintf("クイズをやめるパカ (%d問中%d問正解)", turn, score))
+	}
+
+	order := strings.Split(conv.State["questions"], ",")
+	turn, err := strconv.Atoi(conv.State["turn"])
+	if err != nil || turn >= len(order) {
+		conv.End()
+		return nil, nil
+	}
+	i, err := strconv.Atoi(order[turn])
+	if err != nil || i < 0 || i >= len(p.questions) {
+		conv.End()
+		return nil, nil
+	}
+	q := p.questions[i]
+
+	score, _ := strconv.Atoi(conv.State["score"])
+	var result string
+	if q.correct(body) {
+		score++
+		result = "正解パカ!"
+	} else {
+		result = fmt.Sprintf("残念、正解は「%s」パカ", q.Answers[0])
+	}
+	turn++
+
+	if turn >= len(order) {
+		conv.End()
+		return p.reply(message, fmt.Sprintf("%s\n%d問中%d問正解パカ", result, turn, score))
+	}
+
+	conv.State["turn"] = strconv.Itoa(turn)
+	conv.State["score"] = strconv.Itoa(score)
+	conv.Await(quizAnswerTimeout)
+	return p.reply(message, fmt.Sprintf("%s\n%s", result, p.ask(order, turn)))
+}
+
+// start は問題を選んで最初の問題を出します
+func (p *QuizProcessor) start(message *model.Message, conv *Conversation) (*model.Message, error) {
+	n := quizRounds
+	if n > len(p.questions) {
+		n = len(p.questions)
+	}
+	if n == 0 {
+		conv.End()
+		return p.reply(message, "問題がないパカ")
+	}
+
+	order := make([]string, n)
+	for j, i := range p.perm(len(p.questions))[:n] {
+		order[j] = strconv.Itoa(i)
+	}
+
+	conv.End()
+	conv.State["questions"] = strings.Join(order, ",")
+	conv.State["turn"] = "0"
+	conv.State["score"] = "0"
+	conv.Await(quizAnswerTimeout)
+	return p.reply(message, p.ask(order, 0))
+}
+
+// ask はturn番目の問題文を返します
+func (p *QuizProcessor) ask(order []string, turn int) string {
+	i, _ := strconv.Atoi(order[turn])
+	return fmt.Sprintf("第%d問: %s", turn+1, p.questions[i].Question)
+}
+
+// reply はmessageを送ったユーザー宛ての投稿用messageを返します
+func (p *QuizProcessor) reply(message *model.Message, body string) (*model.Message, error) {
+	return &model.Message{
+		Body:     fmt.Sprintf("@%s %s", message.UserName, body),
+		UserName: "bot",
+	}, nil
+}
+
+// correct はanswerが正解のいずれかに一致するか返します。大文字と小文字、前後の空白は区別しません
+func (q QuizQuestion) correct(answer string) bool {
+	answer = strings.TrimSpace(answer)
+	for _, a := range q.Answers {
+		if strings.EqualFold(answer, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewQuizProcessor はquestionsから問題を出す新しいQuizProcessor構造体のポインタを返します
+func NewQuizProcessor(questions []QuizQuestion) *QuizProcessor {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &QuizProcessor{
+		questions: questions,
+		perm:      r.Perm,
+	}
+}
@@ -0,0 +1,260 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"gopkg.in/yaml.v2"
+)
+
+// 保存期間を過ぎたメッセージの扱いです
+const (
+	// RetentionDelete はメッセージを削除します
+	RetentionDelete = "delete"
+	// RetentionArchive はメッセージをアーカイブのデータベースに移します
+	RetentionArchive = "archive"
+)
+
+// retentionBatchSize は1度に削除、アーカイブするメッセージの数です
+const retentionBatchSize = 500
+
+// defaultRetentionSchedule は保存期間を過ぎたメッセージを片付けるデフォルトのスケジュールです
+const defaultRetentionSchedule = "30 3 * * *"
+
+type (
+	// RetentionConfig はretention.ymlを読むための構造体です
+	//
+	// Scheduleは片付けるスケジュールで、省略した場合は毎日3時30分です
+	// Archiveはアーカイブに使うSQLiteのファイルで、actionがarchiveのpolicyがある場合は必要です
+	// Policiesは上から順に適用します
+	RetentionConfig struct {
+		Schedule string             `yaml:"schedule"`
+		Archive  string             `yaml:"archive"`
+		Policies []*RetentionPolicy `yaml:"policies"`
+	}
+
+	// RetentionPolicy はメッセージの保存期間の設定です
+	//
+	// Channelが空の場合は全てのチャンネルに適用します。Fromはbots、humansか空(全て)です
+	// MaxAgeは"168h"や"7d"のような期間で、これより前に投稿されたメッセージをActionに従って片付けます
+	RetentionPolicy struct {
+		Name    string `yaml:"name" json:"name"`
+		Channel string `yaml:"channel" json:"channel"`
+		From    string `yaml:"from" json:"from"`
+		MaxAge  string `yaml:"max_age" json:"max_age"`
+		Action  string `yaml:"action" json:"action"`
+		maxAge  time.Duration
+	}
+
+	// RetentionResult は1つのpolicyで片付けた、またはdry runで片付けるはずのメッセージの数です
+	RetentionResult struct {
+		Policy   string `json:"policy"`
+		Action   string `json:"action"`
+		Before   int64  `json:"before"`
+		Messages int64  `json:"messages"`
+		DryRun   bool   `json:"dry_run"`
+	}
+
+	// Retention はpolicyに従って保存期間を過ぎたメッセージを削除、アーカイブします
+	//
+	//   fields
+	//     db       *sql.DB
+	//     archive  *sql.DB
+	//     policies []*RetentionPolicy
+	Retention struct {
+		db       *sql.DB
+		archive  *sql.DB
+		policies []*RetentionPolicy
+	}
+)
+
+// NewRetentionConfigFromFile はファイルパスから新しいRetentionConfigを返します
+func NewRetentionConfigFromFile(path string) (*RetentionConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewRetentionConfig(f)
+}
+
+// NewRetentionConfig はyamlを読み込んで新しいRetentionConfigを返します
+func NewRetentionConfig(r io.Reader) (*RetentionConfig, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var c RetentionConfig
+	if err = yaml.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if err = c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate は設定が正しいか確かめます
+func (c *RetentionConfig) Validate() error {
+	if c.Schedule == "" {
+		c.Schedule = defaultRetentionSchedule
+	}
+	if _, err := ParseSchedule(c.Schedule); err != nil {
+		return fmt.Errorf("retention schedule: %s", err)
+	}
+
+	names := map[string]bool{}
+	for i, p := range c.Policies {
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("policy%d", i+1)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate retention policy: %s", p.Name)
+		}
+		names[p.Name] = true
+
+		switch p.From {
+		case model.RetentionFromAll, model.RetentionFromBots, model.RetentionFromHumans:
+		default:
+			return fmt.Errorf("retention policy %s: from must be bots or humans: %s", p.Name, p.From)
+		}
+		switch p.Action {
+		case RetentionDelete:
+		case RetentionArchive:
+			if c.Archive == "" {
+				return fmt.Errorf("retention policy %s: archive is required to archive messages", p.Name)
+			}
+		default:
+			return fmt.Errorf("retention policy %s: action must be delete or archive: %s", p.Name, p.Action)
+		}
+		d, err := parseRetentionAge(p.MaxAge)
+		if err != nil {
+			return fmt.Errorf("retention policy %s: %s", p.Name, err)
+		}
+		p.maxAge = d
+	}
+	return nil
+}
+
+// parseRetentionAge はtime.ParseDurationの形式に加えて"7d"のような日数を読みます
+func parseRetentionAge(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if strings.HasSuffix(s, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(s, "d"))
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("max_age must be a positive duration: %q", s)
+	}
+	return d, nil
+}
+
+// NewRetention は新しいRetention構造体のポインタを返します
+//
+// archiveはactionがarchiveのpolicyがない場合はnilにできます
+func NewRetention(db, archive *sql.DB, policies []*RetentionPolicy) *Retention {
+	return &Retention{
+		db:       db,
+		archive:  archive,
+		policies: policies,
+	}
+}
+
+// Policies は設定されているpolicyを返します
+func (r *Retention) Policies() []*RetentionPolicy {
+	return r.policies
+}
+
+// Run はtの時点で保存期間を過ぎたメッセージをpolicyごとに片付けます
+//
+// dryRunがtrueの場合は何も変更せずに、片付けるはずのメッセージの数を返します
+func (r *Retention) Run(t time.Time, dryRun bool) ([]*RetentionResult, error) {
+	results := []*RetentionResult{}
+	var earlier []*model.RetentionFilter
+	for _, p := range r.policies {
+		f := &model.RetentionFilter{Channel: p.Channel, From: p.From, Before: t.Add(-p.maxAge)}
+		result := &RetentionResult{Policy: p.Name, Action: p.Action, Before: f.Before.Unix(), DryRun: dryRun}
+		results = append(results, result)
+
+		// 実際に片付ける場合は先のpolicyで消えたメッセージを後のpolicyは数えないので、dry runでも除きます
+		if dryRun {
+			n, err := model.MessagesExpiredCount(r.db, f, earlier...)
+			if err != nil {
+				return results, err
+			}
+			result.Messages = n
+			earlier = append(earlier, f)
+			continue
+		}
+
+		n, err := r.apply(p, f, t)
+		result.Messages = n
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// apply はpのactionに従ってfに当てはまるメッセージを少しずつ片付け、片付けた数を返します
+func (r *Retention) apply(p *RetentionPolicy, f *model.RetentionFilter, t time.Time) (int64, error) {
+	if p.Action == RetentionArchive && r.archive == nil {
+		return 0, errors.New("archive database is not configured")
+	}
+
+	var total int64
+	for {
+		ms, err := model.MessagesExpired(r.db, f, retentionBatchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(ms) == 0 {
+			return total, nil
+		}
+
+		// アーカイブに書いてから削除するので、途中で失敗してもメッセージはなくなりません
+		if p.Action == RetentionArchive {
+			for _, m := range ms {
+				m.ArchivedAt = t
+				m.Policy = p.Name
+			}
+			if err := model.ArchiveMessages(r.archive, ms); err != nil {
+				return total, err
+			}
+		}
+		ids := make([]int64, len(ms))
+		for i, m := range ms {
+			ids[i] = m.ID
+		}
+		n, err := model.MessagesDelete(r.db, ids)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if len(ms) < retentionBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// NewRetentionBot はscheduleの時刻に保存期間を過ぎたメッセージを片付ける新しいScheduledBotの構造体のポインタを返します
+func NewRetentionBot(r *Retention, schedule *Schedule, loc *time.Location) *ScheduledBot {
+	job := JobFunc(func(t time.Time) ([]*model.Message, error) {
+		_, err := r.Run(t, false)
+		return nil, err
+	})
+
+	return NewScheduledBot("retentionbot", schedule, loc, SkipMissed, job)
+}
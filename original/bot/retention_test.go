@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRetentionConfigは設定の間違いをエラーにする(t *testing.T) {
+	cases := []struct {
+		yml      string
+		expected string
+	}{
+		{"policies:\n  - {from: bots, max_age: 7d, action: delete}\n", ""},
+		{"policies:\n  - {max_age: 7d, action: archive}\n", "archive is required"},
+		{"policies:\n  - {max_age: 7d, action: drop}\n", "action must be"},
+		{"policies:\n  - {from: robots, max_age: 7d, action: delete}\n", "from must be"},
+		{"policies:\n  - {max_age: -1h, action: delete}\n", "max_age must be"},
+		{"schedule: every day\n", "retention schedule"},
+	}
+	for _, tc := range cases {
+		_, err := NewRetentionConfig(strings.NewReader(tc.yml))
+		if tc.expected == "" && err != nil {
+			t.Errorf("%q: expected no error but not, actual %s", tc.yml, err)
+		}
+		if tc.expected != "" && (err == nil || !strings.Contains(err.Error(), tc.expected)) {
+			t.Errorf("%q: expected error %q but not, actual %v", tc.yml, tc.expected, err)
+		}
+	}
+}
+
+// openRetentionDB はmessageとexternal_botのテーブルを作ったデータベースと、アーカイブのデータベースを開きます
+func openRetentionDB(t *testing.T) (*sql.DB, *sql.DB) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE message (id INTEGER NOT NULL PRIMARY KEY, body TEXT NOT NULL DEFAULT "", username TEXT NOT NULL DEFAULT "", created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime')), channel TEXT NOT NULL DEFAULT "", version INTEGER NOT NULL DEFAULT 1)`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	if _, err := db.Exec(`CREATE TABLE external_bot (name TEXT NOT NULL)`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	if _, err := db.Exec(`INSERT INTO external_bot (name) VALUES ('deployer')`); err != nil {
+		t.Fatalf("failed to insert: %s", err)
+	}
+	archive, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	archive.SetMaxOpenConns(1)
+	if err := model.InitArchive(archive); err != nil {
+		t.Fatalf("failed to init archive: %s", err)
+	}
+	return db, archive
+}
+
+func TestRetentionは古いメッセージを削除とアーカイブに分けて片付ける(t *testing.T) {
+	db, archive := openRetentionDB(t)
+	defer db.Close()
+	defer archive.Close()
+
+	now := time.Now()
+	for _, m := range []struct {
+		username string
+		age      time.Duration
+	}{
+		{"bot", 10 * 24 * time.Hour},
+		{"deployer", 10 * 24 * time.Hour},
+		{"alice", 10 * 24 * time.Hour},
+		{"alice", 400 * 24 * time.Hour},
+		{"bot", time.Hour},
+	} {
+		created := now.Add(-m.age).Format("2006-01-02 15:04:05")
+		if _, err := db.Exec(`INSERT INTO message (body, username, created) VALUES ('hello', ?, ?)`, m.username, created); err != nil {
+			t.Fatalf("failed to insert: %s", err)
+		}
+	}
+
+	c, err := NewRetentionConfig(strings.NewReader(`
+archive: archive.db
+policies:
+  - {name: bots, from: bots, max_age: 7d, action: delete}
+  - {name: humans, from: humans, max_age: 365d, action: archive}
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	r := NewRetention(db, archive, c.Policies)
+
+	count := func() int {
+		var n int
+		db.QueryRow(`SELECT count(*) FROM message`).Scan(&n)
+		return n
+	}
+	for _, dryRun := range []bool{true, false} {
+		results, err := r.Run(now, dryRun)
+		if err != nil {
+			t.Fatalf("failed to run: %s", err)
+		}
+		if len(results) != 2 || results[0].Messages != 2 || results[1].Messages != 1 {
+			t.Fatalf("2 bot messages and 1 human message expected but not, actual %v %v", results[0], results[1])
+		}
+	}
+	if n := count(); n != 2 {
+		t.Fatalf("2 messages expected to remain but not, actual %d", n)
+	}
+
+	ms, err := model.ArchivedMessages(archive, "", 0, 10)
+	if err != nil || len(ms) != 1 || ms[0].ID != 4 || ms[0].Policy != "humans" {
+		t.Fatalf("archived message 4 expected but not, actual %v %v", ms, err)
+	}
+	if age := now.Sub(ms[0].CreatedAt); age < 399*24*time.Hour {
+		t.Fatalf("created_at of the original message expected but not, actual %s", ms[0].CreatedAt)
+	}
+}
+
+func TestRetentionは使い回されたIDのメッセージもアーカイブに残す(t *testing.T) {
+	db, archive := openRetentionDB(t)
+	defer db.Close()
+	defer archive.Close()
+
+	c, err := NewRetentionConfig(strings.NewReader(`
+archive: archive.db
+policies:
+  - {name: humans, from: humans, max_age: 7d, action: archive}
+  - {name: all, max_age: 7d, action: delete}
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	r := NewRetention(db, archive, c.Policies)
+
+	now := time.Now()
+	for i, body := range []string{"first", "second"} {
+		// 最後のメッセージを削除した後なので、SQLiteは同じIDを振ります
+		created := now.Add(-time.Duration(10+i) * 24 * time.Hour).Format("2006-01-02 15:04:05")
+		if _, err := db.Exec(`INSERT INTO message (body, username, created) VALUES (?, 'alice', ?)`, body, created); err != nil {
+			t.Fatalf("failed to insert: %s", err)
+		}
+		if _, err := db.Exec(`INSERT INTO message (body, username, created) VALUES ('hello', 'bot', ?)`, created); err != nil {
+			t.Fatalf("failed to insert: %s", err)
+		}
+
+		// 後のpolicyにも当てはまる人のメッセージは、先のpolicyだけで数えます
+		for _, dryRun := range []bool{true, false} {
+			results, err := r.Run(now, dryRun)
+			if err != nil {
+				t.Fatalf("failed to run: %s", err)
+			}
+			if results[0].Messages != 1 || results[1].Messages != 1 {
+				t.Fatalf("dry run %t: 1 message for each policy expected but not, actual %v %v", dryRun, results[0], results[1])
+			}
+		}
+	}
+
+	ms, err := model.ArchivedMessages(archive, "", 0, 10)
+	if err != nil || len(ms) != 2 {
+		t.Fatalf("2 archived messages expected but not, actual %v %v", ms, err)
+	}
+	if ms[0].ID != ms[1].ID || ms[0].Body != "second" || ms[1].Body != "first" || ms[0].ArchiveID == ms[1].ArchiveID {
+		t.Fatalf("messages with the same id expected to be archived separately but not, actual %+v %+v", ms[0].Message, ms[1].Message)
+	}
+	m, err := model.ArchivedMessageByID(archive, ms[1].ArchiveID)
+	if err != nil || m.Body != "first" {
+		t.Fatalf("archived message first expected but not, actual %v %v", m, err)
+	}
+}
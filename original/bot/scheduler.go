@@ -0,0 +1,227 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+const (
+	// missedRunsLimit はRunAllMissedで実行する回数の上限です。これより前の回は実行しません
+	missedRunsLimit = 10
+	// missedRunsMaxAge は実行されなかった回を遡る期間です。長く止まっていた場合もこれより前の回は数えません
+	missedRunsMaxAge = 7 * 24 * time.Hour
+)
+
+// サーバーが止まっていた間に実行されなかった回の扱いです
+const (
+	// SkipMissed は実行されなかった回を実行しません
+	SkipMissed MissedRunPolicy = iota
+	// RunOnceMissed は実行されなかった回のうち最後の1回だけを実行します
+	RunOnceMissed
+	// RunAllMissed は実行されなかった回を、最近のmissedRunsLimit回まで全て実行します
+	RunAllMissed
+)
+
+type (
+	// MissedRunPolicy はサーバーが止まっていた間に実行されなかった回の扱いです
+	MissedRunPolicy int
+
+	// Job はスケジュールされた時刻に投稿用messageを作るインターフェースです
+	//
+	// 投稿するものがない場合はnilを返せます
+	Job interface {
+		Run(t time.Time) ([]*model.Message, error)
+	}
+
+	// JobFunc は関数をJobとして使うための型です
+	JobFunc func(t time.Time) ([]*model.Message, error)
+
+	// ScheduledBot はscheduleの時刻になるとjobが作ったmessageを投稿するbotです
+	//
+	//   fields
+	//     name     string
+	//     schedule *Schedule
+	//     location *time.Location
+	//     policy   MissedRunPolicy
+	//     job      Job
+	//     next     time.Time
+	ScheduledBot struct {
+		name     string
+		schedule *Schedule
+		location *time.Location
+		policy   MissedRunPolicy
+		job      Job
+		next     time.Time
+	}
+
+	// Scheduler は登録されたScheduledBotをそれぞれのスケジュールで動かします
+	//
+	// 最後に実行した時刻をDBに記録し、起動時にはpolicyに従って止まっていた間の回を扱います
+	//
+	//   fields
+	//     db   *sql.DB
+	//     out  chan *model.Message
+	//     bots []*ScheduledBot
+	//     now  func() time.Time
+	Scheduler struct {
+		db   *sql.DB
+		out  chan *model.Message
+		bots []*ScheduledBot
+		now  func() time.Time
+	}
+)
+
+// Run はtに対してfを呼び出します
+func (f JobFunc) Run(t time.Time) ([]*model.Message, error) {
+	return f(t)
+}
+
+// NewScheduledBot は新しいScheduledBot構造体のポインタを返します
+//
+// locationがnilの場合はtime.Localでスケジュールを解釈します
+func NewScheduledBot(name string, schedule *Schedule, location *time.Location, policy MissedRunPolicy, job Job) *ScheduledBot {
+	if location == nil {
+		location = time.Local
+	}
+	return &ScheduledBot{
+		name:     name,
+		schedule: schedule,
+		location: location,
+		policy:   policy,
+		job:      job,
+	}
+}
+
+// Name はbotの名前を返します
+func (b *ScheduledBot) Name() string {
+	return b.name
+}
+
+// Add はScheduledBotを登録します。Runより前に呼び出してください
+func (s *Scheduler) Add(bots ...*ScheduledBot) {
+	s.bots = append(s.bots, bots...)
+}
+
+// Run はSchedulerを起動します
+func (s *Scheduler) Run(ctx context.Context) {
+	now := s.now()
+	for _, b := range s.bots {
+		s.catchUp(b, now)
+		b.next = b.schedule.Next(now.In(b.location))
+	}
+
+	for {
+		var next time.Time
+		for _, b := range s.bots {
+			if !b.next.IsZero() && (next.IsZero() || b.next.Before(next)) {
+				next = b.next
+			}
+		}
+		if next.IsZero() {
+			<-ctx.Done()
+			return
+		}
+
+		timer := time.NewTimer(next.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			now := s.now()
+			for _, b := range s.bots {
+				if b.next.IsZero() || b.next.After(now) {
+					continue
+				}
+				s.fire(b, b.next)
+				b.next = b.schedule.Next(now.In(b.location))
+			}
+		}
+	}
+}
+
+// catchUp はbが最後に実行された時刻からnowまでに実行されなかった回をpolicyに従って実行します
+func (s *Scheduler) catchUp(b *ScheduledBot, now time.Time) {
+	run, err := model.ScheduledRunByName(s.db, b.name)
+	switch {
+	case err == sql.ErrNoRows:
+		// 初めて起動した場合は過去の回を実行しません
+		s.save(b, now)
+		return
+	case err != nil:
+		log.Printf("%s: %#v\n", b.name, err)
+		return
+	}
+
+	if b.policy == SkipMissed {
+		s.save(b, now)
+		return
+	}
+
+	// 最後の回から順に数え、実行する最近の回だけを残します
+	from := run.LastRun
+	if now.Sub(from) > missedRunsMaxAge {
+		from = now.Add(-missedRunsMaxAge)
+	}
+	keep := 1
+	if b.policy == RunAllMissed {
+		keep = missedRunsLimit
+	}
+	var missed []time.Time
+	total := 0
+	for t := b.schedule.Next(from.In(b.location)); !t.IsZero() && !t.After(now); t = b.schedule.Next(t) {
+		total++
+		missed = append(missed, t)
+		if len(missed) > keep {
+			missed = missed[1:]
+		}
+	}
+	if len(missed) == 0 {
+		return
+	}
+	if b.policy == RunAllMissed && total > len(missed) {
+		log.Printf("%s: %d missed runs, only last %d are run\n", b.name, total, len(missed))
+	}
+	for _, t := range missed {
+		s.fire(b, t)
+	}
+	s.save(b, now)
+}
+
+// fire はtの回のjobを実行し、作られたmessageを投稿します
+func (s *Scheduler) fire(b *ScheduledBot, t time.Time) {
+	msgs, err := b.job.Run(t)
+	if err != nil {
+		log.Printf("%s: %#v\n", b.name, err)
+	}
+	for _, m := range msgs {
+		if m != nil {
+			s.out <- m
+		}
+	}
+	s.save(b, t)
+}
+
+// save はbが最後に実行された時刻を記録します
+func (s *Scheduler) save(b *ScheduledBot, t time.Time) {
+	r := &model.ScheduledRun{
+		Name:    b.name,
+		LastRun: t,
+	}
+	if err := r.Save(s.db); err != nil {
+		log.Printf("%s: %#v\n", b.name, err)
+	}
+}
+
+// NewScheduler は新しいScheduler構造体のポインタを返します
+func NewScheduler(db *sql.DB, out chan *model.Message) *Scheduler {
+	return &Scheduler{
+		db:  db,
+		out: out,
+		now: time.Now,
+	}
+}
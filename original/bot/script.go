@@ -0,0 +1,654 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+const (
+	// scriptMaxSourceSize はスクリプトの最大の大きさです
+	scriptMaxSourceSize = 64 * 1024
+	// scriptMaxSteps はフックを1回呼ぶときに実行できる最大のステップ数です
+	scriptMaxSteps = 1000000
+	// scriptTimeout はフックを1回呼ぶときの時間の上限です
+	scriptTimeout = time.Second
+	// scriptMaxValueSize はスクリプトが1回の演算や関数の呼び出しで作れる値の最大の大きさです
+	scriptMaxValueSize = 1024 * 1024
+	// scriptMaxAlloc はフックを1回呼ぶときにスクリプトが作れる値の大きさの合計の上限です
+	scriptMaxAlloc = 64 * 1024 * 1024
+	// scriptQueueSize はスクリプトのbotが処理を待たせておけるメッセージの数です。溢れたメッセージは捨てます
+	scriptQueueSize = 16
+	// scriptMaxReplyLength は1回の返信の最大の文字数です
+	scriptMaxReplyLength = 4000
+	// scriptMaxKVValueLength はkvに保存できる値の最大の文字数です
+	scriptMaxKVValueLength = 4096
+	// scriptMaxKVCalls はフックを1回呼ぶときにkvを使える回数です
+	scriptMaxKVCalls = 50
+	// scriptMaxKVListLimit はkv.listで返せる最大の件数です
+	scriptMaxKVListLimit = 100
+	// scriptHTTPTimeout はhttp.getのタイムアウトです
+	scriptHTTPTimeout = 3 * time.Second
+	// scriptMaxHTTPResponseSize はhttp.getで読み込むレスポンスの最大の大きさです
+	scriptMaxHTTPResponseSize = 64 * 1024
+
+	// scriptCallKey は実行中のフックの状態をThreadに入れるキーです
+	scriptCallKey = "script.call"
+	// scriptAllocKey は作った値の大きさの合計をThreadに入れるキーです
+	scriptAllocKey = "script.alloc"
+)
+
+const (
+	// ScriptGrantNetwork はhttp.getでネットワークにアクセスすることを許可します
+	ScriptGrantNetwork = "network"
+)
+
+// scriptGrants は許可できる機能です。ファイルシステムにアクセスする機能はありません
+var scriptGrants = map[string]bool{
+	ScriptGrantNetwork: true,
+}
+
+type (
+	// Script はアップロードされたStarlarkのスクリプトをコンパイルしたbotです
+	//
+	// スクリプトはprocess(msg)を定義し、reply(text)を呼ぶか文字列を返して返信します
+	// check(msg)を定義した場合は、それがTrueを返すメッセージだけをprocessに渡します
+	// msgはid, body, username, channelを持つstructです
+	//
+	// 使える機能は次の通りです。ファイルシステムとload文は使えません
+	//   reply(text)
+	//   kv.get(key, default=None), kv.set(key, value, ttl=0), kv.delete(key)
+	//   kv.incr(key, delta=1), kv.list(prefix="", limit=100)
+	//   random.int(n), random.choice(seq)
+	//   http.get(url) (ScriptGrantNetworkを許可した場合のみ)
+	//
+	// フックは1回ごとにscriptMaxStepsとscriptTimeoutで制限されます
+	// 1ステップで大きな値を作れる演算、メソッド、組み込み関数は、読み込むときにscriptGuardsの関数を通るように書き換え、
+	// 1つの値をscriptMaxValueSize、フックを1回呼ぶ間の合計をscriptMaxAllocまでに制限します
+	// トップレベルの変数は読み込んだ後に変更できないので、状態はkvに保存します
+	//
+	//   fields
+	//     name    string
+	//     kv      *KV
+	//     check   starlark.Callable
+	//     process starlark.Callable
+	//     client  *http.Client
+	//     mu      sync.Mutex
+	//     rand    *rand.Rand
+	Script struct {
+		name    string
+		kv      *KV
+		check   starlark.Callable
+		process starlark.Callable
+		client  *http.Client
+		mu      sync.Mutex
+		rand    *rand.Rand
+	}
+
+	// ScriptError はスクリプトの実行中のエラーです
+	ScriptError struct {
+		Name string
+		Err  error
+	}
+
+	// ScriptHost はスクリプトのbotをMulticasterに登録し、入れ替えます
+	//
+	// muはbotsとctxだけを守ります。Multicasterへの登録と解除はregMuで順番に行い、muを持ったまま待ちません
+	//
+	//   fields
+	//     db          *sql.DB
+	//     multicaster *Multicaster
+	//     out         chan *model.Message
+	//     regMu       sync.Mutex
+	//     mu          sync.Mutex
+	//     ctx         context.Context
+	//     bots        map[string]*scriptBot
+	ScriptHost struct {
+		db          *sql.DB
+		multicaster *Multicaster
+		out         chan *model.Message
+		regMu       sync.Mutex
+		mu          sync.Mutex
+		ctx         context.Context
+		bots        map[string]*scriptBot
+	}
+
+	// scriptBot は登録中のスクリプトのbotです
+	//
+	// Multicasterにはrelayを登録し、relayが受け取ったメッセージを待たずにbotのキューに渡します
+	// フックに時間がかかってもMulticasterが他のbotに配るのを止めません
+	scriptBot struct {
+		relay  *Bot
+		cancel context.CancelFunc
+	}
+
+	// scriptCall はフックを1回呼ぶ間の状態です
+	scriptCall struct {
+		replies []string
+		length  int
+		kvCalls int
+	}
+)
+
+// Error はエラーの内容を返します
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("script %s: %s", e.Name, e.Err)
+}
+
+// ReplyMessage はエラーを知らせる返信を返します
+func (e *ScriptError) ReplyMessage() string {
+	return fmt.Sprintf("スクリプト%sでエラーが起きたパカ: %s", e.Name, e.Err)
+}
+
+// CompileScript はkvを状態の保存先にしてsのスクリプトを読み込みます。トップレベルのコードもフックと同じく制限されます
+func CompileScript(kv *KV, s *model.BotScript) (*Script, error) {
+	if len(s.Source) > scriptMaxSourceSize {
+		return nil, fmt.Errorf("source must be at most %d bytes", scriptMaxSourceSize)
+	}
+
+	sc := &Script{
+		name: s.Name,
+		kv:   kv,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, g := range s.Grants {
+		if !scriptGrants[g] {
+			return nil, fmt.Errorf("unknown grant %q", g)
+		}
+		if g == ScriptGrantNetwork {
+			sc.client = &http.Client{Timeout: scriptHTTPTimeout}
+		}
+	}
+
+	f, err := syntax.LegacyFileOptions().Parse(s.Name+".star", s.Source, 0)
+	if err != nil {
+		return nil, err
+	}
+	guardScript(f)
+	predeclared := sc.predeclared()
+	prog, err := starlark.FileProgram(f, predeclared.Has)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := sc.thread()
+	stop := watchScript(thread)
+	globals, err := prog.Init(thread, predeclared)
+	stop()
+	if err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+
+	process, ok := globals["process"].(starlark.Callable)
+	if !ok {
+		return nil, errors.New("script must define process(msg)")
+	}
+	sc.process = process
+	if v, ok := globals["check"]; ok {
+		check, ok := v.(starlark.Callable)
+		if !ok {
+			return nil, errors.New("check must be a function")
+		}
+		sc.check = check
+	}
+	return sc, nil
+}
+
+// Check はcheck(msg)がTrueを返す場合trueを返します。checkがない場合は常にtrueを返します
+func (s *Script) Check(m *model.Message) bool {
+	if s.check == nil {
+		return true
+	}
+	v, _, err := s.call(s.check, m)
+	if err != nil {
+		log.Printf("script %s: %s\n", s.name, err)
+		return false
+	}
+	return bool(v.Truth())
+}
+
+// Process はprocess(msg)を呼び、replyに渡された文字列と戻り値の文字列を返信します
+func (s *Script) Process(m *model.Message) (*model.Message, error) {
+	v, replies, err := s.call(s.process, m)
+	if err != nil {
+		return nil, &ScriptError{Name: s.name, Err: err}
+	}
+
+	switch v := v.(type) {
+	case starlark.NoneType:
+	case starlark.String:
+		replies = append(replies, string(v))
+	default:
+		return nil, &ScriptError{Name: s.name, Err: fmt.Errorf("process must return None or a string, not %s", v.Type())}
+	}
+	body := strings.Join(replies, "\n")
+	if body == "" {
+		return nil, nil
+	}
+	if utf8.RuneCountInString(body) > scriptMaxReplyLength {
+		return nil, &ScriptError{Name: s.name, Err: fmt.Errorf("reply must be at most %d characters", scriptMaxReplyLength)}
+	}
+
+	return &model.Message{
+		Body:     body,
+		UserName: "bot",
+		Channel:  m.Channel,
+	}, nil
+}
+
+// call は制限をかけてfnにmを渡して呼び、戻り値とreplyに渡された文字列を返します
+func (s *Script) call(fn starlark.Callable, m *model.Message) (starlark.Value, []string, error) {
+	thread := s.thread()
+	call := &scriptCall{}
+	thread.SetLocal(scriptCallKey, call)
+
+	msg := starlarkstruct.FromStringDict(starlark.String("message"), starlark.StringDict{
+		"id":       starlark.MakeInt64(m.ID),
+		"body":     starlark.String(m.Body),
+		"username": starlark.String(m.UserName),
+		"channel":  starlark.String(m.Channel),
+	})
+
+	stop := watchScript(thread)
+	v, err := starlark.Call(thread, fn, starlark.Tuple{msg}, nil)
+	stop()
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, call.replies, nil
+}
+
+// thread は実行のステップ数と作る値の大きさを制限した新しいThreadを返します
+func (s *Script) thread() *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: s.name,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Printf("script %s: %s\n", s.name, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(scriptMaxSteps)
+	thread.SetLocal(scriptAllocKey, &scriptAlloc{})
+	return thread
+}
+
+// predeclared はスクリプトから使える関数を返します
+func (s *Script) predeclared() starlark.StringDict {
+	d := starlark.StringDict{
+		"reply": starlark.NewBuiltin("reply", s.reply),
+		"kv": &starlarkstruct.Module{
+			Name: "kv",
+			Members: starlark.StringDict{
+				"get":    starlark.NewBuiltin("kv.get", s.kvGet),
+				"set":    starlark.NewBuiltin("kv.set", s.kvSet),
+				"delete": starlark.NewBuiltin("kv.delete", s.kvDelete),
+				"incr":   starlark.NewBuiltin("kv.incr", s.kvIncr),
+				"list":   starlark.NewBuiltin("kv.list", s.kvList),
+			},
+		},
+		"random": &starlarkstruct.Module{
+			Name: "random",
+			Members: starlark.StringDict{
+				"int":    starlark.NewBuiltin("random.int", s.randomInt),
+				"choice": starlark.NewBuiltin("random.choice", s.randomChoice),
+			},
+		},
+	}
+	for name, v := range scriptGuards {
+		d[name] = v
+	}
+	if s.client != nil {
+		d["http"] = &starlarkstruct.Module{
+			Name: "http",
+			Members: starlark.StringDict{
+				"get": starlark.NewBuiltin("http.get", s.httpGet),
+			},
+		}
+	}
+	return d
+}
+
+// reply は返信する文字列を追加します
+func (s *Script) reply(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var text string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "text", &text); err != nil {
+		return nil, err
+	}
+	call, err := scriptCallOf(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	call.length += utf8.RuneCountInString(text)
+	if call.length > scriptMaxReplyLength {
+		return nil, fmt.Errorf("%s: reply must be at most %d characters", b.Name(), scriptMaxReplyLength)
+	}
+	call.replies = append(call.replies, text)
+	return starlark.None, nil
+}
+
+// kvGet はこのスクリプトのkeyの値を返します。ない場合はdefaultを返します
+func (s *Script) kvGet(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	var def starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "default?", &def); err != nil {
+		return nil, err
+	}
+	if err := s.useKV(thread, b); err != nil {
+		return nil, err
+	}
+
+	v, ok, err := s.kv.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	if !ok {
+		return def, nil
+	}
+	return starlark.String(v), nil
+}
+
+// kvSet はこのスクリプトのkeyに文字列の値を保存します。ttlは秒で、0の場合は期限がありません
+func (s *Script) kvSet(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key, value string
+	var ttl int
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "value", &value, "ttl?", &ttl); err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(value) > scriptMaxKVValueLength {
+		return nil, fmt.Errorf("%s: value must be at most %d characters", b.Name(), scriptMaxKVValueLength)
+	}
+	if ttl < 0 {
+		return nil, fmt.Errorf("%s: ttl must not be negative", b.Name())
+	}
+	if err := s.useKV(thread, b); err != nil {
+		return nil, err
+	}
+
+	if err := s.kv.Set(key, value, time.Duration(ttl)*time.Second); err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	return starlark.None, nil
+}
+
+// kvDelete はこのスクリプトのkeyを削除します
+func (s *Script) kvDelete(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key); err != nil {
+		return nil, err
+	}
+	if err := s.useKV(thread, b); err != nil {
+		return nil, err
+	}
+
+	if err := s.kv.Delete(key); err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	return starlark.None, nil
+}
+
+// kvIncr はこのスクリプトのkeyの整数の値にdeltaを足し、足した後の値を返します
+func (s *Script) kvIncr(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	delta := int64(1)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "delta?", &delta); err != nil {
+		return nil, err
+	}
+	if err := s.useKV(thread, b); err != nil {
+		return nil, err
+	}
+
+	n, err := s.kv.Incr(key, delta)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	return starlark.MakeInt64(n), nil
+}
+
+// kvList はこのスクリプトのprefixで始まるkeyと値のdictをkeyの順に返します
+func (s *Script) kvList(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var prefix string
+	limit := scriptMaxKVListLimit
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "prefix?", &prefix, "limit?", &limit); err != nil {
+		return nil, err
+	}
+	if limit < 1 || limit > scriptMaxKVListLimit {
+		return nil, fmt.Errorf("%s: limit must be between 1 and %d", b.Name(), scriptMaxKVListLimit)
+	}
+	if err := s.useKV(thread, b); err != nil {
+		return nil, err
+	}
+
+	es, err := s.kv.List(prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	d := starlark.NewDict(len(es))
+	for _, e := range es {
+		d.SetKey(starlark.String(e.Key), starlark.String(e.Value))
+	}
+	return d, nil
+}
+
+// useKV はkvを使った回数を数え、scriptMaxKVCallsを超えた場合はエラーを返します
+func (s *Script) useKV(thread *starlark.Thread, b *starlark.Builtin) error {
+	call, err := scriptCallOf(thread, b)
+	if err != nil {
+		return err
+	}
+	call.kvCalls++
+	if call.kvCalls > scriptMaxKVCalls {
+		return fmt.Errorf("%s: kv can be used at most %d times per call", b.Name(), scriptMaxKVCalls)
+	}
+	return nil
+}
+
+// randomInt は0以上n未満の乱数を返します
+func (s *Script) randomInt(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var n int
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "n", &n); err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("%s: n must be positive", b.Name())
+	}
+	return starlark.MakeInt(s.intn(n)), nil
+}
+
+// randomChoice はseqの要素を1つ選んで返します
+func (s *Script) randomChoice(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var seq starlark.Indexable
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "seq", &seq); err != nil {
+		return nil, err
+	}
+	if seq.Len() == 0 {
+		return nil, fmt.Errorf("%s: seq must not be empty", b.Name())
+	}
+	return seq.Index(s.intn(seq.Len())), nil
+}
+
+// intn は0以上n未満の乱数を返します
+func (s *Script) intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Intn(n)
+}
+
+// httpGet はurlをGETしてレスポンスのボディを返します
+func (s *Script) httpGet(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var rawurl string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &rawurl); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("%s: url must be an absolute http or https URL", b.Name())
+	}
+
+	resp, err := s.client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: unexpected status %s", b.Name(), resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, scriptMaxHTTPResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	return starlark.String(body), nil
+}
+
+// scriptCallOf はthreadで実行中のフックの状態を返します。トップレベルのコードではエラーを返します
+func scriptCallOf(thread *starlark.Thread, b *starlark.Builtin) (*scriptCall, error) {
+	call, ok := thread.Local(scriptCallKey).(*scriptCall)
+	if !ok {
+		return nil, fmt.Errorf("%s can only be called from check or process", b.Name())
+	}
+	return call, nil
+}
+
+// watchScript はthreadがscriptTimeoutを超えた場合に止めます
+//
+// 返した関数を呼ぶと監視をやめます
+func watchScript(thread *starlark.Thread) func() {
+	timer := time.AfterFunc(scriptTimeout, func() {
+		thread.Cancel("time limit exceeded")
+	})
+	return func() { timer.Stop() }
+}
+
+// Start はdbに保存された全てのスクリプトを読み込んで登録します
+//
+// 読み込めないスクリプトはログに出して飛ばします。ctxが終了すると全てのスクリプトのbotも止まります
+func (h *ScriptHost) Start(ctx context.Context) error {
+	h.mu.Lock()
+	h.ctx = ctx
+	h.mu.Unlock()
+
+	ss, err := model.BotScriptsAll(h.db)
+	if err != nil {
+		return err
+	}
+	for _, s := range ss {
+		sc, err := h.Compile(s)
+		if err != nil {
+			log.Printf("script %s: %s\n", s.Name, err)
+			continue
+		}
+		h.Load(sc)
+	}
+	return nil
+}
+
+// Compile はsのスクリプトを、スクリプトごとの名前空間のKVを渡して読み込みます
+func (h *ScriptHost) Compile(s *model.BotScript) (*Script, error) {
+	return CompileScript(NewKV(h.db, "script:"+s.Name), s)
+}
+
+// Load はscを登録します。同じ名前のスクリプトが登録されていれば置き換えます
+//
+// Startの前に呼んだ場合は何もしません
+func (h *ScriptHost) Load(sc *Script) {
+	h.regMu.Lock()
+	defer h.regMu.Unlock()
+
+	h.mu.Lock()
+	if h.ctx == nil {
+		h.mu.Unlock()
+		return
+	}
+	sb := newScriptBot(h.ctx, sc, h.out)
+	old := h.bots[sc.name]
+	h.bots[sc.name] = sb
+	h.mu.Unlock()
+
+	h.multicaster.BotIn <- sb.relay
+	if old != nil {
+		h.stop(old)
+	}
+}
+
+// Unload はnameのスクリプトのbotを止めます
+func (h *ScriptHost) Unload(name string) {
+	h.regMu.Lock()
+	defer h.regMu.Unlock()
+
+	h.mu.Lock()
+	sb, ok := h.bots[name]
+	delete(h.bots, name)
+	h.mu.Unlock()
+
+	if ok {
+		h.stop(sb)
+	}
+}
+
+// stop はsbの登録を解除してから止めます。h.regMuを取った状態で呼びます
+func (h *ScriptHost) stop(sb *scriptBot) {
+	// 登録を解除してから止めないとMulticasterが閉じたinに送ってしまいます
+	h.multicaster.BotOut <- sb.relay
+	sb.cancel()
+}
+
+// newScriptBot はscを動かすbotとMulticasterに登録するrelayを起動します
+func newScriptBot(ctx context.Context, sc *Script, out chan *model.Message) *scriptBot {
+	ctx, cancel := context.WithCancel(ctx)
+	relay := &Bot{
+		name: "script:" + sc.name,
+		in:   make(chan *model.Message),
+	}
+	b := &Bot{
+		name:      relay.name,
+		in:        make(chan *model.Message, scriptQueueSize),
+		out:       out,
+		checker:   And(NewUserDenyChecker("bot"), sc),
+		processor: sc,
+	}
+
+	// relayが止まってからbotを止め、閉じたキューに送らないようにします
+	botCtx, botCancel := context.WithCancel(context.Background())
+	go b.Run(botCtx)
+	go func() {
+		defer botCancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m := <-relay.in:
+				select {
+				case b.in <- m:
+				default:
+					log.Printf("%s: queue is full, dropped message %d\n", b.name, m.ID)
+				}
+			}
+		}
+	}()
+	return &scriptBot{relay: relay, cancel: cancel}
+}
+
+// NewScriptHost は新しいScriptHost構造体のポインタを返します
+func NewScriptHost(db *sql.DB, multicaster *Multicaster, out chan *model.Message) *ScriptHost {
+	return &ScriptHost{
+		db:          db,
+		multicaster: multicaster,
+		out:         out,
+		bots:        map[string]*scriptBot{},
+	}
+}
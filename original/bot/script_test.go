@@ -0,0 +1,189 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestScriptはkvに状態を保存して返信する(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE bot_kv (namespace TEXT NOT NULL, key TEXT NOT NULL, value TEXT NOT NULL DEFAULT "", expires_at INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (namespace, key))`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+
+	sc, err := CompileScript(NewKV(db, "script:counter"), &model.BotScript{Name: "counter", Source: `
+def check(msg):
+    return msg.body.startswith("count")
+
+def process(msg):
+    n = int(kv.get(msg.username, "0")) + 1
+    kv.set(msg.username, str(n))
+    reply("@%s %d回目パカ" % (msg.username, n))
+`})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	if sc.Check(&model.Message{Body: "hello"}) {
+		t.Fatal("check expected to be false but not")
+	}
+	m := &model.Message{Body: "count", UserName: "alice", Channel: "random"}
+	if !sc.Check(m) {
+		t.Fatal("check expected to be true but not")
+	}
+	for _, expected := range []string{"@alice 1回目パカ", "@alice 2回目パカ"} {
+		reply, err := sc.Process(m)
+		if err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		if reply.Body != expected || reply.Channel != "random" {
+			t.Fatalf("%q in random expected but not, actual %q in %q", expected, reply.Body, reply.Channel)
+		}
+	}
+	if v, err := model.KVGet(db, "script:counter", "alice", time.Now()); err != nil || v != "2" {
+		t.Fatalf("kv value 2 expected but not, actual %q, %v", v, err)
+	}
+}
+
+func TestScriptは制限を超えると止まる(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		grants []string
+		err    string
+	}{
+		{name: "no process", source: `x = 1`, err: "process"},
+		{name: "no network", source: `def process(msg): return http.get("http://example.com")`, err: "undefined: http"},
+		{name: "no load", source: "load(\"os.star\", \"os\")\ndef process(msg): pass", err: "load"},
+		{name: "unknown grant", source: `def process(msg): pass`, grants: []string{"filesystem"}, err: "unknown grant"},
+		{name: "top level loop", source: "n = len([i for i in range(100000000) if False])\ndef process(msg): pass", err: "too many steps"},
+	}
+	for _, c := range cases {
+		_, err := CompileScript(nil, &model.BotScript{Name: "limited", Source: c.source, Grants: c.grants})
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: error containing %q expected but not, actual %v", c.name, c.err, err)
+		}
+	}
+
+	sc, err := CompileScript(nil, &model.BotScript{Name: "loop", Source: `
+def process(msg):
+    for i in range(100000000):
+        pass
+`})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	_, err = sc.Process(&model.Message{Body: "loop"})
+	re, ok := err.(ReplyError)
+	if !ok || !strings.Contains(re.ReplyMessage(), "too many steps") {
+		t.Fatalf("step limit error expected but not, actual %v", err)
+	}
+}
+
+func TestScriptは大きな値を作ると止まる(t *testing.T) {
+	cases := map[string]string{
+		"repeat":  `return "a" * (1 << 28)`,
+		"list":    `return len(list(range(1 << 28)))`,
+		"join":    `return ",".join(["a" * 1000] * 2000)`,
+		"format":  `s = "a" * 600000; return "%s%s" % (s, s)`,
+		"double":  "s = \"ab\"\n    for i in range(40):\n        s += s",
+		"str":     `return str(["a" * 1000] * 2000)`,
+		"getattr": `return getattr(",", "join")(["a" * 1000] * 2000)`,
+		"int":     "n = 3\n    for i in range(30):\n        n = n * n",
+		"total":   "xs = []\n    for i in range(100):\n        xs.append(\"a\" * 1000000)",
+		"slice":   "l = [0] * 60000\n    for i in range(100):\n        m = l[:]",
+	}
+	for name, body := range cases {
+		sc, err := CompileScript(nil, &model.BotScript{Name: name, Source: "def process(msg):\n    " + body + "\n"})
+		if err != nil {
+			t.Fatalf("%s: unexpected error %s", name, err)
+		}
+		_, err = sc.Process(&model.Message{Body: "big"})
+		if err == nil || !strings.Contains(err.Error(), " bytes") {
+			t.Errorf("%s: size limit error expected but not, actual %v", name, err)
+		}
+	}
+
+	if _, err := CompileScript(nil, &model.BotScript{Name: "toplevel", Source: "s = 'a' * (1 << 28)\ndef process(msg): pass"}); err == nil || !strings.Contains(err.Error(), "value must be at most") {
+		t.Fatalf("size limit error expected but not, actual %v", err)
+	}
+}
+
+func TestScriptは書き換えた演算を元と同じように計算する(t *testing.T) {
+	sc, err := CompileScript(nil, &model.BotScript{Name: "ops", Source: `
+def process(msg):
+    xs = [1]
+    ys = xs
+    xs += [2, 3]
+    counts = {"a": 1}
+    counts["a"] += 2
+    words = msg.body.split(" ")
+    s = "-".join(words[::-1]) + "!" * 2
+    s += " %d %s" % (len(ys), counts["a"])
+    return s + " " + "{}/{}".format(getattr(msg, "username"), sorted(counts.keys())[0]) + str(1 << 3)
+`})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	m, err := sc.Process(&model.Message{Body: "a b c", UserName: "alice"})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if expected := "c-b-a!! 3 3 alice/a8"; m.Body != expected {
+		t.Fatalf("%q expected but not, actual %q", expected, m.Body)
+	}
+
+	sc, err = CompileScript(nil, &model.BotScript{Name: "typo", Source: "def process(msg):\n    return msg.bdy\n"})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if _, err := sc.Process(&model.Message{Body: "typo"}); err == nil || !strings.Contains(err.Error(), ".bdy") {
+		t.Fatalf("attribute error expected but not, actual %v", err)
+	}
+}
+
+func TestScriptHostは処理が詰まったスクリプトで他のbotを止めない(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgIn := make(chan *model.Message)
+	mc := NewMulticaster(msgIn)
+	go mc.Run(ctx)
+	probe := &Bot{name: "probe", in: make(chan *model.Message)}
+	mc.BotIn <- probe
+
+	// 返信を誰も読まないので、スクリプトのbotは最初の返信で詰まります
+	h := NewScriptHost(nil, mc, make(chan *model.Message))
+	h.ctx = ctx
+	sc, err := CompileScript(nil, &model.BotScript{Name: "echo", Source: `def process(msg): return msg.body`})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	h.Load(sc)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < scriptQueueSize*3; i++ {
+			msgIn <- &model.Message{ID: int64(i), Body: "hello", UserName: "alice"}
+			<-probe.in
+		}
+		h.Unload("echo")
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("multicaster expected not to be blocked by the script but it was")
+	}
+}
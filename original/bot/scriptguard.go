@@ -0,0 +1,714 @@
+package bot
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+const (
+	// scriptWordSize はリストやタプルの要素1つを数えるときのバイト数です
+	scriptWordSize = 16
+	// scriptEntrySize はdictの要素1つを数えるときのバイト数です
+	scriptEntrySize = 48
+
+	// scriptBinaryName は演算を書き換えて呼ぶ関数の名前です。スクリプトには書けない名前にしています
+	scriptBinaryName = "$binary"
+	// scriptInplaceName は代入演算を書き換えて呼ぶ関数の名前です
+	scriptInplaceName = "$inplace"
+	// scriptAttrName は属性の参照を書き換えて呼ぶ関数の名前です
+	scriptAttrName = "$attr"
+	// scriptSliceName はスライスを書き換えて呼ぶ関数の名前です
+	scriptSliceName = "$slice"
+)
+
+var (
+	// scriptBinaryOps は結果が引数より大きくなる演算です
+	scriptBinaryOps = map[syntax.Token]bool{
+		syntax.PLUS:    true,
+		syntax.STAR:    true,
+		syntax.PERCENT: true,
+		syntax.PIPE:    true,
+		syntax.LTLT:    true,
+	}
+
+	// scriptAssignOps は代入演算と、それが使う演算です
+	scriptAssignOps = map[syntax.Token]syntax.Token{
+		syntax.PLUS_EQ:    syntax.PLUS,
+		syntax.STAR_EQ:    syntax.STAR,
+		syntax.PERCENT_EQ: syntax.PERCENT,
+		syntax.PIPE_EQ:    syntax.PIPE,
+		syntax.LTLT_EQ:    syntax.LTLT,
+	}
+
+	// scriptGuards はスクリプトから使える関数のうち、作る値の大きさを数えるものです
+	//
+	// 書き換えたスクリプトが呼ぶ関数と、値を作る組み込み関数を置き換えたものがあります
+	scriptGuards = starlark.StringDict{
+		scriptBinaryName:  starlark.NewBuiltin(scriptBinaryName, scriptBinary),
+		scriptInplaceName: starlark.NewBuiltin(scriptInplaceName, scriptInplace),
+		scriptAttrName:    starlark.NewBuiltin(scriptAttrName, scriptAttr),
+		scriptSliceName:   starlark.NewBuiltin(scriptSliceName, scriptSlice),
+		"getattr":         starlark.NewBuiltin("getattr", scriptGetattr),
+		"list":            scriptBuiltin("list", scriptIterableSize(scriptWordSize)),
+		"tuple":           scriptBuiltin("tuple", scriptIterableSize(scriptWordSize)),
+		"sorted":          scriptBuiltin("sorted", scriptIterableSize(scriptWordSize)),
+		"reversed":        scriptBuiltin("reversed", scriptIterableSize(scriptWordSize)),
+		"enumerate":       scriptBuiltin("enumerate", scriptIterableSize(4*scriptWordSize)),
+		"dict":            scriptBuiltin("dict", scriptDictSize),
+		"zip":             scriptBuiltin("zip", scriptZipSize),
+		"bytes":           scriptBuiltin("bytes", scriptBytesSize),
+		"str":             scriptBuiltin("str", scriptStrSize),
+		"repr":            scriptBuiltin("repr", scriptArgsReprSize),
+		"print":           scriptBuiltin("print", scriptArgsReprSize),
+		"fail":            scriptBuiltin("fail", scriptArgsReprSize),
+	}
+)
+
+// scriptAlloc はThreadで作った値の大きさの合計です
+type scriptAlloc struct {
+	size int
+}
+
+// reserveScriptAlloc はthreadでsizeバイトの値を作るときに呼び、1つの値か合計が上限を超える場合はエラーを返します
+func reserveScriptAlloc(thread *starlark.Thread, name string, size int) error {
+	if size > scriptMaxValueSize {
+		return fmt.Errorf("%s: value must be at most %d bytes", name, scriptMaxValueSize)
+	}
+	a, ok := thread.Local(scriptAllocKey).(*scriptAlloc)
+	if !ok {
+		return nil
+	}
+	a.size += size
+	if a.size > scriptMaxAlloc {
+		return fmt.Errorf("%s: values must be at most %d bytes in total", name, scriptMaxAlloc)
+	}
+	return nil
+}
+
+// guardScript はfのスクリプトを、大きな値を作れる演算と属性の参照がscriptGuardsの関数を通るように書き換えます
+func guardScript(f *syntax.File) {
+	guardStmts(f.Stmts)
+}
+
+// guardStmts はstmtsの文を書き換えます
+func guardStmts(stmts []syntax.Stmt) {
+	for _, s := range stmts {
+		guardStmt(s)
+	}
+}
+
+// guardStmt はsの文を書き換えます
+func guardStmt(s syntax.Stmt) {
+	switch s := s.(type) {
+	case *syntax.AssignStmt:
+		op, ok := scriptAssignOps[s.Op]
+		if !ok || !isScriptAugmentable(s.LHS) {
+			s.LHS = guardTarget(s.LHS)
+			s.RHS = guardExpr(s.RHS)
+			return
+		}
+		// x op= y を x = $inplace(op, x, y) にします。x[i]やx.fのxとiは2回評価されます
+		s.LHS = guardTarget(s.LHS)
+		s.RHS = scriptGuardCall(scriptInplaceName, syntax.Start(s.LHS), s.OpPos, scriptIntLiteral(int(op), s.OpPos), scriptReadTarget(s.LHS), guardExpr(s.RHS))
+		s.Op = syntax.EQ
+	case *syntax.DefStmt:
+		guardParams(s.Params)
+		guardStmts(s.Body)
+	case *syntax.ExprStmt:
+		s.X = guardExpr(s.X)
+	case *syntax.ForStmt:
+		s.Vars = guardTarget(s.Vars)
+		s.X = guardExpr(s.X)
+		guardStmts(s.Body)
+	case *syntax.WhileStmt:
+		s.Cond = guardExpr(s.Cond)
+		guardStmts(s.Body)
+	case *syntax.IfStmt:
+		s.Cond = guardExpr(s.Cond)
+		guardStmts(s.True)
+		guardStmts(s.False)
+	case *syntax.ReturnStmt:
+		if s.Result != nil {
+			s.Result = guardExpr(s.Result)
+		}
+	}
+}
+
+// guardParams は関数の引数のデフォルト値を書き換えます
+func guardParams(params []syntax.Expr) {
+	for _, p := range params {
+		if p, ok := p.(*syntax.BinaryExpr); ok && p.Op == syntax.EQ {
+			p.Y = guardExpr(p.Y)
+		}
+	}
+}
+
+// guardTarget は代入先のeの中の式を書き換えます。代入先そのものは書き換えません
+func guardTarget(e syntax.Expr) syntax.Expr {
+	switch e := e.(type) {
+	case *syntax.ParenExpr:
+		e.X = guardTarget(e.X)
+	case *syntax.ListExpr:
+		for i, x := range e.List {
+			e.List[i] = guardTarget(x)
+		}
+	case *syntax.TupleExpr:
+		for i, x := range e.List {
+			e.List[i] = guardTarget(x)
+		}
+	case *syntax.IndexExpr:
+		e.X = guardExpr(e.X)
+		e.Y = guardExpr(e.Y)
+	case *syntax.DotExpr:
+		e.X = guardExpr(e.X)
+	}
+	return e
+}
+
+// isScriptAugmentable は代入演算の代入先にできる場合trueを返します
+func isScriptAugmentable(e syntax.Expr) bool {
+	switch e.(type) {
+	case *syntax.Ident, *syntax.IndexExpr, *syntax.DotExpr:
+		return true
+	}
+	return false
+}
+
+// scriptReadTarget は書き換えた代入先eの値を読む式を返します
+func scriptReadTarget(e syntax.Expr) syntax.Expr {
+	switch e := e.(type) {
+	case *syntax.Ident:
+		return &syntax.Ident{NamePos: e.NamePos, Name: e.Name}
+	case *syntax.IndexExpr:
+		return &syntax.IndexExpr{X: e.X, Lbrack: e.Lbrack, Y: e.Y, Rbrack: e.Rbrack}
+	case *syntax.DotExpr:
+		return scriptGuardCall(scriptAttrName, syntax.Start(e), e.NamePos, e.X, scriptStringLiteral(e.Name.Name, e.NamePos))
+	}
+	return e
+}
+
+// guardExpr はeの式を書き換えた式を返します
+func guardExpr(e syntax.Expr) syntax.Expr {
+	switch e := e.(type) {
+	case *syntax.BinaryExpr:
+		e.X = guardExpr(e.X)
+		e.Y = guardExpr(e.Y)
+		if scriptBinaryOps[e.Op] {
+			return scriptGuardCall(scriptBinaryName, syntax.Start(e), e.OpPos, scriptIntLiteral(int(e.Op), e.OpPos), e.X, e.Y)
+		}
+	case *syntax.CallExpr:
+		e.Fn = guardExpr(e.Fn)
+		for i, a := range e.Args {
+			if a, ok := a.(*syntax.BinaryExpr); ok && a.Op == syntax.EQ {
+				a.Y = guardExpr(a.Y)
+				continue
+			}
+			e.Args[i] = guardExpr(a)
+		}
+	case *syntax.Comprehension:
+		e.Body = guardExpr(e.Body)
+		for _, c := range e.Clauses {
+			switch c := c.(type) {
+			case *syntax.ForClause:
+				c.Vars = guardTarget(c.Vars)
+				c.X = guardExpr(c.X)
+			case *syntax.IfClause:
+				c.Cond = guardExpr(c.Cond)
+			}
+		}
+	case *syntax.CondExpr:
+		e.Cond = guardExpr(e.Cond)
+		e.True = guardExpr(e.True)
+		e.False = guardExpr(e.False)
+	case *syntax.DictEntry:
+		e.Key = guardExpr(e.Key)
+		e.Value = guardExpr(e.Value)
+	case *syntax.DictExpr:
+		for i, x := range e.List {
+			e.List[i] = guardExpr(x)
+		}
+	case *syntax.DotExpr:
+		return scriptGuardCall(scriptAttrName, syntax.Start(e), e.NamePos, guardExpr(e.X), scriptStringLiteral(e.Name.Name, e.NamePos))
+	case *syntax.IndexExpr:
+		e.X = guardExpr(e.X)
+		e.Y = guardExpr(e.Y)
+	case *syntax.LambdaExpr:
+		guardParams(e.Params)
+		e.Body = guardExpr(e.Body)
+	case *syntax.ListExpr:
+		for i, x := range e.List {
+			e.List[i] = guardExpr(x)
+		}
+	case *syntax.TupleExpr:
+		for i, x := range e.List {
+			e.List[i] = guardExpr(x)
+		}
+	case *syntax.ParenExpr:
+		e.X = guardExpr(e.X)
+	case *syntax.SliceExpr:
+		e.X = guardExpr(e.X)
+		strided := 0
+		for _, x := range []*syntax.Expr{&e.Lo, &e.Hi, &e.Step} {
+			if *x != nil {
+				*x = guardExpr(*x)
+			}
+		}
+		if e.Step != nil {
+			strided = 1
+		}
+		return scriptGuardCall(scriptSliceName, syntax.Start(e), e.Lbrack, e, scriptIntLiteral(strided, e.Lbrack))
+	case *syntax.UnaryExpr:
+		if e.X != nil {
+			e.X = guardExpr(e.X)
+		}
+	}
+	return e
+}
+
+// scriptGuardCall はstartから始まり、posでnameの関数をargsで呼ぶ式を返します
+func scriptGuardCall(name string, start, pos syntax.Position, args ...syntax.Expr) *syntax.CallExpr {
+	return &syntax.CallExpr{
+		Fn:     &syntax.Ident{NamePos: start, Name: name},
+		Lparen: pos,
+		Args:   args,
+		Rparen: pos,
+	}
+}
+
+// scriptIntLiteral はnの整数のリテラルを返します
+func scriptIntLiteral(n int, pos syntax.Position) *syntax.Literal {
+	return &syntax.Literal{Token: syntax.INT, TokenPos: pos, Raw: strconv.Itoa(n), Value: int64(n)}
+}
+
+// scriptStringLiteral はsの文字列のリテラルを返します
+func scriptStringLiteral(s string, pos syntax.Position) *syntax.Literal {
+	return &syntax.Literal{Token: syntax.STRING, TokenPos: pos, Raw: strconv.Quote(s), Value: s}
+}
+
+// scriptBinary はx op yを計算します。結果の大きさを先に見積もって制限します
+func scriptBinary(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var op int
+	var x, y starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 3, &op, &x, &y); err != nil {
+		return nil, err
+	}
+	return scriptBinaryOp(thread, syntax.Token(op), x, y)
+}
+
+// scriptInplace はx op= yのop=を計算します。リストの+=はxを書き換えます
+func scriptInplace(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var op int
+	var x, y starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 3, &op, &x, &y); err != nil {
+		return nil, err
+	}
+	l, ok := x.(*starlark.List)
+	if _, iterable := y.(starlark.Iterable); !ok || !iterable || syntax.Token(op) != syntax.PLUS {
+		return scriptBinaryOp(thread, syntax.Token(op), x, y)
+	}
+
+	if err := reserveScriptAlloc(thread, "+=", scriptMul(starlark.Len(y), scriptWordSize)); err != nil {
+		return nil, err
+	}
+	extend, err := l.Attr("extend")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := starlark.Call(thread, extend, starlark.Tuple{y}, nil); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// scriptBinaryOp は大きさを制限してx op yを計算します
+func scriptBinaryOp(thread *starlark.Thread, op syntax.Token, x, y starlark.Value) (starlark.Value, error) {
+	if err := reserveScriptAlloc(thread, op.String(), scriptBinarySize(op, x, y)); err != nil {
+		return nil, err
+	}
+	return starlark.Binary(op, x, y)
+}
+
+// scriptBinarySize はx op yの結果のおおよその大きさを返します
+func scriptBinarySize(op syntax.Token, x, y starlark.Value) int {
+	switch op {
+	case syntax.STAR:
+		if isScriptSequence(x) {
+			return scriptMul(scriptSize(x), scriptRepeat(y))
+		}
+		if isScriptSequence(y) {
+			return scriptMul(scriptSize(y), scriptRepeat(x))
+		}
+	case syntax.LTLT:
+		return scriptSize(x) + 64
+	case syntax.PERCENT:
+		if format, ok := x.(starlark.String); ok {
+			return len(format) + scriptMul(strings.Count(string(format), "%"), scriptReprSize(y))
+		}
+	}
+	return scriptSize(x) + scriptSize(y)
+}
+
+// scriptAttr はx.nameを返します。文字列やリストのメソッドは作る値の大きさを制限するものにして返します
+func scriptAttr(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	var name string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &x, &name); err != nil {
+		return nil, err
+	}
+	v, err := scriptGetAttr(x, name)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("%s has no .%s field or method", x.Type(), name)
+	}
+	return v, nil
+}
+
+// scriptGetattr は組み込みのgetattrをscriptAttrと同じ制限をかけて置き換えます
+func scriptGetattr(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x, def starlark.Value
+	var name string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &x, &name, &def); err != nil {
+		return nil, err
+	}
+	v, err := scriptGetAttr(x, name)
+	if _, ok := err.(starlark.NoSuchAttrError); (ok || (err == nil && v == nil)) && def != nil {
+		return def, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	if v == nil {
+		return nil, fmt.Errorf("%s: %s has no .%s field or method", b.Name(), x.Type(), name)
+	}
+	return v, nil
+}
+
+// scriptGetAttr はx.nameを返します。ない場合はnilを返します
+func scriptGetAttr(x starlark.Value, name string) (starlark.Value, error) {
+	h, ok := x.(starlark.HasAttrs)
+	if !ok {
+		return nil, nil
+	}
+	v, err := h.Attr(name)
+	if err != nil || v == nil {
+		return v, err
+	}
+	method, ok := v.(*starlark.Builtin)
+	if !ok || method.Receiver() == nil {
+		return v, nil
+	}
+	switch x.(type) {
+	case starlark.String, starlark.Bytes, *starlark.List, *starlark.Dict:
+	default:
+		return v, nil
+	}
+
+	return starlark.NewBuiltin(method.Name(), func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		size := scriptMethodSize(x, name, args, kwargs)
+		if err := reserveScriptAlloc(thread, name, size); err != nil {
+			return nil, err
+		}
+		v, err := starlark.Call(thread, method, args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 && isScriptCopyMethod(x, name) {
+			if err := reserveScriptAlloc(thread, name, scriptSize(v)); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	}), nil
+}
+
+// scriptMethodSize はx.name(args, kwargs)が作る値のおおよその大きさを返します
+//
+// 結果が引数よりずっと大きくなるメソッドだけを見積もり、それ以外は0を返します
+func scriptMethodSize(x starlark.Value, name string, args starlark.Tuple, kwargs []starlark.Tuple) int {
+	switch x := x.(type) {
+	case starlark.String:
+		switch name {
+		case "join":
+			if len(args) != 1 {
+				return 0
+			}
+			n := 0
+			iter := starlark.Iterate(args[0])
+			if iter == nil {
+				return 0
+			}
+			defer iter.Done()
+			var e starlark.Value
+			for iter.Next(&e) && n <= scriptMaxValueSize {
+				n += len(x) + scriptSize(e)
+			}
+			return n
+		case "replace":
+			if len(args) < 2 {
+				return 0
+			}
+			old, ok1 := starlark.AsString(args[0])
+			repl, ok2 := starlark.AsString(args[1])
+			if !ok1 || !ok2 || len(repl) <= len(old) {
+				return 0
+			}
+			return len(x) + scriptMul(strings.Count(string(x), old), len(repl)-len(old))
+		case "format":
+			largest := 0
+			for _, a := range args {
+				if n := scriptReprSize(a); n > largest {
+					largest = n
+				}
+			}
+			for _, kv := range kwargs {
+				if n := scriptReprSize(kv[1]); n > largest {
+					largest = n
+				}
+			}
+			return len(x) + scriptMul(strings.Count(string(x), "{"), largest)
+		}
+	case *starlark.List:
+		if name == "extend" && len(args) == 1 {
+			return scriptMul(starlark.Len(args[0]), scriptWordSize)
+		}
+	case *starlark.Dict:
+		if name == "update" {
+			n := len(kwargs)
+			if len(args) == 1 {
+				n += starlark.Len(args[0])
+			}
+			return scriptMul(n, scriptEntrySize)
+		}
+	}
+	return 0
+}
+
+// isScriptCopyMethod はx.nameが新しい値を作って返すメソッドの場合trueを返します
+func isScriptCopyMethod(x starlark.Value, name string) bool {
+	switch x.(type) {
+	case starlark.String, starlark.Bytes:
+		return true
+	case *starlark.Dict:
+		return name == "items" || name == "keys" || name == "values"
+	}
+	return false
+}
+
+// scriptSlice はスライスした値の大きさを数えます。刻みのない文字列のスライスは元の文字列を共有するので数えません
+func scriptSlice(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var v starlark.Value
+	var strided int
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &v, &strided); err != nil {
+		return nil, err
+	}
+	switch v.(type) {
+	case starlark.String, starlark.Bytes:
+		if strided == 0 {
+			return v, nil
+		}
+	}
+	if err := reserveScriptAlloc(thread, "slice", scriptSize(v)); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// scriptBuiltin は組み込み関数のnameを、sizeで見積もった大きさを制限して呼ぶものにします
+func scriptBuiltin(name string, size func(args starlark.Tuple, kwargs []starlark.Tuple) int) *starlark.Builtin {
+	fn := starlark.Universe[name]
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := reserveScriptAlloc(thread, name, size(args, kwargs)); err != nil {
+			return nil, err
+		}
+		return starlark.Call(thread, fn, args, kwargs)
+	})
+}
+
+// scriptIterableSize は最初の引数の要素1つをnバイトとして数える関数を返します
+func scriptIterableSize(n int) func(args starlark.Tuple, kwargs []starlark.Tuple) int {
+	return func(args starlark.Tuple, kwargs []starlark.Tuple) int {
+		if len(args) == 0 {
+			return 0
+		}
+		return scriptMul(starlark.Len(args[0]), n)
+	}
+}
+
+// scriptDictSize はdict(args, kwargs)の大きさを見積もります
+func scriptDictSize(args starlark.Tuple, kwargs []starlark.Tuple) int {
+	n := len(kwargs)
+	if len(args) > 0 {
+		n += starlark.Len(args[0])
+	}
+	return scriptMul(n, scriptEntrySize)
+}
+
+// scriptZipSize はzip(args)の大きさを見積もります
+func scriptZipSize(args starlark.Tuple, kwargs []starlark.Tuple) int {
+	shortest := -1
+	for _, a := range args {
+		if n := starlark.Len(a); n >= 0 && (shortest < 0 || n < shortest) {
+			shortest = n
+		}
+	}
+	return scriptMul(shortest, (len(args)+1)*scriptWordSize)
+}
+
+// scriptBytesSize はbytes(args)の大きさを見積もります
+func scriptBytesSize(args starlark.Tuple, kwargs []starlark.Tuple) int {
+	if len(args) == 0 {
+		return 0
+	}
+	if s, ok := args[0].(starlark.String); ok {
+		return len(s)
+	}
+	return starlark.Len(args[0])
+}
+
+// scriptStrSize はstr(args)の大きさを見積もります。文字列はそのまま返すので数えません
+func scriptStrSize(args starlark.Tuple, kwargs []starlark.Tuple) int {
+	if len(args) == 1 {
+		if _, ok := args[0].(starlark.String); ok {
+			return 0
+		}
+	}
+	return scriptArgsReprSize(args, kwargs)
+}
+
+// scriptArgsReprSize は引数を全て文字列にしたおおよその長さを返します
+func scriptArgsReprSize(args starlark.Tuple, kwargs []starlark.Tuple) int {
+	n := 0
+	for _, a := range args {
+		n += scriptReprSize(a) + 1
+	}
+	for _, kv := range kwargs {
+		n += scriptReprSize(kv[1]) + 1
+	}
+	return n
+}
+
+// isScriptSequence は繰り返しで大きくなる値の場合trueを返します
+func isScriptSequence(v starlark.Value) bool {
+	switch v.(type) {
+	case starlark.String, starlark.Bytes, starlark.Tuple, *starlark.List:
+		return true
+	}
+	return false
+}
+
+// scriptRepeat は繰り返しの回数としてのvを返します。整数でない場合は0を返します
+func scriptRepeat(v starlark.Value) int {
+	i, ok := v.(starlark.Int)
+	if !ok {
+		return 0
+	}
+	n, ok := i.Int64()
+	if !ok || n > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	if n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+// scriptMul は上限で止めたa*bを返します。負の数は0として扱います
+func scriptMul(a, b int) int {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	if a > math.MaxInt32/b {
+		return math.MaxInt32
+	}
+	return a * b
+}
+
+// scriptSize はvのおおよそのバイト数を返します。要素の値は数えません
+func scriptSize(v starlark.Value) int {
+	switch v := v.(type) {
+	case starlark.String:
+		return len(v)
+	case starlark.Bytes:
+		return len(v)
+	case starlark.Int:
+		return scriptIntSize(v)
+	case starlark.Tuple:
+		return len(v) * scriptWordSize
+	case *starlark.List:
+		return v.Len() * scriptWordSize
+	case *starlark.Dict:
+		return v.Len() * scriptEntrySize
+	}
+	return 0
+}
+
+// scriptIntSize はiのバイト数を返します。64ビットに収まる場合は0を返します
+func scriptIntSize(i starlark.Int) int {
+	if _, ok := i.Int64(); ok {
+		return 0
+	}
+	return i.BigInt().BitLen()/8 + 1
+}
+
+// scriptReprSize はvを文字列にしたおおよその長さを返します
+//
+// scriptMaxValueSizeを超えた時点で数えるのをやめます。自分を含むリストやdictは1回だけ数えます
+func scriptReprSize(v starlark.Value) int {
+	n := 0
+	var path []starlark.Value
+	var walk func(v starlark.Value)
+	walk = func(v starlark.Value) {
+		if n > scriptMaxValueSize {
+			return
+		}
+		switch v := v.(type) {
+		case starlark.String:
+			n += len(v) + 2
+		case starlark.Bytes:
+			n += len(v) + 3
+		case starlark.Int:
+			n += scriptIntSize(v)*3 + 20
+		case starlark.Tuple:
+			n += 2
+			for _, e := range v {
+				n += 2
+				walk(e)
+			}
+		case *starlark.List, *starlark.Dict:
+			for _, p := range path {
+				if p == v {
+					n += 5
+					return
+				}
+			}
+			path = append(path, v)
+			defer func() { path = path[:len(path)-1] }()
+
+			n += 2
+			d, _ := v.(*starlark.Dict)
+			iter := starlark.Iterate(v)
+			defer iter.Done()
+			var e starlark.Value
+			for iter.Next(&e) && n <= scriptMaxValueSize {
+				n += 2
+				walk(e)
+				if d != nil {
+					value, _, _ := d.Get(e)
+					n += 2
+					walk(value)
+				}
+			}
+		default:
+			n += len(v.String())
+		}
+	}
+	walk(v)
+	return n
+}
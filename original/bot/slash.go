@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+// slashCommandTimeout はSlackと同じく、スラッシュコマンドの応答を待つ時間です
+const slashCommandTimeout = 3 * time.Second
+
+type (
+	// SlashCommandDispatcher は登録されたスラッシュコマンドをSlack互換の形式で外部のURLにPOSTするCommandFallbackです
+	//
+	// レスポンスがJSONなら"text"と"attachments"を、そうでなければボディをそのまま返信にします
+	//
+	//   fields
+	//     db     *sql.DB
+	//     client *http.Client
+	SlashCommandDispatcher struct {
+		db     *sql.DB
+		client *http.Client
+	}
+
+	// slashCommandResponse はスラッシュコマンドのレスポンスのうち、返信に使うフィールドです
+	slashCommandResponse struct {
+		Text        string `json:"text"`
+		Attachments []struct {
+			Fallback string `json:"fallback"`
+			Title    string `json:"title"`
+			Text     string `json:"text"`
+		} `json:"attachments"`
+	}
+
+	// slashCommandError はスラッシュコマンドのURLがエラーを返したことを表すエラーです
+	slashCommandError struct {
+		command string
+		status  string
+	}
+)
+
+// Dispatch はnameのスラッシュコマンドが登録されていれば、そのURLにPOSTしたレスポンスを返信にします
+func (d *SlashCommandDispatcher) Dispatch(msgIn *model.Message, name, text string) (*model.Message, bool, error) {
+	c, err := model.SlashCommandByCommand(d.db, name)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, false, nil
+	case err != nil:
+		return nil, true, err
+	}
+
+	form := url.Values{
+		"token":        {c.Token},
+		"command":      {"/" + c.Command},
+		"text":         {text},
+		"user_id":      {msgIn.UserName},
+		"user_name":    {msgIn.UserName},
+		"channel_id":   {msgIn.Channel},
+		"channel_name": {msgIn.Channel},
+		"trigger_id":   {strconv.FormatInt(msgIn.ID, 10)},
+	}
+	resp, err := d.client.PostForm(c.URL, form)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseSize))
+	if err != nil {
+		return nil, true, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, true, &slashCommandError{command: c.Command, status: resp.Status}
+	}
+
+	reply := strings.TrimSpace(string(body))
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var r slashCommandResponse
+		if err := json.Unmarshal(body, &r); err != nil {
+			return nil, true, err
+		}
+		lines := []string{}
+		if r.Text != "" {
+			lines = append(lines, r.Text)
+		}
+		for _, a := range r.Attachments {
+			switch {
+			case a.Title != "" || a.Text != "":
+				lines = append(lines, strings.TrimSpace(a.Title+"\n"+a.Text))
+			case a.Fallback != "":
+				lines = append(lines, a.Fallback)
+			}
+		}
+		reply = strings.Join(lines, "\n")
+	}
+
+	// 空のレスポンスは、コマンド側がchat.postMessageなどで後から返信することを表します
+	if reply == "" {
+		return nil, true, nil
+	}
+	return &model.Message{
+		Body:     reply,
+		UserName: "bot",
+		Channel:  msgIn.Channel,
+	}, true, nil
+}
+
+// Error はエラーメッセージを返します
+func (e *slashCommandError) Error() string {
+	return fmt.Sprintf("slash command /%s: unexpected status %s", e.command, e.status)
+}
+
+// ReplyMessage はユーザーに返信するメッセージを返します
+func (e *slashCommandError) ReplyMessage() string {
+	return fmt.Sprintf("コマンド「/%s」の応答がエラーだったパカ (%s)", e.command, e.status)
+}
+
+// NewSlashCommandDispatcher は新しいSlashCommandDispatcher構造体のポインタを返します
+func NewSlashCommandDispatcher(db *sql.DB) *SlashCommandDispatcher {
+	return &SlashCommandDispatcher{
+		db:     db,
+		client: &http.Client{Timeout: slashCommandTimeout},
+	}
+}
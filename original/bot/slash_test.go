@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSlashCommandDispatcherの返信はコマンドとして実行されない(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE slash_command (id INTEGER NOT NULL PRIMARY KEY, command TEXT NOT NULL DEFAULT "", url TEXT NOT NULL DEFAULT "", token TEXT NOT NULL DEFAULT "")`); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("/echo again"))
+	}))
+	defer ts.Close()
+
+	for _, c := range []*model.SlashCommand{
+		{Command: "broken", URL: ts.URL + "/broken"},
+		{Command: "echo", URL: ts.URL + "/echo"},
+	} {
+		if _, err := c.Insert(db); err != nil {
+			t.Fatalf("failed to insert: %s", err)
+		}
+	}
+
+	r := NewCommandRouter()
+	r.SetFallback(NewSlashCommandDispatcher(db))
+
+	m, err := r.Process(&model.Message{Body: "/broken now", UserName: "alice"})
+	re, ok := err.(ReplyError)
+	if !ok {
+		t.Fatalf("ReplyError expected but not, actual %v, %v", m, err)
+	}
+	if reply := re.ReplyMessage(); strings.HasPrefix(reply, "/") || !strings.Contains(reply, "/broken") {
+		t.Fatalf("reply not starting with the prefix expected but not, actual %q", reply)
+	}
+
+	m, err = r.Process(&model.Message{Body: "/echo hi", UserName: "alice"})
+	if err != nil || m.Body != "/echo again" {
+		t.Fatalf("reply \"/echo again\" expected but not, actual %v, %v", m, err)
+	}
+	// Posterが投稿したメッセージとして戻ってきても、もう一度は実行しません
+	m.Origin = model.OriginBot
+	if r.Check(m) {
+		t.Fatalf("reply %q expected not to be checked but it was", m.Body)
+	}
+	if requests != 2 {
+		t.Fatalf("2 requests expected but not, actual %d", requests)
+	}
+}
@@ -0,0 +1,211 @@
+package bot
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// defaultClock は"tomorrow", "明日"のように時刻が省略された場合に使う時刻です
+	defaultClock = 9 * time.Hour
+	// maxRelative は"in 30m", "30分後"の形で指定できる最大の時間です
+	maxRelative = 5 * 365 * 24 * time.Hour
+)
+
+var (
+	// "in 30m", "in 1h30m", "in 2 hours"
+	enRelativePattern = regexp.MustCompile(`(?i)\Ain\s+((?:\d+\s*(?:seconds?|secs?|s|minutes?|mins?|m|hours?|hrs?|h|days?|d)\s*)+)`)
+	enUnitPattern     = regexp.MustCompile(`(?i)(\d+)\s*(seconds?|secs?|s|minutes?|mins?|m|hours?|hrs?|h|days?|d)`)
+	// "tomorrow", "today at 10:00", "tomorrow 3pm"
+	enDayPattern = regexp.MustCompile(`(?i)\A(today|tomorrow)\b(?:\s+(?:at\s+)?(\d{1,2})(?::(\d{2}))?\s*(am|pm)?\b)?`)
+	// "at 10:00", "10:00", "at 3pm"
+	enClockPattern = regexp.MustCompile(`(?i)\A(?:at\s+(\d{1,2})(?::(\d{2}))?\s*(am|pm)?\b|(\d{1,2}):(\d{2})\s*(am|pm)?\b)`)
+
+	// "30分後", "1時間30分後", "3日後"
+	jaRelativePattern = regexp.MustCompile(`\A((?:\d+\s*(?:日|時間|分|秒)\s*)+)後`)
+	jaUnitPattern     = regexp.MustCompile(`(\d+)\s*(日|時間|分|秒)`)
+	// "明日", "明日 10:00", "明日10時", "今日15時半"
+	jaDayPattern = regexp.MustCompile(`\A(今日|明日|明後日)(?:\s*(\d{1,2})(?::(\d{2})|時(?:(\d{1,2})分|(半))?))?`)
+	// "10:00", "10時", "10時30分"
+	jaClockPattern = regexp.MustCompile(`\A(\d{1,2})(?::(\d{2})|時(?:(\d{1,2})分|(半))?)`)
+
+	enUnits = map[string]time.Duration{
+		"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+		"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+		"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+		"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	}
+	jaUnits = map[string]time.Duration{
+		"秒": time.Second, "分": time.Minute, "時間": time.Hour, "日": 24 * time.Hour,
+	}
+
+	errInvalidClock = errors.New("時刻が正しくありません")
+	errPastTime     = errors.New("過去の時刻は指定できません")
+	errTooFar       = errors.New("5年より先の時刻は指定できません")
+	errNoTime       = errors.New("いつ知らせるか分かりません。\"in 30m\", \"tomorrow 10:00\", \"30分後\", \"明日10時\"のように指定してください")
+)
+
+// parseWhen はtextの先頭にある日本語か英語の時刻の表現を解析し、その時刻と残りの文字列を返します
+//
+// 相対時刻は"in 30m", "30分後"、日付と時刻は"tomorrow 10:00", "明日10時"、時刻だけは"at 15:00", "15時"の形で書けます
+// 時刻だけを指定して既に過ぎている場合は翌日の時刻になります
+func parseWhen(text string, now time.Time) (time.Time, string, error) {
+	text = strings.TrimSpace(text)
+
+	// "in 5 mangoes"のように単位の後に英字が続く場合は時刻として扱いません
+	if m := enRelativePattern.FindStringSubmatch(text); m != nil && !startsWithLetter(text[len(strings.TrimRightFunc(m[0], unicode.IsSpace)):]) {
+		d, err := sumUnits(enUnitPattern, enUnits, strings.ToLower(m[1]))
+		return now.Add(d), restOf(text, m[0]), err
+	}
+	if m := jaRelativePattern.FindStringSubmatch(text); m != nil {
+		d, err := sumUnits(jaUnitPattern, jaUnits, m[1])
+		return now.Add(d), restOf(text, m[0]), err
+	}
+
+	if m := enDayPattern.FindStringSubmatch(text); m != nil {
+		days := 0
+		if strings.ToLower(m[1]) == "tomorrow" {
+			days = 1
+		}
+		t, err := onDay(now, days, m[2], m[3], "", m[4])
+		return t, restOf(text, m[0]), err
+	}
+	if m := jaDayPattern.FindStringSubmatch(text); m != nil {
+		days := map[string]int{"今日": 0, "明日": 1, "明後日": 2}[m[1]]
+		minute := m[3]
+		if minute == "" {
+			minute = m[4]
+		}
+		t, err := onDay(now, days, m[2], minute, m[5], "")
+		return t, restOf(text, m[0]), err
+	}
+
+	if m := enClockPattern.FindStringSubmatch(text); m != nil {
+		hour, minute, ampm := m[1], m[2], m[3]
+		if hour == "" {
+			hour, minute, ampm = m[4], m[5], m[6]
+		}
+		t, err := nextClock(now, hour, minute, "", ampm)
+		return t, restOf(text, m[0]), err
+	}
+	if m := jaClockPattern.FindStringSubmatch(text); m != nil {
+		minute := m[2]
+		if minute == "" {
+			minute = m[3]
+		}
+		t, err := nextClock(now, m[1], minute, m[4], "")
+		return t, restOf(text, m[0]), err
+	}
+
+	return time.Time{}, text, errNoTime
+}
+
+// startsWithLetter はsが英字で始まるか返します
+func startsWithLetter(s string) bool {
+	return s != "" && unicode.IsLetter(rune(s[0]))
+}
+
+// sumUnits は"1h30m"のような数値と単位の並びを合計します
+//
+// 合計がmaxRelativeを超える場合はerrTooFar、0の場合はerrPastTimeを返します。途中で溢れないように1つずつ確かめます
+func sumUnits(pattern *regexp.Regexp, units map[string]time.Duration, s string) (time.Duration, error) {
+	var d time.Duration
+	for _, m := range pattern.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		unit := units[m[2]]
+		if err != nil || n > int64(maxRelative/unit) {
+			return 0, errTooFar
+		}
+		d += time.Duration(n) * unit
+		if d > maxRelative {
+			return 0, errTooFar
+		}
+	}
+	if d <= 0 {
+		return 0, errPastTime
+	}
+	return d, nil
+}
+
+// onDay はnowのdays日後のhour:minuteを返します。hourが空の場合はdefaultClockを使います
+func onDay(now time.Time, days int, hour, minute, half, ampm string) (time.Time, error) {
+	clock := defaultClock
+	if hour != "" {
+		var err error
+		if clock, err = parseClockParts(hour, minute, half, ampm); err != nil {
+			return time.Time{}, err
+		}
+	}
+	y, mo, d := now.Date()
+	t := time.Date(y, mo, d+days, 0, 0, 0, 0, now.Location()).Add(clock)
+	if !t.After(now) {
+		return time.Time{}, errPastTime
+	}
+	return t, nil
+}
+
+// nextClock はnowより後で最初のhour:minuteを返します
+func nextClock(now time.Time, hour, minute, half, ampm string) (time.Time, error) {
+	clock, err := parseClockParts(hour, minute, half, ampm)
+	if err != nil {
+		return time.Time{}, err
+	}
+	y, mo, d := now.Date()
+	t := time.Date(y, mo, d, 0, 0, 0, 0, now.Location()).Add(clock)
+	if !t.After(now) {
+		t = time.Date(y, mo, d+1, 0, 0, 0, 0, now.Location()).Add(clock)
+	}
+	return t, nil
+}
+
+// parseClockParts は時、分、"半"、am/pmから0時からの経過時間を返します
+func parseClockParts(hour, minute, half, ampm string) (time.Duration, error) {
+	h, err := strconv.Atoi(hour)
+	if err != nil {
+		return 0, errInvalidClock
+	}
+	m := 0
+	if minute != "" {
+		if m, err = strconv.Atoi(minute); err != nil {
+			return 0, errInvalidClock
+		}
+	}
+	if half != "" {
+		m = 30
+	}
+	switch strings.ToLower(ampm) {
+	case "am":
+		if h < 1 || h > 12 {
+			return 0, errInvalidClock
+		}
+		if h == 12 {
+			h = 0
+		}
+	case "pm":
+		if h < 1 || h > 12 {
+			return 0, errInvalidClock
+		}
+		if h != 12 {
+			h += 12
+		}
+	}
+	if h > 23 || m > 59 {
+		return 0, errInvalidClock
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// restOf はtextから解析した部分を取り除き、"to"や"に"などのつなぎの言葉も取り除いた残りを返します
+func restOf(text, parsed string) string {
+	rest := strings.TrimSpace(strings.TrimPrefix(text, parsed))
+	for _, p := range []string{"to ", "To ", "に", "、", ","} {
+		if strings.HasPrefix(rest, p) {
+			return strings.TrimSpace(strings.TrimPrefix(rest, p))
+		}
+	}
+	return rest
+}
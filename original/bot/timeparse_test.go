@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWhenが日本語と英語の時刻を解析する(t *testing.T) {
+	now := time.Date(2018, 4, 22, 13, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		text string
+		when time.Time
+		rest string
+	}{
+		{"in 30m to deploy", now.Add(30 * time.Minute), "deploy"},
+		{"in 1h30m deploy", now.Add(90 * time.Minute), "deploy"},
+		{"in 2 hours to eat lunch", now.Add(2 * time.Hour), "eat lunch"},
+		{"in 3 days review", now.AddDate(0, 0, 3), "review"},
+		{"tomorrow 10:00 review PR", time.Date(2018, 4, 23, 10, 0, 0, 0, time.UTC), "review PR"},
+		{"tomorrow at 3pm call", time.Date(2018, 4, 23, 15, 0, 0, 0, time.UTC), "call"},
+		{"tomorrow standup", time.Date(2018, 4, 23, 9, 0, 0, 0, time.UTC), "standup"},
+		{"today 18:00 go home", time.Date(2018, 4, 22, 18, 0, 0, 0, time.UTC), "go home"},
+		{"at 9:15 coffee", time.Date(2018, 4, 23, 9, 15, 0, 0, time.UTC), "coffee"},
+		{"15:00 meeting", time.Date(2018, 4, 22, 15, 0, 0, 0, time.UTC), "meeting"},
+		{"30分後にデプロイ", now.Add(30 * time.Minute), "デプロイ"},
+		{"1時間30分後 デプロイ", now.Add(90 * time.Minute), "デプロイ"},
+		{"明日10時にレビュー", time.Date(2018, 4, 23, 10, 0, 0, 0, time.UTC), "レビュー"},
+		{"明日 10:30 レビュー", time.Date(2018, 4, 23, 10, 30, 0, 0, time.UTC), "レビュー"},
+		{"明後日 ゴミ出し", time.Date(2018, 4, 24, 9, 0, 0, 0, time.UTC), "ゴミ出し"},
+		{"今日15時半に会議", time.Date(2018, 4, 22, 15, 30, 0, 0, time.UTC), "会議"},
+		{"9時 朝会", time.Date(2018, 4, 23, 9, 0, 0, 0, time.UTC), "朝会"},
+	}
+	for _, tc := range cases {
+		when, rest, err := parseWhen(tc.text, now)
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %s", tc.text, err)
+		}
+		if !when.Equal(tc.when) {
+			t.Fatalf("%s: time expected %s but not, actual %s", tc.text, tc.when, when)
+		}
+		if rest != tc.rest {
+			t.Fatalf("%s: rest expected %q but not, actual %q", tc.text, tc.rest, rest)
+		}
+	}
+}
+
+func TestParseWhenは解析できない時刻をエラーにする(t *testing.T) {
+	now := time.Date(2018, 4, 22, 13, 30, 0, 0, time.UTC)
+
+	for _, text := range []string{"deploy", "in 5 mangoes", "today 10:00 past", "25:00 late", "tomorrow 13pm"} {
+		if _, _, err := parseWhen(text, now); err == nil {
+			t.Fatalf("%s: error expected but nil", text)
+		}
+	}
+
+	cases := []struct {
+		text     string
+		expected error
+	}{
+		{"in 0m deploy", errPastTime},
+		{"0分後にデプロイ", errPastTime},
+		{"in 99999999999999 days to x", errTooFar},
+		{"in 99999999999999999999 days to x", errTooFar},
+		{"in 1000000h to x", errTooFar},
+		{"in 1000d 1000d to x", errTooFar},
+		{"2000日後に", errTooFar},
+	}
+	for _, tc := range cases {
+		if _, _, err := parseWhen(tc.text, now); err != tc.expected {
+			t.Errorf("%s: error %q expected but not, actual %v", tc.text, tc.expected, err)
+		}
+	}
+}
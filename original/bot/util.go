@@ -52,17 +52,27 @@ func post(url string, params url.Values, out interface{}) error {
 	return nil
 }
 
-// postJSON はinputをJSON形式でurlにPOSTします
-func postJSON(url string, input interface{}, output interface{}) error {
+// postJSON はinputをJSON形式でheaderを付けてurlにPOSTします
+func postJSON(url string, header http.Header, input interface{}, output interface{}) error {
 	data, err := json.Marshal(input)
 	if err != nil {
 		return err
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
 	if err != nil {
 		return err
 	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
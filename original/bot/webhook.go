@@ -0,0 +1,365 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+)
+
+const (
+	// webhookWorkers は同時に配送するworkerの数です
+	webhookWorkers = 4
+	// webhookQueueSize は配送を待てるメッセージの数です。超えた分は失敗として記録します
+	webhookQueueSize = 100
+	// webhookTimeout は1回のPOSTのタイムアウトです
+	webhookTimeout = 10 * time.Second
+	// webhookMaxResponseSize は読み込むレスポンスの最大の大きさです
+	webhookMaxResponseSize = 64 * 1024
+
+	// WebhookSignatureHeader は"sha256=<hex>"形式の署名を入れるヘッダーです
+	//
+	// 署名はSecretを鍵にした、WebhookTimestampHeaderの値と"."とリクエストボディを連結した文字列のHMAC-SHA256です
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	// WebhookTimestampHeader は送信時刻のunix時間を入れるヘッダーです
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	// WebhookDeliveryHeader は配送のIDを入れるヘッダーです
+	WebhookDeliveryHeader = "X-Webhook-Delivery"
+)
+
+// webhookBackoff は再送までの待ち時間です。要素の数だけ再送します
+var webhookBackoff = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 2 * time.Minute}
+
+type (
+	// WebhookDispatcher は登録されたwebhookのパターンにマッチしたメッセージを外部のURLにPOSTするProcessorです
+	//
+	// 配送はRunで起動したworkerが非同期に行い、失敗した場合はwebhookBackoffの間隔で再送します
+	// 配送の状態はwebhook_deliveryに記録し、終了したときに配送中だったものはResumeで送り直します
+	// レスポンスのJSONに"reply"か"text"があれば、botのメッセージとしてoutに渡します
+	//
+	//   fields
+	//     db       *sql.DB
+	//     out      chan *model.Message
+	//     client   *http.Client
+	//     queue    chan *webhookJob
+	//     backoff  []time.Duration
+	//     now      func() time.Time
+	//     mu       sync.Mutex
+	//     patterns map[string]*regexp.Regexp
+	WebhookDispatcher struct {
+		db       *sql.DB
+		out      chan *model.Message
+		client   *http.Client
+		queue    chan *webhookJob
+		backoff  []time.Duration
+		now      func() time.Time
+		mu       sync.Mutex
+		patterns map[string]*regexp.Regexp
+	}
+
+	// WebhookPayload はwebhookにPOSTするJSONの構造体です
+	WebhookPayload struct {
+		WebhookID   int64          `json:"webhook_id"`
+		WebhookName string         `json:"webhook_name"`
+		Message     *model.Message `json:"message"`
+		Matches     []string       `json:"matches"`
+	}
+
+	// webhookResponse はwebhookのレスポンスのうち、返信として使うフィールドです
+	webhookResponse struct {
+		Reply string `json:"reply"`
+		Text  string `json:"text"`
+	}
+
+	// webhookJob は1件の配送です
+	webhookJob struct {
+		webhook  *model.OutgoingWebhook
+		delivery *model.WebhookDelivery
+		message  *model.Message
+		body     []byte
+	}
+)
+
+// Process はmessageにマッチするwebhookへの配送を予約します。返信は配送後に非同期に行うので、nilを返します
+func (d *WebhookDispatcher) Process(message *model.Message) (*model.Message, error) {
+	ws, err := model.OutgoingWebhooksAll(d.db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range ws {
+		if w.Channel != "" && w.Channel != message.Channel {
+			continue
+		}
+		re, err := d.compile(w.Pattern)
+		if err != nil {
+			log.Printf("webhook %d: %s\n", w.ID, err)
+			continue
+		}
+		matches := re.FindStringSubmatch(message.Body)
+		if matches == nil {
+			continue
+		}
+		if err := d.enqueue(w, message, matches); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// compile はpatternをコンパイルした正規表現を返します。同じpatternは使い回します
+func (d *WebhookDispatcher) compile(pattern string) (*regexp.Regexp, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if re, ok := d.patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	d.patterns[pattern] = re
+	return re, nil
+}
+
+// enqueue は配送を記録してqueueに入れます。queueがいっぱいの場合は失敗として記録します
+func (d *WebhookDispatcher) enqueue(w *model.OutgoingWebhook, message *model.Message, matches []string) error {
+	delivery, err := (&model.WebhookDelivery{
+		WebhookID: w.ID,
+		MessageID: message.ID,
+		Status:    model.DeliveryPending,
+		UpdatedAt: d.now(),
+	}).Insert(d.db)
+	if err != nil {
+		return err
+	}
+	job, err := newWebhookJob(w, delivery, message, matches)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case d.queue <- job:
+		return nil
+	default:
+		return d.fail(delivery, "delivery queue is full")
+	}
+}
+
+// Resume は前回の終了時に配送中だった配送を読み込み、Runのworkerに渡します
+//
+// 新しい配送と混ざらないように、botを起動する前に呼びます。読み込みが終わると、queueへの追加はctxが終了するまで続けます
+// 再起動の前に届いていた配送は2回届くことがあるので、受け取る側はWebhookDeliveryHeaderで重複を除けます
+func (d *WebhookDispatcher) Resume(ctx context.Context) error {
+	ds, err := model.WebhookDeliveriesPending(d.db)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for _, delivery := range ds {
+			job, err := d.restore(delivery)
+			if err != nil {
+				if err := d.fail(delivery, err.Error()); err != nil {
+					log.Printf("webhook %d: %s\n", delivery.WebhookID, err)
+				}
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case d.queue <- job:
+			}
+		}
+	}()
+	return nil
+}
+
+// restore は記録された配送から、webhookとメッセージを読み込み直したjobを返します
+func (d *WebhookDispatcher) restore(delivery *model.WebhookDelivery) (*webhookJob, error) {
+	w, err := model.OutgoingWebhookByID(d.db, delivery.WebhookID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook: %s", err)
+	}
+	message, err := model.MessageByID(d.db, delivery.MessageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load message: %s", err)
+	}
+	re, err := d.compile(w.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches := re.FindStringSubmatch(message.Body)
+	if matches == nil {
+		return nil, errors.New("message no longer matches the pattern")
+	}
+	return newWebhookJob(w, delivery, message, matches)
+}
+
+// fail は配送を失敗として記録します
+func (d *WebhookDispatcher) fail(delivery *model.WebhookDelivery, reason string) error {
+	delivery.Status = model.DeliveryFailed
+	delivery.Error = reason
+	delivery.UpdatedAt = d.now()
+	return delivery.Update(d.db)
+}
+
+// Run は配送のworkerを起動し、ctxが終了するまで待ちます
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < webhookWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-d.queue:
+					d.deliver(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver はjobを配送し、失敗した場合は再送します。ctxが終了した場合は配送中のまま終わります
+func (d *WebhookDispatcher) deliver(ctx context.Context, job *webhookJob) {
+	delivery := job.delivery
+	for {
+		delivery.Attempts++
+		code, reply, retry, err := d.post(ctx, job)
+		delivery.StatusCode = code
+		delivery.UpdatedAt = d.now()
+
+		switch {
+		case err == nil:
+			delivery.Status = model.DeliverySucceeded
+			delivery.Error = ""
+		case !retry || delivery.Attempts > len(d.backoff):
+			delivery.Status = model.DeliveryFailed
+			delivery.Error = err.Error()
+		default:
+			delivery.Error = err.Error()
+		}
+		if err := delivery.Update(d.db); err != nil {
+			log.Printf("webhook %d: %s\n", job.webhook.ID, err)
+		}
+
+		if delivery.Status == model.DeliverySucceeded {
+			if reply != "" {
+				d.out <- &model.Message{
+					Body:     reply,
+					UserName: "bot",
+					Channel:  job.message.Channel,
+				}
+			}
+			return
+		}
+		if delivery.Status == model.DeliveryFailed {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.backoff[delivery.Attempts-1]):
+		}
+	}
+}
+
+// post はjobを1回POSTし、ステータスコード、返信、再送すべきかを返します
+//
+// 接続できない場合、5xx、429は再送します。それ以外の2xxでないステータスは再送しません
+func (d *WebhookDispatcher) post(ctx context.Context, job *webhookJob) (int, string, bool, error) {
+	req, err := http.NewRequest(http.MethodPost, job.webhook.URL, bytes.NewReader(job.body))
+	if err != nil {
+		return 0, "", false, err
+	}
+	req = req.WithContext(ctx)
+
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(job.webhook.Secret, timestamp, job.body))
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(job.delivery.ID, 10))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", true, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseSize))
+	if err != nil {
+		return resp.StatusCode, "", true, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return resp.StatusCode, "", retry, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	// JSONでないレスポンスは返信なしとして扱います
+	var r webhookResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return resp.StatusCode, "", false, nil
+	}
+	if r.Reply != "" {
+		return resp.StatusCode, r.Reply, false, nil
+	}
+	return resp.StatusCode, r.Text, false, nil
+}
+
+// newWebhookJob はwにPOSTするペイロードを作り、配送のjobを返します
+func newWebhookJob(w *model.OutgoingWebhook, delivery *model.WebhookDelivery, message *model.Message, matches []string) (*webhookJob, error) {
+	body, err := json.Marshal(&WebhookPayload{
+		WebhookID:   w.ID,
+		WebhookName: w.Name,
+		Message:     message,
+		Matches:     matches,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &webhookJob{webhook: w, delivery: delivery, message: message, body: body}, nil
+}
+
+// SignWebhook はsecretでtimestampとbodyに署名した"sha256=<hex>"形式の文字列を返します
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewWebhookDispatcher は配送の結果をdbに記録し、返信をoutに渡す新しいWebhookDispatcher構造体のポインタを返します
+func NewWebhookDispatcher(db *sql.DB, out chan *model.Message) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:       db,
+		out:      out,
+		client:   &http.Client{Timeout: webhookTimeout},
+		queue:    make(chan *webhookJob, webhookQueueSize),
+		backoff:  webhookBackoff,
+		now:      time.Now,
+		patterns: map[string]*regexp.Regexp{},
+	}
+}
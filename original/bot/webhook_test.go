@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestWebhookDispatcherは署名してPOSTし失敗したら再送する(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, q := range []string{
+		`CREATE TABLE outgoing_webhook (id INTEGER NOT NULL PRIMARY KEY, name TEXT NOT NULL DEFAULT "", pattern TEXT NOT NULL DEFAULT "", url TEXT NOT NULL DEFAULT "", secret TEXT NOT NULL DEFAULT "", channel TEXT NOT NULL DEFAULT "")`,
+		`CREATE TABLE webhook_delivery (id INTEGER NOT NULL PRIMARY KEY, webhook_id INTEGER NOT NULL, message_id INTEGER NOT NULL DEFAULT 0, status TEXT NOT NULL DEFAULT "pending", attempts INTEGER NOT NULL DEFAULT 0, status_code INTEGER NOT NULL DEFAULT 0, error TEXT NOT NULL DEFAULT "", updated_at INTEGER NOT NULL DEFAULT 0)`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to create table: %s", err)
+		}
+	}
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		if expected := SignWebhook("s3cret", r.Header.Get(WebhookTimestampHeader), body); r.Header.Get(WebhookSignatureHeader) != expected {
+			t.Errorf("signature expected %s but not, actual %s", expected, r.Header.Get(WebhookSignatureHeader))
+		}
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var p WebhookPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("failed to decode payload: %s", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"reply": "deployed " + p.Matches[1]})
+	}))
+	defer ts.Close()
+
+	for _, w := range []*model.OutgoingWebhook{
+		{Name: "deploy", Pattern: `\Adeploy (\w+)\z`, URL: ts.URL, Secret: "s3cret"},
+		{Name: "ops only", Pattern: `deploy`, URL: ts.URL, Secret: "s3cret", Channel: "ops"},
+	} {
+		if _, err := w.Insert(db); err != nil {
+			t.Fatalf("failed to insert: %s", err)
+		}
+	}
+
+	out := make(chan *model.Message, 10)
+	d := NewWebhookDispatcher(db, out)
+	d.backoff = []time.Duration{time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	if _, err := d.Process(&model.Message{ID: 42, Body: "deploy api", UserName: "alice", Channel: "random"}); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	select {
+	case m := <-out:
+		if m.Body != "deployed api" || m.Channel != "random" {
+			t.Fatalf("reply expected \"deployed api\" in random but not, actual %q in %q", m.Body, m.Channel)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reply expected but not")
+	}
+
+	ds, err := model.WebhookDeliveriesByWebhookID(db, 1, 10)
+	if err != nil {
+		t.Fatalf("failed to get deliveries: %s", err)
+	}
+	if len(ds) != 1 || ds[0].Status != model.DeliverySucceeded || ds[0].Attempts != 2 || ds[0].MessageID != 42 {
+		t.Fatalf("a succeeded delivery after 2 attempts expected but not, actual %#v", ds)
+	}
+	if ds, _ := model.WebhookDeliveriesByWebhookID(db, 2, 10); len(ds) != 0 {
+		t.Fatalf("no delivery for another channel expected but not, actual %d", len(ds))
+	}
+}
+
+func TestWebhookDispatcherは配送中だった配送を再起動後に送り直す(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, q := range []string{
+		`CREATE TABLE message (id INTEGER NOT NULL PRIMARY KEY, body TEXT NOT NULL DEFAULT "", username TEXT NOT NULL DEFAULT "", channel TEXT NOT NULL DEFAULT "", version INTEGER NOT NULL DEFAULT 1)`,
+		`CREATE TABLE outgoing_webhook (id INTEGER NOT NULL PRIMARY KEY, name TEXT NOT NULL DEFAULT "", pattern TEXT NOT NULL DEFAULT "", url TEXT NOT NULL DEFAULT "", secret TEXT NOT NULL DEFAULT "", channel TEXT NOT NULL DEFAULT "")`,
+		`CREATE TABLE webhook_delivery (id INTEGER NOT NULL PRIMARY KEY, webhook_id INTEGER NOT NULL, message_id INTEGER NOT NULL DEFAULT 0, status TEXT NOT NULL DEFAULT "pending", attempts INTEGER NOT NULL DEFAULT 0, status_code INTEGER NOT NULL DEFAULT 0, error TEXT NOT NULL DEFAULT "", updated_at INTEGER NOT NULL DEFAULT 0)`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to create table: %s", err)
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(WebhookDeliveryHeader) != "2" {
+			t.Errorf("delivery 2 expected but not, actual %s", r.Header.Get(WebhookDeliveryHeader))
+		}
+		json.NewEncoder(w).Encode(map[string]string{"reply": "deployed"})
+	}))
+	defer ts.Close()
+
+	m, err := (&model.Message{Body: "deploy api", UserName: "alice", Channel: "ops"}).Insert(db)
+	if err != nil {
+		t.Fatalf("failed to insert message: %s", err)
+	}
+	w, err := (&model.OutgoingWebhook{Name: "deploy", Pattern: `\Adeploy (\w+)\z`, URL: ts.URL}).Insert(db)
+	if err != nil {
+		t.Fatalf("failed to insert webhook: %s", err)
+	}
+	for _, d := range []*model.WebhookDelivery{
+		{WebhookID: w.ID, MessageID: 99, Status: model.DeliveryPending},
+		{WebhookID: w.ID, MessageID: m.ID, Status: model.DeliveryPending, Attempts: 1},
+		{WebhookID: w.ID, MessageID: m.ID, Status: model.DeliverySucceeded, Attempts: 1},
+	} {
+		if _, err := d.Insert(db); err != nil {
+			t.Fatalf("failed to insert delivery: %s", err)
+		}
+	}
+
+	out := make(chan *model.Message, 10)
+	d := NewWebhookDispatcher(db, out)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := d.Resume(ctx); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	go d.Run(ctx)
+
+	select {
+	case m := <-out:
+		if m.Body != "deployed" || m.Channel != "ops" {
+			t.Fatalf("reply expected \"deployed\" in ops but not, actual %q in %q", m.Body, m.Channel)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reply expected but not")
+	}
+
+	ds, err := model.WebhookDeliveriesByWebhookID(db, w.ID, 10)
+	if err != nil {
+		t.Fatalf("failed to get deliveries: %s", err)
+	}
+	if len(ds) != 3 || ds[2].Status != model.DeliveryFailed || ds[1].Status != model.DeliverySucceeded || ds[1].Attempts != 2 || ds[0].Attempts != 1 {
+		t.Fatalf("resumed delivery and failed one for a deleted message expected but not, actual %#v", ds)
+	}
+	if ds, err := model.WebhookDeliveriesPending(db); err != nil || len(ds) != 0 {
+		t.Fatalf("no pending delivery expected but not, actual %d, %v", len(ds), err)
+	}
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// masked はPrintで秘密の値の代わりに表示する文字列です
+const masked = "********"
+
+type (
+	// Config はconfig.ymlを読むための構造体です
+	//
+	// Defaultの値にconfig.yml、環境変数、コマンドラインのフラグの順に上書きします
+	Config struct {
+		HTTP     HTTP     `yaml:"http"`
+		Database Database `yaml:"database"`
+		Bots     Bots     `yaml:"bots"`
+		Auth     Auth     `yaml:"auth"`
+		Limits   Limits   `yaml:"limits"`
+		Logging  Logging  `yaml:"logging"`
+	}
+
+	// HTTP はHTTPサーバーの設定です
+	//
+	// Modeはginのモード(debug、release、test)で、空の場合は環境変数GIN_MODEに従います
+	HTTP struct {
+		Port      string `yaml:"port"`
+		Templates string `yaml:"templates"`
+		Assets    string `yaml:"assets"`
+		Mode      string `yaml:"mode"`
+	}
+
+	// Database はデータベースの設定です
+	//
+	// 接続先はConfigのファイルのEnvの設定です。Retentionのファイルがない場合は古いメッセージを片付けません
+	Database struct {
+		Config    string `yaml:"config"`
+		Env       string `yaml:"env"`
+		Retention string `yaml:"retention"`
+		Backup    Backup `yaml:"backup"`
+	}
+
+	// Backup はSQLiteのスナップショットの設定です
+	//
+	// Dirが空の場合はスナップショットを作りません。Intervalが0の場合は定期的には作りません
+	// KeepとMaxAgeが0の場合はその条件では消しません
+	Backup struct {
+		Dir      string        `yaml:"dir"`
+		Interval time.Duration `yaml:"interval"`
+		Keep     int           `yaml:"keep"`
+		MaxAge   time.Duration `yaml:"max_age"`
+	}
+
+	// Bots はbotの設定です
+	//
+	// Enabledは動かすbotの名前で、空の場合は全てのbotを動かします
+	// Timezoneはスケジュールされたbotやリマインダーの時刻を解釈するタイムゾーンです
+	Bots struct {
+		Enabled         []string `yaml:"enabled"`
+		OmikujiTable    string   `yaml:"omikuji_table"`
+		Timezone        string   `yaml:"timezone"`
+		KeywordAPIAppID string   `yaml:"keyword_api_app_id"`
+		TalkAPIKey      string   `yaml:"talk_api_key"`
+	}
+
+	// Auth は認証の設定です。AdminTokenが空の場合、管理用のAPIは無効です
+	Auth struct {
+		AdminToken string `yaml:"admin_token"`
+	}
+
+	// Limits は上限の設定です
+	//
+	// PosterBufferはbotが投稿するメッセージを溜めておける数です
+	Limits struct {
+		PosterBuffer int `yaml:"poster_buffer"`
+	}
+
+	// Logging はログの設定です
+	//
+	// Outputはstderr、stdoutかファイルのパスで、ファイルには追記します
+	// AccessLogがfalseの場合はリクエストごとのログを出しません
+	Logging struct {
+		Output    string `yaml:"output"`
+		AccessLog bool   `yaml:"access_log"`
+	}
+)
+
+// Default はデフォルトの設定を返します。config.ymlがない場合はこの設定で動きます
+func Default() *Config {
+	return &Config{
+		HTTP: HTTP{
+			Port:      "8080",
+			Templates: "./templates/*",
+			Assets:    "./assets",
+		},
+		Database: Database{
+			Config:    "dbconfig.yml",
+			Env:       "development",
+			Retention: "./retention.yml",
+			Backup: Backup{
+				Dir:      "backups",
+				Interval: time.Hour,
+				Keep:     24,
+				MaxAge:   7 * 24 * time.Hour,
+			},
+		},
+		Bots: Bots{
+			OmikujiTable: "./omikuji.yml",
+			Timezone:     "Asia/Tokyo",
+		},
+		Limits: Limits{
+			PosterBuffer: 10,
+		},
+		Logging: Logging{
+			Output:    "stderr",
+			AccessLog: true,
+		},
+	}
+}
+
+// NewConfigFromFile はファイルパスからDefaultに上書きした新しいConfigを返します
+func NewConfigFromFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewConfig(f)
+}
+
+// NewConfig はyamlを読み込んでDefaultに上書きした新しいConfigを返します
+//
+// 文字列の値の${VAR}は環境変数の値に置き換えます。書き間違いに気付けるように、知らない項目はエラーにします
+func NewConfig(r io.Reader) (*Config, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	c := Default()
+	if err = yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, err
+	}
+	if err = ExpandFields(c, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate は設定が正しいか確かめ、間違いを全てまとめて返します
+func (c *Config) Validate() error {
+	var errs Errors
+	if n, err := strconv.Atoi(c.HTTP.Port); err != nil || n < 1 || n > 65535 {
+		errs = append(errs, fmt.Errorf("http.port must be between 1 and 65535: %q", c.HTTP.Port))
+	}
+	switch c.HTTP.Mode {
+	case "", "debug", "release", "test":
+	default:
+		errs = append(errs, fmt.Errorf("http.mode must be debug, release or test: %q", c.HTTP.Mode))
+	}
+	if c.Database.Config == "" {
+		errs = append(errs, fmt.Errorf("database.config is required"))
+	}
+	if c.Database.Env == "" {
+		errs = append(errs, fmt.Errorf("database.env is required"))
+	}
+	if c.Database.Backup.Interval < 0 {
+		errs = append(errs, fmt.Errorf("database.backup.interval must not be negative: %s", c.Database.Backup.Interval))
+	}
+	if c.Database.Backup.Keep < 0 {
+		errs = append(errs, fmt.Errorf("database.backup.keep must not be negative: %d", c.Database.Backup.Keep))
+	}
+	if c.Database.Backup.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("database.backup.max_age must not be negative: %s", c.Database.Backup.MaxAge))
+	}
+	if _, err := time.LoadLocation(c.Bots.Timezone); err != nil {
+		errs = append(errs, fmt.Errorf("bots.timezone: %s", err))
+	}
+	if c.Limits.PosterBuffer < 0 {
+		errs = append(errs, fmt.Errorf("limits.poster_buffer must not be negative: %d", c.Limits.PosterBuffer))
+	}
+	if c.Logging.Output == "" {
+		errs = append(errs, fmt.Errorf("logging.output is required"))
+	}
+	return errs.Err()
+}
+
+// BotEnabled はnameのbotを動かすか返します
+func (c *Config) BotEnabled(name string) bool {
+	if len(c.Bots.Enabled) == 0 {
+		return true
+	}
+	for _, n := range c.Bots.Enabled {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LogWriter はLogging.Outputに対応するログの書き込み先を返します
+func (c *Config) LogWriter() (io.Writer, error) {
+	switch c.Logging.Output {
+	case "stderr":
+		return os.Stderr, nil
+	case "stdout":
+		return os.Stdout, nil
+	default:
+		return os.OpenFile(c.Logging.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	}
+}
+
+// Print は設定をyamlでwに書きます。秘密の値は伏せます
+func (c *Config) Print(w io.Writer) error {
+	p := *c
+	for _, s := range []*string{&p.Auth.AdminToken, &p.Bots.KeywordAPIAppID, &p.Bots.TalkAPIKey} {
+		if *s != "" {
+			*s = masked
+		}
+	}
+	b, err := yaml.Marshal(&p)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
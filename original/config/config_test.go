@@ -0,0 +1,93 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewConfigは書いた項目だけデフォルトを上書きする(t *testing.T) {
+	os.Setenv("CONFIG_TEST_TOKEN", "secret")
+	defer os.Unsetenv("CONFIG_TEST_TOKEN")
+
+	c, err := NewConfig(strings.NewReader(`
+http:
+  port: "9000"
+database:
+  backup:
+    keep: 3
+bots:
+  enabled: [omikujibot, dicebot]
+auth:
+  admin_token: ${CONFIG_TEST_TOKEN}
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+
+	expected := Default()
+	expected.HTTP.Port = "9000"
+	expected.Database.Backup.Keep = 3
+	expected.Bots.Enabled = []string{"omikujibot", "dicebot"}
+	expected.Auth.AdminToken = "secret"
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("config expected %+v but not, actual %+v", expected, c)
+	}
+	if !c.BotEnabled("dicebot") || c.BotEnabled("talkbot") {
+		t.Errorf("only enabled bots expected but not, actual %v", c.Bots.Enabled)
+	}
+	if !Default().BotEnabled("talkbot") {
+		t.Errorf("all bots expected to be enabled by default")
+	}
+}
+
+func TestNewConfigは知らない項目をエラーにする(t *testing.T) {
+	_, err := NewConfig(strings.NewReader("http:\n  prot: \"9000\"\n"))
+	if err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Errorf("error for unknown field expected but not, actual %v", err)
+	}
+}
+
+func TestValidateは間違いを全て返す(t *testing.T) {
+	c := Default()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("default config expected to be valid but not, actual %s", err)
+	}
+
+	c.HTTP.Port = "http"
+	c.Database.Backup.Interval = -time.Minute
+	c.Bots.Timezone = "Mars/Olympus"
+	c.Limits.PosterBuffer = -1
+	err := c.Validate()
+	for _, expected := range []string{"http.port", "database.backup.interval", "bots.timezone", "limits.poster_buffer"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("error for %s expected but not, actual %v", expected, err)
+		}
+	}
+}
+
+func TestPrintは秘密の値を伏せる(t *testing.T) {
+	c := Default()
+	c.Auth.AdminToken = "secret"
+	c.Bots.TalkAPIKey = "talk"
+
+	var buf bytes.Buffer
+	if err := c.Print(&buf); err != nil {
+		t.Fatalf("failed to print: %s", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "secret") || strings.Contains(out, "talk:") || !strings.Contains(out, "admin_token: '********'") {
+		t.Errorf("masked secrets expected but not, actual\n%s", out)
+	}
+	if c.Auth.AdminToken != "secret" {
+		t.Errorf("config expected not to be changed but not, actual %s", c.Auth.AdminToken)
+	}
+
+	// 出力した設定はそのまま読み込めます
+	if _, err := NewConfig(&buf); err != nil {
+		t.Errorf("printed config expected to be loadable but not, actual %s", err)
+	}
+}
@@ -0,0 +1,163 @@
+// Package config は設定ファイルと環境変数から設定を読み込むパッケージです
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// EnvPrefix はサーバーの設定を上書きする環境変数の接頭辞です
+const EnvPrefix = "APP_"
+
+// envVarPattern は設定ファイルの中の${VAR}と${VAR:-default}です
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// Errors は設定の間違いをまとめたエラーです。起動時に全ての間違いを1度に知らせるために使います
+type Errors []error
+
+// Error は1行に1つずつエラーを並べます
+func (es Errors) Error() string {
+	ss := make([]string, len(es))
+	for i, err := range es {
+		ss[i] = err.Error()
+	}
+	return strings.Join(ss, "\n")
+}
+
+// Err はエラーがない場合にnilを返します
+func (es Errors) Err() error {
+	if len(es) == 0 {
+		return nil
+	}
+	return es
+}
+
+// Expand はsの${VAR}を環境変数VARの値に置き換えます。lookupにはos.LookupEnvを渡します
+//
+// ${VAR:-default}はVARが設定されていないか空の場合にdefaultを使います
+// 設定されていない${VAR}はエラーにします。パスワードなどに含まれる$を壊さないように、$VARの形式は置き換えません
+func Expand(s string, lookup func(string) (string, bool)) (string, error) {
+	var errs Errors
+	expanded := envVarPattern.ReplaceAllStringFunc(s, func(m string) string {
+		groups := envVarPattern.FindStringSubmatch(m)
+		name, def := groups[1], groups[2]
+		v, ok := lookup(name)
+		if def != "" {
+			if v == "" {
+				return strings.TrimPrefix(def, ":-")
+			}
+			return v
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("environment variable %s is not set", name))
+		}
+		return v
+	})
+	if err := errs.Err(); err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+// ExpandFields はvが指す構造体、map、sliceの中の全ての文字列を、yamlを読み込んだ後でExpandで置き換えます
+//
+// yamlのテキストを置き換えると、": "や"#"を含む値でyamlの意味が変わってしまうので、読み込んだ後の値を置き換えます
+// 置き換えるのは文字列の値だけです。エラーはyamlの項目の名前を付けて全てまとめて返します
+func ExpandFields(v interface{}, lookup func(string) (string, bool)) error {
+	var errs Errors
+	expandValue(reflect.ValueOf(v), "", lookup, &errs)
+	return errs.Err()
+}
+
+// expandValue はvの中の文字列をExpandで置き換えます。pathはエラーに付けるyamlの項目の名前です
+func expandValue(v reflect.Value, path string, lookup func(string) (string, bool), errs *Errors) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			expandValue(v.Elem(), path, lookup, errs)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if f.PkgPath != "" || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			expandValue(v.Field(i), joinPath(path, name), lookup, errs)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		for _, k := range keys {
+			// mapの値は直接書き換えられないので、コピーを置き換えて戻します
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			expandValue(e, joinPath(path, fmt.Sprint(k)), lookup, errs)
+			v.SetMapIndex(k, e)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			expandValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), lookup, errs)
+		}
+	case reflect.String:
+		s, err := Expand(v.String(), lookup)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("%s: %s", path, err))
+			return
+		}
+		if v.CanSet() {
+			v.SetString(s)
+		}
+	}
+}
+
+// joinPath はyamlの項目の名前を"."でつなぎます
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// EnvName はフラグの名前に対応する環境変数の名前を返します。例えば-backup-dirはAPP_BACKUP_DIRです
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// ApplyEnv はfsのフラグのうち、コマンドラインで指定されなかったものを環境変数の値で上書きします
+//
+// 優先順位はコマンドライン、環境変数、デフォルトの順です。fs.Parseの後に呼びます
+// 環境変数で設定したフラグもコマンドラインで指定したものと同じようにfs.Visitで辿れます
+// 値が正しくない環境変数は全てまとめてErrorsで返します
+func ApplyEnv(fs *flag.FlagSet, lookup func(string) (string, bool)) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var errs Errors
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] {
+			return
+		}
+		name := EnvName(f.Name)
+		v, ok := lookup(name)
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value %q: %s", name, v, err))
+		}
+	})
+	return errs.Err()
+}
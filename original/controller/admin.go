@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/httputil"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth は"Authorization: Bearer <token>"ヘッダーがtokenと一致するリクエストだけを通すミドルウェアを返します
+//
+// tokenが空の場合は管理用のAPIを無効にし、全てのリクエストに403を返します
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			resp := httputil.NewErrorResponse(errors.New("admin API is disabled"))
+			c.AbortWithStatusJSON(http.StatusForbidden, resp)
+			return
+		}
+
+		given := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			resp := httputil.NewErrorResponse(errors.New("invalid admin token"))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, resp)
+			return
+		}
+		c.Next()
+	}
+}
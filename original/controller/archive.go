@@ -0,0 +1,340 @@
+package controller
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/httputil"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gin-gonic/gin"
+)
+
+// エクスポートの形式です
+const (
+	// archiveNDJSON は1行に1つのレコードを書く形式です。最後の行のendレコードでメッセージの数を確認できます
+	archiveNDJSON = "ndjson"
+	// archiveJSON はmeta、users、channels、messagesを持つ1つのJSONです
+	archiveJSON = "json"
+)
+
+// archiveFormatVersion はエクスポートの形式のバージョンです。形式を変えたら増やします
+const archiveFormatVersion = 1
+
+// archiveMaxImportSize はインポートで受け付けるリクエストのボディの最大の大きさです
+//
+// インポートは1つのトランザクションで行うので、全てのメッセージをメモリーに読み込みます
+const archiveMaxImportSize = 64 * 1024 * 1024
+
+// NDJSONのレコードの種類です
+const (
+	recordMeta    = "meta"
+	recordUser    = "user"
+	recordChannel = "channel"
+	recordMessage = "message"
+	recordEnd     = "end"
+)
+
+type (
+	// Archive is controller for requests to export and import the chat history
+	//
+	// ユーザーとチャンネルのテーブルはないので、メッセージのユーザー名とチャンネルから作ります
+	Archive struct {
+		DB *sql.DB
+	}
+
+	// archiveMeta はエクスポートしたデータの情報です
+	//
+	// Sourceはエクスポートしたデータベースを表すIDで、インポートで同じメッセージを2回追加しないために使います
+	archiveMeta struct {
+		FormatVersion int       `json:"format_version"`
+		Source        string    `json:"source"`
+		ExportedAt    time.Time `json:"exported_at"`
+	}
+
+	// archiveName はユーザーとチャンネルのレコードです
+	archiveName struct {
+		Name string `json:"name"`
+	}
+
+	// archiveRecord はNDJSONの1行です。Typeによって使うフィールドが違います
+	archiveRecord struct {
+		Type          string     `json:"type"`
+		FormatVersion int        `json:"format_version,omitempty"`
+		Source        string     `json:"source,omitempty"`
+		ExportedAt    *time.Time `json:"exported_at,omitempty"`
+		*model.Message
+		Name  string `json:"name,omitempty"`
+		Count int    `json:"count,omitempty"`
+	}
+
+	// archive はJSONの形式のエクスポートです。NDJSONも読み込んだらこの形にします
+	archive struct {
+		Meta     archiveMeta      `json:"meta"`
+		Users    []archiveName    `json:"users"`
+		Channels []archiveName    `json:"channels"`
+		Messages []*model.Message `json:"messages"`
+	}
+)
+
+// Export は全てのメッセージとユーザー、チャンネルをformatパラメーターの形式で返します
+//
+// formatはndjson(デフォルト)かjsonです。メッセージは1件ずつ読んで書き出すので、全てをメモリーに読み込みません
+func (a *Archive) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", archiveNDJSON)
+	if format != archiveNDJSON && format != archiveJSON {
+		resp := httputil.NewErrorResponse(fmt.Errorf("unknown format: %s", format))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	newID, err := newSecret()
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	source, err := model.InstanceID(a.DB, newID[:32])
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	users, err := model.MessageUserNames(a.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	channels, err := model.MessageChannels(a.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	meta := &archiveMeta{FormatVersion: archiveFormatVersion, Source: source, ExportedAt: time.Now()}
+	contentType := "application/x-ndjson"
+	if format == archiveJSON {
+		contentType = "application/json; charset=utf-8"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.%s"`, meta.ExportedAt.Format("20060102-150405"), format))
+	c.Status(http.StatusOK)
+
+	// 書き始めた後はステータスを変えられないので、エラーはログに出して途中で止めます
+	// NDJSONはendレコードがないことで、JSONは閉じていないことでインポートの時に気付けます
+	w := bufio.NewWriter(c.Writer)
+	if err := writeArchive(w, format, meta, users, channels, func(f func(m *model.Message) error) error {
+		return model.MessagesEach(a.DB, f)
+	}); err != nil {
+		log.Printf("failed to export: %s\n", err)
+	}
+	w.Flush()
+}
+
+// Import はExportの形式のデータをリクエストのボディから読み込み、1つのトランザクションでメッセージを追加します
+//
+// idsパラメーターがremapの場合は新しいIDを振り、keep(デフォルト)の場合はIDを変えません
+// dry_run=trueの場合は何も変更せずに結果だけを返します。同じデータを何度インポートしても、2回目以降は何も追加しません
+func (a *Archive) Import(c *gin.Context) {
+	ids := c.DefaultQuery("ids", "keep")
+	if ids != "keep" && ids != "remap" {
+		resp := httputil.NewErrorResponse(fmt.Errorf("ids must be keep or remap: %s", ids))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	arc, err := readArchive(http.MaxBytesReader(c.Writer, c.Request.Body, archiveMaxImportSize))
+	switch {
+	case errors.As(err, new(*http.MaxBytesError)):
+		resp := httputil.NewErrorResponse(fmt.Errorf("archive must be at most %d bytes", archiveMaxImportSize))
+		c.JSON(http.StatusRequestEntityTooLarge, resp)
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	if arc.Meta.FormatVersion > archiveFormatVersion {
+		resp := httputil.NewErrorResponse(fmt.Errorf("unsupported format version: %d", arc.Meta.FormatVersion))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	opts := model.ImportOptions{
+		Source:   c.DefaultQuery("source", arc.Meta.Source),
+		RemapIDs: ids == "remap",
+		DryRun:   c.Query("dry_run") == "true",
+	}
+	if opts.RemapIDs && opts.Source == "" {
+		resp := httputil.NewErrorResponse(errors.New("source is required to remap ids"))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	report, err := model.ImportMessages(a.DB, arc.Messages, opts)
+	if _, ok := err.(*model.ImportDuplicateError); ok {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	switch {
+	case err == model.ErrImportConflict && opts.DryRun:
+		// dry runでは衝突も結果として返します
+	case err == model.ErrImportConflict:
+		c.JSON(http.StatusConflict, gin.H{
+			"result": report,
+			"error":  httputil.NewErrorResponse(err).Error,
+		})
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": report,
+		"error":  nil,
+	})
+}
+
+// writeArchive はformatの形式でwに書き出します。eachには1件ずつメッセージを渡す関数を渡します
+func writeArchive(w io.Writer, format string, meta *archiveMeta, users, channels []string, each func(f func(m *model.Message) error) error) error {
+	enc := json.NewEncoder(w)
+	if format == archiveNDJSON {
+		if err := enc.Encode(&archiveRecord{Type: recordMeta, FormatVersion: meta.FormatVersion, Source: meta.Source, ExportedAt: &meta.ExportedAt}); err != nil {
+			return err
+		}
+		for _, name := range users {
+			if err := enc.Encode(&archiveRecord{Type: recordUser, Name: name}); err != nil {
+				return err
+			}
+		}
+		for _, name := range channels {
+			if err := enc.Encode(&archiveRecord{Type: recordChannel, Name: name}); err != nil {
+				return err
+			}
+		}
+		n := 0
+		if err := each(func(m *model.Message) error {
+			n++
+			return enc.Encode(&archiveRecord{Type: recordMessage, Message: m})
+		}); err != nil {
+			return err
+		}
+		return enc.Encode(&archiveRecord{Type: recordEnd, Count: n})
+	}
+
+	// JSONは全体を1つの値にするため、messagesの配列を少しずつ書きます
+	head, err := json.Marshal(&archive{
+		Meta:     *meta,
+		Users:    archiveNames(users),
+		Channels: archiveNames(channels),
+	})
+	if err != nil {
+		return err
+	}
+	// 最後の`"messages":null}`を取り除いて配列を開きます
+	head = head[:len(head)-len(`null}`)]
+	if _, err := w.Write(append(head, '[')); err != nil {
+		return err
+	}
+	first := true
+	if err := each(func(m *model.Message) error {
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// readArchive はNDJSONかJSONの形式のエクスポートを読み込みます。最初の値にtypeがあればNDJSONとして読みます
+func readArchive(r io.Reader) (*archive, error) {
+	dec := json.NewDecoder(r)
+	var first json.RawMessage
+	if err := dec.Decode(&first); err != nil {
+		return nil, err
+	}
+	var rec archiveRecord
+	if err := json.Unmarshal(first, &rec); err != nil {
+		return nil, err
+	}
+	if rec.Type == "" {
+		arc := &archive{}
+		if err := json.Unmarshal(first, arc); err != nil {
+			return nil, err
+		}
+		return arc, nil
+	}
+
+	arc := &archive{}
+	ended := false
+	for {
+		if ended {
+			return nil, errors.New("records after end")
+		}
+		switch rec.Type {
+		case recordMeta:
+			arc.Meta = archiveMeta{FormatVersion: rec.FormatVersion, Source: rec.Source}
+			if rec.ExportedAt != nil {
+				arc.Meta.ExportedAt = *rec.ExportedAt
+			}
+		case recordUser:
+			arc.Users = append(arc.Users, archiveName{Name: rec.Name})
+		case recordChannel:
+			arc.Channels = append(arc.Channels, archiveName{Name: rec.Name})
+		case recordMessage:
+			if rec.Message == nil {
+				return nil, errors.New("message record without message")
+			}
+			arc.Messages = append(arc.Messages, rec.Message)
+		case recordEnd:
+			if rec.Count != len(arc.Messages) {
+				return nil, fmt.Errorf("archive has %d messages but end record says %d", len(arc.Messages), rec.Count)
+			}
+			ended = true
+		default:
+			return nil, fmt.Errorf("unknown record type: %s", rec.Type)
+		}
+
+		rec = archiveRecord{}
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if !ended {
+		return nil, errors.New("archive is truncated: no end record")
+	}
+	return arc, nil
+}
+
+// archiveNames はnamesをレコードにします
+func archiveNames(names []string) []archiveName {
+	ns := make([]archiveName, len(names))
+	for i, name := range names {
+		ns[i] = archiveName{Name: name}
+	}
+	return ns
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gin-gonic/gin"
+)
+
+func TestArchiveは書き出した形式を読み込める(t *testing.T) {
+	ms := []*model.Message{
+		{ID: 1, Body: "hello", UserName: "alice", Version: 1},
+		{ID: 3, Body: "hi", UserName: "bob", Channel: "random", Version: 2},
+	}
+	each := func(f func(m *model.Message) error) error {
+		for _, m := range ms {
+			if err := f(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	meta := &archiveMeta{FormatVersion: archiveFormatVersion, Source: "src", ExportedAt: time.Now()}
+
+	for _, format := range []string{archiveNDJSON, archiveJSON} {
+		var buf bytes.Buffer
+		if err := writeArchive(&buf, format, meta, []string{"alice", "bob"}, []string{"random"}, each); err != nil {
+			t.Fatalf("%s: failed to write: %s", format, err)
+		}
+		arc, err := readArchive(&buf)
+		if err != nil {
+			t.Fatalf("%s: failed to read: %s", format, err)
+		}
+		if arc.Meta.Source != "src" || len(arc.Users) != 2 || len(arc.Channels) != 1 || len(arc.Messages) != 2 {
+			t.Fatalf("%s: archive expected but not, actual %#v", format, arc)
+		}
+		if m := arc.Messages[1]; m.ID != 3 || m.Body != "hi" || m.Channel != "random" || m.Version != 2 {
+			t.Fatalf("%s: message expected but not, actual %#v", format, m)
+		}
+	}
+
+	// 途中で切れたNDJSONはendレコードがないのでエラーにします
+	var buf bytes.Buffer
+	writeArchive(&buf, archiveNDJSON, meta, nil, nil, each)
+	lines := strings.SplitAfter(buf.String(), "\n")
+	truncated := strings.Join(lines[:len(lines)-2], "")
+	if _, err := readArchive(strings.NewReader(truncated)); err == nil {
+		t.Fatalf("truncated archive must be an error")
+	}
+}
+
+func TestArchiveは同じIDが重なったデータのインポートを400にする(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := &Archive{}
+	r := gin.New()
+	r.POST("/import", a.Import)
+
+	body := `{"meta":{"format_version":1,"source":"src"},"messages":[{"id":1,"body":"a"},{"id":2,"body":"b"},{"id":1,"body":"c"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/import?ids=remap", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "duplicate message ids") {
+		t.Fatalf("400 for duplicate ids expected but not, actual %d %s", rec.Code, rec.Body.String())
+	}
+}
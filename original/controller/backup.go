@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/db"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/httputil"
+	"github.com/gin-gonic/gin"
+)
+
+// Backup is controller for requests to snapshots of the database
+type Backup struct {
+	Snapshots *db.Snapshots
+}
+
+// All は全てのスナップショットを新しい順にJSONで返します
+func (b *Backup) All(c *gin.Context) {
+	ss, err := b.Snapshots.List()
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": ss,
+		"error":  nil,
+	})
+}
+
+// Create はすぐにスナップショットを作り、古いスナップショットを消してから作ったスナップショットをJSONで返します
+func (b *Backup) Create(c *gin.Context) {
+	s, err := b.Snapshots.Create()
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"result": s,
+		"error":  nil,
+	})
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/bot"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/httputil"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// externalBotDefaultQuota はquotaが指定されなかった場合の1分間の返信の数です
+	externalBotDefaultQuota = 30
+	// externalBotMaxQuota は指定できる1分間の返信の最大の数です
+	externalBotMaxQuota = 600
+)
+
+// externalBotNamePattern は外部のbotの名前に使える文字です
+var externalBotNamePattern = regexp.MustCompile(`\A[a-zA-Z0-9_\-]{1,32}\z`)
+
+// externalBotUpgrader は外部のbotの接続をWebSocketにします
+//
+// botはブラウザではなくtokenで認証するので、Originは確認しません
+var externalBotUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// ExternalBot is controller for requests to external bots
+type ExternalBot struct {
+	DB  *sql.DB
+	Hub *bot.ExternalBotHub
+}
+
+// Connect は"Authorization: Bearer <token>"ヘッダーで外部のbotを認証し、WebSocketで接続します
+//
+// URLはアクセスログに残るので、tokenをクエリパラメーターで渡すことはできません
+func (e *ExternalBot) Connect(c *gin.Context) {
+	var token string
+	if h := c.Request.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimPrefix(h, "Bearer ")
+	}
+	if token == "" {
+		resp := httputil.NewErrorResponse(errors.New("token is required"))
+		c.JSON(http.StatusUnauthorized, resp)
+		return
+	}
+
+	eb, err := model.ExternalBotByToken(e.DB, token)
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(errors.New("invalid token"))
+		c.JSON(http.StatusUnauthorized, resp)
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	// Upgradeは失敗した場合にエラーのレスポンスを返します
+	conn, err := externalBotUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	if err := e.Hub.Serve(c.Request.Context(), conn, eb); err != nil {
+		log.Printf("external bot %s: %s\n", eb.Name, err)
+	}
+}
+
+// All は全ての外部のbotをJSONで返します。tokenは返しません
+func (e *ExternalBot) All(c *gin.Context) {
+	bs, err := model.ExternalBotsAll(e.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	if bs == nil {
+		bs = make([]*model.ExternalBot, 0)
+	}
+	for _, b := range bs {
+		b.Token = ""
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": bs,
+		"error":  nil,
+	})
+}
+
+// Create は新しい外部のbotを保存し、接続に使うtokenを含めてJSONで返します
+func (e *ExternalBot) Create(c *gin.Context) {
+	var b model.ExternalBot
+	if err := c.BindJSON(&b); err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	if !externalBotNamePattern.MatchString(b.Name) || b.Name == "bot" {
+		resp := httputil.NewErrorResponse(errors.New("name must consist of 1 to 32 a-z, A-Z, 0-9, _ and - and must not be bot"))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	if b.Quota == 0 {
+		b.Quota = externalBotDefaultQuota
+	}
+	if b.Quota < 1 || b.Quota > externalBotMaxQuota {
+		resp := httputil.NewErrorResponse(errors.New("quota must be between 1 and " + strconv.Itoa(externalBotMaxQuota)))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	token, err := newSecret()
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	b.Token = token
+
+	inserted, err := b.Insert(e.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"result": inserted,
+		"error":  nil,
+	})
+}
+
+// DeleteByID はパラメーターで受け取ったidの外部のbotを削除し、接続していれば切ります
+func (e *ExternalBot) DeleteByID(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	b, err := model.ExternalBotByID(e.DB, id)
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusNotFound, resp)
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	if err := b.Delete(e.DB); err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	e.Hub.Disconnect(b.Name)
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": nil,
+		"error":  nil,
+	})
+}
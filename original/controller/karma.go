@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/httputil"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// karmaDefaultLimit はlimitが指定されなかった場合にランキングで返す人数です
+	karmaDefaultLimit = 10
+	// karmaMaxLimit はランキングで返せる最大の人数です
+	karmaMaxLimit = 100
+)
+
+// Karma is controller for requests to karma
+type Karma struct {
+	DB *sql.DB
+}
+
+// Top はスコアの高い順のランキングをJSONで返します。人数はクエリのlimitで指定できます
+func (k *Karma) Top(c *gin.Context) {
+	limit := karmaDefaultLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > karmaMaxLimit {
+			resp := httputil.NewErrorResponse(errors.New("limit must be between 1 and 100"))
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		limit = n
+	}
+
+	ks, err := model.KarmaTop(k.DB, limit)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	if ks == nil {
+		ks = make([]*model.Karma, 0)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": ks,
+		"error":  nil,
+	})
+}
+
+// GetByUserName はパラメーターで受け取ったユーザーのスコアと最近の理由をJSONで返します
+func (k *Karma) GetByUserName(c *gin.Context) {
+	username := c.Param("username")
+
+	karma, err := model.KarmaByUserName(k.DB, username)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	vs, err := model.KarmaVotesWithReasonByTarget(k.DB, username, karmaDefaultLimit)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	if vs == nil {
+		vs = make([]*model.KarmaVote, 0)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": gin.H{
+			"karma":   karma,
+			"reasons": vs,
+		},
+		"error": nil,
+	})
+}
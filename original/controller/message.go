@@ -1,25 +1,43 @@
 package controller
 
 import (
+	"crypto/subtle"
 	"database/sql"
 	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/bot"
 	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/httputil"
 	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
 	"github.com/gin-gonic/gin"
 )
 
+// messageSearchLimit はメッセージを検索したときに返す最大の件数です
+const messageSearchLimit = 100
+
 // Message is controller for requests to messages
+//
+// PosterTokenはbotのPosterと共有するtokenで、一致したメッセージはbotの投稿としてStreamに渡します
 type Message struct {
-	DB     *sql.DB
-	Stream chan *model.Message
+	Messages    model.MessageStore
+	Stream      chan *model.Message
+	PosterToken string
 }
 
 // All は全てのメッセージを取得してJSONで返します
+//
+// クエリパラメーターのqが指定された場合は、本文にqを含むメッセージを新しい順に返します
 func (m *Message) All(c *gin.Context) {
-	msgs, err := model.MessagesAll(m.DB)
+	var (
+		msgs []*model.Message
+		err  error
+	)
+	if q := c.Query("q"); q != "" {
+		msgs, err = m.Messages.Search(q, messageSearchLimit)
+	} else {
+		msgs, err = m.Messages.All()
+	}
 	if err != nil {
 		resp := httputil.NewErrorResponse(err)
 		c.JSON(http.StatusInternalServerError, resp)
@@ -38,8 +56,17 @@ func (m *Message) All(c *gin.Context) {
 }
 
 // GetByID はパラメーターで受け取ったidのメッセージを取得してJSONで返します
+//
+// ETagヘッダーにメッセージのバージョンを返します。If-None-Matchが一致した場合は304を返します
 func (m *Message) GetByID(c *gin.Context) {
-	msg, err := model.MessageByID(m.DB, c.Param("id"))
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	msg, err := m.Messages.ByID(id)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -52,6 +79,13 @@ func (m *Message) GetByID(c *gin.Context) {
 		return
 	}
 
+	etag := httputil.ETag(msg.Version)
+	c.Header("ETag", etag)
+	if h := c.Request.Header.Get("If-None-Match"); h != "" && httputil.MatchIfNoneMatch(h, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"result": msg,
 		"error":  nil,
@@ -82,7 +116,7 @@ func (m *Message) Create(c *gin.Context) {
 		return
 	}
 
-	inserted, err := msg.Insert(m.DB)
+	inserted, err := m.Messages.Create(&msg)
 	if err != nil {
 		resp := httputil.NewErrorResponse(err)
 		c.JSON(http.StatusInternalServerError, resp)
@@ -90,6 +124,9 @@ func (m *Message) Create(c *gin.Context) {
 	}
 
 	// bot対応
+	if m.fromPoster(c) {
+		inserted.Origin = model.OriginBot
+	}
 	m.Stream <- inserted
 
 	c.JSON(http.StatusCreated, gin.H{
@@ -99,6 +136,8 @@ func (m *Message) Create(c *gin.Context) {
 }
 
 // UpdateByID は...
+//
+// If-Matchヘッダーがある場合は、メッセージのETagが一致するときだけ更新し、一致しなければ412を返します
 func (m *Message) UpdateByID(c *gin.Context) {
 	// 1-3. メッセージを編集しよう
 	// ...
@@ -118,14 +157,30 @@ func (m *Message) UpdateByID(c *gin.Context) {
 		return
 	}
 
+	version, ok := m.checkIfMatch(c, id)
+	if !ok {
+		return
+	}
+
 	msg.ID = id
-	updated, err := msg.Update(m.DB)
-	if err != nil {
+	msg.Version = version
+	updated, err := m.Messages.Update(&msg)
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusNotFound, resp)
+		return
+	case err == model.ErrVersionConflict:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusPreconditionFailed, resp)
+		return
+	case err != nil:
 		resp := httputil.NewErrorResponse(err)
 		c.JSON(http.StatusInternalServerError, resp)
 		return
 	}
 
+	c.Header("ETag", httputil.ETag(updated.Version))
 	c.JSON(http.StatusOK, gin.H{
 		"result": updated,
 		"error":  nil,
@@ -133,11 +188,11 @@ func (m *Message) UpdateByID(c *gin.Context) {
 }
 
 // DeleteByID は...
+//
+// If-Matchヘッダーがある場合は、メッセージのETagが一致するときだけ削除し、一致しなければ412を返します
 func (m *Message) DeleteByID(c *gin.Context) {
 	// 1-4. メッセージを削除しよう
 	// ...
-	var msg model.Message
-
 	i := c.Param("id")
 	id, err := strconv.ParseInt(i, 10, 64)
 	if err != nil {
@@ -146,9 +201,18 @@ func (m *Message) DeleteByID(c *gin.Context) {
 		return
 	}
 
-	msg.ID = id
-	err = msg.Delete(m.DB)
-	if err != nil {
+	version, ok := m.checkIfMatch(c, id)
+	if !ok {
+		return
+	}
+
+	err = m.Messages.Delete(id, version)
+	switch {
+	case err == model.ErrVersionConflict:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusPreconditionFailed, resp)
+		return
+	case err != nil:
 		resp := httputil.NewErrorResponse(err)
 		c.JSON(http.StatusInternalServerError, resp)
 		return
@@ -159,3 +223,41 @@ func (m *Message) DeleteByID(c *gin.Context) {
 		"error":  nil,
 	})
 }
+
+// checkIfMatch はIf-Matchヘッダーとidのメッセージの今のETagを比べ、一致した場合はそのバージョンを返します
+//
+// If-Matchヘッダーがない場合はバージョンを確認しないので0を返します
+// 一致しない場合とメッセージがない場合はエラーのレスポンスを返し、falseを返します
+func (m *Message) checkIfMatch(c *gin.Context, id int64) (int64, bool) {
+	h := c.Request.Header.Get("If-Match")
+	if h == "" {
+		return 0, true
+	}
+
+	current, err := m.Messages.ByID(id)
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusPreconditionFailed, resp)
+		return 0, false
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return 0, false
+	}
+
+	etag := httputil.ETag(current.Version)
+	if !httputil.MatchIfMatch(h, etag) {
+		c.Header("ETag", etag)
+		resp := httputil.NewErrorResponse(model.ErrVersionConflict)
+		c.JSON(http.StatusPreconditionFailed, resp)
+		return 0, false
+	}
+	return current.Version, true
+}
+
+// fromPoster はリクエストにbotのPosterのtokenが付いているか返します
+func (m *Message) fromPoster(c *gin.Context) bool {
+	given := c.GetHeader(bot.PosterTokenHeader)
+	return m.PosterToken != "" && subtle.ConstantTimeCompare([]byte(given), []byte(m.PosterToken)) == 1
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/bot"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMessageはMessageStoreに読み書きする(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stream := make(chan *model.Message, 10)
+	m := &Message{
+		Messages: model.NewMemoryMessageStore(
+			&model.Message{Body: "hello", UserName: "alice"},
+			&model.Message{Body: "deploy done", UserName: "bob"},
+		),
+		Stream: stream,
+	}
+	r := gin.New()
+	r.GET("/messages", m.All)
+	r.GET("/messages/:id", m.GetByID)
+	r.POST("/messages", m.Create)
+	r.PUT("/messages/:id", m.UpdateByID)
+	r.DELETE("/messages/:id", m.DeleteByID)
+
+	call := func(method, path, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := call(http.MethodPost, "/messages", `{"body": "lunch?", "username": "carol"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("status code expected %d but not, actual %d", http.StatusCreated, code)
+	}
+	if created := <-stream; created.ID != 3 || created.Body != "lunch?" {
+		t.Fatalf("created message expected but not, actual %#v", created)
+	}
+
+	if code, _ := call(http.MethodPut, "/messages/2", `{"body": "deploy failed"}`); code != http.StatusOK {
+		t.Fatalf("status code expected %d but not, actual %d", http.StatusOK, code)
+	}
+	code, resp = call(http.MethodGet, "/messages/2", "")
+	if code != http.StatusOK || resp["result"].(map[string]interface{})["body"] != "deploy failed" {
+		t.Fatalf("updated message expected but not, actual %d %v", code, resp)
+	}
+
+	code, resp = call(http.MethodGet, "/messages?q=DEPLOY", "")
+	if results, ok := resp["result"].([]interface{}); code != http.StatusOK || !ok || len(results) != 1 {
+		t.Fatalf("one search result expected but not, actual %d %v", code, resp)
+	}
+
+	if code, _ := call(http.MethodDelete, "/messages/2", ""); code != http.StatusOK {
+		t.Fatalf("status code expected %d but not, actual %d", http.StatusOK, code)
+	}
+	if code, _ := call(http.MethodGet, "/messages/2", ""); code != http.StatusNotFound {
+		t.Fatalf("status code expected %d but not, actual %d", http.StatusNotFound, code)
+	}
+	if code, _ := call(http.MethodPut, "/messages/2", `{"body": "again"}`); code != http.StatusNotFound {
+		t.Fatalf("status code expected %d but not, actual %d", http.StatusNotFound, code)
+	}
+	if code, _ := call(http.MethodGet, "/messages/abc", ""); code != http.StatusBadRequest {
+		t.Fatalf("status code expected %d but not, actual %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestMessageはPosterのtokenが一致した投稿だけbotの投稿にする(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stream := make(chan *model.Message, 10)
+	m := &Message{Messages: model.NewMemoryMessageStore(), Stream: stream, PosterToken: "t0ken"}
+	r := gin.New()
+	r.POST("/messages", m.Create)
+
+	cases := []struct {
+		token    string
+		body     string
+		expected string
+	}{
+		{"t0ken", `{"body": "hello", "username": "bot"}`, model.OriginBot},
+		{"", `{"body": "hello", "username": "bot"}`, ""},
+		{"wrong", `{"body": "hello", "username": "bot"}`, ""},
+		{"", `{"body": "hello", "username": "mallory", "Origin": "bot", "origin": "bot"}`, ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(c.body))
+		if c.token != "" {
+			req.Header.Set(bot.PosterTokenHeader, c.token)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("status code expected %d but not, actual %d", http.StatusCreated, rec.Code)
+		}
+		if created := <-stream; created.Origin != c.expected {
+			t.Fatalf("token %q: origin expected %q but not, actual %q", c.token, c.expected, created.Origin)
+		}
+	}
+}
+
+func TestMessageはIfMatchが一致しない更新と削除を412で断る(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := &Message{
+		Messages: model.NewMemoryMessageStore(&model.Message{Body: "hello", UserName: "alice"}),
+		Stream:   make(chan *model.Message, 10),
+	}
+	r := gin.New()
+	r.GET("/messages/:id", m.GetByID)
+	r.PUT("/messages/:id", m.UpdateByID)
+	r.DELETE("/messages/:id", m.DeleteByID)
+
+	call := func(method, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/messages/1", strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call(http.MethodGet, "", nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag != `"1"` {
+		t.Fatalf("ETag \"1\" expected but not, actual %d %q", rec.Code, etag)
+	}
+	if rec := call(http.MethodGet, "", map[string]string{"If-None-Match": etag}); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("status code expected %d but not, actual %d", http.StatusNotModified, rec.Code)
+	}
+
+	// aliceとbobが同じバージョンを編集し、先に保存したaliceだけが成功します
+	rec = call(http.MethodPut, `{"body": "hello from alice"}`, map[string]string{"If-Match": etag})
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"2"` {
+		t.Fatalf("updated ETag \"2\" expected but not, actual %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+	rec = call(http.MethodPut, `{"body": "hello from bob"}`, map[string]string{"If-Match": etag})
+	if rec.Code != http.StatusPreconditionFailed || rec.Header().Get("ETag") != `"2"` {
+		t.Fatalf("status code expected %d but not, actual %d", http.StatusPreconditionFailed, rec.Code)
+	}
+	if rec := call(http.MethodGet, "", map[string]string{"If-None-Match": etag}); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "hello from alice") {
+		t.Fatalf("alice's message expected but not, actual %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := call(http.MethodDelete, "", map[string]string{"If-Match": etag}); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("status code expected %d but not, actual %d", http.StatusPreconditionFailed, rec.Code)
+	}
+	if rec := call(http.MethodDelete, "", map[string]string{"If-Match": `W/"2"`}); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("weak ETag must not match If-Match, actual %d", rec.Code)
+	}
+	if rec := call(http.MethodDelete, "", map[string]string{"If-Match": `"1", "2"`}); rec.Code != http.StatusOK {
+		t.Fatalf("status code expected %d but not, actual %d", http.StatusOK, rec.Code)
+	}
+	if rec := call(http.MethodDelete, "", map[string]string{"If-Match": "*"}); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("If-Match on deleted message expected %d but not, actual %d", http.StatusPreconditionFailed, rec.Code)
+	}
+}
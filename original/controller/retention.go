@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/bot"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/httputil"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gin-gonic/gin"
+)
+
+// アーカイブのメッセージを返す数です
+const (
+	archivedDefaultLimit = 100
+	archivedMaxLimit     = 1000
+)
+
+type (
+	// Retention is controller for requests to retention policies
+	Retention struct {
+		Retention *bot.Retention
+	}
+
+	// ArchivedMessage is controller for read-only requests to archived messages
+	ArchivedMessage struct {
+		Archive *sql.DB
+	}
+)
+
+// Report は今片付けるとしたら各policyで片付けるメッセージの数をJSONで返します。何も変更しません
+func (r *Retention) Report(c *gin.Context) {
+	results, err := r.Retention.Run(time.Now(), true)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": gin.H{
+			"policies": r.Retention.Policies(),
+			"results":  results,
+		},
+		"error": nil,
+	})
+}
+
+// Run はスケジュールを待たずに保存期間を過ぎたメッセージを片付け、片付けた数をJSONで返します
+//
+// dry_run=trueの場合はReportと同じです
+func (r *Retention) Run(c *gin.Context) {
+	results, err := r.Retention.Run(time.Now(), c.Query("dry_run") == "true")
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": results,
+		"error":  nil,
+	})
+}
+
+// All はアーカイブのメッセージをアーカイブした新しい順にJSONで返します
+//
+// channelパラメーターでチャンネルを、before_idパラメーターでarchive_idがそれより前のメッセージに絞り込めます
+func (a *ArchivedMessage) All(c *gin.Context) {
+	limit := archivedDefaultLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > archivedMaxLimit {
+			resp := httputil.NewErrorResponse(errors.New("limit must be between 1 and 1000"))
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		limit = n
+	}
+	var beforeID int64
+	if s := c.Query("before_id"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			resp := httputil.NewErrorResponse(err)
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		beforeID = n
+	}
+
+	ms, err := model.ArchivedMessages(a.Archive, c.Query("channel"), beforeID, limit)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": ms,
+		"error":  nil,
+	})
+}
+
+// GetByID はパラメーターで受け取ったarchive_idのアーカイブのメッセージを1件返します
+func (a *ArchivedMessage) GetByID(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	m, err := model.ArchivedMessageByID(a.Archive, id)
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusNotFound, resp)
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": m,
+		"error":  nil,
+	})
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/bot"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/httputil"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gin-gonic/gin"
+)
+
+// scriptNamePattern はスクリプトの名前に使える文字です
+var scriptNamePattern = regexp.MustCompile(`\A[a-z0-9_\-]{1,32}\z`)
+
+// Script is controller for requests to bot scripts
+type Script struct {
+	DB   *sql.DB
+	Host *bot.ScriptHost
+}
+
+// All は全てのスクリプトをJSONで返します
+func (s *Script) All(c *gin.Context) {
+	ss, err := model.BotScriptsAll(s.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	if ss == nil {
+		ss = make([]*model.BotScript, 0)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": ss,
+		"error":  nil,
+	})
+}
+
+// GetByName はパラメーターで受け取ったnameのスクリプトをJSONで返します
+func (s *Script) GetByName(c *gin.Context) {
+	sc, err := model.BotScriptByName(s.DB, c.Param("name"))
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusNotFound, resp)
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": sc,
+		"error":  nil,
+	})
+}
+
+// Save はパラメーターで受け取ったnameのスクリプトを読み込んで保存し、botとして登録します
+//
+// 同じ名前のスクリプトがある場合は置き換えます。読み込めないスクリプトは保存しません
+func (s *Script) Save(c *gin.Context) {
+	var sc model.BotScript
+	if err := c.BindJSON(&sc); err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	sc.Name = c.Param("name")
+	sc.UpdatedAt = time.Now()
+	if sc.Grants == nil {
+		sc.Grants = []string{}
+	}
+
+	if !scriptNamePattern.MatchString(sc.Name) {
+		resp := httputil.NewErrorResponse(errors.New("name must consist of 1 to 32 a-z, 0-9, _ and -"))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	compiled, err := s.Host.Compile(&sc)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	saved, err := sc.Save(s.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	s.Host.Load(compiled)
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": saved,
+		"error":  nil,
+	})
+}
+
+// DeleteByName はパラメーターで受け取ったnameのスクリプトを削除し、botを止めます
+func (s *Script) DeleteByName(c *gin.Context) {
+	name := c.Param("name")
+	err := (&model.BotScript{Name: name}).Delete(s.DB)
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusNotFound, resp)
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	s.Host.Unload(name)
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": nil,
+		"error":  nil,
+	})
+}
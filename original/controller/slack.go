@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// slackLinkPattern は"<https://example.com|example>"や"<https://example.com>"にマッチします
+	slackLinkPattern = regexp.MustCompile(`<([^<>|]+)(?:\|([^<>]+))?>`)
+	// slackUnescaper はSlackのテキストでエスケープされる文字を元に戻します
+	slackUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+)
+
+type (
+	// SlackMessage はSlack互換のメッセージのうち、このアプリで扱うフィールドの構造体です
+	//
+	// IconEmojiは受け付けますが、メッセージにアイコンがないため使いません
+	SlackMessage struct {
+		Text        string             `json:"text" form:"text"`
+		UserName    string             `json:"username" form:"username"`
+		IconEmoji   string             `json:"icon_emoji" form:"icon_emoji"`
+		Channel     string             `json:"channel" form:"channel"`
+		Attachments []*SlackAttachment `json:"attachments"`
+	}
+
+	// SlackAttachment はSlack互換のattachmentの構造体です
+	SlackAttachment struct {
+		Fallback  string        `json:"fallback"`
+		Color     string        `json:"color"`
+		Pretext   string        `json:"pretext"`
+		Title     string        `json:"title"`
+		TitleLink string        `json:"title_link"`
+		Text      string        `json:"text"`
+		Fields    []*SlackField `json:"fields"`
+		Footer    string        `json:"footer"`
+	}
+
+	// SlackField はattachmentの"title: value"形式の項目です
+	SlackField struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+		Short bool   `json:"short"`
+	}
+)
+
+// Body はtextとattachmentsをつなげたメッセージの本文を返します
+func (m *SlackMessage) Body() string {
+	var parts []string
+	if m.Text != "" {
+		parts = append(parts, slackText(m.Text))
+	}
+	for _, a := range m.Attachments {
+		if a == nil {
+			continue
+		}
+		if s := a.body(); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// body はattachmentを行に分けた本文を返します。何もない場合はfallbackを返します
+func (a *SlackAttachment) body() string {
+	var lines []string
+	if a.Pretext != "" {
+		lines = append(lines, slackText(a.Pretext))
+	}
+	switch {
+	case a.Title != "" && a.TitleLink != "":
+		lines = append(lines, fmt.Sprintf("%s (%s)", slackText(a.Title), a.TitleLink))
+	case a.Title != "":
+		lines = append(lines, slackText(a.Title))
+	}
+	if a.Text != "" {
+		lines = append(lines, slackText(a.Text))
+	}
+	for _, f := range a.Fields {
+		if f == nil {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", slackText(f.Title), slackText(f.Value)))
+	}
+	if a.Footer != "" {
+		lines = append(lines, slackText(a.Footer))
+	}
+	if len(lines) == 0 {
+		return slackText(a.Fallback)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// slackText はSlackのリンク記法とエスケープを普通のテキストにします
+func slackText(s string) string {
+	s = slackLinkPattern.ReplaceAllStringFunc(s, func(link string) string {
+		m := slackLinkPattern.FindStringSubmatch(link)
+		if m[2] == "" {
+			return m[1]
+		}
+		return fmt.Sprintf("%s (%s)", m[2], m[1])
+	})
+	return slackUnescaper.Replace(s)
+}
@@ -0,0 +1,372 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// slackHistoryDefaultLimit はconversations.historyでlimitが指定されなかった場合に返す件数です
+	slackHistoryDefaultLimit = 100
+	// slackHistoryMaxLimit はconversations.historyで返せる最大の件数です
+	slackHistoryMaxLimit = 1000
+
+	slackIntegrationKey = "slack.integration"
+	slackParamsKey      = "slack.params"
+)
+
+// SlackAPI is controller for requests to the Slack-compatible Web API
+//
+// incoming webhookのtokenで認証し、そのwebhookとして投稿します
+// メッセージのtsは"<メッセージのID>.000000"です
+type SlackAPI struct {
+	DB       *sql.DB
+	Messages model.MessageStore
+	Stream   chan *model.Message
+}
+
+// Auth は"Authorization: Bearer <token>"ヘッダーか"token"パラメーターでincoming webhookを認証するミドルウェアを返します
+//
+// Slackと同じく、エラーもステータス200で{"ok": false, "error": "..."}を返します
+func (s *SlackAPI) Auth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params, err := slackParams(c)
+		if err != nil {
+			slackError(c, "invalid_form_data")
+			c.Abort()
+			return
+		}
+
+		token := params["token"]
+		if h := c.Request.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+			token = strings.TrimPrefix(h, "Bearer ")
+		}
+		if token == "" {
+			slackError(c, "not_authed")
+			c.Abort()
+			return
+		}
+
+		wh, err := model.IncomingWebhookByToken(s.DB, token)
+		switch {
+		case err == sql.ErrNoRows:
+			slackError(c, "invalid_auth")
+			c.Abort()
+			return
+		case err != nil:
+			slackError(c, "internal_error")
+			c.Abort()
+			return
+		}
+
+		c.Set(slackIntegrationKey, wh)
+		c.Set(slackParamsKey, params)
+		c.Next()
+	}
+}
+
+// AuthTest はauth.testです
+func (s *SlackAPI) AuthTest(c *gin.Context) {
+	wh, _ := slackContext(c)
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"user":    wh.Name,
+		"user_id": wh.Name,
+		"bot_id":  strconv.FormatInt(wh.ID, 10),
+	})
+}
+
+// PostMessage はchat.postMessageです
+func (s *SlackAPI) PostMessage(c *gin.Context) {
+	wh, params := slackContext(c)
+
+	sm, err := slackMessageFromParams(params)
+	if err != nil {
+		slackError(c, "invalid_attachments")
+		return
+	}
+	msg := model.Message{
+		Body:     sm.Body(),
+		UserName: integrationUserName(wh, sm.UserName),
+		Channel:  slackChannel(params["channel"]),
+	}
+	if msg.Body == "" {
+		slackError(c, "no_text")
+		return
+	}
+	if msg.Channel == "" {
+		msg.Channel = wh.Channel
+	}
+
+	inserted, err := s.Messages.Create(&msg)
+	if err != nil {
+		slackError(c, "internal_error")
+		return
+	}
+
+	// bot対応
+	inserted.Origin = model.OriginWebhook
+	s.Stream <- inserted
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"channel": inserted.Channel,
+		"ts":      slackTS(inserted.ID),
+		"message": slackMessageJSON(inserted),
+	})
+}
+
+// Update はchat.updateです。このwebhookが投稿したメッセージだけを更新できます
+func (s *SlackAPI) Update(c *gin.Context) {
+	wh, params := slackContext(c)
+
+	msg, ok := s.ownMessage(c, wh, params, "cant_update_message")
+	if !ok {
+		return
+	}
+	sm, err := slackMessageFromParams(params)
+	if err != nil {
+		slackError(c, "invalid_attachments")
+		return
+	}
+	msg.Body = sm.Body()
+	if msg.Body == "" {
+		slackError(c, "no_text")
+		return
+	}
+
+	updated, err := s.Messages.Update(msg)
+	if err != nil {
+		slackError(c, "internal_error")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"channel": updated.Channel,
+		"ts":      slackTS(updated.ID),
+		"text":    updated.Body,
+		"message": slackMessageJSON(updated),
+	})
+}
+
+// Delete はchat.deleteです。このwebhookが投稿したメッセージだけを削除できます
+func (s *SlackAPI) Delete(c *gin.Context) {
+	wh, params := slackContext(c)
+
+	msg, ok := s.ownMessage(c, wh, params, "cant_delete_message")
+	if !ok {
+		return
+	}
+	if err := s.Messages.Delete(msg.ID, msg.Version); err != nil {
+		slackError(c, "internal_error")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"channel": msg.Channel,
+		"ts":      slackTS(msg.ID),
+	})
+}
+
+// History はconversations.historyです。新しい順に返し、続きはresponse_metadata.next_cursorで取得できます
+func (s *SlackAPI) History(c *gin.Context) {
+	_, params := slackContext(c)
+
+	limit := slackHistoryDefaultLimit
+	if l := params["limit"]; l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			slackError(c, "invalid_limit")
+			return
+		}
+		limit = n
+		if limit > slackHistoryMaxLimit {
+			limit = slackHistoryMaxLimit
+		}
+	}
+
+	var oldest, latest int64
+	var ok bool
+	if oldest, ok = parseSlackTS(params["oldest"]); !ok {
+		slackError(c, "invalid_ts_oldest")
+		return
+	}
+	if latest, ok = parseSlackTS(params["latest"]); !ok {
+		slackError(c, "invalid_ts_latest")
+		return
+	}
+	if cursor := params["cursor"]; cursor != "" {
+		n, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || n <= 0 {
+			slackError(c, "invalid_cursor")
+			return
+		}
+		if latest == 0 || n < latest {
+			latest = n
+		}
+	}
+
+	ms, err := s.Messages.ByChannel(slackChannel(params["channel"]), oldest, latest, limit+1)
+	if err != nil {
+		slackError(c, "internal_error")
+		return
+	}
+
+	hasMore := len(ms) > limit
+	if hasMore {
+		ms = ms[:limit]
+	}
+	messages := make([]gin.H, len(ms))
+	for i, m := range ms {
+		messages[i] = slackMessageJSON(m)
+	}
+	nextCursor := ""
+	if hasMore {
+		nextCursor = strconv.FormatInt(ms[len(ms)-1].ID, 10)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":       true,
+		"messages": messages,
+		"has_more": hasMore,
+		"response_metadata": gin.H{
+			"next_cursor": nextCursor,
+		},
+	})
+}
+
+// ownMessage はパラメーターのtsのメッセージがwhの投稿したものなら返します
+//
+// そうでない場合はdeniedか、メッセージがない場合はmessage_not_foundのエラーを返信します
+func (s *SlackAPI) ownMessage(c *gin.Context, wh *model.IncomingWebhook, params map[string]string, denied string) (*model.Message, bool) {
+	id, ok := parseSlackTS(params["ts"])
+	if !ok || id == 0 {
+		slackError(c, "message_not_found")
+		return nil, false
+	}
+
+	msg, err := s.Messages.ByID(id)
+	switch {
+	case err == sql.ErrNoRows:
+		slackError(c, "message_not_found")
+		return nil, false
+	case err != nil:
+		slackError(c, "internal_error")
+		return nil, false
+	}
+	if ch, ok := params["channel"]; ok && slackChannel(ch) != msg.Channel {
+		slackError(c, "message_not_found")
+		return nil, false
+	}
+	if !postedBy(wh, msg.UserName) {
+		slackError(c, denied)
+		return nil, false
+	}
+	return msg, true
+}
+
+// slackParams はクエリとフォーム、またはJSONのボディのパラメーターを文字列のmapにします
+//
+// JSONの数値や配列、オブジェクトはJSONの文字列のまま入れます
+func slackParams(c *gin.Context) (map[string]string, error) {
+	params := map[string]string{}
+	for k, vs := range c.Request.URL.Query() {
+		params[k] = vs[0]
+	}
+
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		if err := c.Request.ParseForm(); err != nil {
+			return nil, err
+		}
+		for k, vs := range c.Request.PostForm {
+			params[k] = vs[0]
+		}
+		return params, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(c.Request.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	for k, v := range raw {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			params[k] = s
+		} else {
+			params[k] = string(v)
+		}
+	}
+	return params, nil
+}
+
+// slackContext はAuthが設定したwebhookとパラメーターを返します
+func slackContext(c *gin.Context) (*model.IncomingWebhook, map[string]string) {
+	wh, _ := c.Get(slackIntegrationKey)
+	params, _ := c.Get(slackParamsKey)
+	return wh.(*model.IncomingWebhook), params.(map[string]string)
+}
+
+// slackMessageFromParams はtext, username, attachmentsのパラメーターからSlackMessageを作ります
+func slackMessageFromParams(params map[string]string) (*SlackMessage, error) {
+	sm := &SlackMessage{
+		Text:      params["text"],
+		UserName:  params["username"],
+		IconEmoji: params["icon_emoji"],
+	}
+	if a := params["attachments"]; a != "" {
+		if err := json.Unmarshal([]byte(a), &sm.Attachments); err != nil {
+			return nil, err
+		}
+	}
+	return sm, nil
+}
+
+// slackError はSlackの形式のエラーを返します
+func slackError(c *gin.Context, code string) {
+	c.JSON(http.StatusOK, gin.H{
+		"ok":    false,
+		"error": code,
+	})
+}
+
+// slackChannel は"#general"のようなチャンネル名から"#"を取り除きます
+func slackChannel(channel string) string {
+	return strings.TrimPrefix(channel, "#")
+}
+
+// slackTS はメッセージのIDをtsにします
+func slackTS(id int64) string {
+	return strconv.FormatInt(id, 10) + ".000000"
+}
+
+// parseSlackTS はtsをメッセージのIDにします。空の場合は0を返します
+func parseSlackTS(ts string) (int64, bool) {
+	if ts == "" {
+		return 0, true
+	}
+	if i := strings.Index(ts, "."); i >= 0 {
+		ts = ts[:i]
+	}
+	id, err := strconv.ParseInt(ts, 10, 64)
+	return id, err == nil && id >= 0
+}
+
+// slackMessageJSON はメッセージをSlackのメッセージの形式にします
+func slackMessageJSON(m *model.Message) gin.H {
+	return gin.H{
+		"type":     "message",
+		"user":     m.UserName,
+		"username": m.UserName,
+		"text":     m.Body,
+		"ts":       slackTS(m.ID),
+		"channel":  m.Channel,
+	}
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSlackAPIはwebhookとして投稿し自分のメッセージだけ更新できる(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, q := range []string{
+		`CREATE TABLE message (id INTEGER NOT NULL PRIMARY KEY, body TEXT NOT NULL DEFAULT "", username TEXT NOT NULL DEFAULT "", channel TEXT NOT NULL DEFAULT "", version INTEGER NOT NULL DEFAULT 1)`,
+		`CREATE TABLE incoming_webhook (id INTEGER NOT NULL PRIMARY KEY, name TEXT NOT NULL DEFAULT "", token TEXT NOT NULL DEFAULT "", channel TEXT NOT NULL DEFAULT "")`,
+		`INSERT INTO message (body, username, channel) VALUES ("hello", "alice", "general")`,
+		`INSERT INTO incoming_webhook (name, token) VALUES ("ci", "xoxb-ci")`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to set up: %s", err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	stream := make(chan *model.Message, 10)
+	s := &SlackAPI{DB: db, Messages: model.NewSQLMessageStore(db), Stream: stream}
+	r := gin.New()
+	api := r.Group("/slack/api", s.Auth())
+	api.POST("/chat.postMessage", s.PostMessage)
+	api.POST("/chat.update", s.Update)
+	api.Any("/conversations.history", s.History)
+
+	call := func(method string, body string, form url.Values, token string) map[string]interface{} {
+		var req *http.Request
+		if form != nil {
+			req = httptest.NewRequest(http.MethodPost, "/slack/api/"+method, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest(http.MethodPost, "/slack/api/"+method, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		var resp map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: failed to decode %q: %s", method, rec.Body.String(), err)
+		}
+		return resp
+	}
+
+	if resp := call("chat.postMessage", `{"channel": "#general", "text": "hi"}`, nil, "wrong"); resp["error"] != "invalid_auth" {
+		t.Fatalf("invalid_auth expected but not, actual %v", resp)
+	}
+
+	resp := call("chat.postMessage", `{"channel": "#general", "text": "build passed", "username": "jenkins"}`, nil, "xoxb-ci")
+	if resp["ok"] != true || resp["ts"] != "2.000000" || resp["channel"] != "general" {
+		t.Fatalf("posted message expected but not, actual %v", resp)
+	}
+	if m := <-stream; m.UserName != "jenkins (ci)" || m.Body != "build passed" || m.Origin != model.OriginWebhook {
+		t.Fatalf("message attributed to the webhook expected but not, actual %#v", m)
+	}
+
+	form := url.Values{"token": {"xoxb-ci"}, "channel": {"general"}, "ts": {"2.000000"}, "text": {"build fixed"}}
+	if resp := call("chat.update", "", form, ""); resp["ok"] != true || resp["text"] != "build fixed" {
+		t.Fatalf("updated message expected but not, actual %v", resp)
+	}
+	form.Set("ts", "1.000000")
+	if resp := call("chat.update", "", form, ""); resp["error"] != "cant_update_message" {
+		t.Fatalf("cant_update_message expected but not, actual %v", resp)
+	}
+
+	resp = call("conversations.history", `{"channel": "general", "limit": 1}`, nil, "xoxb-ci")
+	messages := resp["messages"].([]interface{})
+	if len(messages) != 1 || messages[0].(map[string]interface{})["text"] != "build fixed" || resp["has_more"] != true {
+		t.Fatalf("the latest message with more expected but not, actual %v", resp)
+	}
+	cursor := resp["response_metadata"].(map[string]interface{})["next_cursor"].(string)
+	resp = call("conversations.history", `{"channel": "general", "cursor": "`+cursor+`"}`, nil, "xoxb-ci")
+	messages = resp["messages"].([]interface{})
+	if len(messages) != 1 || messages[0].(map[string]interface{})["text"] != "hello" || resp["has_more"] != false {
+		t.Fatalf("the first message without more expected but not, actual %v", resp)
+	}
+}
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSlackMessageはtextとattachmentsを本文にする(t *testing.T) {
+	payload := `{
+		"text": "Build <https://ci.example.com/builds/42|#42> passed &amp; deployed",
+		"username": "ci",
+		"icon_emoji": ":rocket:",
+		"attachments": [
+			{"fallback": "ignored", "pretext": "Summary", "title": "main", "title_link": "https://example.com/main", "text": "3 commits", "fields": [{"title": "Duration", "value": "2m", "short": true}]},
+			{"fallback": "Only fallback"},
+			null
+		]
+	}`
+	var m SlackMessage
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+
+	expected := "Build #42 (https://ci.example.com/builds/42) passed & deployed\nSummary\nmain (https://example.com/main)\n3 commits\nDuration: 2m\nOnly fallback"
+	if actual := m.Body(); actual != expected {
+		t.Fatalf("body expected %q but not, actual %q", expected, actual)
+	}
+}
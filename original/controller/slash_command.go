@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/httputil"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gin-gonic/gin"
+)
+
+// slashCommandPattern はスラッシュコマンドの名前に使える文字です
+var slashCommandPattern = regexp.MustCompile(`\A[a-z0-9_\-]+\z`)
+
+// SlashCommand is controller for requests to slash commands
+type SlashCommand struct {
+	DB *sql.DB
+}
+
+// All は全てのスラッシュコマンドをJSONで返します。tokenは返しません
+func (s *SlashCommand) All(c *gin.Context) {
+	cs, err := model.SlashCommandsAll(s.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	if cs == nil {
+		cs = make([]*model.SlashCommand, 0)
+	}
+	for _, cmd := range cs {
+		cmd.Token = ""
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": cs,
+		"error":  nil,
+	})
+}
+
+// Create は新しいスラッシュコマンドを保存し、リクエストに含めるtokenを含めてJSONで返します
+func (s *SlashCommand) Create(c *gin.Context) {
+	var cmd model.SlashCommand
+	if err := c.BindJSON(&cmd); err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	if !slashCommandPattern.MatchString(cmd.Command) {
+		resp := httputil.NewErrorResponse(errors.New("command must consist of a-z, 0-9, _ and -"))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	if !isHTTPURL(cmd.URL) {
+		resp := httputil.NewErrorResponse(errors.New("url must be an absolute http or https URL"))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	if _, err := model.SlashCommandByCommand(s.DB, cmd.Command); err == nil {
+		resp := httputil.NewErrorResponse(errors.New("command is already registered"))
+		c.JSON(http.StatusConflict, resp)
+		return
+	}
+
+	token, err := newSecret()
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	cmd.Token = token
+
+	inserted, err := cmd.Insert(s.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"result": inserted,
+		"error":  nil,
+	})
+}
+
+// DeleteByID はパラメーターで受け取ったidのスラッシュコマンドを削除します
+func (s *SlashCommand) DeleteByID(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	err = (&model.SlashCommand{ID: id}).Delete(s.DB)
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusNotFound, resp)
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": nil,
+		"error":  nil,
+	})
+}
@@ -0,0 +1,335 @@
+package controller
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/httputil"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
+	"github.com/gin-gonic/gin"
+)
+
+// webhookDeliveryLimit は配送の記録を返す件数です
+const webhookDeliveryLimit = 50
+
+// Webhook is controller for requests to webhooks
+type Webhook struct {
+	DB       *sql.DB
+	Messages model.MessageStore
+	Stream   chan *model.Message
+}
+
+// OutgoingAll は全てのoutgoing webhookをJSONで返します。secretは返しません
+func (w *Webhook) OutgoingAll(c *gin.Context) {
+	ws, err := model.OutgoingWebhooksAll(w.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	if ws == nil {
+		ws = make([]*model.OutgoingWebhook, 0)
+	}
+	for _, wh := range ws {
+		wh.Secret = ""
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": ws,
+		"error":  nil,
+	})
+}
+
+// CreateOutgoing は新しいoutgoing webhookを保存し、secretを含めてJSONで返します
+//
+// secretが空の場合はランダムに作ります
+func (w *Webhook) CreateOutgoing(c *gin.Context) {
+	var wh model.OutgoingWebhook
+	if err := c.BindJSON(&wh); err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	if wh.Name == "" || wh.Pattern == "" {
+		resp := httputil.NewErrorResponse(errors.New("name and pattern are required"))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	if _, err := regexp.Compile(wh.Pattern); err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	if !isHTTPURL(wh.URL) {
+		resp := httputil.NewErrorResponse(errors.New("url must be an absolute http or https URL"))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	if wh.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			resp := httputil.NewErrorResponse(err)
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+		wh.Secret = secret
+	}
+
+	inserted, err := wh.Insert(w.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"result": inserted,
+		"error":  nil,
+	})
+}
+
+// DeleteOutgoing はパラメーターで受け取ったidのoutgoing webhookを削除します
+func (w *Webhook) DeleteOutgoing(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	err = (&model.OutgoingWebhook{ID: id}).Delete(w.DB)
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusNotFound, resp)
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": nil,
+		"error":  nil,
+	})
+}
+
+// OutgoingDeliveries はパラメーターで受け取ったidのoutgoing webhookの配送の記録を新しい順にJSONで返します
+func (w *Webhook) OutgoingDeliveries(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	_, err = model.OutgoingWebhookByID(w.DB, id)
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusNotFound, resp)
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	ds, err := model.WebhookDeliveriesByWebhookID(w.DB, id, webhookDeliveryLimit)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	if ds == nil {
+		ds = make([]*model.WebhookDelivery, 0)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": ds,
+		"error":  nil,
+	})
+}
+
+// IncomingAll は全てのincoming webhookをJSONで返します。tokenは返しません
+func (w *Webhook) IncomingAll(c *gin.Context) {
+	ws, err := model.IncomingWebhooksAll(w.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	if ws == nil {
+		ws = make([]*model.IncomingWebhook, 0)
+	}
+	for _, wh := range ws {
+		wh.Token = ""
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": ws,
+		"error":  nil,
+	})
+}
+
+// CreateIncoming は新しいincoming webhookを保存し、tokenとPOSTするパスを含めてJSONで返します
+func (w *Webhook) CreateIncoming(c *gin.Context) {
+	var wh model.IncomingWebhook
+	if err := c.BindJSON(&wh); err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	if wh.Name == "" {
+		resp := httputil.NewErrorResponse(errors.New("name is required"))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	token, err := newSecret()
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	wh.Token = token
+
+	inserted, err := wh.Insert(w.DB)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"result": gin.H{
+			"webhook": inserted,
+			"path":    fmt.Sprintf("/api/hooks/%s", inserted.Token),
+		},
+		"error": nil,
+	})
+}
+
+// DeleteIncoming はパラメーターで受け取ったidのincoming webhookを削除します
+func (w *Webhook) DeleteIncoming(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	err = (&model.IncomingWebhook{ID: id}).Delete(w.DB)
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusNotFound, resp)
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": nil,
+		"error":  nil,
+	})
+}
+
+// PostIncoming はパラメーターのtokenのincoming webhookとして、Slack互換のペイロードをメッセージとして投稿します
+//
+// ペイロードはJSONのボディか、フォームの"payload"で受け取ります
+func (w *Webhook) PostIncoming(c *gin.Context) {
+	wh, err := model.IncomingWebhookByToken(w.DB, c.Param("token"))
+	switch {
+	case err == sql.ErrNoRows:
+		resp := httputil.NewErrorResponse(errors.New("no such webhook"))
+		c.JSON(http.StatusNotFound, resp)
+		return
+	case err != nil:
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	var sm SlackMessage
+	if strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		err = json.Unmarshal([]byte(c.PostForm("payload")), &sm)
+	} else {
+		err = c.BindJSON(&sm)
+	}
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	msg := model.Message{
+		Body:     sm.Body(),
+		UserName: integrationUserName(wh, sm.UserName),
+		Channel:  wh.Channel,
+	}
+	if msg.Body == "" {
+		resp := httputil.NewErrorResponse(errors.New("text or attachments is required"))
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	if msg.Channel == "" {
+		msg.Channel = strings.TrimPrefix(sm.Channel, "#")
+	}
+
+	inserted, err := w.Messages.Create(&msg)
+	if err != nil {
+		resp := httputil.NewErrorResponse(err)
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	// bot対応
+	inserted.Origin = model.OriginWebhook
+	w.Stream <- inserted
+
+	c.String(http.StatusOK, "ok")
+}
+
+// integrationUserName はincoming webhookからの投稿者名を返します
+//
+// usernameが指定された場合は"username (webhookの名前)"、そうでない場合はwebhookの名前です
+func integrationUserName(wh *model.IncomingWebhook, username string) string {
+	if username == "" || username == wh.Name {
+		return wh.Name
+	}
+	return fmt.Sprintf("%s (%s)", username, wh.Name)
+}
+
+// postedBy はusernameがincoming webhookからの投稿者名か返します
+func postedBy(wh *model.IncomingWebhook, username string) bool {
+	return username == wh.Name || strings.HasSuffix(username, " ("+wh.Name+")")
+}
+
+// isHTTPURL はsがhttpかhttpsの絶対URLか返します
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// newSecret はランダムな32バイトを16進数にした文字列を返します
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,265 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// スナップショットのファイル名です。時刻はUTCで、同じ秒に複数作っても重ならないようにミリ秒まで入れます
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".db"
+	snapshotLayout = "20060102-150405.000"
+)
+
+// backupStepPages はバックアップで1度にコピーするページ数です。書き込みを長く止めないように少しずつコピーします
+const backupStepPages = 256
+
+// ErrNoSnapshot は指定されたスナップショットがないことを表すエラーです
+var ErrNoSnapshot = errors.New("no such snapshot")
+
+type (
+	// Snapshot はバックアップで作ったファイル1つ分の構造体です
+	Snapshot struct {
+		Name      string    `json:"name"`
+		Size      int64     `json:"size"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// Snapshots はSQLiteのデータベースのスナップショットをdirに作り、古いものを消す構造体です
+	//
+	// SQLiteのオンラインバックアップAPIを使うので、サーバーが動いている間でも一貫したスナップショットを作れます
+	// keepより多いスナップショットと、maxAgeより古いスナップショットは作った後に消します。0の場合は制限しません
+	Snapshots struct {
+		datasource string
+		dir        string
+		keep       int
+		maxAge     time.Duration
+		mu         sync.Mutex
+	}
+)
+
+// NewSnapshots は新しいSnapshotsの構造体のポインタを返します
+func NewSnapshots(datasource, dir string, keep int, maxAge time.Duration) *Snapshots {
+	return &Snapshots{
+		datasource: datasource,
+		dir:        dir,
+		keep:       keep,
+		maxAge:     maxAge,
+	}
+}
+
+// Snapshots はdirにスナップショットを作るSnapshotsを返します。SQLite以外のdialectではエラーを返します
+func (c *Config) Snapshots(dir string, keep int, maxAge time.Duration) (*Snapshots, error) {
+	dialect, err := c.driver()
+	if err != nil {
+		return nil, err
+	}
+	if dialect != DialectSQLite3 {
+		return nil, fmt.Errorf("backup is not supported on %s", dialect)
+	}
+	return NewSnapshots(c.Datasource, dir, keep, maxAge), nil
+}
+
+// Run はintervalごとにスナップショットを作ります。ctxが終了するまで戻りません
+func (s *Snapshots) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := s.Create(); err != nil {
+				log.Printf("failed to backup: %s\n", err)
+			}
+		}
+	}
+}
+
+// Create は新しいスナップショットを作り、古いスナップショットを消します
+func (s *Snapshots) Create() (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, err := s.create()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// List はスナップショットを新しい順に返します
+func (s *Snapshots) List() ([]*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list()
+}
+
+// Restore はnameのスナップショットでデータベースを置き換えます。nameがlatestの場合は一番新しいスナップショットを使います
+//
+// 置き換える前のデータベースもスナップショットにするので、間違えて戻しても元に戻せます
+// 他のコネクションが書き込んでいると置き換えられないので、サーバーを起動する前に使います
+func (s *Snapshots) Restore(name string) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ss, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	var snapshot *Snapshot
+	for _, sn := range ss {
+		if name == sn.Name || (name == "latest" && snapshot == nil) {
+			snapshot = sn
+		}
+	}
+	if snapshot == nil {
+		return nil, ErrNoSnapshot
+	}
+
+	if _, err := s.create(); err != nil {
+		return nil, err
+	}
+	if err := backup(filepath.Join(s.dir, snapshot.Name), s.datasource); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// create は今の時刻のスナップショットを作ります
+//
+// 途中で失敗したファイルが残らないように、一時ファイルに書いてから名前を変えます
+// 戻す直前に作るスナップショットが、戻すスナップショットを上書きしないようにします
+func (s *Snapshots) create() (*Snapshot, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	for {
+		_, err := os.Stat(filepath.Join(s.dir, snapshotPrefix+now.Format(snapshotLayout)+snapshotSuffix))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		now = now.Add(time.Millisecond)
+	}
+	name := snapshotPrefix + now.Format(snapshotLayout) + snapshotSuffix
+	path := filepath.Join(s.dir, name)
+	tmp := path + ".tmp"
+	if err := backup(s.datasource, tmp); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Name: name, Size: fi.Size(), CreatedAt: now}, nil
+}
+
+// rotate はkeepより多いスナップショットとmaxAgeより古いスナップショットを消し、消したスナップショットを返します
+func (s *Snapshots) rotate(now time.Time) ([]*Snapshot, error) {
+	ss, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []*Snapshot
+	for i, sn := range ss {
+		if (s.keep > 0 && i >= s.keep) || (s.maxAge > 0 && now.Sub(sn.CreatedAt) > s.maxAge) {
+			if err := os.Remove(filepath.Join(s.dir, sn.Name)); err != nil {
+				return removed, err
+			}
+			removed = append(removed, sn)
+		}
+	}
+	return removed, nil
+}
+
+// list はdirのスナップショットを新しい順に返します。dirがない場合は空です
+func (s *Snapshots) list() ([]*Snapshot, error) {
+	fis, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return []*Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ss := []*Snapshot{}
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		createdAt, err := time.Parse(snapshotLayout, strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix))
+		if err != nil {
+			continue
+		}
+		ss = append(ss, &Snapshot{Name: name, Size: fi.Size(), CreatedAt: createdAt})
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].CreatedAt.After(ss[j].CreatedAt)
+	})
+	return ss, nil
+}
+
+// backup はSQLiteのオンラインバックアップAPIでsrcのデータベースをdestにコピーします
+//
+// database/sqlからは元のコネクションを取り出せないので、ドライバーで直接開きます
+func backup(src, dest string) error {
+	d := &sqlite3.SQLiteDriver{}
+	srcConn, err := d.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	destConn, err := d.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	b, err := destConn.(*sqlite3.SQLiteConn).Backup("main", srcConn.(*sqlite3.SQLiteConn), "main")
+	if err != nil {
+		return err
+	}
+	for {
+		// 他のコネクションが書き込み中の場合はdoneがfalseでエラーもないので、少し待ってから続けます
+		done, err := b.Step(backupStepPages)
+		if err != nil {
+			b.Finish()
+			return err
+		}
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return b.Finish()
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSnapshots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	datasource := filepath.Join(dir, "test.db")
+	conn, err := sql.Open("sqlite3", datasource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	setBody := func(body string) {
+		if _, err := conn.Exec(`update message set body = ?`, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := conn.Exec(`create table message (id integer primary key, body text)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(`insert into message (body) values ('before')`); err != nil {
+		t.Fatal(err)
+	}
+
+	// 開いているコネクションがあってもスナップショットを作れます
+	s := NewSnapshots(datasource, filepath.Join(dir, "backups"), 2, 0)
+	before, err := s.Create()
+	if err != nil {
+		t.Fatalf("failed to backup: %s", err)
+	}
+	setBody("after")
+
+	if _, err := s.Restore("no-such-snapshot.db"); err != ErrNoSnapshot {
+		t.Fatalf("ErrNoSnapshot expected but not, actual %v", err)
+	}
+	if _, err := s.Restore(before.Name); err != nil {
+		t.Fatalf("failed to restore: %s", err)
+	}
+	var body string
+	if err := conn.QueryRow(`select body from message`).Scan(&body); err != nil || body != "before" {
+		t.Fatalf("restored body expected but not, actual %q %v", body, err)
+	}
+
+	// 戻す前の状態もスナップショットになり、次に作った時にkeepより古いものが消えます
+	time.Sleep(2 * time.Millisecond)
+	if _, err := s.Create(); err != nil {
+		t.Fatalf("failed to backup: %s", err)
+	}
+	ss, err := s.List()
+	if err != nil || len(ss) != 2 {
+		t.Fatalf("2 snapshots expected but not, actual %v %v", ss, err)
+	}
+	for _, sn := range ss {
+		if sn.Name == before.Name {
+			t.Fatalf("oldest snapshot %s must be removed", before.Name)
+		}
+	}
+	if _, err := s.Restore("latest"); err != nil {
+		t.Fatalf("failed to restore: %s", err)
+	}
+
+	s.maxAge = time.Hour
+	removed, err := s.rotate(time.Now().Add(2 * time.Hour))
+	if err != nil || len(removed) != 3 {
+		t.Fatalf("old snapshots expected to be removed but not, actual %v %v", removed, err)
+	}
+}
@@ -1,12 +1,19 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/config"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/migrations"
+	"github.com/mattn/go-sqlite3"
 	"gopkg.in/yaml.v2"
 )
 
@@ -15,21 +22,176 @@ type Configs map[string]*Config
 
 // Open はenvで指定された設定で
 func (cs Configs) Open(env string) (*sql.DB, error) {
+	config, err := cs.Get(env)
+	if err != nil {
+		return nil, err
+	}
+	return config.Open()
+}
+
+// Get はenvの設定を返します
+func (cs Configs) Get(env string) (*Config, error) {
 	config, ok := cs[env]
 	if !ok {
 		return nil, fmt.Errorf("no such env in config file: %s", env)
 	}
-	return config.Open()
+	return config, nil
 }
 
-// Config はdbconfig.ymlを読むための構造体です
-type Config struct {
-	Datasource string `yaml:"datasource"`
-}
+// 対応しているdialectです。database/sqlのドライバーの名前と同じです
+const (
+	// DialectSQLite3 はSQLiteです。dialectを省略した場合もSQLiteを使います
+	DialectSQLite3 = "sqlite3"
+	// DialectPostgres はPostgreSQLです
+	DialectPostgres = "postgres"
+	// DialectMySQL はMySQLです
+	DialectMySQL = "mysql"
+)
+
+// sqliteJournalModes はjournal_modeに指定できる値です
+var sqliteJournalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+
+type (
+	// Config はdbconfig.ymlを読むための構造体です
+	//
+	// Dirはsql-migrateが使うdialectごとのマイグレーションのディレクトリです。サーバーの-migrateはバイナリに埋め込まれたものを使います
+	//
+	// MaxOpenConns、MaxIdleConns、ConnMaxLifetimeはコネクションプールの設定で、0の場合はdatabase/sqlのデフォルトのままです
+	// MaxIdleConnsを負の数にすると使っていないコネクションを残しません
+	// JournalMode、BusyTimeout、ForeignKeysはSQLiteのPRAGMAで、全てのコネクションを開いた時に設定します。省略した場合は設定しません
+	Config struct {
+		Dialect         string        `yaml:"dialect"`
+		Datasource      string        `yaml:"datasource"`
+		Dir             string        `yaml:"dir"`
+		MaxOpenConns    int           `yaml:"max_open_conns"`
+		MaxIdleConns    int           `yaml:"max_idle_conns"`
+		ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+		JournalMode     string        `yaml:"journal_mode"`
+		BusyTimeout     time.Duration `yaml:"busy_timeout"`
+		ForeignKeys     *bool         `yaml:"foreign_keys"`
+	}
+
+	// connector はdsnをdriverで開くdriver.Connectorです
+	//
+	//   fields
+	//     dsn    string
+	//     driver driver.Driver
+	connector struct {
+		dsn    string
+		driver driver.Driver
+	}
+)
 
-// Open は新しくデータベースとのコネクションを返します
+// Open はdialectのドライバーで新しくデータベースとのコネクションを返します
+//
+// コネクションプールとSQLiteのPRAGMAを設定し、Pingで接続できることを確かめてから返します
+// SQLite以外のドライバーは使う側でimportしてください
 func (c *Config) Open() (*sql.DB, error) {
-	return sql.Open("sqlite3", c.Datasource)
+	driverName, err := c.driver()
+	if err != nil {
+		return nil, err
+	}
+
+	var db *sql.DB
+	if driverName == DialectSQLite3 {
+		pragmas, err := c.sqlitePragmas()
+		if err != nil {
+			return nil, err
+		}
+		db = sql.OpenDB(&connector{dsn: c.Datasource, driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				for _, pragma := range pragmas {
+					if _, err := conn.Exec(pragma, nil); err != nil {
+						return fmt.Errorf("%s: %s", pragma, err)
+					}
+				}
+				return nil
+			},
+		}})
+	} else {
+		if c.JournalMode != "" || c.BusyTimeout != 0 || c.ForeignKeys != nil {
+			return nil, fmt.Errorf("journal_mode, busy_timeout and foreign_keys are only for %s", DialectSQLite3)
+		}
+		if db, err = sql.Open(driverName, c.Datasource); err != nil {
+			return nil, err
+		}
+	}
+
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	if c.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+
+	// datasourceにはパスワードが含まれることがあるので、エラーには含めません
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %s database: %s", driverName, err)
+	}
+	return db, nil
+}
+
+// sqlitePragmas はコネクションを開くたびに実行するPRAGMAを返します
+//
+// journal_modeを変えるときにロックを待てるように、busy_timeoutを先に設定します
+func (c *Config) sqlitePragmas() ([]string, error) {
+	var pragmas []string
+	if c.BusyTimeout < 0 {
+		return nil, fmt.Errorf("busy_timeout must not be negative: %s", c.BusyTimeout)
+	}
+	if c.BusyTimeout > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA busy_timeout = %d", c.BusyTimeout/time.Millisecond))
+	}
+	if c.JournalMode != "" {
+		mode := strings.ToUpper(c.JournalMode)
+		valid := false
+		for _, m := range sqliteJournalModes {
+			valid = valid || m == mode
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown journal_mode: %s", c.JournalMode)
+		}
+		pragmas = append(pragmas, "PRAGMA journal_mode = "+mode)
+	}
+	if c.ForeignKeys != nil {
+		if *c.ForeignKeys {
+			pragmas = append(pragmas, "PRAGMA foreign_keys = ON")
+		} else {
+			pragmas = append(pragmas, "PRAGMA foreign_keys = OFF")
+		}
+	}
+	return pragmas, nil
+}
+
+// Connect はdriverで新しいコネクションを開きます
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+// Driver はコネクションを開くdriverを返します
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Migrator はdbにバイナリに埋め込まれたdialectのマイグレーションを適用するMigratorを返します
+func (c *Config) Migrator(db *sql.DB) (*Migrator, error) {
+	dialect, err := c.driver()
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(db, dialect, migrations.Files(dialect))
+}
+
+// driver はdialectに対応するドライバーの名前を返します
+func (c *Config) driver() (string, error) {
+	switch c.Dialect {
+	case "":
+		return DialectSQLite3, nil
+	case DialectSQLite3, DialectPostgres, DialectMySQL:
+		return c.Dialect, nil
+	default:
+		return "", fmt.Errorf("unsupported dialect: %s", c.Dialect)
+	}
 }
 
 // NewConfigsFromFile はファイルパスから新しいConfigsを返します
@@ -43,6 +205,8 @@ func NewConfigsFromFile(path string) (Configs, error) {
 }
 
 // NewConfigs はyamlを読み込んで新しいConfigsを返します
+//
+// 文字列の値の${VAR}は読み込んだ後で環境変数の値に置き換えます。パスワードなどをファイルに書かずに済みます
 func NewConfigs(r io.Reader) (Configs, error) {
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
@@ -52,5 +216,8 @@ func NewConfigs(r io.Reader) (Configs, error) {
 	if err = yaml.Unmarshal(b, &configs); err != nil {
 		return nil, err
 	}
+	if err = config.ExpandFields(configs, os.LookupEnv); err != nil {
+		return nil, err
+	}
 	return configs, nil
 }
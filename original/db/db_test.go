@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cs, err := NewConfigs(strings.NewReader(`
+test:
+  dialect: sqlite3
+  datasource: ` + filepath.Join(dir, "test.db") + `
+  max_open_conns: 4
+  conn_max_lifetime: 1h
+  journal_mode: wal
+  busy_timeout: 3s
+  foreign_keys: true
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	db, err := cs.Open("test")
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	defer db.Close()
+	if n := db.Stats().MaxOpenConnections; n != 4 {
+		t.Errorf("max open connections expected 4 but not, actual %d", n)
+	}
+
+	// PRAGMAはコネクションごとの設定なので、同時に開いた2つのコネクションで確かめます
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("failed to get conn: %s", err)
+		}
+		defer conn.Close()
+
+		var mode string
+		var timeout, fk int
+		conn.QueryRowContext(ctx, `PRAGMA journal_mode`).Scan(&mode)
+		conn.QueryRowContext(ctx, `PRAGMA busy_timeout`).Scan(&timeout)
+		conn.QueryRowContext(ctx, `PRAGMA foreign_keys`).Scan(&fk)
+		if mode != "wal" || timeout != 3000 || fk != 1 {
+			t.Errorf("conn %d: pragmas expected but not, actual journal_mode=%s busy_timeout=%d foreign_keys=%d", i, mode, timeout, fk)
+		}
+	}
+}
+
+func TestConfigOpenは間違った設定をエラーにする(t *testing.T) {
+	cases := []struct {
+		config   *Config
+		expected string
+	}{
+		{&Config{Datasource: ":memory:", JournalMode: "fast"}, "unknown journal_mode"},
+		{&Config{Datasource: ":memory:", BusyTimeout: -1}, "busy_timeout must not be negative"},
+		{&Config{Dialect: DialectPostgres, JournalMode: "wal"}, "only for sqlite3"},
+		{&Config{Datasource: filepath.Join("no", "such", "dir", "test.db")}, "failed to connect"},
+	}
+	for _, tc := range cases {
+		db, err := tc.config.Open()
+		if err == nil {
+			db.Close()
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%+v: expected error %q but not, actual %v", tc.config, tc.expected, err)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// migrationTable は適用したマイグレーションを記録するテーブルです
+//
+// sql-migrateと同じテーブルを使うので、sql-migrateで適用済みのデータベースもそのまま使えます
+const migrationTable = "gorp_migrations"
+
+// マイグレーションのロックのキーです。PostgreSQLはadvisory lockに、MySQLはGET_LOCKに使います
+const (
+	migrationLockKey  = 20180422
+	migrationLockName = "vg1day_migrations"
+)
+
+// ErrMigrationLocked は他のプロセスがマイグレーションを実行中でロックを取れなかったことを表すエラーです
+var ErrMigrationLocked = errors.New("migration is locked by another process")
+
+type (
+	// Migration はマイグレーションのファイル1つ分の構造体です
+	//
+	// IDはファイル名で、UpとDownは`-- +migrate Up`と`-- +migrate Down`の後に書かれた文です
+	Migration struct {
+		ID   string
+		Up   []string
+		Down []string
+	}
+
+	// MigrationStatus はマイグレーションが適用済みかどうかを表す構造体です
+	MigrationStatus struct {
+		ID        string
+		AppliedAt time.Time
+		Applied   bool
+	}
+
+	// Migrator はマイグレーションを適用、取り消しする構造体です
+	//
+	//   fields
+	//     db         *sql.DB
+	//     dialect    string
+	//     migrations []*Migration
+	Migrator struct {
+		db         *sql.DB
+		dialect    string
+		migrations []*Migration
+	}
+)
+
+// NewMigrator はfilesのマイグレーションをdialectのdbに適用するMigratorを返します
+//
+// filesはファイル名からSQLへのmapです。ファイル名の先頭の番号の順に適用します
+func NewMigrator(db *sql.DB, dialect string, files map[string]string) (*Migrator, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no migrations for dialect: %s", dialect)
+	}
+	m := &Migrator{db: db, dialect: dialect}
+	for id, src := range files {
+		mg, err := ParseMigration(id, src)
+		if err != nil {
+			return nil, err
+		}
+		m.migrations = append(m.migrations, mg)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return migrationLess(m.migrations[i].ID, m.migrations[j].ID)
+	})
+	return m, nil
+}
+
+// ParseMigration はsql-migrateの形式のSQLを読み、Migrationを返します
+//
+// `-- +migrate StatementBegin`と`-- +migrate StatementEnd`で囲まれた部分は途中に;があっても1つの文として扱います
+func ParseMigration(id, src string) (*Migration, error) {
+	m := &Migration{ID: id}
+	var (
+		stmts     *[]string
+		buf       strings.Builder
+		statement bool
+		hasUp     bool
+	)
+	flush := func() {
+		if s := strings.TrimSpace(buf.String()); s != "" {
+			*stmts = append(*stmts, s)
+		}
+		buf.Reset()
+	}
+
+	sc := bufio.NewScanner(strings.NewReader(src))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "-- +migrate ") {
+			fields := strings.Fields(strings.TrimPrefix(trimmed, "-- +migrate "))
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "Up":
+				if stmts != nil {
+					flush()
+				}
+				stmts, hasUp = &m.Up, true
+			case "Down":
+				if stmts != nil {
+					flush()
+				}
+				stmts = &m.Down
+			case "StatementBegin":
+				statement = true
+			case "StatementEnd":
+				statement = false
+				if stmts != nil {
+					flush()
+				}
+			}
+			continue
+		}
+		if stmts == nil {
+			continue
+		}
+		if buf.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+		if !statement && strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if statement {
+		return nil, fmt.Errorf("%s: missing StatementEnd", id)
+	}
+	if !hasUp {
+		return nil, fmt.Errorf("%s: no +migrate Up section", id)
+	}
+	if stmts != nil {
+		flush()
+	}
+	return m, nil
+}
+
+// Up はまだ適用していないマイグレーションを順に全て適用し、適用したものを返します
+//
+// dryRunがtrueの場合は適用せずに、適用するはずのものを返します
+func (m *Migrator) Up(ctx context.Context, dryRun bool) ([]*Migration, error) {
+	var done []*Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[string]time.Time) error {
+		for _, mg := range m.migrations {
+			if _, ok := applied[mg.ID]; ok {
+				continue
+			}
+			if !dryRun {
+				if err := m.apply(ctx, conn, mg.ID, mg.Up, true); err != nil {
+					return err
+				}
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down は適用済みのマイグレーションを新しいものから順にsteps個取り消し、取り消したものを返します
+//
+// dryRunがtrueの場合は取り消さずに、取り消すはずのものを返します
+func (m *Migrator) Down(ctx context.Context, steps int, dryRun bool) ([]*Migration, error) {
+	var done []*Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[string]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mg := m.migrations[i]
+			if _, ok := applied[mg.ID]; !ok {
+				continue
+			}
+			if !dryRun {
+				if err := m.apply(ctx, conn, mg.ID, mg.Down, false); err != nil {
+					return err
+				}
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status は全てのマイグレーションが適用済みかどうかを古い順に返します
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	var ss []*MigrationStatus
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[string]time.Time) error {
+		for _, mg := range m.migrations {
+			at, ok := applied[mg.ID]
+			ss = append(ss, &MigrationStatus{ID: mg.ID, AppliedAt: at, Applied: ok})
+		}
+		return nil
+	})
+	return ss, err
+}
+
+// locked はロックを取ってからfnを実行します。fnには適用済みのマイグレーションのIDと適用した時刻が渡されます
+//
+// SQLiteはBEGIN IMMEDIATEでデータベースへの書き込みをロックし、全てのマイグレーションを1つのトランザクションで実行します
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, applied map[string]time.Time) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := m.lock(ctx, conn); err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := m.unlock(conn, err); err == nil {
+			err = uerr
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, m.createTable()); err != nil {
+		return err
+	}
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+// lock はdialectごとの方法でマイグレーションのロックを取ります
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) error {
+	switch m.dialect {
+	case DialectPostgres:
+		_, err := conn.ExecContext(ctx, `select pg_advisory_lock($1)`, migrationLockKey)
+		return err
+	case DialectMySQL:
+		var ok sql.NullInt64
+		if err := conn.QueryRowContext(ctx, `select get_lock(?, 60)`, migrationLockName).Scan(&ok); err != nil {
+			return err
+		}
+		if ok.Int64 != 1 {
+			return ErrMigrationLocked
+		}
+		return nil
+	default:
+		if _, err := conn.ExecContext(ctx, `begin immediate`); err != nil {
+			if strings.Contains(err.Error(), "locked") || strings.Contains(err.Error(), "busy") {
+				return ErrMigrationLocked
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// unlock はlockで取ったロックを外します。SQLiteの場合はerrがnilならコミット、そうでなければロールバックします
+//
+// ctxがキャンセルされていてもロックを外せるように、context.Backgroundを使います
+func (m *Migrator) unlock(conn *sql.Conn, err error) error {
+	ctx := context.Background()
+	switch m.dialect {
+	case DialectPostgres:
+		_, uerr := conn.ExecContext(ctx, `select pg_advisory_unlock($1)`, migrationLockKey)
+		return uerr
+	case DialectMySQL:
+		_, uerr := conn.ExecContext(ctx, `select release_lock(?)`, migrationLockName)
+		return uerr
+	default:
+		if err != nil {
+			_, uerr := conn.ExecContext(ctx, `rollback`)
+			return uerr
+		}
+		_, uerr := conn.ExecContext(ctx, `commit`)
+		return uerr
+	}
+}
+
+// apply はstmtsを実行し、upならmigrationTableに記録、そうでなければ記録を削除します
+//
+// SQLite以外はマイグレーションごとにトランザクションを使います。MySQLはDDLを実行すると暗黙にコミットされることに注意してください
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, id string, stmts []string, up bool) error {
+	record := fmt.Sprintf(`delete from %s where id = %s`, migrationTable, m.param(1))
+	args := []interface{}{id}
+	if up {
+		record = fmt.Sprintf(`insert into %s (id, applied_at) values (%s, %s)`, migrationTable, m.param(1), m.param(2))
+		args = append(args, time.Now())
+	}
+
+	if m.dialect == DialectSQLite3 {
+		for _, s := range stmts {
+			if _, err := conn.ExecContext(ctx, s); err != nil {
+				return fmt.Errorf("%s: %s", id, err)
+			}
+		}
+		_, err := conn.ExecContext(ctx, record, args...)
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, s := range stmts {
+		if _, err := tx.ExecContext(ctx, s); err != nil {
+			return fmt.Errorf("%s: %s", id, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applied は適用済みのマイグレーションのIDと適用した時刻を返します
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[string]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(`select id, applied_at from %s`, migrationTable))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[string]time.Time{}
+	for rows.Next() {
+		var (
+			id string
+			at sql.NullString
+		)
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		applied[id] = parseAppliedAt(at.String)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// createTable はmigrationTableを作るSQLを返します。sql-migrateと同じ定義です
+func (m *Migrator) createTable() string {
+	switch m.dialect {
+	case DialectPostgres:
+		return `create table if not exists ` + migrationTable + ` (id text not null primary key, applied_at timestamp with time zone)`
+	default:
+		return `create table if not exists ` + migrationTable + ` (id varchar(255) not null primary key, applied_at datetime)`
+	}
+}
+
+// param はn番目のプレースホルダーを返します
+func (m *Migrator) param(n int) string {
+	if m.dialect == DialectPostgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// parseAppliedAt はドライバーごとに異なる形式のapplied_atを読みます。読めない場合はゼロを返します
+func parseAppliedAt(s string) time.Time {
+	for _, layout := range []string{
+		"2006-01-02 15:04:05.999999999-07:00",
+		time.RFC3339Nano,
+		"2006-01-02 15:04:05.999999999",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// migrationLess はsql-migrateと同じく、ファイル名の先頭の番号、番号が同じならファイル名の順で比べます
+func migrationLess(a, b string) bool {
+	na, nb := migrationNumber(a), migrationNumber(b)
+	if na != nb {
+		return na < nb
+	}
+	return a < b
+}
+
+// migrationNumber はファイル名の先頭の番号を返します。番号がない場合は-1を返します
+func migrationNumber(id string) int {
+	i := strings.IndexFunc(id, func(r rune) bool { return !unicode.IsDigit(r) })
+	if i == 0 {
+		return -1
+	}
+	if i < 0 {
+		i = len(id)
+	}
+	n, err := strconv.Atoi(id[:i])
+	if err != nil {
+		return -1
+	}
+	return n
+}
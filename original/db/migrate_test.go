@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestParseMigration(t *testing.T) {
+	src := `-- +migrate Up
+-- テーブルを作ります
+CREATE TABLE a (
+    id INTEGER NOT NULL PRIMARY KEY
+);
+CREATE INDEX a_id ON a (id);
+
+-- +migrate StatementBegin
+CREATE TRIGGER a_trigger AFTER INSERT ON a BEGIN
+    DELETE FROM a WHERE id < 0;
+END;
+-- +migrate StatementEnd
+
+-- +migrate Down
+DROP TABLE a;
+`
+	m, err := ParseMigration("1_a.sql", src)
+	if err != nil {
+		t.Fatalf("ParseMigration failed: %s", err)
+	}
+	up := []string{
+		"CREATE TABLE a (\n    id INTEGER NOT NULL PRIMARY KEY\n);",
+		"CREATE INDEX a_id ON a (id);",
+		"CREATE TRIGGER a_trigger AFTER INSERT ON a BEGIN\n    DELETE FROM a WHERE id < 0;\nEND;",
+	}
+	if !reflect.DeepEqual(m.Up, up) {
+		t.Errorf("Up = %q, want %q", m.Up, up)
+	}
+	if down := []string{"DROP TABLE a;"}; !reflect.DeepEqual(m.Down, down) {
+		t.Errorf("Down = %q, want %q", m.Down, down)
+	}
+
+	if _, err := ParseMigration("2_b.sql", "CREATE TABLE b (id INTEGER);\n"); err == nil {
+		t.Errorf("ParseMigration without Up section succeeded")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+
+	files := map[string]string{
+		"1_create_a.sql":  "-- +migrate Up\nCREATE TABLE a (id INTEGER);\n\n-- +migrate Down\nDROP TABLE a;\n",
+		"2_create_b.sql":  "-- +migrate Up\nCREATE TABLE b (id INTEGER);\n\n-- +migrate Down\nDROP TABLE b;\n",
+		"10_create_c.sql": "-- +migrate Up\nCREATE TABLE c (id INTEGER);\n\n-- +migrate Down\nDROP TABLE c;\n",
+	}
+	m, err := NewMigrator(db, DialectSQLite3, files)
+	if err != nil {
+		t.Fatalf("NewMigrator failed: %s", err)
+	}
+	ctx := context.Background()
+
+	// sql-migrateで1つ目だけ適用済みのデータベースと同じ状態にします
+	if _, err := db.Exec(`CREATE TABLE gorp_migrations (id varchar(255) not null primary key, applied_at datetime); CREATE TABLE a (id INTEGER); INSERT INTO gorp_migrations VALUES ('1_create_a.sql', '2018-04-22 10:00:00')`); err != nil {
+		t.Fatalf("failed to prepare db: %s", err)
+	}
+
+	ms, err := m.Up(ctx, true)
+	if err != nil {
+		t.Fatalf("Up(dryRun) failed: %s", err)
+	}
+	if got := migrationIDs(ms); !reflect.DeepEqual(got, []string{"2_create_b.sql", "10_create_c.sql"}) {
+		t.Errorf("Up(dryRun) = %v", got)
+	}
+	if tableExists(t, db, "b") {
+		t.Errorf("Up(dryRun) created table b")
+	}
+
+	if _, err := m.Up(ctx, false); err != nil {
+		t.Fatalf("Up failed: %s", err)
+	}
+	if !tableExists(t, db, "b") || !tableExists(t, db, "c") {
+		t.Errorf("Up did not create tables")
+	}
+	if ms, err := m.Up(ctx, false); err != nil || len(ms) != 0 {
+		t.Errorf("second Up = %v, %v, want nothing to run", migrationIDs(ms), err)
+	}
+
+	ms, err = m.Down(ctx, 2, false)
+	if err != nil {
+		t.Fatalf("Down failed: %s", err)
+	}
+	if got := migrationIDs(ms); !reflect.DeepEqual(got, []string{"10_create_c.sql", "2_create_b.sql"}) {
+		t.Errorf("Down = %v", got)
+	}
+	if tableExists(t, db, "b") || !tableExists(t, db, "a") {
+		t.Errorf("Down dropped wrong tables")
+	}
+
+	ss, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %s", err)
+	}
+	var applied []bool
+	for _, s := range ss {
+		applied = append(applied, s.Applied)
+	}
+	if !reflect.DeepEqual(applied, []bool{true, false, false}) {
+		t.Errorf("Status applied = %v", applied)
+	}
+}
+
+func TestMigratorRollsBackOnError(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	m, err := NewMigrator(db, DialectSQLite3, map[string]string{
+		"1_create_a.sql": "-- +migrate Up\nCREATE TABLE a (id INTEGER);\n",
+		"2_broken.sql":   "-- +migrate Up\nCREATE TABLE a (id INTEGER);\n",
+	})
+	if err != nil {
+		t.Fatalf("NewMigrator failed: %s", err)
+	}
+	if _, err := m.Up(context.Background(), false); err == nil {
+		t.Fatalf("Up of broken migration succeeded")
+	}
+	if tableExists(t, db, "a") {
+		t.Errorf("Up did not roll back table a")
+	}
+}
+
+func TestConfigMigrator(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	m, err := (&Config{}).Migrator(db)
+	if err != nil {
+		t.Fatalf("Migrator failed: %s", err)
+	}
+	if _, err := m.Up(context.Background(), false); err != nil {
+		t.Fatalf("Up of embedded migrations failed: %s", err)
+	}
+	if !tableExists(t, db, "message") || !tableExists(t, db, "bot_kv") {
+		t.Errorf("embedded migrations did not create tables")
+	}
+}
+
+func migrationIDs(ms []*Migration) []string {
+	var ids []string
+	for _, m := range ms {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var n int
+	if err := db.QueryRow(`select count(*) from sqlite_master where type = 'table' and name = ?`, name).Scan(&n); err != nil {
+		t.Fatalf("failed to query sqlite_master: %s", err)
+	}
+	return n > 0
+}
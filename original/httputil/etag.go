@@ -0,0 +1,46 @@
+package httputil
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ETag はversionからETagヘッダーの値を作ります
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// MatchIfMatch はIf-Matchヘッダーの値headerがetagに一致するか返します
+//
+// RFC 7232の通り強い比較をするので、W/の付いた弱いETagは一致しません
+func MatchIfMatch(header, etag string) bool {
+	for _, tag := range splitETags(header) {
+		if tag == "*" || (!strings.HasPrefix(tag, "W/") && tag == etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchIfNoneMatch はIf-None-Matchヘッダーの値headerがetagに一致するか返します
+//
+// RFC 7232の通り弱い比較をするので、W/の有無は無視します
+func MatchIfNoneMatch(header, etag string) bool {
+	for _, tag := range splitETags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// splitETags はカンマで区切られたETagのリストを分けます
+func splitETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
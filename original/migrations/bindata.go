@@ -0,0 +1,63 @@
+// Code generated by gen.go; DO NOT EDIT.
+
+package migrations
+
+var files = map[string]map[string]string{
+	"mysql": {
+		"10_create_incoming_webhook_table.sql": "-- +migrate Up\nCREATE TABLE incoming_webhook (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    name VARCHAR(191) NOT NULL DEFAULT '',\n    token VARCHAR(191) NOT NULL DEFAULT '',\n    channel VARCHAR(255) NOT NULL DEFAULT '',\n    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\nCREATE UNIQUE INDEX incoming_webhook_token ON incoming_webhook (token);\n\n-- +migrate Down\nDROP TABLE incoming_webhook;\n",
+		"11_create_slash_command_table.sql":    "-- +migrate Up\nCREATE TABLE slash_command (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    command VARCHAR(191) NOT NULL DEFAULT '',\n    url TEXT NOT NULL,\n    token VARCHAR(191) NOT NULL DEFAULT '',\n    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\nCREATE UNIQUE INDEX slash_command_command ON slash_command (command);\n\n-- +migrate Down\nDROP TABLE slash_command;\n",
+		"12_create_external_bot_table.sql":     "-- +migrate Up\nCREATE TABLE external_bot (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    name VARCHAR(191) NOT NULL DEFAULT '',\n    token VARCHAR(191) NOT NULL DEFAULT '',\n    quota INTEGER NOT NULL DEFAULT 30,\n    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\nCREATE UNIQUE INDEX external_bot_name ON external_bot (name);\nCREATE UNIQUE INDEX external_bot_token ON external_bot (token);\n\n-- +migrate Down\nDROP TABLE external_bot;\n",
+		"13_create_bot_script_table.sql":       "-- +migrate Up\nCREATE TABLE bot_script (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    name VARCHAR(191) NOT NULL DEFAULT '',\n    source TEXT NOT NULL,\n    grants VARCHAR(255) NOT NULL DEFAULT '',\n    updated_at BIGINT NOT NULL DEFAULT 0\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\nCREATE UNIQUE INDEX bot_script_name ON bot_script (name);\n\n-- +migrate Down\nDROP TABLE bot_script;\n",
+		"14_create_bot_kv_table.sql":           "-- +migrate Up\nCREATE TABLE bot_kv (\n    namespace VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,\n    `key` VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,\n    value TEXT NOT NULL,\n    PRIMARY KEY (namespace, `key`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n\n-- +migrate Down\nDROP TABLE bot_kv;\n",
+		"15_add_expires_at_to_bot_kv.sql":      "-- +migrate Up\nALTER TABLE bot_kv ADD COLUMN expires_at BIGINT NOT NULL DEFAULT 0;\nCREATE INDEX bot_kv_expires_at ON bot_kv (expires_at);\n\n-- +migrate Down\nDROP INDEX bot_kv_expires_at ON bot_kv;\nALTER TABLE bot_kv DROP COLUMN expires_at;\n",
+		"16_add_version_to_message.sql":        "-- +migrate Up\nALTER TABLE message ADD COLUMN version BIGINT NOT NULL DEFAULT 1;\n\n-- +migrate Down\nALTER TABLE message DROP COLUMN version;\n",
+		"17_create_message_import_table.sql":   "-- +migrate Up\nCREATE TABLE message_import (\n    source VARCHAR(191) NOT NULL,\n    source_id BIGINT NOT NULL,\n    message_id BIGINT NOT NULL,\n    PRIMARY KEY (source, source_id)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n\n-- +migrate Down\nDROP TABLE message_import;\n",
+		"1_create_message_table.sql":           "-- +migrate Up\nCREATE TABLE message (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    body TEXT NOT NULL,\n    username VARCHAR(191) NOT NULL DEFAULT '',\n    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,\n    updated DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n\n-- +migrate Down\nDROP TABLE message;\n",
+		"2_create_omikuji_table.sql":           "-- +migrate Up\nCREATE TABLE omikuji (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    username VARCHAR(191) NOT NULL DEFAULT '',\n    date VARCHAR(191) NOT NULL DEFAULT '',\n    fortune VARCHAR(255) NOT NULL DEFAULT '',\n    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\nCREATE UNIQUE INDEX omikuji_username_date ON omikuji (username, date);\n\n-- +migrate Down\nDROP TABLE omikuji;\n",
+		"3_add_channel_to_message.sql":         "-- +migrate Up\nALTER TABLE message ADD COLUMN channel VARCHAR(255) NOT NULL DEFAULT '';\n\n-- +migrate Down\nALTER TABLE message DROP COLUMN channel;\n",
+		"4_create_scheduled_run_table.sql":     "-- +migrate Up\nCREATE TABLE scheduled_run (\n    name VARCHAR(191) NOT NULL PRIMARY KEY,\n    last_run BIGINT NOT NULL DEFAULT 0\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n\n-- +migrate Down\nDROP TABLE scheduled_run;\n",
+		"5_create_reminder_table.sql":          "-- +migrate Up\nCREATE TABLE reminder (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    username VARCHAR(191) NOT NULL DEFAULT '',\n    target VARCHAR(191) NOT NULL DEFAULT '',\n    body TEXT NOT NULL,\n    due_at BIGINT NOT NULL DEFAULT 0,\n    fired INTEGER NOT NULL DEFAULT 0,\n    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\nCREATE INDEX reminder_fired_due_at ON reminder (fired, due_at);\n\n-- +migrate Down\nDROP TABLE reminder;\n",
+		"6_create_poll_table.sql":              "-- +migrate Up\nCREATE TABLE poll (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    message_id BIGINT NOT NULL DEFAULT 0,\n    question TEXT NOT NULL,\n    username VARCHAR(191) NOT NULL DEFAULT '',\n    closes_at BIGINT NOT NULL DEFAULT 0,\n    closed INTEGER NOT NULL DEFAULT 0,\n    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\nCREATE INDEX poll_closed_closes_at ON poll (closed, closes_at);\n\nCREATE TABLE poll_option (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    poll_id BIGINT NOT NULL,\n    position INTEGER NOT NULL,\n    label TEXT NOT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\nCREATE UNIQUE INDEX poll_option_poll_id_position ON poll_option (poll_id, position);\n\nCREATE TABLE poll_vote (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    poll_id BIGINT NOT NULL,\n    option_id BIGINT NOT NULL,\n    username VARCHAR(191) NOT NULL DEFAULT '',\n    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\nCREATE UNIQUE INDEX poll_vote_poll_id_username ON poll_vote (poll_id, username);\n\n-- +migrate Down\nDROP TABLE poll_vote;\nDROP TABLE poll_option;\nDROP TABLE poll;\n",
+		"7_create_conversation_table.sql":      "-- +migrate Up\nCREATE TABLE conversation (\n    bot VARCHAR(191) NOT NULL,\n    username VARCHAR(191) NOT NULL,\n    state TEXT NOT NULL,\n    expires_at BIGINT NOT NULL DEFAULT 0,\n    PRIMARY KEY (bot, username)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n\n-- +migrate Down\nDROP TABLE conversation;\n",
+		"8_create_karma_table.sql":             "-- +migrate Up\nCREATE TABLE karma (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    giver VARCHAR(191) NOT NULL DEFAULT '',\n    target VARCHAR(191) NOT NULL DEFAULT '',\n    delta INTEGER NOT NULL DEFAULT 0,\n    reason TEXT NOT NULL,\n    voted_at BIGINT NOT NULL DEFAULT 0\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\nCREATE INDEX karma_target ON karma (target);\nCREATE INDEX karma_giver_target_voted_at ON karma (giver, target, voted_at);\n\n-- +migrate Down\nDROP TABLE karma;\n",
+		"9_create_outgoing_webhook_table.sql":  "-- +migrate Up\nCREATE TABLE outgoing_webhook (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    name VARCHAR(191) NOT NULL DEFAULT '',\n    pattern TEXT NOT NULL,\n    url TEXT NOT NULL,\n    secret VARCHAR(255) NOT NULL DEFAULT '',\n    channel VARCHAR(255) NOT NULL DEFAULT '',\n    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n\nCREATE TABLE webhook_delivery (\n    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    webhook_id BIGINT NOT NULL,\n    message_id BIGINT NOT NULL DEFAULT 0,\n    status VARCHAR(255) NOT NULL DEFAULT 'pending',\n    attempts INTEGER NOT NULL DEFAULT 0,\n    status_code INTEGER NOT NULL DEFAULT 0,\n    error TEXT NOT NULL,\n    updated_at BIGINT NOT NULL DEFAULT 0,\n    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\nCREATE INDEX webhook_delivery_webhook_id ON webhook_delivery (webhook_id);\n\n-- +migrate Down\nDROP TABLE webhook_delivery;\nDROP TABLE outgoing_webhook;\n",
+	},
+	"postgres": {
+		"10_create_incoming_webhook_table.sql": "-- +migrate Up\nCREATE TABLE incoming_webhook (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    name TEXT NOT NULL DEFAULT '',\n    token TEXT NOT NULL DEFAULT '',\n    channel TEXT NOT NULL DEFAULT '',\n    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\nCREATE UNIQUE INDEX incoming_webhook_token ON incoming_webhook (token);\n\n-- +migrate Down\nDROP TABLE incoming_webhook;\n",
+		"11_create_slash_command_table.sql":    "-- +migrate Up\nCREATE TABLE slash_command (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    command TEXT NOT NULL DEFAULT '',\n    url TEXT NOT NULL DEFAULT '',\n    token TEXT NOT NULL DEFAULT '',\n    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\nCREATE UNIQUE INDEX slash_command_command ON slash_command (command);\n\n-- +migrate Down\nDROP TABLE slash_command;\n",
+		"12_create_external_bot_table.sql":     "-- +migrate Up\nCREATE TABLE external_bot (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    name TEXT NOT NULL DEFAULT '',\n    token TEXT NOT NULL DEFAULT '',\n    quota INTEGER NOT NULL DEFAULT 30,\n    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\nCREATE UNIQUE INDEX external_bot_name ON external_bot (name);\nCREATE UNIQUE INDEX external_bot_token ON external_bot (token);\n\n-- +migrate Down\nDROP TABLE external_bot;\n",
+		"13_create_bot_script_table.sql":       "-- +migrate Up\nCREATE TABLE bot_script (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    name TEXT NOT NULL DEFAULT '',\n    source TEXT NOT NULL DEFAULT '',\n    grants TEXT NOT NULL DEFAULT '',\n    updated_at BIGINT NOT NULL DEFAULT 0\n);\nCREATE UNIQUE INDEX bot_script_name ON bot_script (name);\n\n-- +migrate Down\nDROP TABLE bot_script;\n",
+		"14_create_bot_kv_table.sql":           "-- +migrate Up\nCREATE TABLE bot_kv (\n    namespace TEXT NOT NULL,\n    key TEXT NOT NULL,\n    value TEXT NOT NULL DEFAULT '',\n    PRIMARY KEY (namespace, key)\n);\n\n-- +migrate Down\nDROP TABLE bot_kv;\n",
+		"15_add_expires_at_to_bot_kv.sql":      "-- +migrate Up\nALTER TABLE bot_kv ADD COLUMN expires_at BIGINT NOT NULL DEFAULT 0;\nCREATE INDEX bot_kv_expires_at ON bot_kv (expires_at);\n\n-- +migrate Down\nDROP INDEX bot_kv_expires_at;\nALTER TABLE bot_kv DROP COLUMN expires_at;\n",
+		"16_add_version_to_message.sql":        "-- +migrate Up\nALTER TABLE message ADD COLUMN version BIGINT NOT NULL DEFAULT 1;\n\n-- +migrate Down\nALTER TABLE message DROP COLUMN version;\n",
+		"17_create_message_import_table.sql":   "-- +migrate Up\nCREATE TABLE message_import (\n    source TEXT NOT NULL,\n    source_id BIGINT NOT NULL,\n    message_id BIGINT NOT NULL,\n    PRIMARY KEY (source, source_id)\n);\n\n-- +migrate Down\nDROP TABLE message_import;\n",
+		"1_create_message_table.sql":           "-- +migrate Up\nCREATE TABLE message (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    body TEXT NOT NULL DEFAULT '',\n    username TEXT NOT NULL DEFAULT '',\n    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\n    updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\n\n-- +migrate Down\nDROP TABLE message;\n",
+		"2_create_omikuji_table.sql":           "-- +migrate Up\nCREATE TABLE omikuji (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    username TEXT NOT NULL DEFAULT '',\n    date TEXT NOT NULL DEFAULT '',\n    fortune TEXT NOT NULL DEFAULT '',\n    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\nCREATE UNIQUE INDEX omikuji_username_date ON omikuji (username, date);\n\n-- +migrate Down\nDROP TABLE omikuji;\n",
+		"3_add_channel_to_message.sql":         "-- +migrate Up\nALTER TABLE message ADD COLUMN channel TEXT NOT NULL DEFAULT '';\n\n-- +migrate Down\nALTER TABLE message DROP COLUMN channel;\n",
+		"4_create_scheduled_run_table.sql":     "-- +migrate Up\nCREATE TABLE scheduled_run (\n    name TEXT NOT NULL PRIMARY KEY,\n    last_run BIGINT NOT NULL DEFAULT 0\n);\n\n-- +migrate Down\nDROP TABLE scheduled_run;\n",
+		"5_create_reminder_table.sql":          "-- +migrate Up\nCREATE TABLE reminder (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    username TEXT NOT NULL DEFAULT '',\n    target TEXT NOT NULL DEFAULT '',\n    body TEXT NOT NULL DEFAULT '',\n    due_at BIGINT NOT NULL DEFAULT 0,\n    fired INTEGER NOT NULL DEFAULT 0,\n    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\nCREATE INDEX reminder_fired_due_at ON reminder (fired, due_at);\n\n-- +migrate Down\nDROP TABLE reminder;\n",
+		"6_create_poll_table.sql":              "-- +migrate Up\nCREATE TABLE poll (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    message_id BIGINT NOT NULL DEFAULT 0,\n    question TEXT NOT NULL DEFAULT '',\n    username TEXT NOT NULL DEFAULT '',\n    closes_at BIGINT NOT NULL DEFAULT 0,\n    closed INTEGER NOT NULL DEFAULT 0,\n    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\nCREATE INDEX poll_closed_closes_at ON poll (closed, closes_at);\n\nCREATE TABLE poll_option (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    poll_id BIGINT NOT NULL,\n    position INTEGER NOT NULL,\n    label TEXT NOT NULL DEFAULT ''\n);\nCREATE UNIQUE INDEX poll_option_poll_id_position ON poll_option (poll_id, position);\n\nCREATE TABLE poll_vote (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    poll_id BIGINT NOT NULL,\n    option_id BIGINT NOT NULL,\n    username TEXT NOT NULL DEFAULT '',\n    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\nCREATE UNIQUE INDEX poll_vote_poll_id_username ON poll_vote (poll_id, username);\n\n-- +migrate Down\nDROP TABLE poll_vote;\nDROP TABLE poll_option;\nDROP TABLE poll;\n",
+		"7_create_conversation_table.sql":      "-- +migrate Up\nCREATE TABLE conversation (\n    bot TEXT NOT NULL,\n    username TEXT NOT NULL,\n    state TEXT NOT NULL DEFAULT '{}',\n    expires_at BIGINT NOT NULL DEFAULT 0,\n    PRIMARY KEY (bot, username)\n);\n\n-- +migrate Down\nDROP TABLE conversation;\n",
+		"8_create_karma_table.sql":             "-- +migrate Up\nCREATE TABLE karma (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    giver TEXT NOT NULL DEFAULT '',\n    target TEXT NOT NULL DEFAULT '',\n    delta INTEGER NOT NULL DEFAULT 0,\n    reason TEXT NOT NULL DEFAULT '',\n    voted_at BIGINT NOT NULL DEFAULT 0\n);\nCREATE INDEX karma_target ON karma (target);\nCREATE INDEX karma_giver_target_voted_at ON karma (giver, target, voted_at);\n\n-- +migrate Down\nDROP TABLE karma;\n",
+		"9_create_outgoing_webhook_table.sql":  "-- +migrate Up\nCREATE TABLE outgoing_webhook (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    name TEXT NOT NULL DEFAULT '',\n    pattern TEXT NOT NULL DEFAULT '',\n    url TEXT NOT NULL DEFAULT '',\n    secret TEXT NOT NULL DEFAULT '',\n    channel TEXT NOT NULL DEFAULT '',\n    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\n\nCREATE TABLE webhook_delivery (\n    id BIGSERIAL NOT NULL PRIMARY KEY,\n    webhook_id BIGINT NOT NULL,\n    message_id BIGINT NOT NULL DEFAULT 0,\n    status TEXT NOT NULL DEFAULT 'pending',\n    attempts INTEGER NOT NULL DEFAULT 0,\n    status_code INTEGER NOT NULL DEFAULT 0,\n    error TEXT NOT NULL DEFAULT '',\n    updated_at BIGINT NOT NULL DEFAULT 0,\n    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n);\nCREATE INDEX webhook_delivery_webhook_id ON webhook_delivery (webhook_id);\n\n-- +migrate Down\nDROP TABLE webhook_delivery;\nDROP TABLE outgoing_webhook;\n",
+	},
+	"sqlite3": {
+		"10_create_incoming_webhook_table.sql": "-- +migrate Up\nCREATE TABLE incoming_webhook (\n    id INTEGER NOT NULL PRIMARY KEY,\n    name TEXT NOT NULL DEFAULT \"\",\n    token TEXT NOT NULL DEFAULT \"\",\n    channel TEXT NOT NULL DEFAULT \"\",\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))\n);\nCREATE UNIQUE INDEX incoming_webhook_token ON incoming_webhook (token);\n\n-- +migrate Down\nDROP INDEX incoming_webhook_token;\nDROP TABLE incoming_webhook;\n",
+		"11_create_slash_command_table.sql":    "-- +migrate Up\nCREATE TABLE slash_command (\n    id INTEGER NOT NULL PRIMARY KEY,\n    command TEXT NOT NULL DEFAULT \"\",\n    url TEXT NOT NULL DEFAULT \"\",\n    token TEXT NOT NULL DEFAULT \"\",\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))\n);\nCREATE UNIQUE INDEX slash_command_command ON slash_command (command);\n\n-- +migrate Down\nDROP INDEX slash_command_command;\nDROP TABLE slash_command;\n",
+		"12_create_external_bot_table.sql":     "-- +migrate Up\nCREATE TABLE external_bot (\n    id INTEGER NOT NULL PRIMARY KEY,\n    name TEXT NOT NULL DEFAULT \"\",\n    token TEXT NOT NULL DEFAULT \"\",\n    quota INTEGER NOT NULL DEFAULT 30,\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))\n);\nCREATE UNIQUE INDEX external_bot_name ON external_bot (name);\nCREATE UNIQUE INDEX external_bot_token ON external_bot (token);\n\n-- +migrate Down\nDROP INDEX external_bot_token;\nDROP INDEX external_bot_name;\nDROP TABLE external_bot;\n",
+		"13_create_bot_script_table.sql":       "-- +migrate Up\nCREATE TABLE bot_script (\n    id INTEGER NOT NULL PRIMARY KEY,\n    name TEXT NOT NULL DEFAULT \"\",\n    source TEXT NOT NULL DEFAULT \"\",\n    grants TEXT NOT NULL DEFAULT \"\",\n    updated_at INTEGER NOT NULL DEFAULT 0\n);\nCREATE UNIQUE INDEX bot_script_name ON bot_script (name);\n\n-- +migrate Down\nDROP INDEX bot_script_name;\nDROP TABLE bot_script;\n",
+		"14_create_bot_kv_table.sql":           "-- +migrate Up\nCREATE TABLE bot_kv (\n    namespace TEXT NOT NULL,\n    key TEXT NOT NULL,\n    value TEXT NOT NULL DEFAULT \"\",\n    PRIMARY KEY (namespace, key)\n);\n\n-- +migrate Down\nDROP TABLE bot_kv;\n",
+		"15_add_expires_at_to_bot_kv.sql":      "-- +migrate Up\nALTER TABLE bot_kv ADD COLUMN expires_at INTEGER NOT NULL DEFAULT 0;\nCREATE INDEX bot_kv_expires_at ON bot_kv (expires_at);\n\n-- +migrate Down\n-- SQLiteはDROP COLUMNできないのでテーブルを作り直します\nDROP INDEX bot_kv_expires_at;\nCREATE TABLE bot_kv_without_expires_at (\n    namespace TEXT NOT NULL,\n    key TEXT NOT NULL,\n    value TEXT NOT NULL DEFAULT \"\",\n    PRIMARY KEY (namespace, key)\n);\nINSERT INTO bot_kv_without_expires_at (namespace, key, value) SELECT namespace, key, value FROM bot_kv;\nDROP TABLE bot_kv;\nALTER TABLE bot_kv_without_expires_at RENAME TO bot_kv;\n",
+		"16_add_version_to_message.sql":        "-- +migrate Up\nALTER TABLE message ADD COLUMN version INTEGER NOT NULL DEFAULT 1;\n\n-- +migrate Down\n-- SQLiteはDROP COLUMNできないのでテーブルを作り直します\nCREATE TABLE message_without_version (\n    id INTEGER NOT NULL PRIMARY KEY,\n    body TEXT NOT NULL DEFAULT \"\",\n    username TEXT NOT NULL DEFAULT \"\",\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime')),\n    updated TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime')),\n    channel TEXT NOT NULL DEFAULT \"\"\n);\nINSERT INTO message_without_version (id, body, username, created, updated, channel) SELECT id, body, username, created, updated, channel FROM message;\nDROP TABLE message;\nALTER TABLE message_without_version RENAME TO message;\n",
+		"17_create_message_import_table.sql":   "-- +migrate Up\nCREATE TABLE message_import (\n    source TEXT NOT NULL,\n    source_id INTEGER NOT NULL,\n    message_id INTEGER NOT NULL,\n    PRIMARY KEY (source, source_id)\n);\n\n-- +migrate Down\nDROP TABLE message_import;\n",
+		"1_create_message_table.sql":           "-- +migrate Up\nCREATE TABLE message (\n    id INTEGER NOT NULL PRIMARY KEY,\n    body TEXT NOT NULL DEFAULT \"\",\n    username TEXT NOT NULL DEFAULT \"\",\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime')),\n    updated TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))\n);\n\n-- +migrate Down\nDROP TABLE message;\n",
+		"2_create_omikuji_table.sql":           "-- +migrate Up\nCREATE TABLE omikuji (\n    id INTEGER NOT NULL PRIMARY KEY,\n    username TEXT NOT NULL DEFAULT \"\",\n    date TEXT NOT NULL DEFAULT \"\",\n    fortune TEXT NOT NULL DEFAULT \"\",\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))\n);\nCREATE UNIQUE INDEX omikuji_username_date ON omikuji (username, date);\n\n-- +migrate Down\nDROP INDEX omikuji_username_date;\nDROP TABLE omikuji;\n",
+		"3_add_channel_to_message.sql":         "-- +migrate Up\nALTER TABLE message ADD COLUMN channel TEXT NOT NULL DEFAULT \"\";\n\n-- +migrate Down\n-- SQLiteはDROP COLUMNできないのでテーブルを作り直します\nCREATE TABLE message_without_channel (\n    id INTEGER NOT NULL PRIMARY KEY,\n    body TEXT NOT NULL DEFAULT \"\",\n    username TEXT NOT NULL DEFAULT \"\",\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime')),\n    updated TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))\n);\nINSERT INTO message_without_channel (id, body, username, created, updated) SELECT id, body, username, created, updated FROM message;\nDROP TABLE message;\nALTER TABLE message_without_channel RENAME TO message;\n",
+		"4_create_scheduled_run_table.sql":     "-- +migrate Up\nCREATE TABLE scheduled_run (\n    name TEXT NOT NULL PRIMARY KEY,\n    last_run INTEGER NOT NULL DEFAULT 0\n);\n\n-- +migrate Down\nDROP TABLE scheduled_run;\n",
+		"5_create_reminder_table.sql":          "-- +migrate Up\nCREATE TABLE reminder (\n    id INTEGER NOT NULL PRIMARY KEY,\n    username TEXT NOT NULL DEFAULT \"\",\n    target TEXT NOT NULL DEFAULT \"\",\n    body TEXT NOT NULL DEFAULT \"\",\n    due_at INTEGER NOT NULL DEFAULT 0,\n    fired INTEGER NOT NULL DEFAULT 0,\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))\n);\nCREATE INDEX reminder_fired_due_at ON reminder (fired, due_at);\n\n-- +migrate Down\nDROP INDEX reminder_fired_due_at;\nDROP TABLE reminder;\n",
+		"6_create_poll_table.sql":              "-- +migrate Up\nCREATE TABLE poll (\n    id INTEGER NOT NULL PRIMARY KEY,\n    message_id INTEGER NOT NULL DEFAULT 0,\n    question TEXT NOT NULL DEFAULT \"\",\n    username TEXT NOT NULL DEFAULT \"\",\n    closes_at INTEGER NOT NULL DEFAULT 0,\n    closed INTEGER NOT NULL DEFAULT 0,\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))\n);\nCREATE INDEX poll_closed_closes_at ON poll (closed, closes_at);\n\nCREATE TABLE poll_option (\n    id INTEGER NOT NULL PRIMARY KEY,\n    poll_id INTEGER NOT NULL,\n    position INTEGER NOT NULL,\n    label TEXT NOT NULL DEFAULT \"\"\n);\nCREATE UNIQUE INDEX poll_option_poll_id_position ON poll_option (poll_id, position);\n\nCREATE TABLE poll_vote (\n    id INTEGER NOT NULL PRIMARY KEY,\n    poll_id INTEGER NOT NULL,\n    option_id INTEGER NOT NULL,\n    username TEXT NOT NULL DEFAULT \"\",\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))\n);\nCREATE UNIQUE INDEX poll_vote_poll_id_username ON poll_vote (poll_id, username);\n\n-- +migrate Down\nDROP INDEX poll_vote_poll_id_username;\nDROP TABLE poll_vote;\nDROP INDEX poll_option_poll_id_position;\nDROP TABLE poll_option;\nDROP INDEX poll_closed_closes_at;\nDROP TABLE poll;\n",
+		"7_create_conversation_table.sql":      "-- +migrate Up\nCREATE TABLE conversation (\n    bot TEXT NOT NULL,\n    username TEXT NOT NULL,\n    state TEXT NOT NULL DEFAULT \"{}\",\n    expires_at INTEGER NOT NULL DEFAULT 0,\n    PRIMARY KEY (bot, username)\n);\n\n-- +migrate Down\nDROP TABLE conversation;\n",
+		"8_create_karma_table.sql":             "-- +migrate Up\nCREATE TABLE karma (\n    id INTEGER NOT NULL PRIMARY KEY,\n    giver TEXT NOT NULL DEFAULT \"\",\n    target TEXT NOT NULL DEFAULT \"\",\n    delta INTEGER NOT NULL DEFAULT 0,\n    reason TEXT NOT NULL DEFAULT \"\",\n    voted_at INTEGER NOT NULL DEFAULT 0\n);\nCREATE INDEX karma_target ON karma (target);\nCREATE INDEX karma_giver_target_voted_at ON karma (giver, target, voted_at);\n\n-- +migrate Down\nDROP INDEX karma_giver_target_voted_at;\nDROP INDEX karma_target;\nDROP TABLE karma;\n",
+		"9_create_outgoing_webhook_table.sql":  "-- +migrate Up\nCREATE TABLE outgoing_webhook (\n    id INTEGER NOT NULL PRIMARY KEY,\n    name TEXT NOT NULL DEFAULT \"\",\n    pattern TEXT NOT NULL DEFAULT \"\",\n    url TEXT NOT NULL DEFAULT \"\",\n    secret TEXT NOT NULL DEFAULT \"\",\n    channel TEXT NOT NULL DEFAULT \"\",\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))\n);\n\nCREATE TABLE webhook_delivery (\n    id INTEGER NOT NULL PRIMARY KEY,\n    webhook_id INTEGER NOT NULL,\n    message_id INTEGER NOT NULL DEFAULT 0,\n    status TEXT NOT NULL DEFAULT \"pending\",\n    attempts INTEGER NOT NULL DEFAULT 0,\n    status_code INTEGER NOT NULL DEFAULT 0,\n    error TEXT NOT NULL DEFAULT \"\",\n    updated_at INTEGER NOT NULL DEFAULT 0,\n    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))\n);\nCREATE INDEX webhook_delivery_webhook_id ON webhook_delivery (webhook_id);\n\n-- +migrate Down\nDROP INDEX webhook_delivery_webhook_id;\nDROP TABLE webhook_delivery;\nDROP TABLE outgoing_webhook;\n",
+	},
+}
@@ -0,0 +1,57 @@
+//go:build ignore
+// +build ignore
+
+// gen.go はdialectごとのディレクトリの*.sqlを読み、bindata.goに書き出します
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+)
+
+func main() {
+	dirs, err := filepath.Glob("*/*.sql")
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Strings(dirs)
+
+	var b bytes.Buffer
+	fmt.Fprint(&b, "// Code generated by gen.go; DO NOT EDIT.\n\n")
+	fmt.Fprint(&b, "package migrations\n\n")
+	fmt.Fprint(&b, "var files = map[string]map[string]string{\n")
+	dialect := ""
+	for _, path := range dirs {
+		d, name := filepath.Split(path)
+		d = filepath.Clean(d)
+		if d != dialect {
+			if dialect != "" {
+				fmt.Fprint(&b, "},\n")
+			}
+			fmt.Fprintf(&b, "%q: {\n", d)
+			dialect = d
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(&b, "%q: %q,\n", name, src)
+	}
+	if dialect != "" {
+		fmt.Fprint(&b, "},\n")
+	}
+	fmt.Fprint(&b, "}\n")
+
+	out, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("bindata.go", out, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
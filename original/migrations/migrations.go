@@ -0,0 +1,19 @@
+// Package migrations はdialectごとのディレクトリにあるマイグレーションのSQLをバイナリに埋め込むパッケージです
+//
+// *.sqlを追加、変更した場合は `go generate ./migrations` でbindata.goを作り直してください
+package migrations
+
+//go:generate go run gen.go
+
+// Files はdialectのマイグレーションをファイル名からSQLへのmapで返します。dialectがない場合はnilを返します
+func Files(dialect string) map[string]string {
+	fs, ok := files[dialect]
+	if !ok {
+		return nil
+	}
+	copied := make(map[string]string, len(fs))
+	for name, src := range fs {
+		copied[name] = src
+	}
+	return copied
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestFiles はbindata.goがディレクトリの*.sqlと同じ内容か確認します
+func TestFiles(t *testing.T) {
+	paths, err := filepath.Glob("*/*.sql")
+	if err != nil {
+		t.Fatalf("failed to list migrations: %s", err)
+	}
+	n := 0
+	for _, path := range paths {
+		dialect, name := filepath.Split(path)
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", path, err)
+		}
+		if got, ok := Files(filepath.Clean(dialect))[name]; !ok || got != string(src) {
+			t.Errorf("%s is not embedded or outdated. run `go generate ./migrations`", path)
+		}
+		n++
+	}
+	for _, fs := range files {
+		n -= len(fs)
+	}
+	if n != 0 {
+		t.Errorf("bindata.go has files which do not exist. run `go generate ./migrations`")
+	}
+}
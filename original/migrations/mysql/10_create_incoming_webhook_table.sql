@@ -0,0 +1,12 @@
+-- +migrate Up
+CREATE TABLE incoming_webhook (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(191) NOT NULL DEFAULT '',
+    token VARCHAR(191) NOT NULL DEFAULT '',
+    channel VARCHAR(255) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE UNIQUE INDEX incoming_webhook_token ON incoming_webhook (token);
+
+-- +migrate Down
+DROP TABLE incoming_webhook;
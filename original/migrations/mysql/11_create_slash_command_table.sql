@@ -0,0 +1,12 @@
+-- +migrate Up
+CREATE TABLE slash_command (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    command VARCHAR(191) NOT NULL DEFAULT '',
+    url TEXT NOT NULL,
+    token VARCHAR(191) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE UNIQUE INDEX slash_command_command ON slash_command (command);
+
+-- +migrate Down
+DROP TABLE slash_command;
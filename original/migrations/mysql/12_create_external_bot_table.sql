@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE external_bot (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(191) NOT NULL DEFAULT '',
+    token VARCHAR(191) NOT NULL DEFAULT '',
+    quota INTEGER NOT NULL DEFAULT 30,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE UNIQUE INDEX external_bot_name ON external_bot (name);
+CREATE UNIQUE INDEX external_bot_token ON external_bot (token);
+
+-- +migrate Down
+DROP TABLE external_bot;
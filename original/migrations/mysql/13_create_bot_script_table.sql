@@ -0,0 +1,12 @@
+-- +migrate Up
+CREATE TABLE bot_script (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(191) NOT NULL DEFAULT '',
+    source TEXT NOT NULL,
+    grants VARCHAR(255) NOT NULL DEFAULT '',
+    updated_at BIGINT NOT NULL DEFAULT 0
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE UNIQUE INDEX bot_script_name ON bot_script (name);
+
+-- +migrate Down
+DROP TABLE bot_script;
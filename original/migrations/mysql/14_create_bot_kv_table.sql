@@ -0,0 +1,10 @@
+-- +migrate Up
+CREATE TABLE bot_kv (
+    namespace VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,
+    `key` VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (namespace, `key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE bot_kv;
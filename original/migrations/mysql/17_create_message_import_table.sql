@@ -0,0 +1,10 @@
+-- +migrate Up
+CREATE TABLE message_import (
+    source VARCHAR(191) NOT NULL,
+    source_id BIGINT NOT NULL,
+    message_id BIGINT NOT NULL,
+    PRIMARY KEY (source, source_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE message_import;
@@ -0,0 +1,11 @@
+-- +migrate Up
+CREATE TABLE message (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    body TEXT NOT NULL,
+    username VARCHAR(191) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE message;
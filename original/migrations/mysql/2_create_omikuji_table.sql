@@ -0,0 +1,12 @@
+-- +migrate Up
+CREATE TABLE omikuji (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    username VARCHAR(191) NOT NULL DEFAULT '',
+    date VARCHAR(191) NOT NULL DEFAULT '',
+    fortune VARCHAR(255) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE UNIQUE INDEX omikuji_username_date ON omikuji (username, date);
+
+-- +migrate Down
+DROP TABLE omikuji;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE message ADD COLUMN channel VARCHAR(255) NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE message DROP COLUMN channel;
@@ -0,0 +1,8 @@
+-- +migrate Up
+CREATE TABLE scheduled_run (
+    name VARCHAR(191) NOT NULL PRIMARY KEY,
+    last_run BIGINT NOT NULL DEFAULT 0
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE scheduled_run;
@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE reminder (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    username VARCHAR(191) NOT NULL DEFAULT '',
+    target VARCHAR(191) NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    due_at BIGINT NOT NULL DEFAULT 0,
+    fired INTEGER NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE INDEX reminder_fired_due_at ON reminder (fired, due_at);
+
+-- +migrate Down
+DROP TABLE reminder;
@@ -0,0 +1,33 @@
+-- +migrate Up
+CREATE TABLE poll (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    message_id BIGINT NOT NULL DEFAULT 0,
+    question TEXT NOT NULL,
+    username VARCHAR(191) NOT NULL DEFAULT '',
+    closes_at BIGINT NOT NULL DEFAULT 0,
+    closed INTEGER NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE INDEX poll_closed_closes_at ON poll (closed, closes_at);
+
+CREATE TABLE poll_option (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    poll_id BIGINT NOT NULL,
+    position INTEGER NOT NULL,
+    label TEXT NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE UNIQUE INDEX poll_option_poll_id_position ON poll_option (poll_id, position);
+
+CREATE TABLE poll_vote (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    poll_id BIGINT NOT NULL,
+    option_id BIGINT NOT NULL,
+    username VARCHAR(191) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE UNIQUE INDEX poll_vote_poll_id_username ON poll_vote (poll_id, username);
+
+-- +migrate Down
+DROP TABLE poll_vote;
+DROP TABLE poll_option;
+DROP TABLE poll;
@@ -0,0 +1,11 @@
+-- +migrate Up
+CREATE TABLE conversation (
+    bot VARCHAR(191) NOT NULL,
+    username VARCHAR(191) NOT NULL,
+    state TEXT NOT NULL,
+    expires_at BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (bot, username)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE conversation;
@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE karma (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    giver VARCHAR(191) NOT NULL DEFAULT '',
+    target VARCHAR(191) NOT NULL DEFAULT '',
+    delta INTEGER NOT NULL DEFAULT 0,
+    reason TEXT NOT NULL,
+    voted_at BIGINT NOT NULL DEFAULT 0
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE INDEX karma_target ON karma (target);
+CREATE INDEX karma_giver_target_voted_at ON karma (giver, target, voted_at);
+
+-- +migrate Down
+DROP TABLE karma;
@@ -0,0 +1,27 @@
+-- +migrate Up
+CREATE TABLE outgoing_webhook (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(191) NOT NULL DEFAULT '',
+    pattern TEXT NOT NULL,
+    url TEXT NOT NULL,
+    secret VARCHAR(255) NOT NULL DEFAULT '',
+    channel VARCHAR(255) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE webhook_delivery (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    webhook_id BIGINT NOT NULL,
+    message_id BIGINT NOT NULL DEFAULT 0,
+    status VARCHAR(255) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL,
+    updated_at BIGINT NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE INDEX webhook_delivery_webhook_id ON webhook_delivery (webhook_id);
+
+-- +migrate Down
+DROP TABLE webhook_delivery;
+DROP TABLE outgoing_webhook;
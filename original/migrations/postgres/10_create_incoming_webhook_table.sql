@@ -0,0 +1,12 @@
+-- +migrate Up
+CREATE TABLE incoming_webhook (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    token TEXT NOT NULL DEFAULT '',
+    channel TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX incoming_webhook_token ON incoming_webhook (token);
+
+-- +migrate Down
+DROP TABLE incoming_webhook;
@@ -0,0 +1,12 @@
+-- +migrate Up
+CREATE TABLE slash_command (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    command TEXT NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    token TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX slash_command_command ON slash_command (command);
+
+-- +migrate Down
+DROP TABLE slash_command;
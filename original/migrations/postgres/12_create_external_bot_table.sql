@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE external_bot (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    token TEXT NOT NULL DEFAULT '',
+    quota INTEGER NOT NULL DEFAULT 30,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX external_bot_name ON external_bot (name);
+CREATE UNIQUE INDEX external_bot_token ON external_bot (token);
+
+-- +migrate Down
+DROP TABLE external_bot;
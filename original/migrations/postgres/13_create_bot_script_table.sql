@@ -0,0 +1,12 @@
+-- +migrate Up
+CREATE TABLE bot_script (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    source TEXT NOT NULL DEFAULT '',
+    grants TEXT NOT NULL DEFAULT '',
+    updated_at BIGINT NOT NULL DEFAULT 0
+);
+CREATE UNIQUE INDEX bot_script_name ON bot_script (name);
+
+-- +migrate Down
+DROP TABLE bot_script;
@@ -0,0 +1,10 @@
+-- +migrate Up
+CREATE TABLE bot_kv (
+    namespace TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (namespace, key)
+);
+
+-- +migrate Down
+DROP TABLE bot_kv;
@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE bot_kv ADD COLUMN expires_at BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX bot_kv_expires_at ON bot_kv (expires_at);
+
+-- +migrate Down
+DROP INDEX bot_kv_expires_at;
+ALTER TABLE bot_kv DROP COLUMN expires_at;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE message ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+
+-- +migrate Down
+ALTER TABLE message DROP COLUMN version;
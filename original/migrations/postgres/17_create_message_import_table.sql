@@ -0,0 +1,10 @@
+-- +migrate Up
+CREATE TABLE message_import (
+    source TEXT NOT NULL,
+    source_id BIGINT NOT NULL,
+    message_id BIGINT NOT NULL,
+    PRIMARY KEY (source, source_id)
+);
+
+-- +migrate Down
+DROP TABLE message_import;
@@ -0,0 +1,11 @@
+-- +migrate Up
+CREATE TABLE message (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    body TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +migrate Down
+DROP TABLE message;
@@ -0,0 +1,12 @@
+-- +migrate Up
+CREATE TABLE omikuji (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    username TEXT NOT NULL DEFAULT '',
+    date TEXT NOT NULL DEFAULT '',
+    fortune TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX omikuji_username_date ON omikuji (username, date);
+
+-- +migrate Down
+DROP TABLE omikuji;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE message ADD COLUMN channel TEXT NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE message DROP COLUMN channel;
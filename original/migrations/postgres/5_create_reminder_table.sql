@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE reminder (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    username TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL DEFAULT '',
+    due_at BIGINT NOT NULL DEFAULT 0,
+    fired INTEGER NOT NULL DEFAULT 0,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX reminder_fired_due_at ON reminder (fired, due_at);
+
+-- +migrate Down
+DROP TABLE reminder;
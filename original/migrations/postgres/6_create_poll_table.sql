@@ -0,0 +1,33 @@
+-- +migrate Up
+CREATE TABLE poll (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    message_id BIGINT NOT NULL DEFAULT 0,
+    question TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL DEFAULT '',
+    closes_at BIGINT NOT NULL DEFAULT 0,
+    closed INTEGER NOT NULL DEFAULT 0,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX poll_closed_closes_at ON poll (closed, closes_at);
+
+CREATE TABLE poll_option (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    poll_id BIGINT NOT NULL,
+    position INTEGER NOT NULL,
+    label TEXT NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX poll_option_poll_id_position ON poll_option (poll_id, position);
+
+CREATE TABLE poll_vote (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    poll_id BIGINT NOT NULL,
+    option_id BIGINT NOT NULL,
+    username TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX poll_vote_poll_id_username ON poll_vote (poll_id, username);
+
+-- +migrate Down
+DROP TABLE poll_vote;
+DROP TABLE poll_option;
+DROP TABLE poll;
@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE karma (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    giver TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    delta INTEGER NOT NULL DEFAULT 0,
+    reason TEXT NOT NULL DEFAULT '',
+    voted_at BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX karma_target ON karma (target);
+CREATE INDEX karma_giver_target_voted_at ON karma (giver, target, voted_at);
+
+-- +migrate Down
+DROP TABLE karma;
@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE incoming_webhook (
+    id INTEGER NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT "",
+    token TEXT NOT NULL DEFAULT "",
+    channel TEXT NOT NULL DEFAULT "",
+    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE UNIQUE INDEX incoming_webhook_token ON incoming_webhook (token);
+
+-- +migrate Down
+DROP INDEX incoming_webhook_token;
+DROP TABLE incoming_webhook;
@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE slash_command (
+    id INTEGER NOT NULL PRIMARY KEY,
+    command TEXT NOT NULL DEFAULT "",
+    url TEXT NOT NULL DEFAULT "",
+    token TEXT NOT NULL DEFAULT "",
+    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE UNIQUE INDEX slash_command_command ON slash_command (command);
+
+-- +migrate Down
+DROP INDEX slash_command_command;
+DROP TABLE slash_command;
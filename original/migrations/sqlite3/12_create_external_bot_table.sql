@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE external_bot (
+    id INTEGER NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT "",
+    token TEXT NOT NULL DEFAULT "",
+    quota INTEGER NOT NULL DEFAULT 30,
+    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE UNIQUE INDEX external_bot_name ON external_bot (name);
+CREATE UNIQUE INDEX external_bot_token ON external_bot (token);
+
+-- +migrate Down
+DROP INDEX external_bot_token;
+DROP INDEX external_bot_name;
+DROP TABLE external_bot;
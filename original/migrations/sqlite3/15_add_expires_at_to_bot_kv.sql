@@ -0,0 +1,16 @@
+-- +migrate Up
+ALTER TABLE bot_kv ADD COLUMN expires_at INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX bot_kv_expires_at ON bot_kv (expires_at);
+
+-- +migrate Down
+-- SQLiteはDROP COLUMNできないのでテーブルを作り直します
+DROP INDEX bot_kv_expires_at;
+CREATE TABLE bot_kv_without_expires_at (
+    namespace TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL DEFAULT "",
+    PRIMARY KEY (namespace, key)
+);
+INSERT INTO bot_kv_without_expires_at (namespace, key, value) SELECT namespace, key, value FROM bot_kv;
+DROP TABLE bot_kv;
+ALTER TABLE bot_kv_without_expires_at RENAME TO bot_kv;
@@ -0,0 +1,16 @@
+-- +migrate Up
+ALTER TABLE message ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- +migrate Down
+-- SQLiteはDROP COLUMNできないのでテーブルを作り直します
+CREATE TABLE message_without_version (
+    id INTEGER NOT NULL PRIMARY KEY,
+    body TEXT NOT NULL DEFAULT "",
+    username TEXT NOT NULL DEFAULT "",
+    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    updated TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    channel TEXT NOT NULL DEFAULT ""
+);
+INSERT INTO message_without_version (id, body, username, created, updated, channel) SELECT id, body, username, created, updated, channel FROM message;
+DROP TABLE message;
+ALTER TABLE message_without_version RENAME TO message;
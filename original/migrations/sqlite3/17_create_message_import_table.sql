@@ -0,0 +1,10 @@
+-- +migrate Up
+CREATE TABLE message_import (
+    source TEXT NOT NULL,
+    source_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    PRIMARY KEY (source, source_id)
+);
+
+-- +migrate Down
+DROP TABLE message_import;
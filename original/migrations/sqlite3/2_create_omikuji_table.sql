@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE omikuji (
+    id INTEGER NOT NULL PRIMARY KEY,
+    username TEXT NOT NULL DEFAULT "",
+    date TEXT NOT NULL DEFAULT "",
+    fortune TEXT NOT NULL DEFAULT "",
+    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE UNIQUE INDEX omikuji_username_date ON omikuji (username, date);
+
+-- +migrate Down
+DROP INDEX omikuji_username_date;
+DROP TABLE omikuji;
@@ -0,0 +1,15 @@
+-- +migrate Up
+ALTER TABLE message ADD COLUMN channel TEXT NOT NULL DEFAULT "";
+
+-- +migrate Down
+-- SQLiteはDROP COLUMNできないのでテーブルを作り直します
+CREATE TABLE message_without_channel (
+    id INTEGER NOT NULL PRIMARY KEY,
+    body TEXT NOT NULL DEFAULT "",
+    username TEXT NOT NULL DEFAULT "",
+    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    updated TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+INSERT INTO message_without_channel (id, body, username, created, updated) SELECT id, body, username, created, updated FROM message;
+DROP TABLE message;
+ALTER TABLE message_without_channel RENAME TO message;
@@ -0,0 +1,8 @@
+-- +migrate Up
+CREATE TABLE scheduled_run (
+    name TEXT NOT NULL PRIMARY KEY,
+    last_run INTEGER NOT NULL DEFAULT 0
+);
+
+-- +migrate Down
+DROP TABLE scheduled_run;
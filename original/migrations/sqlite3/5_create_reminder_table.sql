@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE reminder (
+    id INTEGER NOT NULL PRIMARY KEY,
+    username TEXT NOT NULL DEFAULT "",
+    target TEXT NOT NULL DEFAULT "",
+    body TEXT NOT NULL DEFAULT "",
+    due_at INTEGER NOT NULL DEFAULT 0,
+    fired INTEGER NOT NULL DEFAULT 0,
+    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE INDEX reminder_fired_due_at ON reminder (fired, due_at);
+
+-- +migrate Down
+DROP INDEX reminder_fired_due_at;
+DROP TABLE reminder;
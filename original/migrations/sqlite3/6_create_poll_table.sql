@@ -0,0 +1,36 @@
+-- +migrate Up
+CREATE TABLE poll (
+    id INTEGER NOT NULL PRIMARY KEY,
+    message_id INTEGER NOT NULL DEFAULT 0,
+    question TEXT NOT NULL DEFAULT "",
+    username TEXT NOT NULL DEFAULT "",
+    closes_at INTEGER NOT NULL DEFAULT 0,
+    closed INTEGER NOT NULL DEFAULT 0,
+    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE INDEX poll_closed_closes_at ON poll (closed, closes_at);
+
+CREATE TABLE poll_option (
+    id INTEGER NOT NULL PRIMARY KEY,
+    poll_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    label TEXT NOT NULL DEFAULT ""
+);
+CREATE UNIQUE INDEX poll_option_poll_id_position ON poll_option (poll_id, position);
+
+CREATE TABLE poll_vote (
+    id INTEGER NOT NULL PRIMARY KEY,
+    poll_id INTEGER NOT NULL,
+    option_id INTEGER NOT NULL,
+    username TEXT NOT NULL DEFAULT "",
+    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE UNIQUE INDEX poll_vote_poll_id_username ON poll_vote (poll_id, username);
+
+-- +migrate Down
+DROP INDEX poll_vote_poll_id_username;
+DROP TABLE poll_vote;
+DROP INDEX poll_option_poll_id_position;
+DROP TABLE poll_option;
+DROP INDEX poll_closed_closes_at;
+DROP TABLE poll;
@@ -0,0 +1,11 @@
+-- +migrate Up
+CREATE TABLE conversation (
+    bot TEXT NOT NULL,
+    username TEXT NOT NULL,
+    state TEXT NOT NULL DEFAULT "{}",
+    expires_at INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (bot, username)
+);
+
+-- +migrate Down
+DROP TABLE conversation;
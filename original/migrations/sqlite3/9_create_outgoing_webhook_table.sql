@@ -0,0 +1,28 @@
+-- +migrate Up
+CREATE TABLE outgoing_webhook (
+    id INTEGER NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT "",
+    pattern TEXT NOT NULL DEFAULT "",
+    url TEXT NOT NULL DEFAULT "",
+    secret TEXT NOT NULL DEFAULT "",
+    channel TEXT NOT NULL DEFAULT "",
+    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE TABLE webhook_delivery (
+    id INTEGER NOT NULL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT "pending",
+    attempts INTEGER NOT NULL DEFAULT 0,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT "",
+    updated_at INTEGER NOT NULL DEFAULT 0,
+    created TIMESTAMP NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE INDEX webhook_delivery_webhook_id ON webhook_delivery (webhook_id);
+
+-- +migrate Down
+DROP INDEX webhook_delivery_webhook_id;
+DROP TABLE webhook_delivery;
+DROP TABLE outgoing_webhook;
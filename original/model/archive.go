@@ -0,0 +1,224 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrImportConflict はIDを変えずにインポートしようとしたメッセージと同じIDの、内容の違うメッセージがあったことを表すエラーです
+var ErrImportConflict = errors.New("messages with the same id already exist")
+
+// instanceNamespace はこのデータベースのIDをbot_kvに保存する名前空間です
+const instanceNamespace = "system"
+
+type (
+	// ImportOptions はメッセージのインポートの設定です
+	//
+	// Sourceはエクスポートしたデータベースを表す名前で、同じメッセージを2回インポートしないために使います
+	// RemapIDsがtrueの場合は新しいIDを振り、falseの場合はエクスポートしたときのIDのまま追加します
+	// DryRunがtrueの場合は最後にロールバックし、何も変更しません
+	ImportOptions struct {
+		Source   string
+		RemapIDs bool
+		DryRun   bool
+	}
+
+	// ImportDuplicateError はインポートするメッセージの中に同じIDが2回以上あったことを表すエラーです
+	ImportDuplicateError struct {
+		IDs []int64
+	}
+
+	// ImportReport はインポートの結果です
+	//
+	// Skippedは前にインポートしたか、同じ内容のメッセージが既にあるため追加しなかった数です
+	// ConflictsはIDを変えずにインポートしようとして、同じIDの違うメッセージがあったIDです
+	ImportReport struct {
+		DryRun    bool    `json:"dry_run"`
+		Messages  int     `json:"messages"`
+		Created   int     `json:"created"`
+		Skipped   int     `json:"skipped"`
+		Conflicts []int64 `json:"conflicts"`
+		Users     int     `json:"users"`
+		Channels  int     `json:"channels"`
+	}
+)
+
+// Error はエラーの内容を返します
+func (e *ImportDuplicateError) Error() string {
+	return fmt.Sprintf("duplicate message ids in the archive: %v", e.IDs)
+}
+
+// MessagesEach は全てのメッセージをIDの順に1件ずつfに渡します。fがエラーを返した場合はそこで止めてそのエラーを返します
+//
+// 全てのメッセージをメモリーに読み込まずに済むので、エクスポートに使います
+func MessagesEach(db *sql.DB, f func(m *Message) error) error {
+	rows, err := on(db).Query(`select id, body, username, channel, version from message order by id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := &Message{}
+		if err := rows.Scan(&m.ID, &m.Body, &m.UserName, &m.Channel, &m.Version); err != nil {
+			return err
+		}
+		if err := f(m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// MessageUserNames はメッセージを投稿したユーザー名を名前の順に返します
+func MessageUserNames(db *sql.DB) ([]string, error) {
+	return distinctMessageColumn(db, "username")
+}
+
+// MessageChannels はメッセージが投稿されたチャンネルを名前の順に返します。空のチャンネルは含みません
+func MessageChannels(db *sql.DB) ([]string, error) {
+	return distinctMessageColumn(db, "channel")
+}
+
+// distinctMessageColumn はmessageテーブルのcolumnの空でない値を重複なく返します
+func distinctMessageColumn(db *sql.DB, column string) ([]string, error) {
+	rows, err := on(db).Query(`select distinct ` + column + ` from message where ` + column + ` != '' order by ` + column)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ss []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// InstanceID はこのデータベースを表すIDを返します。まだない場合はnewIDを保存して返します
+//
+// エクスポートしたデータのsourceに使います
+func InstanceID(db *sql.DB, newID string) (string, error) {
+	c := on(db)
+	col := c.quote("key")
+	if _, err := c.Exec(c.insertIgnore("bot_kv", []string{"namespace", col}, "namespace", col, "value", "expires_at"), instanceNamespace, "instance_id", newID, 0); err != nil {
+		return "", err
+	}
+	return KVGet(db, instanceNamespace, "instance_id", time.Now())
+}
+
+// ImportMessages はmsを1つのトランザクションでインポートします
+//
+// 同じSourceから前にインポートしたメッセージは追加しないので、何度実行しても結果は同じです
+// Conflictsがある場合はロールバックし、ErrImportConflictとImportReportを返します
+// msに同じIDのメッセージがある場合は何もせずにImportDuplicateErrorを返します
+func ImportMessages(db *sql.DB, ms []*Message, opts ImportOptions) (*ImportReport, error) {
+	seen := map[int64]bool{}
+	dup := &ImportDuplicateError{}
+	for _, m := range ms {
+		if seen[m.ID] {
+			dup.IDs = append(dup.IDs, m.ID)
+		}
+		seen[m.ID] = true
+	}
+	if len(dup.IDs) > 0 {
+		return nil, dup
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun, Messages: len(ms), Conflicts: []int64{}}
+	users := map[string]bool{}
+	channels := map[string]bool{}
+
+	tx, err := begin(db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	keptIDs := false
+	for _, m := range ms {
+		if m.ID <= 0 {
+			return nil, errors.New("message without id")
+		}
+		users[m.UserName] = true
+		if m.Channel != "" {
+			channels[m.Channel] = true
+		}
+
+		var id int64
+		err := tx.QueryRow(`select message_id from message_import where source = ? and source_id = ?`, opts.Source, m.ID).Scan(&id)
+		switch {
+		case err == nil:
+			report.Skipped++
+			continue
+		case err != sql.ErrNoRows:
+			return nil, err
+		}
+
+		version := m.Version
+		if version <= 0 {
+			version = 1
+		}
+		if opts.RemapIDs {
+			id, err = tx.Insert(`insert into message (body, username, channel, version) values (?, ?, ?, ?)`, m.Body, m.UserName, m.Channel, version)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			existing := &Message{}
+			err := tx.QueryRow(`select body, username, channel from message where id = ?`, m.ID).Scan(&existing.Body, &existing.UserName, &existing.Channel)
+			switch {
+			case err == nil && existing.Body == m.Body && existing.UserName == m.UserName && existing.Channel == m.Channel:
+				// 後でIDを振り直してインポートしても重ならないように記録します
+				if _, err := tx.Exec(`insert into message_import (source, source_id, message_id) values (?, ?, ?)`, opts.Source, m.ID, m.ID); err != nil {
+					return nil, err
+				}
+				report.Skipped++
+				continue
+			case err == nil:
+				report.Conflicts = append(report.Conflicts, m.ID)
+				continue
+			case err != sql.ErrNoRows:
+				return nil, err
+			}
+			if _, err := tx.Exec(`insert into message (id, body, username, channel, version) values (?, ?, ?, ?, ?)`, m.ID, m.Body, m.UserName, m.Channel, version); err != nil {
+				return nil, err
+			}
+			id = m.ID
+			keptIDs = true
+		}
+
+		if _, err := tx.Exec(`insert into message_import (source, source_id, message_id) values (?, ?, ?)`, opts.Source, m.ID, id); err != nil {
+			return nil, err
+		}
+		report.Created++
+	}
+	report.Users = len(users)
+	report.Channels = len(channels)
+
+	if len(report.Conflicts) > 0 {
+		return report, ErrImportConflict
+	}
+	if keptIDs {
+		if err := tx.resetSequence("message"); err != nil {
+			return nil, err
+		}
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
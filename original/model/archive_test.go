@@ -0,0 +1,70 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestImportMessagesは同じデータを何度インポートしても1回だけ追加する(t *testing.T) {
+	conn := openMigrated(t, dialectSQLite3, ":memory:")
+	defer conn.Close()
+
+	ms := []*Message{
+		{ID: 1, Body: "hello", UserName: "alice", Version: 2},
+		{ID: 2, Body: "hi", UserName: "bob", Channel: "random", Version: 1},
+	}
+
+	report, err := ImportMessages(conn, ms, ImportOptions{Source: "a", DryRun: true})
+	if err != nil || report.Created != 2 {
+		t.Fatalf("dry run expected to create 2 but not, actual %#v %v", report, err)
+	}
+	if all, _ := MessagesAll(conn); len(all) != 0 {
+		t.Fatalf("dry run must not change messages, actual %d", len(all))
+	}
+
+	report, err = ImportMessages(conn, ms, ImportOptions{Source: "a"})
+	if err != nil || report.Created != 2 || report.Users != 2 || report.Channels != 1 {
+		t.Fatalf("2 created messages expected but not, actual %#v %v", report, err)
+	}
+	got, err := MessageByID(conn, 1)
+	if err != nil || got.Body != "hello" || got.Version != 2 {
+		t.Fatalf("imported message expected but not, actual %#v %v", got, err)
+	}
+
+	// IDを振り直しても、前にインポートしたメッセージは追加しません
+	for _, opts := range []ImportOptions{{Source: "a"}, {Source: "a", RemapIDs: true}} {
+		report, err = ImportMessages(conn, ms, opts)
+		if err != nil || report.Created != 0 || report.Skipped != 2 {
+			t.Fatalf("all messages expected to be skipped but not, actual %#v %v", report, err)
+		}
+	}
+
+	// インポートした後に投稿したメッセージはインポートしたIDの続きになります
+	created, err := (&Message{Body: "new", UserName: "carol"}).Insert(conn)
+	if err != nil || created.ID != 3 {
+		t.Fatalf("id 3 expected but not, actual %#v %v", created, err)
+	}
+}
+
+func TestImportMessagesは別のソースのメッセージにIDを振り直して追加する(t *testing.T) {
+	conn := openMigrated(t, dialectSQLite3, ":memory:")
+	defer conn.Close()
+
+	if _, err := ImportMessages(conn, []*Message{{ID: 1, Body: "hello", UserName: "alice"}}, ImportOptions{Source: "a"}); err != nil {
+		t.Fatalf("failed to import: %s", err)
+	}
+
+	ms := []*Message{{ID: 1, Body: "from b", UserName: "bob"}}
+	report, err := ImportMessages(conn, ms, ImportOptions{Source: "b"})
+	if err != ErrImportConflict || len(report.Conflicts) != 1 || report.Conflicts[0] != 1 {
+		t.Fatalf("conflict on id 1 expected but not, actual %#v %v", report, err)
+	}
+
+	report, err = ImportMessages(conn, ms, ImportOptions{Source: "b", RemapIDs: true})
+	if err != nil || report.Created != 1 {
+		t.Fatalf("1 created message expected but not, actual %#v %v", report, err)
+	}
+	got, err := MessageByID(conn, 2)
+	if err != nil || got.Body != "from b" {
+		t.Fatalf("remapped message expected but not, actual %#v %v", got, err)
+	}
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// BotScript は管理者が登録したスクリプトのbotの構造体です
+//
+// Grantsはスクリプトに許可した追加の機能です
+type BotScript struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`
+	Grants    []string  `json:"grants"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BotScriptsAll は全てのスクリプトを名前の順に返します
+func BotScriptsAll(db *sql.DB) ([]*BotScript, error) {
+	rows, err := on(db).Query(`select id, name, source, grants, updated_at from bot_script order by name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ss []*BotScript
+	for rows.Next() {
+		s, err := scanBotScript(rows)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// BotScriptByName は指定された名前のスクリプトを返します
+func BotScriptByName(db *sql.DB, name string) (*BotScript, error) {
+	return scanBotScript(on(db).QueryRow(`select id, name, source, grants, updated_at from bot_script where name = ?`, name))
+}
+
+// Save はスクリプトを追加、または同じ名前のスクリプトがある場合は置き換えます
+func (s *BotScript) Save(db *sql.DB) (*BotScript, error) {
+	tx, err := begin(db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 置き換えてもidが変わらないように、既にある場合は更新します
+	grants := strings.Join(s.Grants, ",")
+	var id int64
+	err = tx.QueryRow(`select id from bot_script where name = ?`, s.Name).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.Exec(`insert into bot_script (name, source, grants, updated_at) values (?, ?, ?, ?)`, s.Name, s.Source, grants, s.UpdatedAt.Unix())
+	case err == nil:
+		_, err = tx.Exec(`update bot_script set source = ?, grants = ?, updated_at = ? where id = ?`, s.Source, grants, s.UpdatedAt.Unix(), id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return BotScriptByName(db, s.Name)
+}
+
+// Delete はスクリプトを削除します。スクリプトがない場合はsql.ErrNoRowsを返します
+func (s *BotScript) Delete(db *sql.DB) error {
+	res, err := on(db).Exec(`delete from bot_script where name = ?`, s.Name)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// scanBotScript は1行をBotScriptにします
+func scanBotScript(row interface {
+	Scan(dest ...interface{}) error
+}) (*BotScript, error) {
+	s := &BotScript{}
+	var grants string
+	var updatedAt int64
+	if err := row.Scan(&s.ID, &s.Name, &s.Source, &grants, &updatedAt); err != nil {
+		return nil, err
+	}
+	s.Grants = []string{}
+	if grants != "" {
+		s.Grants = strings.Split(grants, ",")
+	}
+	s.UpdatedAt = time.Unix(updatedAt, 0)
+	return s, nil
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Conversation はbotとユーザーの間で続いている会話の状態の構造体です
+//
+// StateはbotごとのJSONです
+type Conversation struct {
+	Bot       string
+	UserName  string
+	State     string
+	ExpiresAt time.Time
+}
+
+// ConversationByBotAndUserName はbotとusernameの会話のうち、nowの時点で期限が切れていないものを返します
+//
+// 会話がない場合はsql.ErrNoRowsを返します
+func ConversationByBotAndUserName(db *sql.DB, bot, username string, now time.Time) (*Conversation, error) {
+	c := &Conversation{
+		Bot:      bot,
+		UserName: username,
+	}
+	var expiresAt int64
+	if err := on(db).QueryRow(`select state, expires_at from conversation where bot = ? and username = ? and expires_at > ?`, bot, username, now.Unix()).Scan(&c.State, &expiresAt); err != nil {
+		return nil, err
+	}
+	c.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return c, nil
+}
+
+// Save は会話を追加、または既にある場合は更新します
+func (c *Conversation) Save(db *sql.DB) error {
+	cn := on(db)
+	_, err := cn.Exec(cn.upsert("conversation", []string{"bot", "username"}, "bot", "username", "state", "expires_at"), c.Bot, c.UserName, c.State, c.ExpiresAt.Unix())
+	return err
+}
+
+// ConversationsDeleteExpired はnowの時点で期限が切れた会話を削除し、削除した数を返します
+func ConversationsDeleteExpired(db *sql.DB, now time.Time) (int64, error) {
+	res, err := on(db).Exec(`delete from conversation where expires_at <= ?`, now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Delete は会話を削除します
+func (c *Conversation) Delete(db *sql.DB) error {
+	_, err := on(db).Exec(`delete from conversation where bot = ? and username = ?`, c.Bot, c.UserName)
+	return err
+}
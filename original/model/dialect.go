@@ -0,0 +1,233 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SQLの方言です。dbconfig.ymlのdialectと同じ名前です
+const (
+	dialectSQLite3  = "sqlite3"
+	dialectPostgres = "postgres"
+	dialectMySQL    = "mysql"
+)
+
+type (
+	// queryer は*sql.DBと*sql.Txに共通するメソッドです
+	queryer interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+		Query(query string, args ...interface{}) (*sql.Rows, error)
+		QueryRow(query string, args ...interface{}) *sql.Row
+	}
+
+	// conn は方言に合わせてクエリを書き換えて実行します
+	//
+	// modelのクエリは全て?をプレースホルダーにして書き、connを通して実行します
+	//
+	//   fields
+	//     q       queryer
+	//     dialect string
+	conn struct {
+		q       queryer
+		dialect string
+	}
+
+	// txConn はトランザクションの中でクエリを実行するconnです
+	//
+	//   fields
+	//     tx *sql.Tx
+	txConn struct {
+		*conn
+		tx *sql.Tx
+	}
+)
+
+// on はdbのドライバーの方言でクエリを実行するconnを返します
+func on(db *sql.DB) *conn {
+	return &conn{q: db, dialect: dialectOf(db)}
+}
+
+// begin はトランザクションを開始します
+func begin(db *sql.DB) (*txConn, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &txConn{conn: &conn{q: tx, dialect: dialectOf(db)}, tx: tx}, nil
+}
+
+// dialectOf はdbのドライバーの方言を返します。わからない場合はsqlite3として扱います
+func dialectOf(db *sql.DB) string {
+	switch fmt.Sprintf("%T", db.Driver()) {
+	case "*pq.Driver":
+		return dialectPostgres
+	case "*mysql.MySQLDriver":
+		return dialectMySQL
+	default:
+		return dialectSQLite3
+	}
+}
+
+// Exec はqueryを実行します
+func (c *conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.q.Exec(c.rebind(query), args...)
+}
+
+// Query は行を返すqueryを実行します
+func (c *conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.q.Query(c.rebind(query), args...)
+}
+
+// QueryRow は1行を返すqueryを実行します
+func (c *conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.q.QueryRow(c.rebind(query), args...)
+}
+
+// Insert はinsert文のqueryを実行し、追加した行のidを返します
+//
+// PostgreSQLはLastInsertIdに対応していないので、returningで受け取ります
+func (c *conn) Insert(query string, args ...interface{}) (int64, error) {
+	if c.dialect == dialectPostgres {
+		var id int64
+		err := c.q.QueryRow(c.rebind(query)+" returning id", args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := c.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// upsert はkeysが同じ行があれば置き換え、なければ追加するinsert文を返します
+//
+// columnsにはkeysも含めます
+func (c *conn) upsert(table string, keys []string, columns ...string) string {
+	insert := fmt.Sprintf("insert into %s (%s) values (%s)", table, strings.Join(columns, ", "), placeholders(len(columns)))
+	var sets []string
+	for _, col := range columns {
+		if contains(keys, col) {
+			continue
+		}
+		switch c.dialect {
+		case dialectPostgres:
+			sets = append(sets, fmt.Sprintf("%s = excluded.%s", col, col))
+		case dialectMySQL:
+			sets = append(sets, fmt.Sprintf("%s = values(%s)", col, col))
+		}
+	}
+
+	switch c.dialect {
+	case dialectPostgres:
+		if len(sets) == 0 {
+			return fmt.Sprintf("%s on conflict (%s) do nothing", insert, strings.Join(keys, ", "))
+		}
+		return fmt.Sprintf("%s on conflict (%s) do update set %s", insert, strings.Join(keys, ", "), strings.Join(sets, ", "))
+	case dialectMySQL:
+		if len(sets) == 0 {
+			return strings.Replace(insert, "insert", "insert ignore", 1)
+		}
+		return fmt.Sprintf("%s on duplicate key update %s", insert, strings.Join(sets, ", "))
+	default:
+		return strings.Replace(insert, "insert", "insert or replace", 1)
+	}
+}
+
+// insertIgnore はkeysが同じ行があれば何もせず、なければ追加するinsert文を返します
+func (c *conn) insertIgnore(table string, keys []string, columns ...string) string {
+	insert := fmt.Sprintf("insert into %s (%s) values (%s)", table, strings.Join(columns, ", "), placeholders(len(columns)))
+	switch c.dialect {
+	case dialectPostgres:
+		return fmt.Sprintf("%s on conflict (%s) do nothing", insert, strings.Join(keys, ", "))
+	case dialectMySQL:
+		return strings.Replace(insert, "insert", "insert ignore", 1)
+	default:
+		return strings.Replace(insert, "insert", "insert or ignore", 1)
+	}
+}
+
+// quote は予約語と重なる列の名前をクォートします
+func (c *conn) quote(name string) string {
+	if c.dialect == dialectMySQL {
+		return "`" + name + "`"
+	}
+	return `"` + name + `"`
+}
+
+// forUpdate はselect文で読んだ行をトランザクションの終わりまでロックする句を返します
+//
+// SQLiteは書き込んだ時点でデータベース全体をロックするので、何も返しません
+func (c *conn) forUpdate() string {
+	if c.dialect == dialectSQLite3 {
+		return ""
+	}
+	return " for update"
+}
+
+// resetSequence はidを指定して行を追加した後に、次に振るidをtableのidの最大値の次にします
+//
+// PostgreSQLのBIGSERIALだけが必要で、SQLiteとMySQLは自動で最大値の次を振ります
+func (c *conn) resetSequence(table string) error {
+	if c.dialect != dialectPostgres {
+		return nil
+	}
+	_, err := c.Exec(fmt.Sprintf(`select setval(pg_get_serial_sequence('%s', 'id'), coalesce(max(id), 1)) from %s`, table, table))
+	return err
+}
+
+// rebind はPostgreSQLの場合、?のプレースホルダーを$1, $2, ...に書き換えます
+//
+// 文字列のリテラルとクォートされた名前の中の?は書き換えません
+func (c *conn) rebind(query string) string {
+	if c.dialect != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Commit はトランザクションをコミットします
+func (t *txConn) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback はトランザクションをロールバックします
+func (t *txConn) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// placeholders はn個の?をカンマでつないだ文字列を返します
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// contains はssにsが含まれるか返します
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,501 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/db"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestConnRebind(t *testing.T) {
+	c := &conn{dialect: dialectPostgres}
+	cases := []struct {
+		in, want string
+	}{
+		{`select id from message where id = ?`, `select id from message where id = $1`},
+		{`update message set body = ? where id = ?`, `update message set body = $1 where id = $2`},
+		{`select '?' from message where body = ?`, `select '?' from message where body = $1`},
+		{`select "a?" from message where body = ?`, `select "a?" from message where body = $1`},
+	}
+	for _, tc := range cases {
+		if got := c.rebind(tc.in); got != tc.want {
+			t.Errorf("rebind(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	q := `select id from message where id = ?`
+	for _, d := range []string{dialectSQLite3, dialectMySQL} {
+		if got := (&conn{dialect: d}).rebind(q); got != q {
+			t.Errorf("%s: rebind(%q) = %q, want unchanged", d, q, got)
+		}
+	}
+}
+
+func TestConnUpsert(t *testing.T) {
+	cases := []struct {
+		dialect, want string
+	}{
+		{dialectSQLite3, `insert or replace into scheduled_run (name, last_run) values (?, ?)`},
+		{dialectPostgres, `insert into scheduled_run (name, last_run) values (?, ?) on conflict (name) do update set last_run = excluded.last_run`},
+		{dialectMySQL, `insert into scheduled_run (name, last_run) values (?, ?) on duplicate key update last_run = values(last_run)`},
+	}
+	for _, tc := range cases {
+		c := &conn{dialect: tc.dialect}
+		if got := c.upsert("scheduled_run", []string{"name"}, "name", "last_run"); got != tc.want {
+			t.Errorf("%s: upsert = %q, want %q", tc.dialect, got, tc.want)
+		}
+	}
+}
+
+func TestConnInsertIgnore(t *testing.T) {
+	cases := []struct {
+		dialect, want string
+	}{
+		{dialectSQLite3, `insert or ignore into omikuji (username, date) values (?, ?)`},
+		{dialectPostgres, `insert into omikuji (username, date) values (?, ?) on conflict (username, date) do nothing`},
+		{dialectMySQL, `insert ignore into omikuji (username, date) values (?, ?)`},
+	}
+	for _, tc := range cases {
+		c := &conn{dialect: tc.dialect}
+		if got := c.insertIgnore("omikuji", []string{"username", "date"}, "username", "date"); got != tc.want {
+			t.Errorf("%s: insertIgnore = %q, want %q", tc.dialect, got, tc.want)
+		}
+	}
+}
+
+// TestDialects はSQLiteと、環境変数でデータソースが指定されたPostgreSQLとMySQLで同じ操作ができることを確認します
+//
+// TEST_POSTGRES_DSN、TEST_MYSQL_DSNには空のデータベースを指定してください
+func TestDialects(t *testing.T) {
+	dialects := []struct {
+		driver, datasource string
+	}{
+		{dialectSQLite3, ":memory:"},
+		{dialectPostgres, os.Getenv("TEST_POSTGRES_DSN")},
+		{dialectMySQL, os.Getenv("TEST_MYSQL_DSN")},
+	}
+	for _, d := range dialects {
+		t.Run(d.driver, func(t *testing.T) {
+			if d.datasource == "" {
+				t.Skipf("datasource for %s is not set", d.driver)
+			}
+			db := openMigrated(t, d.driver, d.datasource)
+			defer db.Close()
+
+			testMessages(t, db)
+			testKV(t, db)
+			testKarma(t, db)
+			testBotScript(t, db)
+			testScheduledRun(t, db)
+			testPoll(t, db)
+			testReminder(t, db)
+			testWebhook(t, db)
+			testConversation(t, db)
+			testOmikuji(t, db)
+			testSlashCommand(t, db)
+			testExternalBot(t, db)
+		})
+	}
+}
+
+func testMessages(t *testing.T, db *sql.DB) {
+	m, err := (&Message{Body: "hello", UserName: "alice", Channel: "general"}).Insert(db)
+	if err != nil {
+		t.Fatalf("Insert failed: %s", err)
+	}
+	if m.ID == 0 {
+		t.Fatalf("Insert returned no id")
+	}
+	m.Body = "hello, world"
+	if _, err := m.Update(db); err != nil {
+		t.Fatalf("Update failed: %s", err)
+	}
+	got, err := MessageByID(db, m.ID)
+	if err != nil {
+		t.Fatalf("MessageByID failed: %s", err)
+	}
+	if got.Body != "hello, world" || got.UserName != "alice" || got.Version != 2 {
+		t.Errorf("MessageByID = %+v", got)
+	}
+	if err := m.Delete(db); err != ErrVersionConflict {
+		t.Errorf("Delete with stale version returned %v, want ErrVersionConflict", err)
+	}
+	ms, err := MessagesByChannel(db, "general", 0, 0, 10)
+	if err != nil {
+		t.Fatalf("MessagesByChannel failed: %s", err)
+	}
+	if len(ms) != 1 {
+		t.Errorf("MessagesByChannel returned %d messages, want 1", len(ms))
+	}
+	if ok, err := MessageUserNameExists(db, "alice"); err != nil || !ok {
+		t.Errorf("MessageUserNameExists(alice) = %v, %v, want true", ok, err)
+	}
+	if ok, err := MessageUserNameExists(db, "c"); err != nil || ok {
+		t.Errorf("MessageUserNameExists(c) = %v, %v, want false", ok, err)
+	}
+	if err := got.Delete(db); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+}
+
+func testKV(t *testing.T, db *sql.DB) {
+	now := time.Unix(1524355200, 0)
+	if err := KVSet(db, "ns", "a:1", "x", time.Time{}); err != nil {
+		t.Fatalf("KVSet failed: %s", err)
+	}
+	if err := KVSet(db, "ns", "a:1", "y", time.Time{}); err != nil {
+		t.Fatalf("KVSet failed: %s", err)
+	}
+	if err := KVSet(db, "ns", "a:2", "z", now.Add(-time.Second)); err != nil {
+		t.Fatalf("KVSet failed: %s", err)
+	}
+	if v, err := KVGet(db, "ns", "a:1", now); err != nil || v != "y" {
+		t.Errorf("KVGet = %q, %v, want y", v, err)
+	}
+	if _, err := KVGet(db, "ns", "a:2", now); err != sql.ErrNoRows {
+		t.Errorf("KVGet of expired key returned %v, want sql.ErrNoRows", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		n, err := KVIncr(db, "ns", "count", 2, now)
+		if err != nil {
+			t.Fatalf("KVIncr failed: %s", err)
+		}
+		if n != int64(i*2) {
+			t.Errorf("KVIncr = %d, want %d", n, i*2)
+		}
+	}
+	if _, err := KVIncr(db, "ns", "a:1", 1, now); err != ErrKVNotInteger {
+		t.Errorf("KVIncr of non-integer returned %v, want ErrKVNotInteger", err)
+	}
+
+	es, err := KVList(db, "ns", "a:", 10, now)
+	if err != nil {
+		t.Fatalf("KVList failed: %s", err)
+	}
+	if len(es) != 1 || es[0].Key != "a:1" {
+		t.Errorf("KVList = %+v, want only a:1", es)
+	}
+	if n, err := KVDeleteExpired(db, now); err != nil || n != 1 {
+		t.Errorf("KVDeleteExpired = %d, %v, want 1", n, err)
+	}
+}
+
+func testKarma(t *testing.T, db *sql.DB) {
+	now := time.Unix(1524355200, 0)
+	votes := []*KarmaVote{
+		{Giver: "alice", Target: "bob", Delta: 1, Reason: "thanks", VotedAt: now},
+		{Giver: "carol", Target: "bob", Delta: 1, VotedAt: now},
+		{Giver: "alice", Target: "carol", Delta: -1, VotedAt: now},
+	}
+	for _, v := range votes {
+		if _, err := v.Insert(db, time.Minute); err != nil {
+			t.Fatalf("Insert failed: %s", err)
+		}
+	}
+	if _, err := (&KarmaVote{Giver: "alice", Target: "bob", Delta: 1, VotedAt: now}).Insert(db, time.Minute); err != ErrKarmaVotedRecently {
+		t.Errorf("Insert returned %v, want ErrKarmaVotedRecently", err)
+	}
+
+	k, err := KarmaByUserName(db, "bob")
+	if err != nil {
+		t.Fatalf("KarmaByUserName failed: %s", err)
+	}
+	if k.Score != 2 || k.Plus != 2 || k.Minus != 0 {
+		t.Errorf("KarmaByUserName = %+v", k)
+	}
+	ks, err := KarmaTop(db, 10)
+	if err != nil {
+		t.Fatalf("KarmaTop failed: %s", err)
+	}
+	if len(ks) != 2 || ks[0].UserName != "bob" {
+		t.Errorf("KarmaTop = %+v", ks)
+	}
+	vs, err := KarmaVotesWithReasonByTarget(db, "bob", 10)
+	if err != nil {
+		t.Fatalf("KarmaVotesWithReasonByTarget failed: %s", err)
+	}
+	if len(vs) != 1 || vs[0].Reason != "thanks" {
+		t.Errorf("KarmaVotesWithReasonByTarget = %+v", vs)
+	}
+}
+
+func testBotScript(t *testing.T, db *sql.DB) {
+	s := &BotScript{Name: "echo", Source: "def process(m):\n    reply(m.body)\n", Grants: []string{"network"}}
+	saved, err := s.Save(db)
+	if err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+	s.Source = "def process(m):\n    pass\n"
+	got, err := s.Save(db)
+	if err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+	if got.ID != saved.ID || got.Source != s.Source || len(got.Grants) != 1 {
+		t.Errorf("Save = %+v, want id %d", got, saved.ID)
+	}
+	if err := s.Delete(db); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	if err := s.Delete(db); err != sql.ErrNoRows {
+		t.Errorf("Delete of deleted script returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testScheduledRun(t *testing.T, db *sql.DB) {
+	at := time.Unix(1524355200, 0)
+	for i := 0; i < 2; i++ {
+		r := &ScheduledRun{Name: "omikuji", LastRun: at.Add(time.Duration(i) * time.Hour)}
+		if err := r.Save(db); err != nil {
+			t.Fatalf("Save failed: %s", err)
+		}
+	}
+	got, err := ScheduledRunByName(db, "omikuji")
+	if err != nil {
+		t.Fatalf("ScheduledRunByName failed: %s", err)
+	}
+	if !got.LastRun.Equal(at.Add(time.Hour)) {
+		t.Errorf("ScheduledRunByName = %s, want %s", got.LastRun, at.Add(time.Hour))
+	}
+}
+
+func testPoll(t *testing.T, db *sql.DB) {
+	at := time.Unix(1524355200, 0)
+	p, err := (&Poll{Question: "lunch?", UserName: "alice", ClosesAt: at, Options: []*PollOption{{Label: "sushi"}, {Label: "ramen"}}}).Insert(db)
+	if err != nil {
+		t.Fatalf("Insert failed: %s", err)
+	}
+	if err := p.SetMessageID(db, 42); err != nil {
+		t.Fatalf("SetMessageID failed: %s", err)
+	}
+	if err := p.Vote(db, "bob", p.Options[1], at.Add(-time.Minute)); err != nil {
+		t.Fatalf("Vote failed: %s", err)
+	}
+	if err := p.Vote(db, "bob", p.Options[0], at.Add(-time.Minute)); err != ErrAlreadyVoted {
+		t.Errorf("second Vote returned %v, want ErrAlreadyVoted", err)
+	}
+	if err := p.Vote(db, "carol", p.Options[0], at); err != ErrPollClosed {
+		t.Errorf("Vote after closes_at returned %v, want ErrPollClosed", err)
+	}
+
+	got, err := PollByID(db, p.ID)
+	if err != nil {
+		t.Fatalf("PollByID failed: %s", err)
+	}
+	if got.MessageID != 42 || len(got.Options) != 2 || got.Options[0].Votes != 0 || got.Options[1].Votes != 1 || !got.ClosesAt.Equal(at) {
+		t.Errorf("PollByID = %+v", got)
+	}
+	ids, err := PollsExpired(db, at)
+	if err != nil {
+		t.Fatalf("PollsExpired failed: %s", err)
+	}
+	if len(ids) != 1 || ids[0] != p.ID {
+		t.Errorf("PollsExpired = %v, want [%d]", ids, p.ID)
+	}
+	if err := p.Close(db); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+	if ids, err := PollsExpired(db, at); err != nil || len(ids) != 0 {
+		t.Errorf("PollsExpired after Close = %v, %v, want none", ids, err)
+	}
+}
+
+func testReminder(t *testing.T, db *sql.DB) {
+	at := time.Unix(1524355200, 0)
+	r, err := (&Reminder{UserName: "alice", Target: "bob", Body: "deploy", DueAt: at}).Insert(db)
+	if err != nil {
+		t.Fatalf("Insert failed: %s", err)
+	}
+	if _, err := (&Reminder{UserName: "carol", Target: "carol", Body: "lunch", DueAt: at.Add(time.Hour)}).Insert(db); err != nil {
+		t.Fatalf("Insert failed: %s", err)
+	}
+
+	rs, err := RemindersPendingByUserName(db, "bob")
+	if err != nil {
+		t.Fatalf("RemindersPendingByUserName failed: %s", err)
+	}
+	if len(rs) != 1 || rs[0].ID != r.ID || !rs[0].DueAt.Equal(at) {
+		t.Errorf("RemindersPendingByUserName = %+v", rs)
+	}
+	rs, err = RemindersDue(db, at)
+	if err != nil {
+		t.Fatalf("RemindersDue failed: %s", err)
+	}
+	if len(rs) != 1 || rs[0].Body != "deploy" {
+		t.Errorf("RemindersDue = %+v", rs)
+	}
+	if err := r.MarkFired(db); err != nil {
+		t.Fatalf("MarkFired failed: %s", err)
+	}
+	if ok, err := r.Cancel(db, "alice"); err != nil || ok {
+		t.Errorf("Cancel of fired reminder = %t, %v, want false", ok, err)
+	}
+	if rs, err := RemindersDue(db, at.Add(time.Hour)); err != nil || len(rs) != 1 || rs[0].UserName != "carol" {
+		t.Errorf("RemindersDue after MarkFired = %+v, %v", rs, err)
+	}
+}
+
+func testWebhook(t *testing.T, db *sql.DB) {
+	at := time.Unix(1524355200, 0)
+	w, err := (&OutgoingWebhook{Name: "ci", Pattern: "deploy", URL: "http://example.com/hook", Secret: "s", Channel: "ops"}).Insert(db)
+	if err != nil {
+		t.Fatalf("Insert failed: %s", err)
+	}
+	if got, err := OutgoingWebhookByID(db, w.ID); err != nil || got.Pattern != "deploy" || got.Channel != "ops" {
+		t.Errorf("OutgoingWebhookByID = %+v, %v", got, err)
+	}
+	d, err := (&WebhookDelivery{WebhookID: w.ID, MessageID: 1, Status: DeliveryPending, UpdatedAt: at}).Insert(db)
+	if err != nil {
+		t.Fatalf("Insert failed: %s", err)
+	}
+	d.Status, d.Attempts, d.StatusCode, d.UpdatedAt = DeliverySucceeded, 2, 200, at.Add(time.Minute)
+	if err := d.Update(db); err != nil {
+		t.Fatalf("Update failed: %s", err)
+	}
+	ds, err := WebhookDeliveriesByWebhookID(db, w.ID, 10)
+	if err != nil {
+		t.Fatalf("WebhookDeliveriesByWebhookID failed: %s", err)
+	}
+	if len(ds) != 1 || ds[0].Status != DeliverySucceeded || ds[0].Attempts != 2 || !ds[0].UpdatedAt.Equal(at.Add(time.Minute)) {
+		t.Errorf("WebhookDeliveriesByWebhookID = %+v", ds)
+	}
+	if err := w.Delete(db); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	if ds, err := WebhookDeliveriesByWebhookID(db, w.ID, 10); err != nil || len(ds) != 0 {
+		t.Errorf("deliveries after Delete = %+v, %v, want none", ds, err)
+	}
+	if err := w.Delete(db); err != sql.ErrNoRows {
+		t.Errorf("Delete of deleted webhook returned %v, want sql.ErrNoRows", err)
+	}
+
+	in, err := (&IncomingWebhook{Name: "ci", Token: "xoxb-ci", Channel: "ops"}).Insert(db)
+	if err != nil {
+		t.Fatalf("Insert failed: %s", err)
+	}
+	if got, err := IncomingWebhookByToken(db, "xoxb-ci"); err != nil || got.ID != in.ID {
+		t.Errorf("IncomingWebhookByToken = %+v, %v", got, err)
+	}
+	if ws, err := IncomingWebhooksAll(db); err != nil || len(ws) != 1 {
+		t.Errorf("IncomingWebhooksAll = %+v, %v", ws, err)
+	}
+	if err := in.Delete(db); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+}
+
+func testConversation(t *testing.T, db *sql.DB) {
+	now := time.Unix(1524355200, 0)
+	c := &Conversation{Bot: "quizbot", UserName: "alice", State: `{"q":1}`, ExpiresAt: now.Add(time.Minute)}
+	if err := c.Save(db); err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+	c.State = `{"q":2}`
+	if err := c.Save(db); err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+	got, err := ConversationByBotAndUserName(db, "quizbot", "alice", now)
+	if err != nil {
+		t.Fatalf("ConversationByBotAndUserName failed: %s", err)
+	}
+	if got.State != `{"q":2}` {
+		t.Errorf("ConversationByBotAndUserName = %+v", got)
+	}
+	if _, err := ConversationByBotAndUserName(db, "quizbot", "alice", now.Add(time.Minute)); err != sql.ErrNoRows {
+		t.Errorf("expired conversation returned %v, want sql.ErrNoRows", err)
+	}
+	if n, err := ConversationsDeleteExpired(db, now); err != nil || n != 0 {
+		t.Errorf("ConversationsDeleteExpired before expiry = %d, %v, want 0", n, err)
+	}
+	if n, err := ConversationsDeleteExpired(db, now.Add(time.Minute)); err != nil || n != 1 {
+		t.Errorf("ConversationsDeleteExpired = %d, %v, want 1", n, err)
+	}
+	if err := c.Delete(db); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+}
+
+func testOmikuji(t *testing.T, db *sql.DB) {
+	for _, o := range []*Omikuji{
+		{UserName: "alice", Date: "2018-04-21", Fortune: "吉"},
+		{UserName: "alice", Date: "2018-04-22", Fortune: "大吉"},
+		{UserName: "alice", Date: "2018-04-22", Fortune: "凶"},
+	} {
+		if err := o.Insert(db); err != nil {
+			t.Fatalf("Insert failed: %s", err)
+		}
+	}
+	records, err := OmikujisByUserName(db, "alice", 10)
+	if err != nil {
+		t.Fatalf("OmikujisByUserName failed: %s", err)
+	}
+	if len(records) != 2 || records[0].Date != "2018-04-22" || records[0].Fortune != "大吉" {
+		t.Errorf("OmikujisByUserName = %+v", records)
+	}
+}
+
+func testSlashCommand(t *testing.T, db *sql.DB) {
+	c, err := (&SlashCommand{Command: "deploy", URL: "http://example.com/deploy", Token: "t"}).Insert(db)
+	if err != nil {
+		t.Fatalf("Insert failed: %s", err)
+	}
+	if got, err := SlashCommandByCommand(db, "deploy"); err != nil || got.ID != c.ID || got.Token != "t" {
+		t.Errorf("SlashCommandByCommand = %+v, %v", got, err)
+	}
+	if cs, err := SlashCommandsAll(db); err != nil || len(cs) != 1 {
+		t.Errorf("SlashCommandsAll = %+v, %v", cs, err)
+	}
+	if err := c.Delete(db); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	if err := c.Delete(db); err != sql.ErrNoRows {
+		t.Errorf("Delete of deleted command returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testExternalBot(t *testing.T, db *sql.DB) {
+	b, err := (&ExternalBot{Name: "deployer", Token: "secret", Quota: 30}).Insert(db)
+	if err != nil {
+		t.Fatalf("Insert failed: %s", err)
+	}
+	if got, err := ExternalBotByToken(db, "secret"); err != nil || got.ID != b.ID || got.Quota != 30 {
+		t.Errorf("ExternalBotByToken = %+v, %v", got, err)
+	}
+	if got, err := ExternalBotByID(db, b.ID); err != nil || got.Name != "deployer" {
+		t.Errorf("ExternalBotByID = %+v, %v", got, err)
+	}
+	if bs, err := ExternalBotsAll(db); err != nil || len(bs) != 1 {
+		t.Errorf("ExternalBotsAll = %+v, %v", bs, err)
+	}
+	if err := b.Delete(db); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	if _, err := ExternalBotByToken(db, "secret"); err != sql.ErrNoRows {
+		t.Errorf("ExternalBotByToken of deleted bot returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+// openMigrated はdriverのデータベースを開き、埋め込まれたマイグレーションを全て適用します
+func openMigrated(t *testing.T, driver, datasource string) *sql.DB {
+	config := &db.Config{Dialect: driver, Datasource: datasource}
+	conn, err := config.Open()
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	conn.SetMaxOpenConns(1)
+
+	m, err := config.Migrator(conn)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %s", err)
+	}
+	if _, err := m.Up(context.Background(), false); err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+	return conn
+}
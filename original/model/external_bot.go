@@ -0,0 +1,77 @@
+package model
+
+import (
+	"database/sql"
+)
+
+// ExternalBot はWebSocketで接続する外部のbotの構造体です
+//
+// Quotaは1分間に投稿できる返信の数です
+type ExternalBot struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Token string `json:"token,omitempty"`
+	Quota int    `json:"quota"`
+}
+
+// ExternalBotsAll は全ての外部のbotを返します
+func ExternalBotsAll(db *sql.DB) ([]*ExternalBot, error) {
+	rows, err := on(db).Query(`select id, name, token, quota from external_bot order by name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bs []*ExternalBot
+	for rows.Next() {
+		b := &ExternalBot{}
+		if err := rows.Scan(&b.ID, &b.Name, &b.Token, &b.Quota); err != nil {
+			return nil, err
+		}
+		bs = append(bs, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+// ExternalBotByID は指定されたIDの外部のbotを返します
+func ExternalBotByID(db *sql.DB, id int64) (*ExternalBot, error) {
+	b := &ExternalBot{}
+	if err := on(db).QueryRow(`select id, name, token, quota from external_bot where id = ?`, id).Scan(&b.ID, &b.Name, &b.Token, &b.Quota); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// ExternalBotByToken は指定されたtokenの外部のbotを返します
+func ExternalBotByToken(db *sql.DB, token string) (*ExternalBot, error) {
+	b := &ExternalBot{}
+	if err := on(db).QueryRow(`select id, name, token, quota from external_bot where token = ?`, token).Scan(&b.ID, &b.Name, &b.Token, &b.Quota); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Insert は外部のbotを追加します
+func (b *ExternalBot) Insert(db *sql.DB) (*ExternalBot, error) {
+	id, err := on(db).Insert(`insert into external_bot (name, token, quota) values (?, ?, ?)`, b.Name, b.Token, b.Quota)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExternalBot{
+		ID:    id,
+		Name:  b.Name,
+		Token: b.Token,
+		Quota: b.Quota,
+	}, nil
+}
+
+// Delete は外部のbotを削除します
+func (b *ExternalBot) Delete(db *sql.DB) error {
+	_, err := on(db).Exec(`delete from external_bot where id = ?`, b.ID)
+	return err
+}
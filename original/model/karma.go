@@ -0,0 +1,119 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrKarmaVotedRecently は同じユーザーが同じ相手にinterval以内に再び投票しようとしたことを表すエラーです
+var ErrKarmaVotedRecently = errors.New("karma voted recently")
+
+type (
+	// KarmaVote はGiverがTargetに投じた++か--の1票の構造体です
+	//
+	// Deltaは++なら1、--なら-1です
+	KarmaVote struct {
+		ID      int64     `json:"id"`
+		Giver   string    `json:"giver"`
+		Target  string    `json:"target"`
+		Delta   int       `json:"delta"`
+		Reason  string    `json:"reason"`
+		VotedAt time.Time `json:"voted_at"`
+	}
+
+	// Karma はユーザーのスコアと++、--の数の構造体です
+	Karma struct {
+		UserName string `json:"username"`
+		Score    int    `json:"score"`
+		Plus     int    `json:"plus"`
+		Minus    int    `json:"minus"`
+	}
+)
+
+// KarmaTop はスコアの高い順にlimit件のKarmaを返します
+func KarmaTop(db *sql.DB, limit int) ([]*Karma, error) {
+	rows, err := on(db).Query(`select target, sum(delta), sum(case when delta > 0 then 1 else 0 end), sum(case when delta < 0 then 1 else 0 end) from karma group by target order by sum(delta) desc, target limit ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ks []*Karma
+	for rows.Next() {
+		k := &Karma{}
+		if err := rows.Scan(&k.UserName, &k.Score, &k.Plus, &k.Minus); err != nil {
+			return nil, err
+		}
+		ks = append(ks, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// KarmaByUserName はusernameのKarmaを返します。まだ投票されていない場合はスコアが0のKarmaを返します
+func KarmaByUserName(db *sql.DB, username string) (*Karma, error) {
+	k := &Karma{UserName: username}
+	if err := on(db).QueryRow(`select coalesce(sum(delta), 0), coalesce(sum(case when delta > 0 then 1 else 0 end), 0), coalesce(sum(case when delta < 0 then 1 else 0 end), 0) from karma where target = ?`, username).Scan(&k.Score, &k.Plus, &k.Minus); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// KarmaVotesWithReasonByTarget はtargetへの理由つきの投票を新しい順にlimit件返します
+func KarmaVotesWithReasonByTarget(db *sql.DB, target string, limit int) ([]*KarmaVote, error) {
+	rows, err := on(db).Query(`select id, giver, target, delta, reason, voted_at from karma where target = ? and reason != '' order by voted_at desc, id desc limit ?`, target, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vs []*KarmaVote
+	for rows.Next() {
+		v := &KarmaVote{}
+		var votedAt int64
+		if err := rows.Scan(&v.ID, &v.Giver, &v.Target, &v.Delta, &v.Reason, &votedAt); err != nil {
+			return nil, err
+		}
+		v.VotedAt = time.Unix(votedAt, 0)
+		vs = append(vs, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return vs, nil
+}
+
+// Insert は投票を追加します
+//
+// GiverがTargetにVotedAtより前のinterval以内に投票していた場合はErrKarmaVotedRecentlyを返します
+func (v *KarmaVote) Insert(db *sql.DB, interval time.Duration) (*KarmaVote, error) {
+	tx, err := begin(db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRow(`select count(*) from karma where giver = ? and target = ? and voted_at > ?`, v.Giver, v.Target, v.VotedAt.Add(-interval).Unix()).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, ErrKarmaVotedRecently
+	}
+
+	id, err := tx.Insert(`insert into karma (giver, target, delta, reason, voted_at) values (?, ?, ?, ?, ?)`, v.Giver, v.Target, v.Delta, v.Reason, v.VotedAt.Unix())
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	v.ID = id
+
+	return v, nil
+}
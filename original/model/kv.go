@@ -0,0 +1,136 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrKVNotInteger はKVIncrで整数でない値を増やそうとした場合のエラーです
+var ErrKVNotInteger = errors.New("value is not an integer")
+
+// KVEntry はbotのキーバリューストアの1件の構造体です
+//
+// ExpiresAtがゼロの場合は期限がありません
+type KVEntry struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// KVGet はnamespaceのkeyの値のうち、nowの時点で期限が切れていないものを返します。ない場合はsql.ErrNoRowsを返します
+func KVGet(db *sql.DB, namespace, key string, now time.Time) (string, error) {
+	c := on(db)
+	var value string
+	if err := c.QueryRow(`select value from bot_kv where namespace = ? and `+c.quote("key")+` = ? and (expires_at = 0 or expires_at > ?)`, namespace, key, now.Unix()).Scan(&value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// KVSet はnamespaceのkeyに値を保存します。expiresAtがゼロの場合は期限がありません
+func KVSet(db *sql.DB, namespace, key, value string, expiresAt time.Time) error {
+	c := on(db)
+	_, err := c.Exec(kvUpsert(c), namespace, key, value, kvUnix(expiresAt))
+	return err
+}
+
+// KVDelete はnamespaceのkeyを削除します。ない場合も何もせずnilを返します
+func KVDelete(db *sql.DB, namespace, key string) error {
+	c := on(db)
+	_, err := c.Exec(`delete from bot_kv where namespace = ? and `+c.quote("key")+` = ?`, namespace, key)
+	return err
+}
+
+// KVIncr はnamespaceのkeyの整数の値にdeltaを足し、足した後の値を返します
+//
+// keyがないか期限が切れている場合は0に足し、期限のない値として保存します。既にある値の期限は変えません
+func KVIncr(db *sql.DB, namespace, key string, delta int64, now time.Time) (int64, error) {
+	tx, err := begin(db)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// 最初に書き込んで行をロックすることで、読んでから書くまでの間に他の更新が入らないようにします
+	col := tx.quote("key")
+	if _, err := tx.Exec(`delete from bot_kv where namespace = ? and `+col+` = ? and expires_at != 0 and expires_at <= ?`, namespace, key, now.Unix()); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(tx.insertIgnore("bot_kv", []string{"namespace", col}, "namespace", col, "value", "expires_at"), namespace, key, "0", 0); err != nil {
+		return 0, err
+	}
+
+	var value string
+	if err := tx.QueryRow(`select value from bot_kv where namespace = ? and `+col+` = ?`+tx.forUpdate(), namespace, key).Scan(&value); err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, ErrKVNotInteger
+	}
+	n += delta
+
+	if _, err := tx.Exec(`update bot_kv set value = ? where namespace = ? and `+col+` = ?`, strconv.FormatInt(n, 10), namespace, key); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// KVList はnamespaceのkeyがprefixで始まるもののうち、nowの時点で期限が切れていないものをkeyの順に最大limit件返します
+func KVList(db *sql.DB, namespace, prefix string, limit int, now time.Time) ([]*KVEntry, error) {
+	c := on(db)
+	col := c.quote("key")
+	rows, err := c.Query(`select `+col+`, value, expires_at from bot_kv where namespace = ? and substr(`+col+`, 1, ?) = ? and (expires_at = 0 or expires_at > ?) order by `+col+` limit ?`,
+		namespace, utf8.RuneCountInString(prefix), prefix, now.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var es []*KVEntry
+	for rows.Next() {
+		e := &KVEntry{}
+		var expiresAt int64
+		if err := rows.Scan(&e.Key, &e.Value, &expiresAt); err != nil {
+			return nil, err
+		}
+		if expiresAt != 0 {
+			e.ExpiresAt = time.Unix(expiresAt, 0)
+		}
+		es = append(es, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return es, nil
+}
+
+// KVDeleteExpired はnowの時点で期限が切れた値を全ての名前空間から削除し、削除した件数を返します
+func KVDeleteExpired(db *sql.DB, now time.Time) (int64, error) {
+	res, err := on(db).Exec(`delete from bot_kv where expires_at != 0 and expires_at <= ?`, now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// kvUpsert はbot_kvに値を追加、または置き換えるinsert文を返します
+func kvUpsert(c *conn) string {
+	col := c.quote("key")
+	return c.upsert("bot_kv", []string{"namespace", col}, "namespace", col, "value", "expires_at")
+}
+
+// kvUnix はexpiresAtをunix時間にします。ゼロの場合は0を返します
+func kvUnix(expiresAt time.Time) int64 {
+	if expiresAt.IsZero() {
+		return 0
+	}
+	return expiresAt.Unix()
+}
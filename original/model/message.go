@@ -2,21 +2,39 @@ package model
 
 import (
 	"database/sql"
-	"strconv"
+	"errors"
+	"math"
+	"strings"
+)
+
+// ErrVersionConflict は更新、削除しようとしたメッセージが他の人に更新されていたことを表すエラーです
+var ErrVersionConflict = errors.New("message was modified by someone else")
+
+const (
+	// OriginBot はbotが投稿したメッセージのOriginです
+	OriginBot = "bot"
+	// OriginWebhook はincoming webhookやSlack互換のAPIから投稿されたメッセージのOriginです
+	OriginWebhook = "webhook"
 )
 
 // Message はメッセージの構造体です
+//
+// Versionは追加したときに1で、本文を更新するたびに1増えます
+// Originはbotやwebhookが投稿したメッセージに付ける印で、人が投稿した場合は空です。保存せず、JSONでも受け取りません
 type Message struct {
 	ID       int64  `json:"id"`
 	Body     string `json:"body"`
 	UserName string `json:"username"` // 1-1. ユーザー名を表示しよう
+	Channel  string `json:"channel"`
+	Version  int64  `json:"version"`
+	Origin   string `json:"-"`
 }
 
 // MessagesAll は全てのメッセージを返します
 func MessagesAll(db *sql.DB) ([]*Message, error) {
 
 	// 1-1. ユーザー名を表示しよう
-	rows, err := db.Query(`select id, body, username from message`)
+	rows, err := on(db).Query(`select id, body, username, channel, version from message`)
 	if err != nil {
 		return nil, err
 	}
@@ -26,7 +44,58 @@ func MessagesAll(db *sql.DB) ([]*Message, error) {
 	for rows.Next() {
 		m := &Message{}
 		// 1-1. ユーザー名を表示しよう
-		if err := rows.Scan(&m.ID, &m.Body, &m.UserName); err != nil {
+		if err := rows.Scan(&m.ID, &m.Body, &m.UserName, &m.Channel, &m.Version); err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// MessagesByChannel はchannelのメッセージのうち、IDがoldestより大きくlatestより小さいものを新しい順にlimit件返します
+//
+// latestが0の場合は上限を設けません
+func MessagesByChannel(db *sql.DB, channel string, oldest, latest int64, limit int) ([]*Message, error) {
+	if latest == 0 {
+		latest = math.MaxInt64
+	}
+	rows, err := on(db).Query(`select id, body, username, channel, version from message where channel = ? and id > ? and id < ? order by id desc limit ?`, channel, oldest, latest, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ms []*Message
+	for rows.Next() {
+		m := &Message{}
+		if err := rows.Scan(&m.ID, &m.Body, &m.UserName, &m.Channel, &m.Version); err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// MessagesAfterID はIDがidより大きいメッセージを古い順にlimit件返します
+func MessagesAfterID(db *sql.DB, id int64, limit int) ([]*Message, error) {
+	rows, err := on(db).Query(`select id, body, username, channel, version from message where id > ? order by id limit ?`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ms []*Message
+	for rows.Next() {
+		m := &Message{}
+		if err := rows.Scan(&m.ID, &m.Body, &m.UserName, &m.Channel, &m.Version); err != nil {
 			return nil, err
 		}
 		ms = append(ms, m)
@@ -38,26 +107,66 @@ func MessagesAll(db *sql.DB) ([]*Message, error) {
 	return ms, nil
 }
 
+// MessagesSearch は本文にqueryを含むメッセージを、大文字と小文字を区別せずに新しい順にlimit件返します
+//
+// SQLiteのlowerはASCIIの文字だけを小文字にします
+func MessagesSearch(db *sql.DB, query string, limit int) ([]*Message, error) {
+	pattern := "%" + likeEscaper.Replace(strings.ToLower(query)) + "%"
+	rows, err := on(db).Query(`select id, body, username, channel, version from message where lower(body) like ? escape '!' order by id desc limit ?`, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ms []*Message
+	for rows.Next() {
+		m := &Message{}
+		if err := rows.Scan(&m.ID, &m.Body, &m.UserName, &m.Channel, &m.Version); err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// likeEscaper はlikeのパターンの特殊文字を!でエスケープします
+//
+// MySQLは文字列の中の\もエスケープするので、どのdialectでも同じに書ける!を使います
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
 // MessageByID は指定されたIDのメッセージを1つ返します
-func MessageByID(db *sql.DB, id string) (*Message, error) {
+func MessageByID(db *sql.DB, id int64) (*Message, error) {
 	m := &Message{}
 
 	// 1-1. ユーザー名を表示しよう
-	if err := db.QueryRow(`select id, body, username from message where id = ?`, id).Scan(&m.ID, &m.Body, &m.UserName); err != nil {
+	if err := on(db).QueryRow(`select id, body, username, channel, version from message where id = ?`, id).Scan(&m.ID, &m.Body, &m.UserName, &m.Channel, &m.Version); err != nil {
 		return nil, err
 	}
 
 	return m, nil
 }
 
+// MessageUserNameExists はusernameが投稿したメッセージがあるかを返します
+func MessageUserNameExists(db *sql.DB, username string) (bool, error) {
+	var n int
+	err := on(db).QueryRow(`select 1 from message where username = ? limit 1`, username).Scan(&n)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
+
 // Insert はmessageテーブルに新規データを1件追加します
 func (m *Message) Insert(db *sql.DB) (*Message, error) {
 	// 1-2. ユーザー名を追加しよう
-	res, err := db.Exec(`insert into message (body, username) values (?, ?)`, m.Body, m.UserName)
-	if err != nil {
-		return nil, err
-	}
-	id, err := res.LastInsertId()
+	id, err := on(db).Insert(`insert into message (body, username, channel) values (?, ?, ?)`, m.Body, m.UserName, m.Channel)
 	if err != nil {
 		return nil, err
 	}
@@ -66,19 +175,38 @@ func (m *Message) Insert(db *sql.DB) (*Message, error) {
 		ID:       id,
 		Body:     m.Body,
 		UserName: m.UserName, // 1-2. ユーザー名を追加しよう
+		Channel:  m.Channel,
+		Version:  1,
 	}, nil
 }
 
 // 1-3. メッセージを編集しよう
 // ...
+//
+// m.Versionが0でない場合は、バージョンが同じときだけ更新し、違う場合はErrVersionConflictを返します
 func (m *Message) Update(db *sql.DB) (*Message, error) {
-	_, err := db.Exec(`UPDATE message SET body=?  WHERE id = ?`, m.Body, m.ID)
+	query := `UPDATE message SET body=?, version = version + 1 WHERE id = ?`
+	args := []interface{}{m.Body, m.ID}
+	if m.Version != 0 {
+		query += ` AND version = ?`
+		args = append(args, m.Version)
+	}
+	res, err := on(db).Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
 		return nil, err
 	}
+	if n == 0 {
+		if _, err := MessageByID(db, m.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrVersionConflict
+	}
 
-	id := strconv.FormatInt(m.ID, 10)
-	msg, err := MessageByID(db, id)
+	msg, err := MessageByID(db, m.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -88,11 +216,35 @@ func (m *Message) Update(db *sql.DB) (*Message, error) {
 
 // 1-4. メッセージを削除しよう
 // ...
+//
+// m.Versionが0でない場合は、バージョンが同じときだけ削除し、違う場合はErrVersionConflictを返します
 func (m *Message) Delete(db *sql.DB) error {
-	_, err := db.Exec(`DELETE FROM message WHERE id = ?`, m.ID)
+	query := `DELETE FROM message WHERE id = ?`
+	args := []interface{}{m.ID}
+	if m.Version != 0 {
+		query += ` AND version = ?`
+		args = append(args, m.Version)
+	}
+	res, err := on(db).Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if m.Version == 0 {
+		return nil
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if n == 0 {
+		_, err := MessageByID(db, m.ID)
+		switch {
+		case err == nil:
+			return ErrVersionConflict
+		case err != sql.ErrNoRows:
+			return err
+		}
+	}
 
 	return nil
 }
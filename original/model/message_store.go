@@ -0,0 +1,237 @@
+package model
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// MessageStore はメッセージを保存する場所のインターフェースです
+	//
+	// メッセージがない場合、ByIDとUpdateはsql.ErrNoRowsを返します
+	// UpdateとDeleteはバージョンが指定された場合、メッセージのバージョンが違えばErrVersionConflictを返します
+	MessageStore interface {
+		// All は全てのメッセージを古い順に返します
+		All() ([]*Message, error)
+		// ByChannel はchannelのメッセージのうち、IDがoldestより大きくlatestより小さいものを新しい順にlimit件返します。latestが0の場合は上限を設けません
+		ByChannel(channel string, oldest, latest int64, limit int) ([]*Message, error)
+		// AfterID はIDがidより大きいメッセージを古い順にlimit件返します
+		AfterID(id int64, limit int) ([]*Message, error)
+		// Search は本文にqueryを含むメッセージを、大文字と小文字を区別せずに新しい順にlimit件返します
+		Search(query string, limit int) ([]*Message, error)
+		// ByID は指定されたIDのメッセージを返します
+		ByID(id int64) (*Message, error)
+		// Create はメッセージを追加し、IDを付けたメッセージを返します
+		Create(m *Message) (*Message, error)
+		// Update はm.IDのメッセージの本文を更新してバージョンを1増やし、更新後のメッセージを返します。m.Versionが0の場合はバージョンを確認しません
+		Update(m *Message) (*Message, error)
+		// Delete はidのメッセージを削除します。ない場合も何もせずnilを返します。versionが0の場合はバージョンを確認しません
+		Delete(id, version int64) error
+	}
+
+	// SQLMessageStore はmessageテーブルにメッセージを保存するMessageStoreです
+	//
+	//   fields
+	//     db *sql.DB
+	SQLMessageStore struct {
+		db *sql.DB
+	}
+
+	// MemoryMessageStore はメモリーにメッセージを保存するMessageStoreです。テストや試作に使います
+	//
+	//   fields
+	//     mu       sync.Mutex
+	//     lastID   int64
+	//     messages []*Message
+	MemoryMessageStore struct {
+		mu       sync.Mutex
+		lastID   int64
+		messages []*Message
+	}
+)
+
+// NewSQLMessageStore は新しいSQLMessageStore構造体のポインタを返します
+func NewSQLMessageStore(db *sql.DB) *SQLMessageStore {
+	return &SQLMessageStore{db: db}
+}
+
+// All は全てのメッセージを返します
+func (s *SQLMessageStore) All() ([]*Message, error) {
+	return MessagesAll(s.db)
+}
+
+// ByChannel はchannelのメッセージを新しい順に返します
+func (s *SQLMessageStore) ByChannel(channel string, oldest, latest int64, limit int) ([]*Message, error) {
+	return MessagesByChannel(s.db, channel, oldest, latest, limit)
+}
+
+// AfterID はIDがidより大きいメッセージを古い順に返します
+func (s *SQLMessageStore) AfterID(id int64, limit int) ([]*Message, error) {
+	return MessagesAfterID(s.db, id, limit)
+}
+
+// Search は本文にqueryを含むメッセージを新しい順に返します
+func (s *SQLMessageStore) Search(query string, limit int) ([]*Message, error) {
+	return MessagesSearch(s.db, query, limit)
+}
+
+// ByID は指定されたIDのメッセージを返します
+func (s *SQLMessageStore) ByID(id int64) (*Message, error) {
+	return MessageByID(s.db, id)
+}
+
+// Create はメッセージを追加します
+func (s *SQLMessageStore) Create(m *Message) (*Message, error) {
+	return m.Insert(s.db)
+}
+
+// Update はメッセージの本文を更新します
+func (s *SQLMessageStore) Update(m *Message) (*Message, error) {
+	return m.Update(s.db)
+}
+
+// Delete はidのメッセージを削除します
+func (s *SQLMessageStore) Delete(id, version int64) error {
+	return (&Message{ID: id, Version: version}).Delete(s.db)
+}
+
+// NewMemoryMessageStore はmsを保存した新しいMemoryMessageStore構造体のポインタを返します
+//
+// msのIDは無視し、順に1から振り直します
+func NewMemoryMessageStore(ms ...*Message) *MemoryMessageStore {
+	s := &MemoryMessageStore{}
+	for _, m := range ms {
+		s.Create(m)
+	}
+	return s
+}
+
+// All は全てのメッセージを返します
+func (s *MemoryMessageStore) All() ([]*Message, error) {
+	return s.filter(false, 0, func(m *Message) bool { return true }), nil
+}
+
+// ByChannel はchannelのメッセージを新しい順に返します
+func (s *MemoryMessageStore) ByChannel(channel string, oldest, latest int64, limit int) ([]*Message, error) {
+	if latest == 0 {
+		latest = math.MaxInt64
+	}
+	return s.filter(true, limit, func(m *Message) bool {
+		return m.Channel == channel && m.ID > oldest && m.ID < latest
+	}), nil
+}
+
+// AfterID はIDがidより大きいメッセージを古い順に返します
+func (s *MemoryMessageStore) AfterID(id int64, limit int) ([]*Message, error) {
+	return s.filter(false, limit, func(m *Message) bool { return m.ID > id }), nil
+}
+
+// Search は本文にqueryを含むメッセージを新しい順に返します
+func (s *MemoryMessageStore) Search(query string, limit int) ([]*Message, error) {
+	query = strings.ToLower(query)
+	return s.filter(true, limit, func(m *Message) bool {
+		return strings.Contains(strings.ToLower(m.Body), query)
+	}), nil
+}
+
+// ByID は指定されたIDのメッセージを返します
+func (s *MemoryMessageStore) ByID(id int64) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.index(id)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *s.messages[i]
+	return &copied, nil
+}
+
+// Create はメッセージを追加します
+func (s *MemoryMessageStore) Create(m *Message) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	inserted := &Message{
+		ID:       s.lastID,
+		Body:     m.Body,
+		UserName: m.UserName,
+		Channel:  m.Channel,
+		Version:  1,
+	}
+	s.messages = append(s.messages, inserted)
+	copied := *inserted
+	return &copied, nil
+}
+
+// Update はメッセージの本文を更新します
+func (s *MemoryMessageStore) Update(m *Message) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.index(m.ID)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if m.Version != 0 && m.Version != s.messages[i].Version {
+		return nil, ErrVersionConflict
+	}
+	s.messages[i].Body = m.Body
+	s.messages[i].Version++
+	copied := *s.messages[i]
+	return &copied, nil
+}
+
+// Delete はidのメッセージを削除します
+func (s *MemoryMessageStore) Delete(id, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.index(id)
+	if !ok {
+		return nil
+	}
+	if version != 0 && version != s.messages[i].Version {
+		return ErrVersionConflict
+	}
+	s.messages = append(s.messages[:i], s.messages[i+1:]...)
+	return nil
+}
+
+// filter はfがtrueを返すメッセージのコピーをlimit件返します。limitが0の場合は全て返します
+//
+// newestFirstがtrueの場合は新しい順、そうでなければ古い順です
+func (s *MemoryMessageStore) filter(newestFirst bool, limit int, f func(m *Message) bool) []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ms []*Message
+	for i := range s.messages {
+		m := s.messages[i]
+		if newestFirst {
+			m = s.messages[len(s.messages)-1-i]
+		}
+		if !f(m) {
+			continue
+		}
+		copied := *m
+		ms = append(ms, &copied)
+		if limit > 0 && len(ms) == limit {
+			break
+		}
+	}
+	return ms
+}
+
+// index はidのメッセージのs.messagesでの位置を返します。s.messagesはIDの順に並んでいます
+func (s *MemoryMessageStore) index(id int64) (int, bool) {
+	i := sort.Search(len(s.messages), func(i int) bool { return s.messages[i].ID >= id })
+	if i < len(s.messages) && s.messages[i].ID == id {
+		return i, true
+	}
+	return 0, false
+}
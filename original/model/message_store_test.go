@@ -0,0 +1,138 @@
+package model
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestMessageStore(t *testing.T) {
+	conn := openMigrated(t, dialectSQLite3, ":memory:")
+	defer conn.Close()
+
+	stores := map[string]MessageStore{
+		"sql":    NewSQLMessageStore(conn),
+		"memory": NewMemoryMessageStore(),
+	}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			testMessageStore(t, s)
+		})
+	}
+}
+
+func testMessageStore(t *testing.T, s MessageStore) {
+	for _, m := range []*Message{
+		{Body: "Deploy web", UserName: "alice", Channel: "ops"},
+		{Body: "hello", UserName: "bob", Channel: "general"},
+		{Body: "deploy 100% done", UserName: "alice", Channel: "ops"},
+		{Body: "lunch?", UserName: "carol", Channel: "general"},
+	} {
+		if _, err := s.Create(m); err != nil {
+			t.Fatalf("Create failed: %s", err)
+		}
+	}
+
+	all, err := s.All()
+	if err != nil {
+		t.Fatalf("All failed: %s", err)
+	}
+	if got := messageIDs(all); !equalIDs(got, []int64{1, 2, 3, 4}) {
+		t.Errorf("All = %v", got)
+	}
+
+	ms, err := s.ByChannel("ops", 0, 0, 10)
+	if err != nil {
+		t.Fatalf("ByChannel failed: %s", err)
+	}
+	if got := messageIDs(ms); !equalIDs(got, []int64{3, 1}) {
+		t.Errorf("ByChannel = %v", got)
+	}
+	ms, err = s.ByChannel("general", 0, 4, 10)
+	if err != nil {
+		t.Fatalf("ByChannel failed: %s", err)
+	}
+	if got := messageIDs(ms); !equalIDs(got, []int64{2}) {
+		t.Errorf("ByChannel with latest = %v", got)
+	}
+
+	ms, err = s.AfterID(1, 2)
+	if err != nil {
+		t.Fatalf("AfterID failed: %s", err)
+	}
+	if got := messageIDs(ms); !equalIDs(got, []int64{2, 3}) {
+		t.Errorf("AfterID = %v", got)
+	}
+
+	ms, err = s.Search("DEPLOY", 10)
+	if err != nil {
+		t.Fatalf("Search failed: %s", err)
+	}
+	if got := messageIDs(ms); !equalIDs(got, []int64{3, 1}) {
+		t.Errorf("Search = %v", got)
+	}
+	ms, err = s.Search("100%", 10)
+	if err != nil {
+		t.Fatalf("Search failed: %s", err)
+	}
+	if got := messageIDs(ms); !equalIDs(got, []int64{3}) {
+		t.Errorf("Search with %% = %v", got)
+	}
+
+	updated, err := s.Update(&Message{ID: 2, Body: "hello, world"})
+	if err != nil {
+		t.Fatalf("Update failed: %s", err)
+	}
+	if updated.Body != "hello, world" || updated.UserName != "bob" || updated.Version != 2 {
+		t.Errorf("Update = %+v", updated)
+	}
+	if _, err := s.Update(&Message{ID: 2, Body: "stale", Version: 1}); err != ErrVersionConflict {
+		t.Errorf("Update with stale version returned %v, want ErrVersionConflict", err)
+	}
+	if updated, err := s.Update(&Message{ID: 2, Body: "hello, again", Version: 2}); err != nil || updated.Version != 3 {
+		t.Errorf("Update with current version = %+v, %v", updated, err)
+	}
+	if err := s.Delete(2, 2); err != ErrVersionConflict {
+		t.Errorf("Delete with stale version returned %v, want ErrVersionConflict", err)
+	}
+	if _, err := s.Update(&Message{ID: 100, Body: "none"}); err != sql.ErrNoRows {
+		t.Errorf("Update of missing message returned %v, want sql.ErrNoRows", err)
+	}
+
+	if err := s.Delete(2, 3); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	if _, err := s.ByID(2); err != sql.ErrNoRows {
+		t.Errorf("ByID of deleted message returned %v, want sql.ErrNoRows", err)
+	}
+	if err := s.Delete(2, 3); err != nil {
+		t.Errorf("Delete of deleted message returned %v", err)
+	}
+
+	m, err := s.Create(&Message{Body: "new", UserName: "dave"})
+	if err != nil {
+		t.Fatalf("Create failed: %s", err)
+	}
+	if m.ID != 5 || m.Version != 1 {
+		t.Errorf("Create after Delete returned id %d version %d, want 5 and 1", m.ID, m.Version)
+	}
+}
+
+func messageIDs(ms []*Message) []int64 {
+	var ids []int64
+	for _, m := range ms {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"database/sql"
+)
+
+// Omikuji はユーザーが引いたおみくじの記録の構造体です
+//
+// 同じユーザーは1日に1回分だけ記録されます
+type Omikuji struct {
+	ID       int64  `json:"id"`
+	UserName string `json:"username"`
+	Date     string `json:"date"` // 2006-01-02 形式
+	Fortune  string `json:"fortune"`
+}
+
+// OmikujisByUserName は指定されたユーザーのおみくじの記録を新しい順に最大limit件返します
+func OmikujisByUserName(db *sql.DB, username string, limit int) ([]*Omikuji, error) {
+	rows, err := on(db).Query(`select id, username, date, fortune from omikuji where username = ? order by date desc limit ?`, username, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var omikujis []*Omikuji
+	for rows.Next() {
+		o := &Omikuji{}
+		if err := rows.Scan(&o.ID, &o.UserName, &o.Date, &o.Fortune); err != nil {
+			return nil, err
+		}
+		omikujis = append(omikujis, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return omikujis, nil
+}
+
+// Insert はomikujiテーブルに記録を1件追加します
+//
+// 同じユーザーの同じ日付の記録が既にある場合は何もしません
+func (o *Omikuji) Insert(db *sql.DB) error {
+	c := on(db)
+	_, err := c.Exec(c.insertIgnore("omikuji", []string{"username", "date"}, "username", "date", "fortune"), o.UserName, o.Date, o.Fortune)
+	return err
+}
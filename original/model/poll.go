@@ -0,0 +1,177 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrAlreadyVoted は同じユーザーが同じ投票に2回投票しようとしたことを表すエラーです
+	ErrAlreadyVoted = errors.New("already voted")
+	// ErrPollClosed は締め切られた投票に投票しようとしたことを表すエラーです
+	ErrPollClosed = errors.New("poll closed")
+)
+
+type (
+	// Poll は投票の構造体です
+	//
+	// MessageIDは集計結果を表示するメッセージのIDです
+	Poll struct {
+		ID        int64         `json:"id"`
+		MessageID int64         `json:"message_id"`
+		Question  string        `json:"question"`
+		UserName  string        `json:"username"`
+		ClosesAt  time.Time     `json:"closes_at"`
+		Closed    bool          `json:"closed"`
+		Options   []*PollOption `json:"options"`
+	}
+
+	// PollOption は投票の選択肢と得票数の構造体です
+	PollOption struct {
+		ID       int64  `json:"id"`
+		Position int    `json:"position"`
+		Label    string `json:"label"`
+		Votes    int    `json:"votes"`
+	}
+)
+
+// PollByID は指定されたIDの投票を、選択肢と得票数を含めて返します
+func PollByID(db *sql.DB, id int64) (*Poll, error) {
+	p := &Poll{}
+	var closesAt int64
+	if err := on(db).QueryRow(`select id, message_id, question, username, closes_at, closed from poll where id = ?`, id).Scan(&p.ID, &p.MessageID, &p.Question, &p.UserName, &closesAt, &p.Closed); err != nil {
+		return nil, err
+	}
+	p.ClosesAt = time.Unix(closesAt, 0)
+
+	rows, err := on(db).Query(`select o.id, o.position, o.label, count(v.id) from poll_option o left join poll_vote v on v.option_id = o.id where o.poll_id = ? group by o.id, o.position, o.label order by o.position`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		o := &PollOption{}
+		if err := rows.Scan(&o.ID, &o.Position, &o.Label, &o.Votes); err != nil {
+			return nil, err
+		}
+		p.Options = append(p.Options, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// PollsExpired はnowまでに締め切られるべきでまだ締め切っていない投票のIDを返します
+func PollsExpired(db *sql.DB, now time.Time) ([]int64, error) {
+	rows, err := on(db).Query(`select id from poll where closed = 0 and closes_at <= ? order by closes_at`, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Insert はpollテーブルに投票を、poll_optionテーブルに選択肢を追加します
+func (p *Poll) Insert(db *sql.DB) (*Poll, error) {
+	tx, err := begin(db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := tx.Insert(`insert into poll (message_id, question, username, closes_at) values (?, ?, ?, ?)`, p.MessageID, p.Question, p.UserName, p.ClosesAt.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	inserted := &Poll{
+		ID:        id,
+		MessageID: p.MessageID,
+		Question:  p.Question,
+		UserName:  p.UserName,
+		ClosesAt:  p.ClosesAt,
+	}
+	for i, o := range p.Options {
+		optionID, err := tx.Insert(`insert into poll_option (poll_id, position, label) values (?, ?, ?)`, id, i+1, o.Label)
+		if err != nil {
+			return nil, err
+		}
+		inserted.Options = append(inserted.Options, &PollOption{
+			ID:       optionID,
+			Position: i + 1,
+			Label:    o.Label,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+// SetMessageID は集計結果を表示するメッセージのIDを記録します
+func (p *Poll) SetMessageID(db *sql.DB, messageID int64) error {
+	if _, err := on(db).Exec(`update poll set message_id = ? where id = ?`, messageID, p.ID); err != nil {
+		return err
+	}
+	p.MessageID = messageID
+	return nil
+}
+
+// Vote はusernameのoptionへの投票をnowの時点で記録します
+//
+// 締め切られているか、nowが締め切りを過ぎている場合はErrPollClosedを返します。PollCloseBotが締め切る前でも受け付けません
+// 既に投票している場合はErrAlreadyVotedを返します。同時に投票した場合も一意制約で1票だけ記録します
+func (p *Poll) Vote(db *sql.DB, username string, option *PollOption, now time.Time) error {
+	tx, err := begin(db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var closesAt int64
+	var closed bool
+	if err := tx.QueryRow(`select closes_at, closed from poll where id = ?`+tx.forUpdate(), p.ID).Scan(&closesAt, &closed); err != nil {
+		return err
+	}
+	if closed || now.Unix() >= closesAt {
+		return ErrPollClosed
+	}
+
+	res, err := tx.Exec(tx.insertIgnore("poll_vote", []string{"poll_id", "username"}, "poll_id", "option_id", "username"), p.ID, option.ID, username)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAlreadyVoted
+	}
+	return tx.Commit()
+}
+
+// Close は投票を締め切ります
+func (p *Poll) Close(db *sql.DB) error {
+	if _, err := on(db).Exec(`update poll set closed = 1 where id = ?`, p.ID); err != nil {
+		return err
+	}
+	p.Closed = true
+	return nil
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Reminder はUserNameがTargetに宛てて、DueAtにBodyを知らせるリマインダーの構造体です
+type Reminder struct {
+	ID       int64     `json:"id"`
+	UserName string    `json:"username"`
+	Target   string    `json:"target"`
+	Body     string    `json:"body"`
+	DueAt    time.Time `json:"due_at"`
+}
+
+// RemindersPendingByUserName はusernameが作った、またはusername宛てのまだ知らせていないリマインダーを時刻順に返します
+func RemindersPendingByUserName(db *sql.DB, username string) ([]*Reminder, error) {
+	return queryReminders(db, `select id, username, target, body, due_at from reminder where fired = 0 and (username = ? or target = ?) order by due_at`, username, username)
+}
+
+// RemindersDue はnowまでに知らせるべきでまだ知らせていないリマインダーを時刻順に返します
+func RemindersDue(db *sql.DB, now time.Time) ([]*Reminder, error) {
+	return queryReminders(db, `select id, username, target, body, due_at from reminder where fired = 0 and due_at <= ? order by due_at`, now.Unix())
+}
+
+// queryReminders はqueryの結果をReminderのスライスにして返します
+func queryReminders(db *sql.DB, query string, args ...interface{}) ([]*Reminder, error) {
+	rows, err := on(db).Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rs []*Reminder
+	for rows.Next() {
+		r := &Reminder{}
+		var dueAt int64
+		if err := rows.Scan(&r.ID, &r.UserName, &r.Target, &r.Body, &dueAt); err != nil {
+			return nil, err
+		}
+		r.DueAt = time.Unix(dueAt, 0)
+		rs = append(rs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+// Insert はreminderテーブルに新規データを1件追加します
+func (r *Reminder) Insert(db *sql.DB) (*Reminder, error) {
+	id, err := on(db).Insert(`insert into reminder (username, target, body, due_at) values (?, ?, ?, ?)`, r.UserName, r.Target, r.Body, r.DueAt.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reminder{
+		ID:       id,
+		UserName: r.UserName,
+		Target:   r.Target,
+		Body:     r.Body,
+		DueAt:    r.DueAt,
+	}, nil
+}
+
+// MarkFired はリマインダーを知らせたことを記録します
+func (r *Reminder) MarkFired(db *sql.DB) error {
+	_, err := on(db).Exec(`update reminder set fired = 1 where id = ?`, r.ID)
+	return err
+}
+
+// Cancel はusernameが作った、またはusername宛てのまだ知らせていないリマインダーを削除します
+//
+// 削除できた場合trueを返します
+func (r *Reminder) Cancel(db *sql.DB, username string) (bool, error) {
+	res, err := on(db).Exec(`delete from reminder where id = ? and fired = 0 and (username = ? or target = ?)`, r.ID, username, username)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,253 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 保存期間を過ぎたメッセージのうち、対象にする投稿者です
+const (
+	// RetentionFromAll は全てのメッセージを対象にします
+	RetentionFromAll = ""
+	// RetentionFromBots はbotのメッセージだけを対象にします
+	RetentionFromBots = "bots"
+	// RetentionFromHumans はbot以外のメッセージだけを対象にします
+	RetentionFromHumans = "humans"
+)
+
+// botMessageCondition はbotのメッセージを表す条件です
+//
+// 組み込みのbotは"bot"として、外部のbotは登録した名前で投稿します
+const botMessageCondition = `(username = 'bot' or username in (select name from external_bot))`
+
+// messageCreatedLayout はmessageテーブルのcreatedの形式です
+const messageCreatedLayout = "2006-01-02 15:04:05"
+
+type (
+	// RetentionFilter は保存期間を過ぎたメッセージの条件です
+	//
+	// Channelが空の場合は全てのチャンネル、FromはRetentionFromAllなどのいずれかです
+	// Beforeより前に投稿されたメッセージが対象です
+	RetentionFilter struct {
+		Channel string
+		From    string
+		Before  time.Time
+	}
+
+	// ArchivedMessage はアーカイブに移したメッセージの構造体です
+	//
+	// IDは元のメッセージのIDで、SQLiteは最後のメッセージを削除するとIDを使い回すので重なることがあります
+	// アーカイブの中ではArchiveIDで区別します。Policyはアーカイブに移した保存期間の設定の名前です
+	ArchivedMessage struct {
+		*Message
+		ArchiveID  int64     `json:"archive_id"`
+		CreatedAt  time.Time `json:"created_at"`
+		ArchivedAt time.Time `json:"archived_at"`
+		Policy     string    `json:"policy"`
+	}
+)
+
+// where はfの条件のwhere句と引数を返します
+//
+// createdはタイムゾーンなしで保存されているので、ローカルタイムの文字列にして比べます
+func (f *RetentionFilter) where() (string, []interface{}) {
+	conds := []string{`created < ?`}
+	args := []interface{}{f.Before.In(time.Local).Format(messageCreatedLayout)}
+	if f.Channel != "" {
+		conds = append(conds, `channel = ?`)
+		args = append(args, f.Channel)
+	}
+	switch f.From {
+	case RetentionFromBots:
+		conds = append(conds, botMessageCondition)
+	case RetentionFromHumans:
+		conds = append(conds, `not `+botMessageCondition)
+	}
+	return strings.Join(conds, ` and `), args
+}
+
+// MessagesExpired はfに当てはまるメッセージを古い順にlimit件まで返します
+func MessagesExpired(db *sql.DB, f *RetentionFilter, limit int) ([]*ArchivedMessage, error) {
+	where, args := f.where()
+	rows, err := on(db).Query(`select id, body, username, channel, version, created from message where `+where+` order by id limit ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ms []*ArchivedMessage
+	for rows.Next() {
+		m := &ArchivedMessage{Message: &Message{}}
+		var created string
+		if err := rows.Scan(&m.ID, &m.Body, &m.UserName, &m.Channel, &m.Version, &created); err != nil {
+			return nil, err
+		}
+		if m.CreatedAt, err = parseMessageCreated(created); err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// MessagesExpiredCount はfに当てはまり、excludesのどれにも当てはまらないメッセージの数を返します
+//
+// 先の設定で片付けるメッセージを後の設定で数え直さないように、先の設定の条件をexcludesに渡します
+func MessagesExpiredCount(db *sql.DB, f *RetentionFilter, excludes ...*RetentionFilter) (int64, error) {
+	where, args := f.where()
+	for _, e := range excludes {
+		w, a := e.where()
+		where += ` and not (` + w + `)`
+		args = append(args, a...)
+	}
+	var n int64
+	if err := on(db).QueryRow(`select count(*) from message where `+where, args...).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// MessagesDelete はidsのメッセージを削除し、削除した数を返します
+func MessagesDelete(db *sql.DB, ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	res, err := on(db).Exec(`delete from message where id in (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// parseMessageCreated はドライバーによって違う形式で返るcreatedを時刻にします
+//
+// タイムゾーンがない場合はローカルタイムとして扱います
+func parseMessageCreated(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(messageCreatedLayout, s, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("unknown format of created: " + s)
+	}
+	return t, nil
+}
+
+// archivedMessageColumns はarchived_messageから読み込む列です
+const archivedMessageColumns = `archive_id, id, body, username, channel, version, created_at, archived_at, policy`
+
+// InitArchive はアーカイブのデータベースにテーブルがなければ作ります
+//
+// アーカイブはマイグレーションで管理しない別のSQLiteのファイルです
+func InitArchive(archive *sql.DB) error {
+	tx, err := begin(archive)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{
+		`create table if not exists archived_message (
+    archive_id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    id INTEGER NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL DEFAULT '',
+    channel TEXT NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at INTEGER NOT NULL DEFAULT 0,
+    archived_at INTEGER NOT NULL DEFAULT 0,
+    policy TEXT NOT NULL DEFAULT ''
+)`,
+		`create unique index if not exists archived_message_source on archived_message (id, created_at)`,
+		`create index if not exists archived_message_channel on archived_message (channel, archive_id)`,
+	} {
+		if _, err := tx.Exec(q); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ArchiveMessages はmsをアーカイブに保存します
+//
+// 元のメッセージを削除する前に失敗しても次にやり直せるように、同じIDと投稿時刻のメッセージは飛ばします
+func ArchiveMessages(archive *sql.DB, ms []*ArchivedMessage) error {
+	tx, err := begin(archive)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, m := range ms {
+		if _, err := tx.Exec(`insert or ignore into archived_message (id, body, username, channel, version, created_at, archived_at, policy) values (?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.ID, m.Body, m.UserName, m.Channel, m.Version, m.CreatedAt.Unix(), m.ArchivedAt.Unix(), m.Policy); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ArchivedMessages はアーカイブのメッセージをアーカイブした新しい順にlimit件まで返します
+//
+// channelが空でない場合はそのチャンネルだけ、beforeIDが0より大きい場合はArchiveIDがそれより小さいメッセージだけを返します
+func ArchivedMessages(archive *sql.DB, channel string, beforeID int64, limit int) ([]*ArchivedMessage, error) {
+	conds := []string{`1 = 1`}
+	var args []interface{}
+	if channel != "" {
+		conds = append(conds, `channel = ?`)
+		args = append(args, channel)
+	}
+	if beforeID > 0 {
+		conds = append(conds, `archive_id < ?`)
+		args = append(args, beforeID)
+	}
+	rows, err := on(archive).Query(`select `+archivedMessageColumns+` from archived_message where `+strings.Join(conds, ` and `)+` order by archive_id desc limit ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := []*ArchivedMessage{}
+	for rows.Next() {
+		m, err := scanArchivedMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// ArchivedMessageByID はアーカイブのArchiveIDがidのメッセージを返します。ない場合はsql.ErrNoRowsを返します
+func ArchivedMessageByID(archive *sql.DB, id int64) (*ArchivedMessage, error) {
+	row := on(archive).QueryRow(`select `+archivedMessageColumns+` from archived_message where archive_id = ?`, id)
+	return scanArchivedMessage(row)
+}
+
+// scanArchivedMessage はarchived_messageの1行を読み込みます
+func scanArchivedMessage(row interface {
+	Scan(dest ...interface{}) error
+}) (*ArchivedMessage, error) {
+	m := &ArchivedMessage{Message: &Message{}}
+	var createdAt, archivedAt int64
+	if err := row.Scan(&m.ArchiveID, &m.ID, &m.Body, &m.UserName, &m.Channel, &m.Version, &createdAt, &archivedAt, &m.Policy); err != nil {
+		return nil, err
+	}
+	m.CreatedAt = time.Unix(createdAt, 0)
+	m.ArchivedAt = time.Unix(archivedAt, 0)
+	return m, nil
+}
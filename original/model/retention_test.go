@@ -0,0 +1,43 @@
+package model
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestInitArchiveはアーカイブのテーブルを作る(t *testing.T) {
+	archive, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer archive.Close()
+	archive.SetMaxOpenConns(1)
+
+	// 2回目は何もしません
+	for i := 0; i < 2; i++ {
+		if err := InitArchive(archive); err != nil {
+			t.Fatalf("failed to init archive: %s", err)
+		}
+	}
+
+	// 同じIDでも投稿時刻が違えば別のメッセージとして、同じ投稿時刻なら1回だけ保存します
+	created := time.Unix(100, 0)
+	for _, m := range []*ArchivedMessage{
+		{Message: &Message{ID: 7, Body: "old"}, CreatedAt: created},
+		{Message: &Message{ID: 7, Body: "old"}, CreatedAt: created},
+		{Message: &Message{ID: 7, Body: "new"}, CreatedAt: created.Add(time.Hour)},
+	} {
+		if err := ArchiveMessages(archive, []*ArchivedMessage{m}); err != nil {
+			t.Fatalf("failed to archive: %s", err)
+		}
+	}
+
+	ms, err := ArchivedMessages(archive, "", 0, 10)
+	if err != nil || len(ms) != 2 {
+		t.Fatalf("2 archived messages expected but not, actual %v %v", ms, err)
+	}
+	if ms[1].Body != "old" || ms[0].Body != "new" || ms[0].ArchiveID <= ms[1].ArchiveID {
+		t.Fatalf("messages in archived order expected but not, actual %+v %+v", ms[1], ms[0])
+	}
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ScheduledRun はスケジュールされたbotが最後に実行された時刻の記録です
+type ScheduledRun struct {
+	Name    string
+	LastRun time.Time
+}
+
+// ScheduledRunByName は指定された名前の記録を返します。記録がない場合はsql.ErrNoRowsを返します
+func ScheduledRunByName(db *sql.DB, name string) (*ScheduledRun, error) {
+	var lastRun int64
+	if err := on(db).QueryRow(`select last_run from scheduled_run where name = ?`, name).Scan(&lastRun); err != nil {
+		return nil, err
+	}
+
+	return &ScheduledRun{
+		Name:    name,
+		LastRun: time.Unix(lastRun, 0),
+	}, nil
+}
+
+// Save は記録を追加、または既にある場合は更新します
+func (r *ScheduledRun) Save(db *sql.DB) error {
+	c := on(db)
+	_, err := c.Exec(c.upsert("scheduled_run", []string{"name"}, "name", "last_run"), r.Name, r.LastRun.Unix())
+	return err
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"database/sql"
+)
+
+// SlashCommand は"/command text"のメッセージをSlack互換の形式でURLにPOSTするコマンドの構造体です
+//
+// Commandは"/"を含まない名前です。Tokenは送信元を確かめるためにリクエストに含めます
+type SlashCommand struct {
+	ID      int64  `json:"id"`
+	Command string `json:"command"`
+	URL     string `json:"url"`
+	Token   string `json:"token,omitempty"`
+}
+
+// SlashCommandsAll は全てのコマンドを返します
+func SlashCommandsAll(db *sql.DB) ([]*SlashCommand, error) {
+	rows, err := on(db).Query(`select id, command, url, token from slash_command order by command`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cs []*SlashCommand
+	for rows.Next() {
+		c := &SlashCommand{}
+		if err := rows.Scan(&c.ID, &c.Command, &c.URL, &c.Token); err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+// SlashCommandByCommand は指定された名前のコマンドを返します
+func SlashCommandByCommand(db *sql.DB, command string) (*SlashCommand, error) {
+	c := &SlashCommand{}
+	if err := on(db).QueryRow(`select id, command, url, token from slash_command where command = ?`, command).Scan(&c.ID, &c.Command, &c.URL, &c.Token); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Insert はコマンドを追加します
+func (c *SlashCommand) Insert(db *sql.DB) (*SlashCommand, error) {
+	id, err := on(db).Insert(`insert into slash_command (command, url, token) values (?, ?, ?)`, c.Command, c.URL, c.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SlashCommand{
+		ID:      id,
+		Command: c.Command,
+		URL:     c.URL,
+		Token:   c.Token,
+	}, nil
+}
+
+// Delete はコマンドを削除します。なかった場合はsql.ErrNoRowsを返します
+func (c *SlashCommand) Delete(db *sql.DB) error {
+	res, err := on(db).Exec(`delete from slash_command where id = ?`, c.ID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
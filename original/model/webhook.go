@@ -0,0 +1,243 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	// DeliveryPending は配送中か、再送を待っていることを表します
+	DeliveryPending = "pending"
+	// DeliverySucceeded は配送に成功したことを表します
+	DeliverySucceeded = "succeeded"
+	// DeliveryFailed は再送しても配送できなかったことを表します
+	DeliveryFailed = "failed"
+)
+
+type (
+	// OutgoingWebhook はPatternにマッチしたメッセージをURLにPOSTするwebhookの構造体です
+	//
+	// Channelが空でない場合はそのチャンネルのメッセージだけを送ります。Secretは署名に使います
+	OutgoingWebhook struct {
+		ID      int64  `json:"id"`
+		Name    string `json:"name"`
+		Pattern string `json:"pattern"`
+		URL     string `json:"url"`
+		Secret  string `json:"secret,omitempty"`
+		Channel string `json:"channel"`
+	}
+
+	// IncomingWebhook はTokenを含むURLへのPOSTをメッセージとして投稿するwebhookの構造体です
+	//
+	// Channelが空でない場合はそのチャンネルに投稿します
+	IncomingWebhook struct {
+		ID      int64  `json:"id"`
+		Name    string `json:"name"`
+		Token   string `json:"token,omitempty"`
+		Channel string `json:"channel"`
+	}
+
+	// WebhookDelivery はwebhookにメッセージを送った記録の構造体です
+	WebhookDelivery struct {
+		ID         int64     `json:"id"`
+		WebhookID  int64     `json:"webhook_id"`
+		MessageID  int64     `json:"message_id"`
+		Status     string    `json:"status"`
+		Attempts   int       `json:"attempts"`
+		StatusCode int       `json:"status_code"`
+		Error      string    `json:"error"`
+		UpdatedAt  time.Time `json:"updated_at"`
+	}
+)
+
+// OutgoingWebhooksAll は全てのwebhookを返します
+func OutgoingWebhooksAll(db *sql.DB) ([]*OutgoingWebhook, error) {
+	rows, err := on(db).Query(`select id, name, pattern, url, secret, channel from outgoing_webhook order by id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ws []*OutgoingWebhook
+	for rows.Next() {
+		w := &OutgoingWebhook{}
+		if err := rows.Scan(&w.ID, &w.Name, &w.Pattern, &w.URL, &w.Secret, &w.Channel); err != nil {
+			return nil, err
+		}
+		ws = append(ws, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// OutgoingWebhookByID は指定されたIDのwebhookを返します
+func OutgoingWebhookByID(db *sql.DB, id int64) (*OutgoingWebhook, error) {
+	w := &OutgoingWebhook{}
+	if err := on(db).QueryRow(`select id, name, pattern, url, secret, channel from outgoing_webhook where id = ?`, id).Scan(&w.ID, &w.Name, &w.Pattern, &w.URL, &w.Secret, &w.Channel); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Insert はwebhookを追加します
+func (w *OutgoingWebhook) Insert(db *sql.DB) (*OutgoingWebhook, error) {
+	id, err := on(db).Insert(`insert into outgoing_webhook (name, pattern, url, secret, channel) values (?, ?, ?, ?, ?)`, w.Name, w.Pattern, w.URL, w.Secret, w.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OutgoingWebhook{
+		ID:      id,
+		Name:    w.Name,
+		Pattern: w.Pattern,
+		URL:     w.URL,
+		Secret:  w.Secret,
+		Channel: w.Channel,
+	}, nil
+}
+
+// Delete はwebhookと配送の記録を削除します。webhookがなかった場合はsql.ErrNoRowsを返します
+func (w *OutgoingWebhook) Delete(db *sql.DB) error {
+	tx, err := begin(db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`delete from outgoing_webhook where id = ?`, w.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec(`delete from webhook_delivery where webhook_id = ?`, w.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// WebhookDeliveriesByWebhookID はwebhookの配送の記録を新しい順にlimit件返します
+func WebhookDeliveriesByWebhookID(db *sql.DB, webhookID int64, limit int) ([]*WebhookDelivery, error) {
+	rows, err := on(db).Query(`select id, webhook_id, message_id, status, attempts, status_code, error, updated_at from webhook_delivery where webhook_id = ? order by id desc limit ?`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// WebhookDeliveriesPending は配送中か再送を待っている配送の記録を古い順に返します
+func WebhookDeliveriesPending(db *sql.DB) ([]*WebhookDelivery, error) {
+	rows, err := on(db).Query(`select id, webhook_id, message_id, status, attempts, status_code, error, updated_at from webhook_delivery where status = ? order by id`, DeliveryPending)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// scanWebhookDeliveries はrowsから配送の記録を読み込み、rowsを閉じます
+func scanWebhookDeliveries(rows *sql.Rows) ([]*WebhookDelivery, error) {
+	defer rows.Close()
+
+	var ds []*WebhookDelivery
+	for rows.Next() {
+		d := &WebhookDelivery{}
+		var updatedAt int64
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.MessageID, &d.Status, &d.Attempts, &d.StatusCode, &d.Error, &updatedAt); err != nil {
+			return nil, err
+		}
+		d.UpdatedAt = time.Unix(updatedAt, 0)
+		ds = append(ds, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+// Insert は配送の記録を追加します
+func (d *WebhookDelivery) Insert(db *sql.DB) (*WebhookDelivery, error) {
+	id, err := on(db).Insert(`insert into webhook_delivery (webhook_id, message_id, status, attempts, status_code, error, updated_at) values (?, ?, ?, ?, ?, ?, ?)`, d.WebhookID, d.MessageID, d.Status, d.Attempts, d.StatusCode, d.Error, d.UpdatedAt.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	inserted := *d
+	inserted.ID = id
+	return &inserted, nil
+}
+
+// Update は配送の状態、試行回数、最後の結果を更新します
+func (d *WebhookDelivery) Update(db *sql.DB) error {
+	_, err := on(db).Exec(`update webhook_delivery set status = ?, attempts = ?, status_code = ?, error = ?, updated_at = ? where id = ?`, d.Status, d.Attempts, d.StatusCode, d.Error, d.UpdatedAt.Unix(), d.ID)
+	return err
+}
+
+// IncomingWebhooksAll は全てのincoming webhookを返します
+func IncomingWebhooksAll(db *sql.DB) ([]*IncomingWebhook, error) {
+	rows, err := on(db).Query(`select id, name, token, channel from incoming_webhook order by id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ws []*IncomingWebhook
+	for rows.Next() {
+		w := &IncomingWebhook{}
+		if err := rows.Scan(&w.ID, &w.Name, &w.Token, &w.Channel); err != nil {
+			return nil, err
+		}
+		ws = append(ws, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// IncomingWebhookByToken は指定されたtokenのincoming webhookを返します
+func IncomingWebhookByToken(db *sql.DB, token string) (*IncomingWebhook, error) {
+	w := &IncomingWebhook{}
+	if err := on(db).QueryRow(`select id, name, token, channel from incoming_webhook where token = ?`, token).Scan(&w.ID, &w.Name, &w.Token, &w.Channel); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Insert はincoming webhookを追加します
+func (w *IncomingWebhook) Insert(db *sql.DB) (*IncomingWebhook, error) {
+	id, err := on(db).Insert(`insert into incoming_webhook (name, token, channel) values (?, ?, ?)`, w.Name, w.Token, w.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IncomingWebhook{
+		ID:      id,
+		Name:    w.Name,
+		Token:   w.Token,
+		Channel: w.Channel,
+	}, nil
+}
+
+// Delete はincoming webhookを削除します。なかった場合はsql.ErrNoRowsを返します
+func (w *IncomingWebhook) Delete(db *sql.DB) error {
+	res, err := on(db).Exec(`delete from incoming_webhook where id = ?`, w.ID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
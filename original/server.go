@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/bot"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/config"
 	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/controller"
 	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/db"
 	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
 	"github.com/gin-gonic/gin"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -23,35 +31,55 @@ type Server struct {
 	multicaster *bot.Multicaster
 	poster      *bot.Poster
 	bots        []*bot.Bot
+	scheduler   *bot.Scheduler
+	webhooks    *bot.WebhookDispatcher
+	scripts     *bot.ScriptHost
+	snapshots   *db.Snapshots
+	archive     *sql.DB
+	config      *config.Config
 }
 
-// NewServer は新しいServerの構造体のポインタを返します
-func NewServer() *Server {
+// NewServer はcの設定で新しいServerの構造体のポインタを返します
+func NewServer(c *config.Config) *Server {
+	if c.HTTP.Mode != "" {
+		gin.SetMode(c.HTTP.Mode)
+	}
+	engine := gin.New()
+	if c.Logging.AccessLog {
+		engine.Use(gin.Logger())
+	}
+	engine.Use(gin.Recovery())
+
 	return &Server{
-		Engine: gin.Default(),
+		Engine: engine,
+		config: c,
 	}
 }
 
 // Init はサーバーを初期化します
-func (s *Server) Init(dbconf, env string) error {
-	cs, err := db.NewConfigsFromFile(dbconf)
+func (s *Server) Init() error {
+	cs, err := db.NewConfigsFromFile(s.config.Database.Config)
 	if err != nil {
 		return err
 	}
 
-	db, err := cs.Open(env)
+	dbc, err := cs.Get(s.config.Database.Env)
+	if err != nil {
+		return err
+	}
+	db, err := dbc.Open()
 	if err != nil {
 		return err
 	}
 	s.db = db
 
 	// routing
-	s.Engine.LoadHTMLGlob("./templates/*")
+	s.Engine.LoadHTMLGlob(s.config.HTTP.Templates)
 
 	s.Engine.GET("/", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "index.html", gin.H{})
 	})
-	s.Engine.Static("/assets", "./assets")
+	s.Engine.Static("/assets", s.config.HTTP.Assets)
 
 	// tutorial. 自己紹介を追加する
 	// ...
@@ -62,42 +90,241 @@ func (s *Server) Init(dbconf, env string) error {
 		c.String(http.StatusOK, "pong")
 	})
 
+	// botのPosterの投稿を人の投稿と見分けるtokenは、起動するたびに作り直します
+	posterToken, err := newPosterToken()
+	if err != nil {
+		return err
+	}
 	msgStream := make(chan *model.Message)
-	mctr := &controller.Message{DB: db, Stream: msgStream}
+	msgs := model.NewSQLMessageStore(db)
+	mctr := &controller.Message{Messages: msgs, Stream: msgStream, PosterToken: posterToken}
 	api.GET("/messages", mctr.All)
 	api.GET("/messages/:id", mctr.GetByID)
 	api.POST("/messages", mctr.Create)
 	api.PUT("/messages/:id", mctr.UpdateByID)
 	api.DELETE("/messages/:id", mctr.DeleteByID)
 
+	kctr := &controller.Karma{DB: db}
+	api.GET("/karma", kctr.Top)
+	api.GET("/karma/:username", kctr.GetByUserName)
+
+	// admin
+	// auth.admin_tokenが設定されていない場合、管理用のAPIは無効です
+	admin := api.Group("/admin", controller.AdminAuth(s.config.Auth.AdminToken))
+	wctr := &controller.Webhook{DB: db, Messages: msgs, Stream: msgStream}
+	admin.GET("/webhooks/outgoing", wctr.OutgoingAll)
+	admin.POST("/webhooks/outgoing", wctr.CreateOutgoing)
+	admin.DELETE("/webhooks/outgoing/:id", wctr.DeleteOutgoing)
+	admin.GET("/webhooks/outgoing/:id/deliveries", wctr.OutgoingDeliveries)
+	admin.GET("/webhooks/incoming", wctr.IncomingAll)
+	admin.POST("/webhooks/incoming", wctr.CreateIncoming)
+	admin.DELETE("/webhooks/incoming/:id", wctr.DeleteIncoming)
+
+	sctr := &controller.SlashCommand{DB: db}
+	admin.GET("/slash_commands", sctr.All)
+	admin.POST("/slash_commands", sctr.Create)
+	admin.DELETE("/slash_commands/:id", sctr.DeleteByID)
+
+	// 履歴のエクスポートとインポート。別のサーバーへの移行やバックアップに使います
+	actr := &controller.Archive{DB: db}
+	admin.GET("/export", actr.Export)
+	admin.POST("/import", actr.Import)
+
+	// スナップショットはSQLiteの場合だけ作れます
+	if backup := s.config.Database.Backup; backup.Dir != "" {
+		snapshots, err := dbc.Snapshots(backup.Dir, backup.Keep, backup.MaxAge)
+		if err != nil {
+			log.Printf("backup is disabled: %s\n", err)
+		} else {
+			s.snapshots = snapshots
+			bctr := &controller.Backup{Snapshots: snapshots}
+			admin.GET("/backups", bctr.All)
+			admin.POST("/backup", bctr.Create)
+		}
+	}
+
+	// incoming webhookはURLのtokenで認証します
+	api.POST("/hooks/:token", wctr.PostIncoming)
+
+	// Slack互換のWeb API。SlackのライブラリのベースURLを"http://<host>/slack/api/"にすると使えます
+	sapi := &controller.SlackAPI{DB: db, Messages: msgs, Stream: msgStream}
+	slack := s.Engine.Group("/slack/api", sapi.Auth())
+	slack.Any("/auth.test", sapi.AuthTest)
+	slack.POST("/chat.postMessage", sapi.PostMessage)
+	slack.POST("/chat.update", sapi.Update)
+	slack.POST("/chat.delete", sapi.Delete)
+	slack.Any("/conversations.history", sapi.History)
+
 	// bot
 	mc := bot.NewMulticaster(msgStream)
 	s.multicaster = mc
 
-	poster := bot.NewPoster(10)
+	poster := bot.NewPoster(s.config.Limits.PosterBuffer, posterToken)
 	s.poster = poster
 
-	helloWorldBot := bot.NewHelloWorldBot(s.poster.In)
-	s.bots = append(s.bots, helloWorldBot)
-	omikujiBot := bot.NewOmikujiBot(s.poster.In)
-	s.bots = append(s.bots, omikujiBot)
-	keywordBot := bot.NewKeywordBot(s.poster.In)
-	s.bots = append(s.bots, keywordBot)
-	gachaBot := bot.NewGachaBot(s.poster.In)
-	s.bots = append(s.bots, gachaBot)
-	talkBot := bot.NewTalkBot(s.poster.In)
-	s.bots = append(s.bots, talkBot)
+	omikujiTable, err := loadOmikujiTable(s.config.Bots.OmikujiTable)
+	if err != nil {
+		return err
+	}
+	// タイムゾーンはスケジュールされたbotやリマインダーの時刻を解釈するのに使います
+	loc, err := time.LoadLocation(s.config.Bots.Timezone)
+	if err != nil {
+		return err
+	}
+	s.webhooks = bot.NewWebhookDispatcher(s.db, s.poster.In)
+	router := bot.NewCommandRouter(
+		bot.NewOmikujiCommand(s.db, omikujiTable),
+		bot.NewGachaCommand(),
+	)
+	router.SetFallback(bot.NewSlashCommandDispatcher(s.db))
+
+	// bots.enabledで選んだbotだけを動かします
+	bots := []*bot.Bot{
+		bot.NewHelloWorldBot(s.poster.In),
+		bot.NewOmikujiBot(s.poster.In, s.db, omikujiTable),
+		bot.NewKeywordBot(s.poster.In, s.config.Bots.KeywordAPIAppID),
+		bot.NewGachaBot(s.poster.In),
+		bot.NewTalkBot(s.poster.In, s.config.Bots.TalkAPIKey),
+		bot.NewReminderBot(s.poster.In, s.db, loc),
+		bot.NewPollBot(s.poster.In, s.db, loc, msgs, msgStream),
+		bot.NewQuizBot(s.poster.In, s.db),
+		bot.NewKarmaBot(s.poster.In, s.db),
+		bot.NewDiceBot(s.poster.In),
+		bot.NewWebhookBot(s.poster.In, s.webhooks),
+		bot.NewCommandBot(s.poster.In, router),
+	}
+	scheduledBots := []*bot.ScheduledBot{
+		bot.NewStandupBot(loc),
+		bot.NewDailyOmikujiBot(omikujiTable, loc),
+	}
+	known := map[string]bool{}
+	for _, b := range bots {
+		known[b.Name()] = true
+		if s.config.BotEnabled(b.Name()) {
+			s.bots = append(s.bots, b)
+		}
+	}
+	for _, b := range scheduledBots {
+		known[b.Name()] = true
+	}
+	for _, name := range s.config.Bots.Enabled {
+		if !known[name] {
+			return fmt.Errorf("unknown bot in bots.enabled: %s", name)
+		}
+	}
+
+	// 外部のbotはWebSocketで接続し、接続している間だけMulticasterに登録されます
+	hub := bot.NewExternalBotHub(msgs, mc, s.poster.In)
+	ectr := &controller.ExternalBot{DB: db, Hub: hub}
+	api.GET("/bots/connect", ectr.Connect)
+	admin.GET("/bots", ectr.All)
+	admin.POST("/bots", ectr.Create)
+	admin.DELETE("/bots/:id", ectr.DeleteByID)
+
+	// スクリプトのbotは管理用のAPIでアップロードするとすぐに登録されます
+	s.scripts = bot.NewScriptHost(s.db, mc, s.poster.In)
+	scctr := &controller.Script{DB: db, Host: s.scripts}
+	admin.GET("/scripts", scctr.All)
+	admin.GET("/scripts/:name", scctr.GetByName)
+	admin.PUT("/scripts/:name", scctr.Save)
+	admin.DELETE("/scripts/:name", scctr.DeleteByName)
+
+	// scheduled bot
+	// リマインダーや投票の締め切りなど、他の機能を支えるものはbots.enabledに関わらず動かします
+	s.scheduler = bot.NewScheduler(s.db, s.poster.In)
+	for _, b := range scheduledBots {
+		if s.config.BotEnabled(b.Name()) {
+			s.scheduler.Add(b)
+		}
+	}
+	s.scheduler.Add(
+		bot.NewReminderDispatchBot(s.db),
+		bot.NewPollCloseBot(s.db, loc),
+		bot.NewKVExpireBot(s.db),
+		bot.NewConversationExpireBot(s.db),
+	)
+
+	// 保存期間の設定がある場合だけ、古いメッセージを片付けます
+	rc, err := loadRetentionConfig(s.config.Database.Retention)
+	if err != nil {
+		return err
+	}
+	if rc != nil {
+		if rc.Archive != "" {
+			archive, err := openArchive(rc.Archive)
+			if err != nil {
+				return err
+			}
+			s.archive = archive
+			if err := model.InitArchive(archive); err != nil {
+				return err
+			}
+			// アーカイブしたメッセージは読むことだけできます
+			amctr := &controller.ArchivedMessage{Archive: archive}
+			api.GET("/archive/messages", amctr.All)
+			api.GET("/archive/messages/:id", amctr.GetByID)
+		}
+		retention := bot.NewRetention(s.db, s.archive, rc.Policies)
+		rctr := &controller.Retention{Retention: retention}
+		admin.GET("/retention", rctr.Report)
+		admin.POST("/retention", rctr.Run)
+		s.scheduler.Add(bot.NewRetentionBot(retention, bot.MustParseSchedule(rc.Schedule), loc))
+	}
 
 	return nil
 }
 
+// newPosterToken はランダムな32バイトを16進数にした、Posterのtokenを返します
+func newPosterToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// loadOmikujiTable はpathのおみくじの表を読み込みます。ファイルがない場合はbot.DefaultOmikujiTableを返します
+func loadOmikujiTable(path string) (*bot.OmikujiTable, error) {
+	t, err := bot.NewOmikujiTableFromFile(path)
+	if os.IsNotExist(err) {
+		return bot.DefaultOmikujiTable, nil
+	}
+	return t, err
+}
+
+// loadRetentionConfig はpathの保存期間の設定を読み込みます。ファイルがない場合はnilを返します
+func loadRetentionConfig(path string) (*bot.RetentionConfig, error) {
+	c, err := bot.NewRetentionConfigFromFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return c, err
+}
+
+// openArchive はpathのSQLiteのファイルをアーカイブのデータベースとして開きます
+//
+// 保存期間のbotの書き込みとAPIの読み込みが重なるので、WALにしてbusy_timeoutの間はロックが外れるのを待ちます
+func openArchive(path string) (*sql.DB, error) {
+	c := &db.Config{
+		Dialect:     db.DialectSQLite3,
+		Datasource:  path,
+		JournalMode: "wal",
+		BusyTimeout: 5 * time.Second,
+	}
+	return c.Open()
+}
+
 // Close はDBとの接続を閉じてサーバーを終了します
 func (s *Server) Close() error {
+	if s.archive != nil {
+		s.archive.Close()
+	}
 	return s.db.Close()
 }
 
 // Run はサーバーを起動します
-func (s *Server) Run(port string) {
+func (s *Server) Run() {
+	port := s.config.HTTP.Port
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -105,27 +332,272 @@ func (s *Server) Run(port string) {
 	go s.multicaster.Run(ctx)
 	go s.poster.Run(ctx, fmt.Sprintf("http://0.0.0.0:%s", port))
 
+	// 前回の終了時に配送中だったwebhookは、botが新しい配送を始める前に読み込みます
+	if err := s.webhooks.Resume(ctx); err != nil {
+		log.Printf("failed to resume webhook deliveries: %s\n", err)
+	}
 	for _, b := range s.bots {
 		go b.Run(ctx)
 		s.multicaster.BotIn <- b
 	}
+	go s.scheduler.Run(ctx)
+	go s.webhooks.Run(ctx)
+	if interval := s.config.Database.Backup.Interval; s.snapshots != nil && interval > 0 {
+		go s.snapshots.Run(ctx, interval)
+	}
+	if err := s.scripts.Start(ctx); err != nil {
+		log.Printf("failed to load scripts: %s\n", err)
+	}
 
 	s.Engine.Run(fmt.Sprintf(":%s", port))
 }
 
+// migrate はenvのデータベースにバイナリに埋め込まれたマイグレーションをmodeに従って実行し、結果をwに書きます
+//
+// modeはup、down、statusのいずれかです。dryRunがtrueの場合はup、downで実行するはずのSQLを書くだけで実行しません
+func migrate(dbconf, env, mode string, steps int, dryRun bool, w io.Writer) error {
+	if mode != "up" && mode != "down" && mode != "status" {
+		return fmt.Errorf("unknown migrate mode: %s", mode)
+	}
+
+	cs, err := db.NewConfigsFromFile(dbconf)
+	if err != nil {
+		return err
+	}
+	config, err := cs.Get(env)
+	if err != nil {
+		return err
+	}
+	conn, err := config.Open()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	m, err := config.Migrator(conn)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if mode == "status" {
+		ss, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range ss {
+			appliedAt := "pending"
+			if st.Applied {
+				appliedAt = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%-45s %s\n", st.ID, appliedAt)
+		}
+		return nil
+	}
+
+	var ms []*db.Migration
+	if mode == "up" {
+		ms, err = m.Up(ctx, dryRun)
+	} else {
+		ms, err = m.Down(ctx, steps, dryRun)
+	}
+	if err != nil {
+		return err
+	}
+	if len(ms) == 0 {
+		fmt.Fprintln(w, "no migrations to run")
+	}
+	for _, mg := range ms {
+		if !dryRun {
+			fmt.Fprintf(w, "%s %s\n", mode, mg.ID)
+			continue
+		}
+		stmts := mg.Up
+		if mode == "down" {
+			stmts = mg.Down
+		}
+		fmt.Fprintf(w, "-- %s %s\n", mode, mg.ID)
+		for _, stmt := range stmts {
+			fmt.Fprintln(w, stmt)
+		}
+	}
+	return nil
+}
+
+// restore はenvのデータベースをdirにあるnameのスナップショットで置き換え、結果をwに書きます
+//
+// nameがlatestの場合は一番新しいスナップショットを使います
+func restore(dbconf, env, dir, name string, w io.Writer) error {
+	cs, err := db.NewConfigsFromFile(dbconf)
+	if err != nil {
+		return err
+	}
+	config, err := cs.Get(env)
+	if err != nil {
+		return err
+	}
+	snapshots, err := config.Snapshots(dir, 0, 0)
+	if err != nil {
+		return err
+	}
+	snapshot, err := snapshots.Restore(name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "restored %s\n", snapshot.Name)
+	return nil
+}
+
+// validateMigrateFlags はマイグレーションのフラグの値が正しいか確かめ、間違いを全てまとめて返します
+func validateMigrateFlags(migrateMode string, migrateSteps int) error {
+	var errs config.Errors
+	switch migrateMode {
+	case "", "up", "down", "status":
+	default:
+		errs = append(errs, fmt.Errorf("migrate must be up, down or status: %q", migrateMode))
+	}
+	if migrateSteps < 1 {
+		errs = append(errs, fmt.Errorf("migrate-steps must be positive: %d", migrateSteps))
+	}
+	return errs.Err()
+}
+
+// loadConfig はpathの設定ファイルを読み込みます。requiredでない場合、ファイルがなければデフォルトの設定を返します
+func loadConfig(path string, required bool) (*config.Config, error) {
+	c, err := config.NewConfigFromFile(path)
+	if os.IsNotExist(err) && !required {
+		return config.Default(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return c, nil
+}
+
+// overrideConfig はコマンドラインか環境変数で指定されたフラグの値でcを上書きします
+func overrideConfig(c *config.Config, fs *flag.FlagSet) {
+	fs.Visit(func(f *flag.Flag) {
+		g := f.Value.(flag.Getter).Get()
+		switch f.Name {
+		case "port":
+			c.HTTP.Port = g.(string)
+		case "dbconf":
+			c.Database.Config = g.(string)
+		case "env":
+			c.Database.Env = g.(string)
+		case "backup-dir":
+			c.Database.Backup.Dir = g.(string)
+		case "backup-interval":
+			c.Database.Backup.Interval = g.(time.Duration)
+		case "backup-keep":
+			c.Database.Backup.Keep = g.(int)
+		case "backup-max-age":
+			c.Database.Backup.MaxAge = g.(time.Duration)
+		case "admin-token":
+			c.Auth.AdminToken = g.(string)
+		case "keyword-api-app-id":
+			c.Bots.KeywordAPIAppID = g.(string)
+		case "talk-api-key":
+			c.Bots.TalkAPIKey = g.(string)
+		}
+	})
+}
+
 func main() {
+	// フラグのデフォルトはconfig.ymlがない場合の値です。指定したフラグだけがconfig.ymlの値を上書きします
+	d := config.Default()
 	var (
-		dbconf = flag.String("dbconf", "dbconfig.yml", "database configuration file.")
-		env    = flag.String("env", "development", "application envirionment (production, development etc.)")
-		port   = flag.String("port", "8080", "listening port.")
+		configFile  = flag.String("config", "config.yml", "configuration file. the defaults are used if the default file does not exist.")
+		printConfig = flag.Bool("print-config", false, "print the effective configuration merged from the defaults, -config, environment variables and flags, then exit.")
+
+		_ = flag.String("dbconf", d.Database.Config, "database configuration file.")
+		_ = flag.String("env", d.Database.Env, "application envirionment (production, development etc.)")
+		_ = flag.String("port", d.HTTP.Port, "listening port.")
+
+		migrateMode  = flag.String("migrate", "", "migrate the database before starting the server (up, down, status). only up starts the server after migration.")
+		migrateSteps = flag.Int("migrate-steps", 1, "number of migrations to roll back with -migrate=down.")
+		dryRun       = flag.Bool("dryrun", false, "print the migrations to run with -migrate and exit without running them.")
+
+		_           = flag.String("backup-dir", d.Database.Backup.Dir, "directory to write snapshots of the sqlite3 database. empty disables backup.")
+		_           = flag.Duration("backup-interval", d.Database.Backup.Interval, "interval of scheduled snapshots. 0 disables scheduled snapshots.")
+		_           = flag.Int("backup-keep", d.Database.Backup.Keep, "number of snapshots to keep. 0 keeps all.")
+		_           = flag.Duration("backup-max-age", d.Database.Backup.MaxAge, "snapshots older than this are removed. 0 keeps all.")
+		restoreFrom = flag.String("restore", "", "replace the database with the snapshot in the backup directory before starting the server (file name or latest).")
+
+		// 秘密の値はプロセスの一覧に出ないように、フラグではなく環境変数で渡してください
+		_ = flag.String("admin-token", "", "token for the admin API. the admin API is disabled if empty. defaults to ADMIN_TOKEN.")
+		_ = flag.String("keyword-api-app-id", "", "application id of the Yahoo! keyphrase API used by keywordbot.")
+		_ = flag.String("talk-api-key", "", "api key of the A3RT Talk API used by talkbot.")
 	)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nevery flag can also be set by the environment variable %s<FLAG>, e.g. %s for -backup-dir.\n", config.EnvPrefix, config.EnvName("backup-dir"))
+		fmt.Fprintf(os.Stderr, "settings are merged in the order of the defaults, -config, environment variables and flags on the command line.\n")
+	}
 	flag.Parse()
 
-	s := NewServer()
-	if err := s.Init(*dbconf, *env); err != nil {
+	// 設定ファイル、環境変数とフラグの間違いはまとめて知らせます
+	var errs config.Errors
+	if err := config.ApplyEnv(flag.CommandLine, os.LookupEnv); err != nil {
+		errs = append(errs, err)
+	}
+	configSet := false
+	flag.Visit(func(f *flag.Flag) {
+		configSet = configSet || f.Name == "config"
+	})
+	c, err := loadConfig(*configFile, configSet)
+	if err != nil {
+		log.Fatalf("invalid configuration:\n%s", err)
+	}
+	overrideConfig(c, flag.CommandLine)
+	if c.Auth.AdminToken == "" {
+		c.Auth.AdminToken = os.Getenv("ADMIN_TOKEN")
+	}
+	if err := c.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateMigrateFlags(*migrateMode, *migrateSteps); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errs.Err(); err != nil {
+		log.Fatalf("invalid configuration:\n%s", err)
+	}
+
+	if *printConfig {
+		if err := c.Print(os.Stdout); err != nil {
+			log.Fatalf("fail to print config: %s", err)
+		}
+		return
+	}
+
+	w, err := c.LogWriter()
+	if err != nil {
+		log.Fatalf("fail to open log: %s", err)
+	}
+	log.SetOutput(w)
+	gin.DefaultWriter = w
+	gin.DefaultErrorWriter = w
+
+	if *restoreFrom != "" {
+		if err := restore(c.Database.Config, c.Database.Env, c.Database.Backup.Dir, *restoreFrom, os.Stdout); err != nil {
+			log.Fatalf("fail to restore: %s", err)
+		}
+	}
+
+	if *migrateMode != "" {
+		if err := migrate(c.Database.Config, c.Database.Env, *migrateMode, *migrateSteps, *dryRun, os.Stdout); err != nil {
+			log.Fatalf("fail to migrate: %s", err)
+		}
+		if *migrateMode != "up" || *dryRun {
+			return
+		}
+	}
+
+	s := NewServer(c)
+	if err := s.Init(); err != nil {
 		log.Fatalf("fail to init server: %s", err)
 	}
 	defer s.Close()
 
-	s.Run(*port)
+	s.Run()
 }
@@ -9,14 +9,22 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/config"
+	"github.com/VG-Tech-Dojo/vg-1day-2018-04-22/original/model"
 )
 
 const (
 	dbconf = "dbconfig.yml"
 	env    = "test"
 	port   = "50000"
+	// dbfile はdbconfig.ymlのtest環境のデータベースのファイルです
+	dbfile = "test.db"
 )
 
+// fixtures はテストの前に投稿しておくメッセージです。idは1から順に振られます
+var fixtures = []string{"hoge", "fuga", "piyo"}
+
 var tsURL = "http://localhost:" + port
 
 func TestMain(m *testing.M) {
@@ -24,16 +32,57 @@ func TestMain(m *testing.M) {
 }
 
 func realMain(m *testing.M) int {
-	s := NewServer()
-	if err := s.Init(dbconf, env); err != nil {
+	// idを固定するために空のデータベースから始めます
+	for _, f := range []string{dbfile, dbfile + "-wal", dbfile + "-shm"} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			panic(fmt.Sprintf("failed to remove %s: %v", f, err))
+		}
+	}
+	if err := migrate(dbconf, env, "up", 0, false, ioutil.Discard); err != nil {
+		panic(fmt.Sprintf("failed to migrate: %v", err))
+	}
+
+	c := config.Default()
+	c.Database.Config = dbconf
+	c.Database.Env = env
+	c.HTTP.Port = port
+	s := NewServer(c)
+	if err := s.Init(); err != nil {
 		panic(fmt.Sprintf("failed to init server: %v", err))
 	}
-	go s.Run(port)
 	defer s.Close()
 
+	msgs := model.NewSQLMessageStore(s.db)
+	for _, body := range fixtures {
+		if _, err := msgs.Create(&model.Message{Body: body, UserName: "vg"}); err != nil {
+			panic(fmt.Sprintf("failed to create fixture: %v", err))
+		}
+	}
+
+	go s.Run()
+	if err := waitForServer(5 * time.Second); err != nil {
+		panic(fmt.Sprintf("failed to start server: %v", err))
+	}
+
 	return m.Run()
 }
 
+// waitForServer はサーバーがリクエストを受け付けるまで、timeoutまで待ちます
+func waitForServer(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := http.Get(tsURL + "/api/ping")
+		if err == nil {
+			resp.Body.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func TestTopページが200を返す(t *testing.T) {
 	resp, err := http.Get(tsURL + "/")
 	if err != nil {
@@ -87,7 +136,7 @@ func TestAPIがメッセージを全て返す(t *testing.T) {
 		t.Fatalf("failed to read http response, %s", err)
 	}
 
-	expected := `{"error":null,"result":[{"id":1,"body":"hoge"},{"id":2,"body":"fuga"},{"id":3,"body":"piyo"}]}`
+	expected := `{"error":null,"result":[{"id":1,"body":"hoge","username":"vg","channel":"","version":1},{"id":2,"body":"fuga","username":"vg","channel":"","version":1},{"id":3,"body":"piyo","username":"vg","channel":"","version":1}]}`
 	// http responseの末尾に改行が含まれるので除去して比較します
 	actual := strings.TrimRight(string(b), "\n")
 	if actual != expected {
@@ -115,7 +164,7 @@ func TestAPIが指定したIDのメッセージを返す(t *testing.T) {
 		t.Fatalf("failed to read http response, %s", err)
 	}
 
-	expected := `{"error":null,"result":{"id":1,"body":"hoge"}}`
+	expected := `{"error":null,"result":{"id":1,"body":"hoge","username":"vg","channel":"","version":1}}`
 	// http responseの末尾に改行が含まれるので除去して比較します
 	actual := strings.TrimRight(string(b), "\n")
 	if actual != expected {
@@ -125,7 +174,7 @@ func TestAPIが指定したIDのメッセージを返す(t *testing.T) {
 
 func TestAPIが新しいメッセージを作成する(t *testing.T) {
 	tm := "testmessage"
-	resp, err := http.Post(tsURL+"/api/messages", "application/json", bytes.NewBuffer([]byte(fmt.Sprintf(`{"body": "%s"}`, tm))))
+	resp, err := http.Post(tsURL+"/api/messages", "application/json", bytes.NewBuffer([]byte(fmt.Sprintf(`{"body": "%s", "username": "alice"}`, tm))))
 	if err != nil {
 		t.Fatalf("failed to post request: %s", err)
 	}
@@ -144,7 +193,7 @@ func TestAPIが新しいメッセージを作成する(t *testing.T) {
 		t.Fatalf("failed to read http response, %s", err)
 	}
 
-	expected := fmt.Sprintf(`{"error":null,"result":{"id":4,"body":"%s"}}`, tm)
+	expected := fmt.Sprintf(`{"error":null,"result":{"id":4,"body":"%s","username":"alice","channel":"","version":1}}`, tm)
 	// http responseの末尾に改行が含まれるので除去して比較します
 	actual := strings.TrimRight(string(b), "\n")
 	if actual != expected {
@@ -154,7 +203,7 @@ func TestAPIが新しいメッセージを作成する(t *testing.T) {
 
 func TestHelloWorldBotが反応する(t *testing.T) {
 	// botが反応するキーワードを投稿する
-	r, err := http.Post(tsURL+"/api/messages", "application/json", bytes.NewBuffer([]byte(`{"body": "hello"}`)))
+	r, err := http.Post(tsURL+"/api/messages", "application/json", bytes.NewBuffer([]byte(`{"body": "hello", "username": "alice"}`)))
 	if err != nil {
 		t.Fatalf("failed to post request: %s", err)
 	}
@@ -173,7 +222,7 @@ func TestHelloWorldBotが反応する(t *testing.T) {
 		t.Fatalf("failed to read http response, %s", err)
 	}
 
-	expected := `{"error":null,"result":{"id":6,"body":"hello, world!"}}`
+	expected := `{"error":null,"result":{"id":6,"body":"hello, world!","username":"bot","channel":"","version":1}}`
 	// http responseの末尾に改行が含まれるので除去して比較します
 	actual := strings.TrimRight(string(b), "\n")
 	if actual != expected {